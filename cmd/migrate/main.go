@@ -0,0 +1,66 @@
+// Command migrate inspects and rolls back the LingoMarker database schema.
+// The server applies pending migrations on startup, so this tool is only
+// needed for status checks and rollbacks.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"lingomarker/internal/config"
+	"lingomarker/internal/database"
+	"log"
+	"os"
+)
+
+func main() {
+	cfgPath := flag.String("config", "config.yaml", "path to the configuration file")
+	down := flag.Int("down", -1, "roll back to the given schema version (0 rolls back everything)")
+	up := flag.Bool("up", false, "apply all pending migrations")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*cfgPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration from %s: %v", *cfgPath, err)
+	}
+
+	db, err := database.OpenDB(cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	switch {
+	case *up:
+		if err := db.MigrateUp(); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case *down >= 0:
+		if err := db.MigrateDown(*down); err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+	}
+
+	if err := printStatus(db); err != nil {
+		log.Fatalf("Failed to read migration status: %v", err)
+	}
+}
+
+func printStatus(db *database.DB) error {
+	applied, err := database.AppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	appliedAt := make(map[int]string, len(applied))
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt.Format("2006-01-02 15:04:05")
+	}
+
+	for _, m := range db.Migrations() {
+		state, ok := appliedAt[m.Version]
+		if !ok {
+			state = "pending"
+		}
+		fmt.Fprintf(os.Stdout, "%04d_%-40s %s\n", m.Version, m.Name, state)
+	}
+	return nil
+}
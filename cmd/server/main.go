@@ -7,8 +7,11 @@ import (
 	"lingomarker/internal/auth"
 	"lingomarker/internal/config"
 	"lingomarker/internal/database"
+	"lingomarker/internal/feeds"
 	"lingomarker/internal/handlers"
+	"lingomarker/internal/jobs"
 	"lingomarker/internal/router"
+	"lingomarker/internal/storage"
 	"lingomarker/internal/tlsgen"
 	"lingomarker/internal/transcription"
 	"log"
@@ -61,6 +64,28 @@ func main() {
 	}
 	defer db.Close()
 
+	// --- Blob Storage ---
+	var blobs storage.BlobStore
+	switch cfg.Storage.Backend {
+	case "", "filesystem":
+		blobs, err = storage.NewFilesystem(cfg.Storage.UploadDir)
+	case "s3":
+		blobs, err = storage.NewS3(storage.S3Config{
+			Endpoint:        cfg.Storage.S3.Endpoint,
+			Region:          cfg.Storage.S3.Region,
+			Bucket:          cfg.Storage.S3.Bucket,
+			Prefix:          cfg.Storage.S3.Prefix,
+			AccessKeyID:     cfg.Storage.S3.AccessKeyID,
+			SecretAccessKey: cfg.Storage.S3.SecretAccessKey,
+			PathStyle:       cfg.Storage.S3.PathStyle,
+		})
+	default:
+		err = fmt.Errorf("unknown backend %q, expected filesystem or s3", cfg.Storage.Backend)
+	}
+	if err != nil {
+		log.Fatalf("Failed to initialize blob storage: %v", err)
+	}
+
 	// --- Templates ---
 	templates, err := handlers.LoadTemplates(cfg.Web.TemplateDir)
 	if err != nil {
@@ -69,13 +94,44 @@ func main() {
 
 	// --- Initialize Transcription Service ---
 	transcriptionCfg := &transcription.Config{
-		ModelName: "gemini-2.5-flash", // Make this configurable later if needed
+		ModelName:        "gemini-2.5-flash", // Make this configurable later if needed
+		ChunkDuration:    cfg.Transcription.ChunkDuration,
+		ChunkOverlap:     cfg.Transcription.ChunkOverlap,
+		ChunkConcurrency: cfg.Transcription.ChunkConcurrency,
 	}
 	transcriptionSvc := transcription.NewService(transcriptionCfg)
 
+	// --- Transcription Workers ---
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	transcriptionPool := jobs.NewTranscriptionPool(db, blobs, transcriptionSvc, jobs.Config{
+		Workers:           cfg.Transcription.Workers,
+		LeaseDuration:     cfg.Transcription.LeaseDuration,
+		HeartbeatInterval: cfg.Transcription.HeartbeatInterval,
+		PollInterval:      cfg.Transcription.PollInterval,
+		MaxAttempts:       cfg.Transcription.MaxAttempts,
+		RetryBaseDelay:    cfg.Transcription.RetryBaseDelay,
+		RetryMaxDelay:     cfg.Transcription.RetryMaxDelay,
+	})
+	if err := transcriptionPool.Start(workersCtx); err != nil {
+		log.Fatalf("Failed to start transcription workers: %v", err)
+	}
+
+	// --- Feed Poller ---
+	feedPoller := jobs.NewFeedPoller(db, blobs, feeds.NewClient(), transcriptionPool, jobs.FeedConfig{
+		CheckInterval:   cfg.Feeds.CheckInterval,
+		PollInterval:    cfg.Feeds.PollInterval,
+		MaxEpisodeSize:  cfg.Feeds.MaxEpisodeSize,
+		DownloadTimeout: cfg.Feeds.DownloadTimeout,
+	})
+	feedPoller.Start(workersCtx)
+
+	// --- Upload Janitor ---
+	uploadJanitor := jobs.NewUploadJanitor(db, blobs, time.Hour)
+	uploadJanitor.Start(workersCtx)
+
 	// --- Handlers ---
 	webHandlers := &handlers.WebHandlers{DB: db, Cfg: cfg, Templates: templates}
-	apiHandlers := &handlers.APIHandlers{DB: db, Cfg: cfg, TranscriptionSvc: transcriptionSvc}
+	apiHandlers := &handlers.APIHandlers{DB: db, Cfg: cfg, Blobs: blobs, Transcriptions: transcriptionPool, Feeds: feedPoller}
 
 	// --- Use the SimpleRouter ---
 	mux := router.New()
@@ -102,8 +158,13 @@ func main() {
 	mux.Handle("POST", "/settings", authMW(http.HandlerFunc(webHandlers.HandleSettingsPage)))
 	mux.Handle("GET", "/podcasts/upload", authMW(http.HandlerFunc(webHandlers.HandlePodcastUploadPage)))
 	mux.Handle("GET", "/podcasts", authMW(http.HandlerFunc(webHandlers.HandlePodcastListPage)))
+	mux.Handle("GET", "/podcasts/feeds", authMW(http.HandlerFunc(webHandlers.HandleFeedListPage)))
 	mux.HandlePrefix("GET", "/podcasts/play/", authMW(http.HandlerFunc(webHandlers.HandlePodcastPlayPage)))
 	mux.Handle("GET", "/review", authMW(http.HandlerFunc(webHandlers.HandleReviewPage)))
+	mux.Handle("GET", "/read", authMW(http.HandlerFunc(webHandlers.HandleArticleListPage)))
+	mux.HandlePrefix("GET", "/read/", authMW(http.HandlerFunc(webHandlers.HandleReaderPage)))
+	mux.Handle("GET", "/books", authMW(http.HandlerFunc(webHandlers.HandleBookListPage)))
+	mux.HandlePrefix("GET", "/books/read/", authMW(http.HandlerFunc(webHandlers.HandleBookReaderPage)))
 
 	// Authenticated API Endpoints
 	// Note: Register specific paths *before* prefixes if they might overlap
@@ -114,6 +175,93 @@ func main() {
 	mux.Handle("GET", "/api/training/data", authMW(http.HandlerFunc(apiHandlers.HandleGetTrainingData)))
 	mux.Handle("POST", "/api/import", authMW(http.HandlerFunc(apiHandlers.HandleImportData)))
 	mux.Handle("GET", "/api/review", authMW(http.HandlerFunc(apiHandlers.HandleGetReviewData)))
+	mux.Handle("GET", "/api/export", authMW(http.HandlerFunc(apiHandlers.HandleExportArchive)))
+	mux.Handle("POST", "/api/import/archive", authMW(http.HandlerFunc(apiHandlers.HandleImportArchive)))
+	mux.Handle("GET", "/api/export/anki", authMW(http.HandlerFunc(apiHandlers.HandleExportAnki)))
+	mux.Handle("POST", "/api/import/csv", authMW(http.HandlerFunc(apiHandlers.HandleImportCSV)))
+	mux.Handle("GET", "/api/export/csv", authMW(http.HandlerFunc(apiHandlers.HandleExportCSV)))
+	mux.Handle("POST", "/api/import/kindle", authMW(http.HandlerFunc(apiHandlers.HandleImportKindle)))
+	mux.Handle("GET", "/api/quiz", authMW(http.HandlerFunc(apiHandlers.HandleGetQuiz)))
+	mux.Handle("POST", "/api/quiz", authMW(http.HandlerFunc(apiHandlers.HandleCheckQuiz)))
+	mux.Handle("GET", "/api/srs/due", authMW(http.HandlerFunc(apiHandlers.HandleGetDueCards)))
+	mux.Handle("DELETE", "/api/wordforms/cache", authMW(http.HandlerFunc(apiHandlers.HandleInvalidateWordForms)))
+
+	// Dictionaries: GET/POST /api/dictionaries, PUT/DELETE /api/dictionaries/{id}
+	mux.Handle("GET", "/api/dictionaries", authMW(http.HandlerFunc(apiHandlers.HandleListDictionaries)))
+	mux.Handle("POST", "/api/dictionaries", authMW(http.HandlerFunc(apiHandlers.HandleCreateDictionary)))
+	mux.HandlePrefix("PUT", "/api/dictionaries/", authMW(http.HandlerFunc(apiHandlers.HandleUpdateDictionary)))
+	mux.HandlePrefix("DELETE", "/api/dictionaries/", authMW(http.HandlerFunc(apiHandlers.HandleDeleteDictionary)))
+
+	// Articles: GET/POST /api/articles, GET/DELETE /api/articles/{id}
+	mux.Handle("GET", "/api/articles", authMW(http.HandlerFunc(apiHandlers.HandleListArticles)))
+	mux.Handle("POST", "/api/articles", authMW(http.HandlerFunc(apiHandlers.HandleCreateArticle)))
+	mux.HandlePrefix("GET", "/api/articles/", authMW(http.HandlerFunc(apiHandlers.HandleGetArticle)))
+	mux.HandlePrefix("DELETE", "/api/articles/", authMW(http.HandlerFunc(apiHandlers.HandleDeleteArticle)))
+
+	// Books: GET/POST /api/books, GET/DELETE /api/books/{id},
+	// GET /api/books/{id}/chapters/{n}, PUT /api/books/{id}/position
+	mux.Handle("GET", "/api/books", authMW(http.HandlerFunc(apiHandlers.HandleListBooks)))
+	mux.Handle("POST", "/api/books", authMW(http.HandlerFunc(apiHandlers.HandleUploadBook)))
+	mux.HandlePrefix("DELETE", "/api/books/", authMW(http.HandlerFunc(apiHandlers.HandleDeleteBook)))
+	mux.HandlePrefix("GET", "/api/books/", authMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathSuffix := router.GetPathParam(r.Context())
+		idOnly, rest, _ := strings.Cut(pathSuffix, "/")
+		if _, err := uuid.Parse(idOnly); err != nil {
+			http.Error(w, "Invalid book ID format in path", http.StatusBadRequest)
+			return
+		}
+		if rest == "" {
+			ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, idOnly)
+			apiHandlers.HandleGetBook(w, r.WithContext(ctxWithID))
+		} else if chapter, ok := strings.CutPrefix(rest, "chapters/"); ok && chapter != "" && !strings.Contains(chapter, "/") {
+			ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, idOnly+"/"+chapter)
+			apiHandlers.HandleGetBookChapter(w, r.WithContext(ctxWithID))
+		} else {
+			http.NotFound(w, r)
+		}
+	})))
+	mux.HandlePrefix("PUT", "/api/books/", authMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathSuffix := router.GetPathParam(r.Context())
+		idOnly, ok := strings.CutSuffix(pathSuffix, "/position")
+		if !ok || idOnly == "" || strings.Contains(idOnly, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if _, err := uuid.Parse(idOnly); err != nil {
+			http.Error(w, "Invalid book ID format in path", http.StatusBadRequest)
+			return
+		}
+		ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, idOnly)
+		apiHandlers.HandleSaveBookPosition(w, r.WithContext(ctxWithID))
+	})))
+
+	// Feeds: GET/POST /api/feeds, PUT/DELETE /api/feeds/{id}, POST /api/feeds/{id}/refresh
+	mux.Handle("GET", "/api/feeds", authMW(http.HandlerFunc(apiHandlers.HandleListFeeds)))
+	mux.Handle("POST", "/api/feeds", authMW(http.HandlerFunc(apiHandlers.HandleCreateFeed)))
+	mux.HandlePrefix("PUT", "/api/feeds/", authMW(http.HandlerFunc(apiHandlers.HandleUpdateFeed)))
+	mux.HandlePrefix("DELETE", "/api/feeds/", authMW(http.HandlerFunc(apiHandlers.HandleDeleteFeed)))
+	mux.HandlePrefix("POST", "/api/feeds/", authMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathSuffix := router.GetPathParam(r.Context())
+		idOnly, ok := strings.CutSuffix(pathSuffix, "/refresh")
+		if !ok || idOnly == "" || strings.Contains(idOnly, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if _, err := uuid.Parse(idOnly); err != nil {
+			http.Error(w, "Invalid feed ID format in path", http.StatusBadRequest)
+			return
+		}
+		ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, idOnly)
+		apiHandlers.HandleRefreshFeed(w, r.WithContext(ctxWithID))
+	})))
+
+	// Resumable uploads (tus): POST /api/uploads, HEAD/PATCH/DELETE /api/uploads/{id}
+	mux.Handle("OPTIONS", "/api/uploads", http.HandlerFunc(apiHandlers.HandleUploadOptions))
+	mux.HandlePrefix("OPTIONS", "/api/uploads/", http.HandlerFunc(apiHandlers.HandleUploadOptions))
+	mux.Handle("POST", "/api/uploads", authMW(http.HandlerFunc(apiHandlers.HandleCreateUpload)))
+	mux.HandlePrefix("HEAD", "/api/uploads/", authMW(http.HandlerFunc(apiHandlers.HandleUploadStatus)))
+	mux.HandlePrefix("PATCH", "/api/uploads/", authMW(http.HandlerFunc(apiHandlers.HandleUploadChunk)))
+	mux.HandlePrefix("DELETE", "/api/uploads/", authMW(http.HandlerFunc(apiHandlers.HandleDeleteUpload)))
 
 	// Podcast API routes
 	mux.Handle("POST", "/api/podcasts", authMW(http.HandlerFunc(apiHandlers.HandlePodcastUpload)))
@@ -146,6 +294,22 @@ func main() {
 			ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, idOnly)
 			apiHandlers.HandleGetPodcastPlayData(w, r.WithContext(ctxWithID)) // Call specific handler
 
+		} else if idOnly, ok := strings.CutSuffix(pathSuffix, "/media_url"); ok && !strings.Contains(idOnly, "/") {
+			if _, err := uuid.Parse(idOnly); err != nil {
+				http.Error(w, "Invalid podcast ID format in path", http.StatusBadRequest)
+				return
+			}
+			ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, idOnly)
+			apiHandlers.HandleGetPodcastMediaURL(w, r.WithContext(ctxWithID))
+
+		} else if idOnly, ok := strings.CutSuffix(pathSuffix, "/transcript"); ok && !strings.Contains(idOnly, "/") {
+			if _, err := uuid.Parse(idOnly); err != nil {
+				http.Error(w, "Invalid podcast ID format in path", http.StatusBadRequest)
+				return
+			}
+			ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, idOnly)
+			apiHandlers.HandleGetPodcastTranscript(w, r.WithContext(ctxWithID))
+
 		} else if !strings.Contains(pathSuffix, "/") { // Assume it's just "{id}"
 			// Validate ID format
 			if _, err := uuid.Parse(pathSuffix); err != nil {
@@ -161,6 +325,50 @@ func main() {
 		}
 	})))
 
+	// POST /api/podcasts/{id}/retranscribe
+	mux.HandlePrefix("POST", "/api/podcasts/", authMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathSuffix := router.GetPathParam(r.Context())
+		idOnly, ok := strings.CutSuffix(pathSuffix, "/retranscribe")
+		if !ok || idOnly == "" || strings.Contains(idOnly, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if _, err := uuid.Parse(idOnly); err != nil {
+			http.Error(w, "Invalid podcast ID format in path", http.StatusBadRequest)
+			return
+		}
+		ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, idOnly)
+		apiHandlers.HandleRetranscribePodcast(w, r.WithContext(ctxWithID))
+	})))
+
+	// PUT /api/podcasts/{id}/transcript
+	mux.HandlePrefix("PUT", "/api/podcasts/", authMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathSuffix := router.GetPathParam(r.Context())
+		idOnly, ok := strings.CutSuffix(pathSuffix, "/transcript")
+		if !ok || idOnly == "" || strings.Contains(idOnly, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if _, err := uuid.Parse(idOnly); err != nil {
+			http.Error(w, "Invalid podcast ID format in path", http.StatusBadRequest)
+			return
+		}
+		ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, idOnly)
+		apiHandlers.HandleImportPodcastTranscript(w, r.WithContext(ctxWithID))
+	})))
+
+	// POST /api/srs/{entryUUID}/grade
+	mux.HandlePrefix("POST", "/api/srs/", authMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathSuffix := router.GetPathParam(r.Context())
+		entryUUID, ok := strings.CutSuffix(pathSuffix, "/grade")
+		if !ok || entryUUID == "" || strings.Contains(entryUUID, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		ctxWithID := context.WithValue(r.Context(), router.PathParamContextKey, entryUUID)
+		apiHandlers.HandleGradeEntry(w, r.WithContext(ctxWithID))
+	})))
+
 	// Add other prefix routes if needed, e.g., for GET /api/podcasts/{id}
 	// mux.HandlePrefix("GET", "/api/podcasts/", authMW(http.HandlerFunc(apiHandlers.HandleGetPodcast))) // Example for later
 
@@ -186,22 +394,11 @@ func main() {
 		}
 	}))
 
-	// --- File Server for Media ---
-	// Serve files from the configured upload directory under the /media/ path
-	// Ensure cfg.Storage.UploadDir is set correctly in your config
-	uploadDir := cfg.Storage.UploadDir
-	if uploadDir == "" {
-		log.Println("Warning: cfg.Storage.UploadDir is not set. Media files may not serve.")
-	} else {
-		absUploadDir, err := filepath.Abs(uploadDir)
-		if err != nil {
-			log.Fatalf("Error getting absolute path for upload directory: %v", err)
-		}
-		log.Printf("Serving media files from %s under /media/", absUploadDir)
-		// http.StripPrefix is important to map /media/path/to/file.mp3 to fs.Open("path/to/file.mp3")
-		fileServer := http.FileServer(http.Dir(absUploadDir))
-		mux.HandlePrefix("GET", "/media/", http.StripPrefix("/media/", fileServer))
-	}
+	// --- Media ---
+	// Podcast audio and video, for their owner only. Outside authMW: signed
+	// URLs work without the session cookie.
+	mux.HandlePrefix("GET", "/media/", http.HandlerFunc(apiHandlers.HandleMedia))
+	mux.HandlePrefix("HEAD", "/media/", http.HandlerFunc(apiHandlers.HandleMedia))
 
 	/*
 		// Root redirect
@@ -253,11 +450,23 @@ func main() {
 	} else if deletedSessions > 0 {
 		log.Printf("Cleaned up %d expired sessions.", deletedSessions)
 	}
+	deletedForms, err := db.DeleteExpiredWordForms(time.Now().UTC())
+	if err != nil {
+		log.Printf("Error cleaning up expired word forms: %v", err)
+	} else if deletedForms > 0 {
+		log.Printf("Cleaned up %d expired cached word forms.", deletedForms)
+	}
 
 	// Shutdown server
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Stop workers; running jobs are handed back to the queue
+	stopWorkers()
+	transcriptionPool.Wait()
+	feedPoller.Wait()
+	uploadJanitor.Wait()
+
 	log.Println("Server exiting.")
 }
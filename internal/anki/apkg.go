@@ -0,0 +1,287 @@
+// Package anki writes marked words as an Anki deck package (.apkg): a zip of
+// a collection in Anki's SQLite schema (version 11) and the media it uses.
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The model and deck keep the same IDs in every export, so that importing a
+// newer export updates the notes of an earlier one instead of duplicating them.
+const (
+	modelID int64 = 1718035200001
+	deckID  int64 = 1718035200002
+)
+
+// Note is one marked word. Context is HTML; the other fields are plain text.
+type Note struct {
+	Key     string // Stable identity of the note across exports, e.g. the entry UUID
+	Word    string
+	Forms   []string
+	Context string
+	Source  string
+	URL     string
+	Audio   string // Name of a media file added with AddMedia, if any
+}
+
+// Deck collects notes and media files for an .apkg.
+type Deck struct {
+	Name  string
+	notes []Note
+	media []mediaFile
+}
+
+type mediaFile struct {
+	name string // Name referenced by notes
+	path string // File on disk
+}
+
+// NewDeck returns an empty deck.
+func NewDeck(name string) *Deck {
+	return &Deck{Name: name}
+}
+
+// AddNote adds a note to the deck.
+func (d *Deck) AddNote(n Note) {
+	d.notes = append(d.notes, n)
+}
+
+// AddMedia adds the file at path to the package under name.
+func (d *Deck) AddMedia(name, path string) {
+	d.media = append(d.media, mediaFile{name: name, path: path})
+}
+
+// Len returns the number of notes in the deck.
+func (d *Deck) Len() int {
+	return len(d.notes)
+}
+
+// WriteAPKG writes the deck as an .apkg to w. tmpDir holds the collection
+// while it is built.
+func (d *Deck) WriteAPKG(w io.Writer, tmpDir string, now time.Time) error {
+	collectionPath := filepath.Join(tmpDir, "collection.anki2")
+	if err := d.writeCollection(collectionPath, now); err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := addFile(zw, "collection.anki2", collectionPath); err != nil {
+		return err
+	}
+	mediaMap := make(map[string]string, len(d.media))
+	for i, m := range d.media {
+		// Media files are stored by number and named in the "media" map.
+		if err := addFile(zw, strconv.Itoa(i), m.path); err != nil {
+			return err
+		}
+		mediaMap[strconv.Itoa(i)] = m.name
+	}
+	mw, err := zw.Create("media")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(mw).Encode(mediaMap); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func addFile(zw *zip.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, f)
+	return err
+}
+
+func (d *Deck) writeCollection(path string, now time.Time) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(collectionSchema); err != nil {
+		return fmt.Errorf("failed to create collection schema: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := d.insertCol(tx, now); err != nil {
+		return err
+	}
+
+	noteStmt, err := tx.Prepare(`INSERT INTO notes (id, guid, mid, mod, usn, tags, flds, sfld, csum, flags, data)
+        VALUES (?, ?, ?, ?, -1, ' lingomarker ', ?, ?, ?, 0, '')`)
+	if err != nil {
+		return err
+	}
+	defer noteStmt.Close()
+	cardStmt, err := tx.Prepare(`INSERT INTO cards (id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data)
+        VALUES (?, ?, ?, 0, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '')`)
+	if err != nil {
+		return err
+	}
+	defer cardStmt.Close()
+
+	// Note and card IDs are creation times in milliseconds and must be unique.
+	baseID := now.UnixMilli()
+	mod := now.Unix()
+	for i, n := range d.notes {
+		audio := ""
+		if n.Audio != "" {
+			audio = "[sound:" + n.Audio + "]"
+		}
+		fields := []string{
+			escape(n.Word),
+			escape(strings.Join(n.Forms, ", ")),
+			n.Context,
+			escape(n.Source),
+			escape(n.URL),
+			audio,
+		}
+		id := baseID + int64(i)
+		if _, err := noteStmt.Exec(id, guid(n.Key), modelID, mod, strings.Join(fields, "\x1f"), n.Word, checksum(n.Word)); err != nil {
+			return fmt.Errorf("failed to insert note for %q: %w", n.Word, err)
+		}
+		if _, err := cardStmt.Exec(id, id, deckID, mod, i+1); err != nil {
+			return fmt.Errorf("failed to insert card for %q: %w", n.Word, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (d *Deck) insertCol(tx *sql.Tx, now time.Time) error {
+	mod := now.Unix()
+	model := map[string]any{
+		"id": modelID, "name": "LingoMarker Word", "type": 0, "mod": mod, "usn": -1,
+		"sortf": 0, "did": deckID, "tags": []string{}, "vers": []int{},
+		"flds":      fieldsJSON("Word", "Forms", "Context", "Source", "URL", "Audio"),
+		"tmpls":     []map[string]any{{"name": "Word", "ord": 0, "qfmt": frontTemplate, "afmt": backTemplate, "did": nil, "bqfmt": "", "bafmt": ""}},
+		"css":       cardCSS,
+		"req":       []any{[]any{0, "any", []int{0}}},
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+	}
+	deck := func(id int64, name string) map[string]any {
+		return map[string]any{
+			"id": id, "name": name, "desc": "", "mod": mod, "usn": -1, "dyn": 0, "conf": 1,
+			"collapsed": false, "browserCollapsed": false, "extendNew": 10, "extendRev": 50,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+	decks := map[string]any{"1": deck(1, "Default"), strconv.FormatInt(deckID, 10): deck(deckID, d.Name)}
+	conf := map[string]any{
+		"activeDecks": []int64{1}, "curDeck": 1, "newSpread": 0, "collapseTime": 1200, "timeLim": 0,
+		"estTimes": true, "dueCounts": true, "curModel": nil, "nextPos": len(d.notes) + 1,
+		"sortType": "noteFld", "sortBackwards": false, "addToCur": true,
+	}
+	dconf := map[string]any{"1": map[string]any{
+		"id": 1, "name": "Default", "replayq": true, "maxTaken": 60, "timer": 0, "autoplay": true,
+		"mod": 0, "usn": 0, "dyn": false,
+		"new":   map[string]any{"delays": []int{1, 10}, "ints": []int{1, 4, 7}, "initialFactor": 2500, "separate": true, "order": 1, "perDay": 20, "bury": true},
+		"rev":   map[string]any{"perDay": 200, "ease4": 1.3, "fuzz": 0.05, "minSpace": 1, "ivlFct": 1, "maxIvl": 36500, "bury": true},
+		"lapse": map[string]any{"delays": []int{10}, "mult": 0, "minInt": 1, "leechFails": 8, "leechAction": 0},
+	}}
+
+	var values []any
+	for _, v := range []any{conf, map[string]any{strconv.FormatInt(modelID, 10): model}, decks, dconf} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		values = append(values, string(b))
+	}
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	_, err := tx.Exec(`INSERT INTO col (id, crt, mod, scm, ver, dty, usn, ls, conf, models, decks, dconf, tags)
+        VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')`,
+		append([]any{dayStart.Unix(), now.UnixMilli(), now.UnixMilli()}, values...)...)
+	if err != nil {
+		return fmt.Errorf("failed to insert collection: %w", err)
+	}
+	return nil
+}
+
+func fieldsJSON(names ...string) []map[string]any {
+	fields := make([]map[string]any, len(names))
+	for i, name := range names {
+		fields[i] = map[string]any{"name": name, "ord": i, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{}}
+	}
+	return fields
+}
+
+// guid derives the note's Anki GUID from its key, so it is the same in every export.
+func guid(key string) string {
+	sum := sha256.Sum256([]byte("lingomarker:" + key))
+	return base64.RawStdEncoding.EncodeToString(sum[:8])
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// checksum is Anki's duplicate check: the first 8 hex digits of the SHA-1 of
+// the sort field without HTML.
+func checksum(field string) int64 {
+	sum := sha1.Sum([]byte(htmlTag.ReplaceAllString(field, "")))
+	n, _ := strconv.ParseInt(fmt.Sprintf("%x", sum[:4]), 16, 64)
+	return n
+}
+
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+const frontTemplate = `<div class="word">{{Word}}</div>`
+
+const backTemplate = `{{FrontSide}}
+<hr id="answer">
+<div class="forms">{{Forms}}</div>
+<div class="context">{{Context}}</div>
+{{Audio}}
+<div class="source">{{#URL}}<a href="{{URL}}">{{/URL}}{{Source}}{{#URL}}</a>{{/URL}}</div>`
+
+const cardCSS = `.card { font-family: sans-serif; font-size: 20px; text-align: center; color: black; background-color: white; }
+.word { font-size: 1.6em; font-weight: bold; }
+.forms { color: #666; }
+.context { margin: 1em 0; text-align: left; line-height: 1.6; }
+.context b { background: #ffeb3b; }
+.source { font-size: 0.8em; color: #666; }`
+
+const collectionSchema = `
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null, flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn on notes (usn);
+CREATE INDEX ix_cards_usn on cards (usn);
+CREATE INDEX ix_revlog_usn on revlog (usn);
+CREATE INDEX ix_cards_nid on cards (nid);
+CREATE INDEX ix_cards_sched on cards (did, queue, due);
+CREATE INDEX ix_revlog_cid on revlog (cid);
+CREATE INDEX ix_notes_csum on notes (csum);
+`
@@ -0,0 +1,49 @@
+package anki
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"lingomarker/internal/quiz"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ClipPadding is added before and after a transcript segment when cutting
+// its audio, since segment timestamps are rounded to the second.
+const ClipPadding = 500 * time.Millisecond
+
+// Highlight escapes paragraph as HTML and puts every form of the word in bold.
+func Highlight(paragraph string, forms []string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range quiz.FindForms(paragraph, forms) {
+		b.WriteString(html.EscapeString(paragraph[last:loc[0]]))
+		b.WriteString("<b>" + html.EscapeString(paragraph[loc[0]:loc[1]]) + "</b>")
+		last = loc[1]
+	}
+	b.WriteString(html.EscapeString(paragraph[last:]))
+	return b.String()
+}
+
+// CutClip writes the audio of src between start and end to dst as MP3, using ffmpeg.
+func CutClip(ctx context.Context, ffmpegPath, src, dst string, start, end time.Duration) error {
+	start = max(start-ClipPadding, 0)
+	end += ClipPadding
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-v", "error", "-y",
+		"-ss", fmt.Sprintf("%.3f", start.Seconds()),
+		"-t", fmt.Sprintf("%.3f", (end-start).Seconds()),
+		"-i", src,
+		"-vn", "-ac", "1", "-c:a", "libmp3lame", "-b:a", "64k",
+		dst,
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed to cut %s: %w: %s", src, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Package archive reads and writes backup archives: a zip holding the user's
+// data as JSON and, optionally, the audio of their podcasts. A bare JSON file
+// is accepted on import too.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lingomarker/internal/models"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Format identifies a LingoMarker archive.
+	Format = "lingomarker-archive"
+	// Version is the archive version written. Archives of any version up to
+	// it can be read.
+	Version = 1
+
+	dataFile = "lingomarker.json"
+	audioDir = "audio/"
+)
+
+var (
+	ErrNotArchive         = errors.New("not a LingoMarker archive")
+	ErrUnsupportedVersion = fmt.Errorf("archive was written by a newer version of LingoMarker (this one reads up to version %d)", Version)
+)
+
+// Write writes a as a zip archive. Unless openAudio is nil, the audio file of
+// every podcast it opens is included and its Audio field set; podcasts whose
+// audio fails to open are exported without it.
+func Write(w io.Writer, a *models.UserArchive, openAudio func(p *models.ArchivedPodcast) (io.ReadCloser, error), now time.Time) error {
+	a.Format, a.Version, a.ExportedAt = Format, Version, now
+	zw := zip.NewWriter(w)
+
+	for i := range a.Podcasts {
+		p := &a.Podcasts[i]
+		p.Audio = ""
+		if openAudio == nil {
+			continue
+		}
+		f, err := openAudio(p)
+		if err != nil {
+			continue // Audio lost on this server; the podcast is still exported
+		}
+		name := audioDir + p.ID + strings.ToLower(path.Ext(p.StorePath))
+		// Audio is already compressed.
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: now})
+		if err == nil {
+			_, err = io.Copy(fw, f)
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to add audio of podcast %s: %w", p.ID, err)
+		}
+		p.Audio = name
+	}
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: dataFile, Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(a); err != nil {
+		return fmt.Errorf("failed to encode archive: %w", err)
+	}
+	return zw.Close()
+}
+
+// Reader is an opened archive.
+type Reader struct {
+	Archive *models.UserArchive
+	files   map[string]*zip.File
+}
+
+// Open reads the archive in r, either a zip or a bare JSON file.
+func Open(r io.ReaderAt, size int64) (*Reader, error) {
+	head := make([]byte, 4)
+	if _, err := r.ReadAt(head, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if !bytes.Equal(head, []byte("PK\x03\x04")) {
+		a, err := decode(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{Archive: a}, nil
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotArchive, err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	data, ok := files[dataFile]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is missing", ErrNotArchive, dataFile)
+	}
+	rc, err := data.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	a, err := decode(rc)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{Archive: a, files: files}, nil
+}
+
+func decode(r io.Reader) (*models.UserArchive, error) {
+	var a models.UserArchive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotArchive, err)
+	}
+	if a.Format != Format {
+		return nil, ErrNotArchive
+	}
+	if a.Version < 1 || a.Version > Version {
+		return nil, ErrUnsupportedVersion
+	}
+	return &a, nil
+}
+
+// HasAudio reports whether the archive contains the audio of p.
+func (r *Reader) HasAudio(p *models.ArchivedPodcast) bool {
+	_, ok := r.files[p.Audio]
+	return ok && strings.HasPrefix(p.Audio, audioDir)
+}
+
+// AudioExt returns the file extension of the audio of p, e.g. ".mp3".
+func AudioExt(p *models.ArchivedPodcast) string {
+	if p.Audio != "" {
+		return strings.ToLower(path.Ext(p.Audio))
+	}
+	return strings.ToLower(filepath.Ext(p.Filename))
+}
+
+// OpenAudio opens the audio of p for reading.
+func (r *Reader) OpenAudio(p *models.ArchivedPodcast) (io.ReadCloser, error) {
+	if !r.HasAudio(p) {
+		return nil, fmt.Errorf("archive has no audio for podcast %s", p.ID)
+	}
+	return r.files[p.Audio].Open()
+}
@@ -24,7 +24,7 @@ func CheckPasswordHash(password, hash string) bool {
 }
 
 // CreateSession creates a new session for the user and returns the session ID
-func CreateSession(db *database.DB, userID int64, maxAge time.Duration) (string, time.Time, error) {
+func CreateSession(db database.SessionStore, userID int64, maxAge time.Duration) (string, time.Time, error) {
 	sessionID := uuid.NewString()
 	expiry := time.Now().Add(maxAge)
 	err := db.CreateSession(sessionID, userID, expiry)
@@ -35,7 +35,7 @@ func CreateSession(db *database.DB, userID int64, maxAge time.Duration) (string,
 }
 
 // ValidateSession checks if a session ID is valid and returns the user ID
-func ValidateSession(db *database.DB, sessionID string) (int64, error) {
+func ValidateSession(db database.SessionStore, sessionID string) (int64, error) {
 	if sessionID == "" {
 		return 0, errors.New("no session ID provided")
 	}
@@ -69,7 +69,7 @@ func ClearSessionCookie(w http.ResponseWriter, cfg *config.Config) {
 }
 
 // GetUserIDFromRequest retrieves the user ID from the session cookie in the request
-func GetUserIDFromRequest(r *http.Request, db *database.DB, cfg *config.Config) (int64, error) {
+func GetUserIDFromRequest(r *http.Request, db database.SessionStore, cfg *config.Config) (int64, error) {
 	cookie, err := r.Cookie(cfg.Session.CookieName)
 	if err != nil {
 		if errors.Is(err, http.ErrNoCookie) {
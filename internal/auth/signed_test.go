@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyMediaQuery(t *testing.T) {
+	const secret, podcastID = "secret", "0b6f3c9e-3d2a-4f7e-9a41-6c1d2e5f7a80"
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		modify    func(q url.Values)
+		podcastID string
+		now       time.Time
+		want      error
+	}{
+		{name: "valid"},
+		{name: "valid until the second it expires", now: expires},
+		{name: "expired", now: expires.Add(time.Second), want: ErrSignatureExpired},
+		{name: "other podcast", podcastID: "5e2d1c6f-7a80-4f7e-9a41-0b6f3c9e3d2a", want: ErrInvalidSignature},
+		{name: "tampered user", modify: func(q url.Values) { q.Set("user", "8") }, want: ErrInvalidSignature},
+		{name: "tampered expiry", modify: func(q url.Values) {
+			q.Set("expires", strconv.FormatInt(expires.Add(24*time.Hour).Unix(), 10))
+		}, want: ErrInvalidSignature},
+		{name: "tampered signature", modify: func(q url.Values) { q.Set("signature", q.Get("signature")[1:]) }, want: ErrInvalidSignature},
+		{name: "missing signature", modify: func(q url.Values) { q.Del("signature") }, want: ErrInvalidSignature},
+		{name: "bad user", modify: func(q url.Values) { q.Set("user", "seven") }, want: ErrInvalidSignature},
+		{name: "bad expiry", modify: func(q url.Values) { q.Set("expires", "tomorrow") }, want: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := SignMediaQuery(secret, 7, podcastID, expires)
+			if tt.modify != nil {
+				tt.modify(query)
+			}
+			id, at := podcastID, now
+			if tt.podcastID != "" {
+				id = tt.podcastID
+			}
+			if !tt.now.IsZero() {
+				at = tt.now
+			}
+			// The query goes through a URL and back, as it does in use.
+			query, _ = url.ParseQuery(query.Encode())
+
+			userID, err := VerifyMediaQuery(secret, query, id, at)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && userID != 7 {
+				t.Errorf("user = %d, want 7", userID)
+			}
+		})
+	}
+}
+
+func TestVerifyMediaQueryOtherSecret(t *testing.T) {
+	now := time.Now()
+	query := SignMediaQuery("secret", 7, "podcast", now.Add(time.Hour))
+	if _, err := VerifyMediaQuery("another secret", query, "podcast", now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("err = %v, want ErrInvalidSignature", err)
+	}
+}
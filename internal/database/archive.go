@@ -0,0 +1,319 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+	"time"
+)
+
+// GetUserArchive collects everything the user owns for a backup. Settings
+// are returned without API keys and podcasts with their transcripts and
+// store paths. Format and Version are left for the caller to fill in.
+func (db *DB) GetUserArchive(userID int64) (*models.UserArchive, error) {
+	bundle, err := db.GetUserDataBundle(userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := db.GetUserSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	settings.GeminiAPIKey, settings.OpenAIAPIKey = "", ""
+	states, err := db.GetReviewStates(userID)
+	if err != nil {
+		return nil, err
+	}
+	podcasts, err := db.getArchivedPodcasts(userID)
+	if err != nil {
+		return nil, err
+	}
+	dicts, err := db.GetDictionaries(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.UserArchive{
+		Dictionaries: dicts,
+		Entries:      bundle.Entries,
+		URLs:         bundle.URLs,
+		Paragraphs:   bundle.Paragraphs,
+		Relations:    bundle.Relations,
+		Settings:     settings,
+		ReviewStates: states,
+		Podcasts:     podcasts,
+	}, nil
+}
+
+func (db *DB) getArchivedPodcasts(userID int64) ([]models.ArchivedPodcast, error) {
+	rows, err := db.Query(`
+        SELECT id, filename, store_path, producer, series, episode, description,
+               original_transcript, final_transcript, upload_time, status, error_message, media_type
+        FROM podcasts WHERE user_id = ?
+        ORDER BY upload_time
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query podcasts for archive: %w", err)
+	}
+	defer rows.Close()
+
+	podcasts := []models.ArchivedPodcast{}
+	for rows.Next() {
+		var p models.ArchivedPodcast
+		var desc, origTranscript, finalTranscript, errMsg sql.NullString
+		if err := rows.Scan(&p.ID, &p.Filename, &p.StorePath, &p.Producer, &p.Series, &p.Episode, &desc,
+			&origTranscript, &finalTranscript, &p.UploadTime, &p.Status, &errMsg, &p.MediaType); err != nil {
+			return nil, fmt.Errorf("failed to scan podcast for archive: %w", err)
+		}
+		p.Description = nullStringPtr(desc)
+		p.OriginalTranscript = nullStringPtr(origTranscript)
+		p.FinalTranscript = nullStringPtr(finalTranscript)
+		p.ErrorMessage = nullStringPtr(errMsg)
+		podcasts = append(podcasts, p)
+	}
+	return podcasts, rows.Err()
+}
+
+// RestoreUserArchive imports an archive in one transaction. In merge mode rows
+// that already exist are kept; with replace the user's words, review state and
+// podcasts are deleted first and the settings overwritten, except API keys.
+// Podcasts must have StorePath set to where their audio will be stored.
+func (db *DB) RestoreUserArchive(userID int64, a *models.UserArchive, replace bool) (*models.RestoreReport, error) {
+	report := &models.RestoreReport{}
+	now := time.Now().UTC()
+	err := db.WithTx(func(qs *Queries) error {
+		if replace {
+			removed, err := clearUserData(qs.q, userID)
+			if err != nil {
+				return err
+			}
+			report.RemovedAudio = removed
+			if a.Settings != nil {
+				if err := restoreSettings(qs.q, userID, a.Settings); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Dictionaries are matched by name, since their IDs differ between servers.
+		dictionaries := make(map[int64]int64, len(a.Dictionaries)) // Archive ID -> ID here
+		for _, d := range a.Dictionaries {
+			var id int64
+			err := qs.q.QueryRow("SELECT id FROM dictionaries WHERE user_id = ? AND LOWER(name) = LOWER(?)", userID, d.Name).Scan(&id)
+			if errors.Is(err, sql.ErrNoRows) {
+				err = qs.q.QueryRow(`
+                    INSERT INTO dictionaries (user_id, name, source_language, target_language, dict_base_url, highlight_color, created_at, updated_at)
+                    VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+                    RETURNING id
+                `, userID, d.Name, d.SourceLanguage, d.TargetLanguage, d.DictBaseURL, d.HighlightColor,
+					orNow(d.CreatedAt, now), orNow(d.UpdatedAt, now)).Scan(&id)
+				report.Dictionaries++
+			}
+			if err != nil {
+				return fmt.Errorf("failed to restore dictionary %q: %w", d.Name, err)
+			}
+			dictionaries[d.ID] = id
+		}
+		if replace && a.Settings != nil {
+			active := sql.NullInt64{Int64: dictionaries[a.Settings.ActiveDictionaryID]}
+			active.Valid = active.Int64 != 0
+			if _, err := qs.q.Exec("UPDATE user_settings SET active_dictionary_id = ? WHERE user_id = ?", active, userID); err != nil {
+				return fmt.Errorf("failed to restore active dictionary: %w", err)
+			}
+		}
+		defaultID, err := defaultDictionaryID(qs.q, userID)
+		if err != nil {
+			return err
+		}
+
+		entries := make(map[string]bool, len(a.Entries))
+		for _, e := range a.Entries {
+			entries[e.UUID] = true
+			dictionaryID, ok := dictionaries[e.DictionaryID]
+			if !ok {
+				dictionaryID = defaultID
+			}
+			n, err := insertCounted(qs.q, `
+                INSERT INTO entries (uuid, user_id, dictionary_id, word, forms_pipe_separated, created_at, updated_at)
+                VALUES (?, ?, ?, ?, ?, ?, ?)
+                ON CONFLICT(user_id, uuid) DO NOTHING
+            `, e.UUID, userID, dictionaryID, e.Word, e.FormsPipeSeparated, orNow(e.CreatedAt, now), orNow(e.UpdatedAt, now))
+			if err != nil {
+				return fmt.Errorf("failed to restore entry %s: %w", e.UUID, err)
+			}
+			report.Entries += n
+		}
+		for _, u := range a.URLs {
+			n, err := insertCounted(qs.q, `
+                INSERT INTO urls (user_id, url_hash, url, title, created_at)
+                VALUES (?, ?, ?, ?, ?)
+                ON CONFLICT(user_id, url_hash) DO NOTHING
+            `, userID, u.URLHash, u.URL, u.Title, orNow(u.CreatedAt, now))
+			if err != nil {
+				return fmt.Errorf("failed to restore URL %s: %w", u.URLHash, err)
+			}
+			report.URLs += n
+		}
+		for _, p := range a.Paragraphs {
+			n, err := insertCounted(qs.q, `
+                INSERT INTO paragraphs (user_id, paragraph_hash, text, created_at)
+                VALUES (?, ?, ?, ?)
+                ON CONFLICT(user_id, paragraph_hash) DO NOTHING
+            `, userID, p.ParagraphHash, p.Text, orNow(p.CreatedAt, now))
+			if err != nil {
+				return fmt.Errorf("failed to restore paragraph %s: %w", p.ParagraphHash, err)
+			}
+			report.Paragraphs += n
+		}
+		for _, r := range a.Relations {
+			if !entries[r.EntryUUID] {
+				report.SkippedRelations++
+				continue
+			}
+			n, err := insertCounted(qs.q, `
+                INSERT INTO relations (user_id, entry_uuid, url_hash, paragraph_hash, transcript_segment_ref, created_at, updated_at)
+                VALUES (?, ?, ?, ?, ?, ?, ?)
+                ON CONFLICT(user_id, entry_uuid, url_hash, paragraph_hash) DO NOTHING
+            `, userID, r.EntryUUID, r.URLHash, r.ParagraphHash, r.TranscriptSegmentRef, orNow(r.CreatedAt, now), orNow(r.UpdatedAt, now))
+			if err != nil {
+				return fmt.Errorf("failed to restore relation of entry %s: %w", r.EntryUUID, err)
+			}
+			report.Relations += n
+		}
+		for _, s := range a.ReviewStates {
+			if !entries[s.EntryUUID] {
+				continue
+			}
+			n, err := insertCounted(qs.q, `
+                INSERT INTO srs_review_state (user_id, entry_uuid, ease, interval_days, repetitions, lapses, due_at, last_reviewed_at, last_grade, created_at, updated_at)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+                ON CONFLICT(user_id, entry_uuid) DO NOTHING
+            `, userID, s.EntryUUID, s.Ease, s.IntervalDays, s.Repetitions, s.Lapses, orNow(s.DueAt, now), s.LastReviewedAt, s.LastGrade)
+			if err != nil {
+				return fmt.Errorf("failed to restore review state of entry %s: %w", s.EntryUUID, err)
+			}
+			report.ReviewStates += n
+		}
+
+		for _, p := range a.Podcasts {
+			var owner int64
+			err := qs.q.QueryRow("SELECT user_id FROM podcasts WHERE id = ?", p.ID).Scan(&owner)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+			case err != nil:
+				return fmt.Errorf("failed to look up podcast %s: %w", p.ID, err)
+			case owner != userID:
+				report.SkippedPodcasts++
+				continue
+			default:
+				continue // Already restored
+			}
+
+			// No worker will pick up a transcription that was in flight at export time.
+			status, errMsg := p.Status, p.ErrorMessage
+			if status != models.StatusCompleted && status != models.StatusFailed {
+				msg := "Transcription had not finished when the archive was exported."
+				status, errMsg = models.StatusFailed, &msg
+			}
+			_, err = qs.q.Exec(`
+                INSERT INTO podcasts (id, user_id, filename, store_path, producer, series, episode, description,
+                                      original_transcript, final_transcript, upload_time, status, error_message, media_type)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            `, p.ID, userID, p.Filename, p.StorePath, p.Producer, p.Series, p.Episode, p.Description,
+				p.OriginalTranscript, p.FinalTranscript, orNow(p.UploadTime, now), status, errMsg, mediaTypeOrAudio(p.MediaType))
+			if err != nil {
+				return fmt.Errorf("failed to restore podcast %s: %w", p.ID, err)
+			}
+			report.Podcasts++
+			report.Restored = append(report.Restored, p.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// clearUserData deletes the user's dictionaries, words, review state and
+// podcasts and returns the store paths of the deleted podcasts.
+func clearUserData(q Querier, userID int64) ([]string, error) {
+	rows, err := q.Query("SELECT store_path FROM podcasts WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query podcasts to replace: %w", err)
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan podcast to replace: %w", err)
+		}
+		paths = append(paths, path)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Relations and review state go with their entries, jobs with their podcasts.
+	for _, table := range []string{"entries", "dictionaries", "urls", "paragraphs", "podcasts"} {
+		query := "DELETE FROM " + table + " WHERE user_id = ?"
+		if table == "paragraphs" {
+			query += " AND " + notInBooks // Books are not part of archives
+		}
+		if _, err := q.Exec(query, userID); err != nil {
+			return nil, fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	return paths, nil
+}
+
+func restoreSettings(q Querier, userID int64, s *models.UserSettings) error {
+	_, err := q.Exec(`
+        INSERT INTO user_settings (
+            user_id, dict_base_url, allow_fragment_url_list, words_number_limit, words_length_limit,
+            highlight_color, forms_provider, openai_base_url, openai_model, updated_at
+        )
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+        ON CONFLICT(user_id) DO UPDATE SET
+            dict_base_url = excluded.dict_base_url,
+            allow_fragment_url_list = excluded.allow_fragment_url_list,
+            words_number_limit = excluded.words_number_limit,
+            words_length_limit = excluded.words_length_limit,
+            highlight_color = excluded.highlight_color,
+            forms_provider = excluded.forms_provider,
+            openai_base_url = excluded.openai_base_url,
+            openai_model = excluded.openai_model,
+            updated_at = CURRENT_TIMESTAMP
+    `, userID, s.DictBaseURL, s.AllowFragmentURLList, s.WordsNumberLimit, s.WordsLengthLimit,
+		s.HighlightColor, s.FormsProvider, s.OpenAIBaseURL, s.OpenAIModel)
+	if err != nil {
+		return fmt.Errorf("failed to restore settings: %w", err)
+	}
+	return nil
+}
+
+// insertCounted runs an INSERT ... ON CONFLICT DO NOTHING and returns 1 if a row was added.
+func insertCounted(q Querier, query string, args ...any) (int, error) {
+	res, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func orNow(t, now time.Time) time.Time {
+	if t.IsZero() {
+		return now
+	}
+	return t
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+)
+
+var ErrArticleNotFound = errors.New("article not found")
+
+// CreateArticle stores an article with its paragraphs and sets its creation
+// time. The paragraphs are kept with the article, apart from the paragraphs
+// table, which only holds the ones words were marked in.
+func (db *DB) CreateArticle(a *models.Article) error {
+	return db.WithTx(func(qs *Queries) error {
+		err := qs.q.QueryRow(`
+            INSERT INTO articles (id, user_id, url, url_hash, title, created_at)
+            VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+            RETURNING created_at
+        `, a.ID, a.UserID, a.URL, a.URLHash, a.Title).Scan(&a.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert article %s: %w", a.ID, err)
+		}
+		for i, p := range a.Paragraphs {
+			if _, err := qs.q.Exec(`
+                INSERT INTO article_paragraphs (article_id, position, paragraph_hash, text)
+                VALUES (?, ?, ?, ?)
+            `, a.ID, i, p.ParagraphHash, p.Text); err != nil {
+				return fmt.Errorf("failed to insert paragraph %d of article %s: %w", i, a.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetArticle returns one of the user's articles with its paragraphs.
+func (db *DB) GetArticle(userID int64, articleID string) (*models.Article, error) {
+	a := &models.Article{}
+	err := db.QueryRow(`
+        SELECT id, user_id, url, url_hash, title, created_at
+        FROM articles WHERE id = ? AND user_id = ?
+    `, articleID, userID).Scan(&a.ID, &a.UserID, &a.URL, &a.URLHash, &a.Title, &a.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrArticleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query article %s: %w", articleID, err)
+	}
+
+	rows, err := db.Query(`
+        SELECT paragraph_hash, text FROM article_paragraphs
+        WHERE article_id = ? ORDER BY position
+    `, articleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query paragraphs of article %s: %w", articleID, err)
+	}
+	defer rows.Close()
+
+	a.Paragraphs = []models.ArticleParagraph{}
+	for rows.Next() {
+		var p models.ArticleParagraph
+		if err := rows.Scan(&p.ParagraphHash, &p.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan paragraph of article %s: %w", articleID, err)
+		}
+		a.Paragraphs = append(a.Paragraphs, p)
+	}
+	return a, rows.Err()
+}
+
+// ListArticles returns the user's articles, newest first.
+func (db *DB) ListArticles(userID int64, limit, offset int) ([]models.ArticleListItem, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := db.Query(`
+        SELECT a.id, a.url, a.title, a.created_at,
+               (SELECT COUNT(*) FROM article_paragraphs p WHERE p.article_id = a.id)
+        FROM articles a
+        WHERE a.user_id = ?
+        ORDER BY a.created_at DESC, a.id
+        LIMIT ? OFFSET ?
+    `, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query articles for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	articles := make([]models.ArticleListItem, 0)
+	for rows.Next() {
+		var a models.ArticleListItem
+		if err := rows.Scan(&a.ID, &a.URL, &a.Title, &a.CreatedAt, &a.Paragraphs); err != nil {
+			return nil, fmt.Errorf("failed to scan article: %w", err)
+		}
+		articles = append(articles, a)
+	}
+	return articles, rows.Err()
+}
+
+// DeleteArticle deletes an article and its paragraphs. Words marked in it
+// keep their context.
+func (db *DB) DeleteArticle(userID int64, articleID string) error {
+	res, err := db.Exec("DELETE FROM articles WHERE id = ? AND user_id = ?", articleID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete article %s: %w", articleID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrArticleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+)
+
+var (
+	ErrBookNotFound    = errors.New("book not found")
+	ErrChapterNotFound = errors.New("chapter not found")
+)
+
+// notInBooks is a condition on a paragraphs row that no book uses it. Books
+// keep their text in paragraphs, so deleting paragraphs that no relation
+// references must leave those alone.
+const notInBooks = `NOT EXISTS (
+    SELECT 1 FROM book_paragraphs bp
+    WHERE bp.user_id = paragraphs.user_id AND bp.paragraph_hash = paragraphs.paragraph_hash
+)`
+
+// CreateBook stores a book with its chapters and sets its creation time.
+// Paragraph text goes to paragraphs, where a paragraph the user already has
+// is shared.
+func (db *DB) CreateBook(b *models.Book) error {
+	return db.WithTx(func(qs *Queries) error {
+		err := qs.q.QueryRow(`
+            INSERT INTO books (id, user_id, filename, title, author, language, created_at)
+            VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+            RETURNING created_at
+        `, b.ID, b.UserID, b.Filename, b.Title, b.Author, b.Language).Scan(&b.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert book %s: %w", b.ID, err)
+		}
+		for _, c := range b.Chapters {
+			if _, err := qs.q.Exec(`
+                INSERT INTO book_chapters (book_id, chapter_index, user_id, title, url, url_hash)
+                VALUES (?, ?, ?, ?, ?, ?)
+            `, b.ID, c.Index, b.UserID, c.Title, c.URL, c.URLHash); err != nil {
+				return fmt.Errorf("failed to insert chapter %d of book %s: %w", c.Index, b.ID, err)
+			}
+			for i, p := range c.Paragraphs {
+				if _, err := qs.q.Exec(`
+                    INSERT INTO paragraphs (user_id, paragraph_hash, text, created_at)
+                    VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+                    ON CONFLICT(user_id, paragraph_hash) DO NOTHING
+                `, b.UserID, p.ParagraphHash, p.Text); err != nil {
+					return fmt.Errorf("failed to insert paragraph %s: %w", p.ParagraphHash, err)
+				}
+				if _, err := qs.q.Exec(`
+                    INSERT INTO book_paragraphs (book_id, chapter_index, position, user_id, paragraph_hash)
+                    VALUES (?, ?, ?, ?, ?)
+                `, b.ID, c.Index, i, b.UserID, p.ParagraphHash); err != nil {
+					return fmt.Errorf("failed to insert paragraph %d of chapter %d of book %s: %w", i, c.Index, b.ID, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ListBooks returns the user's books, newest first.
+func (db *DB) ListBooks(userID int64) ([]models.BookListItem, error) {
+	rows, err := db.Query(`
+        SELECT b.id, b.title, b.author, b.position_chapter, b.created_at,
+               (SELECT COUNT(*) FROM book_chapters c WHERE c.book_id = b.id)
+        FROM books b
+        WHERE b.user_id = ?
+        ORDER BY b.created_at DESC, b.id
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query books for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	books := make([]models.BookListItem, 0)
+	for rows.Next() {
+		var b models.BookListItem
+		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.PositionChapter, &b.CreatedAt, &b.Chapters); err != nil {
+			return nil, fmt.Errorf("failed to scan book: %w", err)
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// GetBook returns one of the user's books with its chapters, without their
+// paragraphs.
+func (db *DB) GetBook(userID int64, bookID string) (*models.Book, error) {
+	b := &models.Book{}
+	err := db.QueryRow(`
+        SELECT id, user_id, filename, title, author, language, position_chapter, position_paragraph, created_at
+        FROM books WHERE id = ? AND user_id = ?
+    `, bookID, userID).Scan(&b.ID, &b.UserID, &b.Filename, &b.Title, &b.Author, &b.Language,
+		&b.PositionChapter, &b.PositionParagraph, &b.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query book %s: %w", bookID, err)
+	}
+
+	rows, err := db.Query(`
+        SELECT c.chapter_index, c.title, c.url, c.url_hash,
+               (SELECT COUNT(*) FROM book_paragraphs p WHERE p.book_id = c.book_id AND p.chapter_index = c.chapter_index)
+        FROM book_chapters c
+        WHERE c.book_id = ?
+        ORDER BY c.chapter_index
+    `, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chapters of book %s: %w", bookID, err)
+	}
+	defer rows.Close()
+
+	b.Chapters = []models.BookChapter{}
+	for rows.Next() {
+		var c models.BookChapter
+		if err := rows.Scan(&c.Index, &c.Title, &c.URL, &c.URLHash, &c.ParagraphCount); err != nil {
+			return nil, fmt.Errorf("failed to scan chapter of book %s: %w", bookID, err)
+		}
+		b.Chapters = append(b.Chapters, c)
+	}
+	return b, rows.Err()
+}
+
+// GetBookChapter returns a chapter of one of the user's books with its
+// paragraphs.
+func (db *DB) GetBookChapter(userID int64, bookID string, chapter int) (*models.BookChapter, error) {
+	c := &models.BookChapter{Index: chapter}
+	err := db.QueryRow(`
+        SELECT title, url, url_hash FROM book_chapters
+        WHERE book_id = ? AND user_id = ? AND chapter_index = ?
+    `, bookID, userID, chapter).Scan(&c.Title, &c.URL, &c.URLHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChapterNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chapter %d of book %s: %w", chapter, bookID, err)
+	}
+
+	rows, err := db.Query(`
+        SELECT bp.paragraph_hash, p.text
+        FROM book_paragraphs bp
+        JOIN paragraphs p ON p.user_id = bp.user_id AND p.paragraph_hash = bp.paragraph_hash
+        WHERE bp.book_id = ? AND bp.chapter_index = ?
+        ORDER BY bp.position
+    `, bookID, chapter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query paragraphs of chapter %d of book %s: %w", chapter, bookID, err)
+	}
+	defer rows.Close()
+
+	c.Paragraphs = []models.ArticleParagraph{}
+	for rows.Next() {
+		var p models.ArticleParagraph
+		if err := rows.Scan(&p.ParagraphHash, &p.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan paragraph of book %s: %w", bookID, err)
+		}
+		c.Paragraphs = append(c.Paragraphs, p)
+	}
+	c.ParagraphCount = len(c.Paragraphs)
+	return c, rows.Err()
+}
+
+// SaveBookPosition records how far the user has read a book.
+func (db *DB) SaveBookPosition(userID int64, bookID string, chapter, paragraph int) error {
+	return db.WithTx(func(qs *Queries) error {
+		var count int
+		err := qs.q.QueryRow(`
+            SELECT COUNT(*) FROM book_chapters WHERE book_id = ? AND user_id = ? AND chapter_index = ?
+        `, bookID, userID, chapter).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to check chapter %d of book %s: %w", chapter, bookID, err)
+		}
+		if count == 0 {
+			return ErrChapterNotFound
+		}
+		if paragraph < 0 {
+			paragraph = 0
+		}
+		if _, err := qs.q.Exec(`
+            UPDATE books SET position_chapter = ?, position_paragraph = ?, position_updated_at = CURRENT_TIMESTAMP
+            WHERE id = ? AND user_id = ?
+        `, chapter, paragraph, bookID, userID); err != nil {
+			return fmt.Errorf("failed to save position in book %s: %w", bookID, err)
+		}
+		return nil
+	})
+}
+
+// DeleteBook deletes a book and the paragraphs of its text that no word was
+// marked in and no other book uses.
+func (db *DB) DeleteBook(userID int64, bookID string) error {
+	return db.WithTx(func(qs *Queries) error {
+		if _, err := qs.q.Exec(`
+            DELETE FROM paragraphs
+            WHERE user_id = ? AND paragraph_hash IN (SELECT paragraph_hash FROM book_paragraphs WHERE book_id = ? AND user_id = ?)
+            AND NOT EXISTS (SELECT 1 FROM relations r WHERE r.user_id = paragraphs.user_id AND r.paragraph_hash = paragraphs.paragraph_hash)
+            AND NOT EXISTS (
+                SELECT 1 FROM book_paragraphs bp
+                WHERE bp.user_id = paragraphs.user_id AND bp.paragraph_hash = paragraphs.paragraph_hash AND bp.book_id <> ?
+            )
+        `, userID, bookID, userID, bookID); err != nil {
+			return fmt.Errorf("failed to delete paragraphs of book %s: %w", bookID, err)
+		}
+		// Chapters and their paragraph lists go with the book.
+		res, err := qs.q.Exec("DELETE FROM books WHERE id = ? AND user_id = ?", bookID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete book %s: %w", bookID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrBookNotFound
+		}
+		return nil
+	})
+}
@@ -6,165 +6,109 @@ import (
 	"fmt"
 	"lingomarker/internal/models"
 	"log"
-	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3" // SQLite driver
 )
 
+// DB is the SQL-backed Store. The same queries serve SQLite and PostgreSQL;
+// the dialect chosen from the DSN handles the differences.
 type DB struct {
 	*sql.DB
+	dialect dialect
+}
+
+// Tx is a transaction that rewrites placeholders for the active dialect.
+type Tx struct {
+	*sql.Tx
+	dialect dialect
 }
 
+// InitDB opens the database and applies any pending schema migrations.
 func InitDB(dataSourceName string) (*DB, error) {
-	// Ensure the directory exists
-	dir := filepath.Dir(dataSourceName)
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		if err := os.MkdirAll(dir, 0750); err != nil {
-			return nil, fmt.Errorf("failed to create database directory %s: %w", dir, err)
-		}
-	} else if err != nil {
-		return nil, fmt.Errorf("failed to check database directory %s: %w", dir, err)
+	db, err := OpenDB(dataSourceName)
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", dataSourceName+"?_foreign_keys=on") // Enable foreign keys
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	if err = db.MigrateUp(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
-	if err = db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	log.Printf("Database initialized successfully (%s).", db.dialect.Name())
+	return db, nil
+}
+
+// OpenDB opens and pings the database without touching the schema.
+// A postgres:// or postgresql:// DSN selects PostgreSQL; anything else is a SQLite file path.
+func OpenDB(dataSourceName string) (*DB, error) {
+	if isPostgresDSN(dataSourceName) {
+		return openPostgres(dataSourceName)
 	}
+	return openSQLite(dataSourceName)
+}
+
+// MigrateUp applies all pending migrations.
+func (db *DB) MigrateUp() error {
+	return Migrate(db, db.dialect.migrations())
+}
 
-	if err = createSchema(db); err != nil {
-		return nil, fmt.Errorf("failed to create schema: %w", err)
+// MigrateDown rolls the schema back to targetVersion.
+func (db *DB) MigrateDown(targetVersion int) error {
+	return MigrateDown(db, db.dialect.migrations(), targetVersion)
+}
+
+// Migrations returns the migrations known to this build for the active backend.
+func (db *DB) Migrations() []Migration {
+	return db.dialect.migrations()
+}
+
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
 	}
+	return &Tx{Tx: tx, dialect: db.dialect}, nil
+}
 
-	log.Println("Database initialized successfully.")
-	return &DB{db}, nil
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), args...)
 }
 
-func createSchema(db *sql.DB) error {
-	schema := `
-        CREATE TABLE IF NOT EXISTS users (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            name TEXT NOT NULL,
-            username TEXT UNIQUE NOT NULL,
-            password_hash TEXT NOT NULL,
-            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-        );
-
-        CREATE TABLE IF NOT EXISTS user_sessions (
-            session_id TEXT PRIMARY KEY,
-            user_id INTEGER NOT NULL,
-            expiry DATETIME NOT NULL,
-            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-        );
-        CREATE INDEX IF NOT EXISTS idx_user_sessions_expiry ON user_sessions(expiry);
-
-				CREATE TABLE IF NOT EXISTS user_settings (
-						user_id INTEGER PRIMARY KEY,
-						gemini_api_key TEXT,
-						dict_base_url TEXT DEFAULT 'https://slovniky.lingea.sk/anglicko-slovensky/', -- New with default
-						allow_fragment_url_list TEXT DEFAULT 'https://www.nytimes.com/,https://developer.mozilla.org/', -- New, comma-separated default
-						words_number_limit INTEGER DEFAULT 4,  -- New with default
-						words_length_limit INTEGER DEFAULT 50, -- New with default
-						highlight_color TEXT DEFAULT 'rgba(210, 210, 10, 0.4)', -- New with default
-						updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-						FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-				);
-
-        CREATE TABLE IF NOT EXISTS entries (
-            uuid TEXT NOT NULL,
-            user_id INTEGER NOT NULL,
-            word TEXT NOT NULL,
-            forms_pipe_separated TEXT NOT NULL,
-            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            PRIMARY KEY (user_id, uuid), -- Composite key: entry UUID is unique per user
-            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-        );
-        CREATE INDEX IF NOT EXISTS idx_entries_user_word ON entries(user_id, word);
-
-        CREATE TABLE IF NOT EXISTS urls (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            user_id INTEGER NOT NULL,
-            url_hash TEXT NOT NULL,
-            url TEXT NOT NULL,
-            title TEXT,
-            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            UNIQUE (user_id, url_hash),
-            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-        );
-
-        CREATE TABLE IF NOT EXISTS paragraphs (
-             id INTEGER PRIMARY KEY AUTOINCREMENT,
-             user_id INTEGER NOT NULL,
-             paragraph_hash TEXT NOT NULL,
-             text TEXT NOT NULL,
-             created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-             UNIQUE (user_id, paragraph_hash),
-             FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-        );
-
-        CREATE TABLE IF NOT EXISTS relations (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            user_id INTEGER NOT NULL,
-            entry_uuid TEXT NOT NULL,
-            url_hash TEXT NOT NULL,
-            paragraph_hash TEXT NOT NULL,
-						transcript_segment_ref TEXT,
-            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            UNIQUE (user_id, entry_uuid, url_hash, paragraph_hash), -- Ensure unique relation per user
-            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-            FOREIGN KEY (user_id, entry_uuid) REFERENCES entries(user_id, uuid) ON DELETE CASCADE
-            -- No FK constraints on url_hash/paragraph_hash to allow flexibility, handled in logic
-            -- Can add them if strict referential integrity is needed, but requires URL/Paragraph to exist first.
-            -- FOREIGN KEY (user_id, url_hash) REFERENCES urls(user_id, url_hash) ON DELETE CASCADE,
-            -- FOREIGN KEY (user_id, paragraph_hash) REFERENCES paragraphs(user_id, paragraph_hash) ON DELETE CASCADE
-        );
-        CREATE INDEX IF NOT EXISTS idx_relations_user_entry ON relations(user_id, entry_uuid);
-        CREATE INDEX IF NOT EXISTS idx_relations_user_updated ON relations(user_id, updated_at);
-				CREATE INDEX IF NOT EXISTS idx_relations_transcript_segment_ref ON relations(transcript_segment_ref);
-
-				CREATE TABLE IF NOT EXISTS podcasts (
-        id TEXT PRIMARY KEY,                        -- UUID v4
-        user_id INTEGER NOT NULL,
-        filename TEXT NOT NULL,                     -- Original filename from upload
-        store_path TEXT UNIQUE NOT NULL,            -- Relative path on server filesystem
-        producer TEXT NOT NULL,
-        series TEXT NOT NULL,
-        episode TEXT NOT NULL,
-        description TEXT,                           -- Optional episode description
-        original_transcript TEXT,                   -- Optional provided transcript
-        final_transcript TEXT,                      -- Generated JSON transcript (nullable initially)
-        upload_time DATETIME DEFAULT CURRENT_TIMESTAMP,
-        status TEXT NOT NULL DEFAULT 'uploaded' CHECK(status IN ('uploaded', 'transcribing', 'completed', 'failed')),
-        error_message TEXT,                         -- Store error message on failure (New)
-        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-        );
-				CREATE INDEX IF NOT EXISTS idx_podcasts_user_status ON podcasts(user_id, status);
-				CREATE INDEX IF NOT EXISTS idx_podcasts_user_upload_time ON podcasts(user_id, upload_time);
-
-        `
-	_, err := db.Exec(schema)
-	return err
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), args...)
 }
 
 // --- User Methods ---
 
 func (db *DB) CreateUser(name, username, passwordHash string) (int64, error) {
-	res, err := db.Exec("INSERT INTO users (name, username, password_hash) VALUES (?, ?, ?)", name, username, passwordHash)
+	// RETURNING works on both backends; lib/pq does not support LastInsertId.
+	var id int64
+	err := db.QueryRow("INSERT INTO users (name, username, password_hash) VALUES (?, ?, ?) RETURNING id", name, username, passwordHash).Scan(&id)
 	if err != nil {
 		// Consider checking for UNIQUE constraint violation specifically
 		return 0, err
 	}
-	return res.LastInsertId()
+	return id, nil
 }
 
 func (db *DB) GetUserByUsername(username string) (*models.User, error) {
@@ -240,6 +184,7 @@ func (db *DB) GetUserSettings(userID int64) (*models.UserSettings, error) {
 		WordsNumberLimit:     4,
 		WordsLengthLimit:     50,
 		HighlightColor:       "rgba(210, 210, 10, 0.4)",
+		FormsProvider:        "gemini",
 	}
 	var geminiKey sql.NullString
 	var dictUrl sql.NullString
@@ -247,15 +192,21 @@ func (db *DB) GetUserSettings(userID int64) (*models.UserSettings, error) {
 	var numLimit sql.NullInt64
 	var lenLimit sql.NullInt64
 	var color sql.NullString
+	var formsProvider, openaiBaseURL, openaiModel, openaiKey sql.NullString
+	var activeDictionary sql.NullInt64
 
 	// Select all settings fields
 	query := `SELECT
 							gemini_api_key, dict_base_url, allow_fragment_url_list,
-							words_number_limit, words_length_limit, highlight_color
+							words_number_limit, words_length_limit, highlight_color,
+							forms_provider, openai_base_url, openai_model, openai_api_key,
+							active_dictionary_id
 						FROM user_settings WHERE user_id = ?`
 
 	err := db.QueryRow(query, userID).Scan(
 		&geminiKey, &dictUrl, &fragmentList, &numLimit, &lenLimit, &color,
+		&formsProvider, &openaiBaseURL, &openaiModel, &openaiKey,
+		&activeDictionary,
 	)
 
 	if err != nil {
@@ -287,6 +238,13 @@ func (db *DB) GetUserSettings(userID int64) (*models.UserSettings, error) {
 	if color.Valid {
 		settings.HighlightColor = color.String
 	}
+	if formsProvider.Valid && formsProvider.String != "" {
+		settings.FormsProvider = formsProvider.String
+	}
+	settings.OpenAIBaseURL = openaiBaseURL.String
+	settings.OpenAIModel = openaiModel.String
+	settings.OpenAIAPIKey = openaiKey.String
+	settings.ActiveDictionaryID = activeDictionary.Int64
 
 	return settings, nil
 }
@@ -296,9 +254,11 @@ func (db *DB) SaveUserSettings(settings *models.UserSettings) error {
 	query := `
 			INSERT INTO user_settings (
 					user_id, gemini_api_key, dict_base_url, allow_fragment_url_list,
-					words_number_limit, words_length_limit, highlight_color, updated_at
+					words_number_limit, words_length_limit, highlight_color,
+					forms_provider, openai_base_url, openai_model, openai_api_key,
+					active_dictionary_id, updated_at
 			)
-			VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 			ON CONFLICT(user_id) DO UPDATE SET
 					gemini_api_key = excluded.gemini_api_key,
 					dict_base_url = excluded.dict_base_url,
@@ -306,6 +266,11 @@ func (db *DB) SaveUserSettings(settings *models.UserSettings) error {
 					words_number_limit = excluded.words_number_limit,
 					words_length_limit = excluded.words_length_limit,
 					highlight_color = excluded.highlight_color,
+					forms_provider = excluded.forms_provider,
+					openai_base_url = excluded.openai_base_url,
+					openai_model = excluded.openai_model,
+					openai_api_key = excluded.openai_api_key,
+					active_dictionary_id = excluded.active_dictionary_id,
 					updated_at = CURRENT_TIMESTAMP;
 	`
 	_, err := db.Exec(
@@ -317,34 +282,131 @@ func (db *DB) SaveUserSettings(settings *models.UserSettings) error {
 		settings.WordsNumberLimit,
 		settings.WordsLengthLimit,
 		settings.HighlightColor,
+		settings.FormsProvider,
+		settings.OpenAIBaseURL,
+		settings.OpenAIModel,
+		settings.OpenAIAPIKey,
+		sql.NullInt64{Int64: settings.ActiveDictionaryID, Valid: settings.ActiveDictionaryID != 0},
 	)
 	return err
 }
 
+// --- Word Forms Cache Methods ---
+
+// GetCachedWordForms returns the cached forms of a normalized word if they have not expired.
+func (db *DB) GetCachedWordForms(language, word string, now time.Time) (string, bool, error) {
+	var forms string
+	err := db.QueryRow(`
+        SELECT forms_pipe_separated FROM word_forms_cache
+        WHERE language = ? AND word = ? AND expires_at > ?
+    `, language, word, now).Scan(&forms)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("error querying word forms cache for %q: %w", word, err)
+	}
+	return forms, true, nil
+}
+
+// PutCachedWordForms stores or refreshes the forms of a normalized word.
+func (db *DB) PutCachedWordForms(language, word, forms, provider string, expiresAt time.Time) error {
+	_, err := db.Exec(`
+        INSERT INTO word_forms_cache (language, word, forms_pipe_separated, provider, created_at, expires_at)
+        VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+        ON CONFLICT(language, word) DO UPDATE SET
+            forms_pipe_separated = excluded.forms_pipe_separated,
+            provider = excluded.provider,
+            created_at = CURRENT_TIMESTAMP,
+            expires_at = excluded.expires_at;
+    `, language, word, forms, provider, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error caching word forms for %q: %w", word, err)
+	}
+	return nil
+}
+
+// DeleteCachedWordForms invalidates one normalized word. Returns the number of rows removed.
+func (db *DB) DeleteCachedWordForms(language, word string) (int64, error) {
+	res, err := db.Exec("DELETE FROM word_forms_cache WHERE language = ? AND word = ?", language, word)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpiredWordForms purges cache rows that expired before now.
+func (db *DB) DeleteExpiredWordForms(now time.Time) (int64, error) {
+	res, err := db.Exec("DELETE FROM word_forms_cache WHERE expires_at <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 // --- Lingo Data Methods ---
 
+// ErrEntryNotFound is returned by MarkWord when the referenced entry does not exist.
+var ErrEntryNotFound = errors.New("entry not found")
+
+// ErrNoImportData is returned by ImportData when the JSON holds no dictionary.
+var ErrNoImportData = errors.New("import: no dictionary data found in JSON")
+
 // UpsertEntry updates an existing entry or inserts a new one
 func (db *DB) UpsertEntry(entry *models.Entry) error {
-	_, err := db.Exec(`
-            INSERT INTO entries (uuid, user_id, word, forms_pipe_separated, created_at, updated_at)
-            VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	return db.With(db).UpsertEntry(entry)
+}
+
+// GetEntryByUUID retrieves a single entry for a user
+func (db *DB) GetEntryByUUID(userID int64, uuid string) (*models.Entry, error) {
+	return db.With(db).GetEntryByUUID(userID, uuid)
+}
+
+// UpsertURL adds a URL if the hash doesn't exist for the user
+func (db *DB) UpsertURL(url *models.URL) error {
+	return db.With(db).UpsertURL(url)
+}
+
+// UpsertParagraph adds a paragraph if the hash doesn't exist for the user
+func (db *DB) UpsertParagraph(para *models.Paragraph) error {
+	return db.With(db).UpsertParagraph(para)
+}
+
+// UpsertRelation updates the timestamp or inserts a new relation
+func (db *DB) UpsertRelation(rel *models.Relation) error {
+	return db.With(db).UpsertRelation(rel)
+}
+
+// UpsertEntry updates an existing entry or inserts a new one. A new entry
+// without a dictionary goes to the user's default dictionary.
+func (qs *Queries) UpsertEntry(entry *models.Entry) error {
+	if entry.DictionaryID == 0 {
+		id, err := defaultDictionaryID(qs.q, entry.UserID)
+		if err != nil {
+			return err
+		}
+		entry.DictionaryID = id
+	}
+	_, err := qs.q.Exec(`
+            INSERT INTO entries (uuid, user_id, dictionary_id, word, forms_pipe_separated, created_at, updated_at)
+            VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
             ON CONFLICT(user_id, uuid) DO UPDATE SET
                 word = excluded.word,
                 forms_pipe_separated = excluded.forms_pipe_separated,
                 updated_at = CURRENT_TIMESTAMP;
-        `, entry.UUID, entry.UserID, entry.Word, entry.FormsPipeSeparated)
+        `, entry.UUID, entry.UserID, entry.DictionaryID, entry.Word, entry.FormsPipeSeparated)
 	return err
 }
 
 // GetEntryByUUID retrieves a single entry for a user
-func (db *DB) GetEntryByUUID(userID int64, uuid string) (*models.Entry, error) {
+func (qs *Queries) GetEntryByUUID(userID int64, uuid string) (*models.Entry, error) {
 	entry := &models.Entry{}
-	err := db.QueryRow(`
-             SELECT uuid, user_id, word, forms_pipe_separated, created_at, updated_at
+	err := qs.q.QueryRow(`
+             SELECT uuid, user_id, COALESCE(dictionary_id, 0), word, forms_pipe_separated, created_at, updated_at
              FROM entries
              WHERE user_id = ? AND uuid = ?
          `, userID, uuid).Scan(
-		&entry.UUID, &entry.UserID, &entry.Word, &entry.FormsPipeSeparated, &entry.CreatedAt, &entry.UpdatedAt,
+		&entry.UUID, &entry.UserID, &entry.DictionaryID, &entry.Word, &entry.FormsPipeSeparated, &entry.CreatedAt, &entry.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -356,8 +418,8 @@ func (db *DB) GetEntryByUUID(userID int64, uuid string) (*models.Entry, error) {
 }
 
 // UpsertURL adds a URL if the hash doesn't exist for the user
-func (db *DB) UpsertURL(url *models.URL) error {
-	_, err := db.Exec(`
+func (qs *Queries) UpsertURL(url *models.URL) error {
+	_, err := qs.q.Exec(`
             INSERT INTO urls (user_id, url_hash, url, title, created_at)
             VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
             ON CONFLICT(user_id, url_hash) DO NOTHING;
@@ -366,8 +428,8 @@ func (db *DB) UpsertURL(url *models.URL) error {
 }
 
 // UpsertParagraph adds a paragraph if the hash doesn't exist for the user
-func (db *DB) UpsertParagraph(para *models.Paragraph) error {
-	_, err := db.Exec(`
+func (qs *Queries) UpsertParagraph(para *models.Paragraph) error {
+	_, err := qs.q.Exec(`
             INSERT INTO paragraphs (user_id, paragraph_hash, text, created_at)
             VALUES (?, ?, ?, CURRENT_TIMESTAMP)
             ON CONFLICT(user_id, paragraph_hash) DO NOTHING;
@@ -376,17 +438,68 @@ func (db *DB) UpsertParagraph(para *models.Paragraph) error {
 }
 
 // UpsertRelation updates the timestamp or inserts a new relation
-func (db *DB) UpsertRelation(rel *models.Relation) error {
-	_, err := db.Exec(`
+func (qs *Queries) UpsertRelation(rel *models.Relation) error {
+	_, err := qs.q.Exec(`
        INSERT INTO relations (user_id, entry_uuid, url_hash, paragraph_hash, transcript_segment_ref, created_at, updated_at)
        VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
        ON CONFLICT(user_id, entry_uuid, url_hash, paragraph_hash) DO UPDATE SET
            transcript_segment_ref = excluded.transcript_segment_ref, -- Update if provided
            updated_at = CURRENT_TIMESTAMP;
-   `, rel.UserID, rel.EntryUUID, rel.URLHash, rel.ParagraphHash, rel.TranscriptSegmentRef) // Added rel.TranscriptSegmentRef
+   `, rel.UserID, rel.EntryUUID, rel.URLHash, rel.ParagraphHash, rel.TranscriptSegmentRef)
 	return err
 }
 
+// MarkWordInput describes a single click on a word in its context.
+type MarkWordInput struct {
+	URL       models.URL
+	Paragraph models.Paragraph
+	// NewEntry is the entry to create when the word is not known yet.
+	// When nil, Relation.EntryUUID must reference an existing entry.
+	NewEntry *models.Entry
+	Relation models.Relation
+}
+
+// MarkWord records a marked word in one transaction: the URL, the paragraph,
+// the entry (when new) and the relation tying them together. Nothing is written
+// if any step fails. Returns the stored entry.
+func (db *DB) MarkWord(in *MarkWordInput) (*models.Entry, error) {
+	var entry *models.Entry
+	err := db.WithTx(func(qs *Queries) error {
+		if err := qs.UpsertURL(&in.URL); err != nil {
+			return fmt.Errorf("failed to upsert url %s: %w", in.URL.URLHash, err)
+		}
+		if err := qs.UpsertParagraph(&in.Paragraph); err != nil {
+			return fmt.Errorf("failed to upsert paragraph %s: %w", in.Paragraph.ParagraphHash, err)
+		}
+		if in.NewEntry != nil {
+			if err := qs.UpsertEntry(in.NewEntry); err != nil {
+				return fmt.Errorf("failed to insert entry %s: %w", in.NewEntry.UUID, err)
+			}
+			in.Relation.EntryUUID = in.NewEntry.UUID
+		}
+
+		// Read the entry before the relation so a concurrently deleted entry is
+		// reported as such instead of as a foreign key failure.
+		var err error
+		entry, err = qs.GetEntryByUUID(in.Relation.UserID, in.Relation.EntryUUID)
+		if err != nil {
+			return fmt.Errorf("failed to get entry %s: %w", in.Relation.EntryUUID, err)
+		}
+		if entry == nil {
+			return ErrEntryNotFound
+		}
+
+		if err := qs.UpsertRelation(&in.Relation); err != nil {
+			return fmt.Errorf("failed to upsert relation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
 // DeleteEntryAndRelations removes an entry and its associated relations for a user
 func (db *DB) DeleteEntryAndRelations(userID int64, entryUUID string) error {
 	tx, err := db.Begin()
@@ -473,7 +586,7 @@ func (db *DB) DeleteEntryAndRelations(userID int64, entryUUID string) error {
 				return fmt.Errorf("failed to check remaining relations for paragraph_hash %s: %w", candidate.ParagraphHash, err)
 			}
 			if count == 0 {
-				_, err = tx.Exec("DELETE FROM paragraphs WHERE user_id = ? AND paragraph_hash = ?", userID, candidate.ParagraphHash)
+				_, err = tx.Exec("DELETE FROM paragraphs WHERE user_id = ? AND paragraph_hash = ? AND "+notInBooks, userID, candidate.ParagraphHash)
 				if err != nil {
 					return fmt.Errorf("failed to delete orphaned paragraph %s: %w", candidate.ParagraphHash, err)
 				}
@@ -486,8 +599,9 @@ func (db *DB) DeleteEntryAndRelations(userID int64, entryUUID string) error {
 	return tx.Commit() // Commit the transaction
 }
 
-// GetUserDataBundle retrieves all necessary data (words a.k.a. entries) for the UserScript highlighting
-func (db *DB) GetUserDataBundle(userID int64) (*models.UserDataBundle, error) {
+// GetUserDataBundle retrieves all necessary data (words a.k.a. entries) for the UserScript highlighting.
+// With a dictionaryID only that dictionary's entries and relations are returned; 0 returns all.
+func (db *DB) GetUserDataBundle(userID, dictionaryID int64) (*models.UserDataBundle, error) {
 	bundle := &models.UserDataBundle{
 		Entries:    make([]models.Entry, 0),
 		URLs:       make([]models.URL, 0),
@@ -497,16 +611,16 @@ func (db *DB) GetUserDataBundle(userID int64) (*models.UserDataBundle, error) {
 
 	// Get Entries
 	rows, err := db.Query(`
-               SELECT uuid, word, forms_pipe_separated, created_at, updated_at
-               FROM entries WHERE user_id = ?
-           `, userID)
+               SELECT uuid, COALESCE(dictionary_id, 0), word, forms_pipe_separated, created_at, updated_at
+               FROM entries WHERE user_id = ? AND (? = 0 OR dictionary_id = ?)
+           `, userID, dictionaryID, dictionaryID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query entries: %w", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		e := models.Entry{UserID: userID}
-		if err := rows.Scan(&e.UUID, &e.Word, &e.FormsPipeSeparated, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		if err := rows.Scan(&e.UUID, &e.DictionaryID, &e.Word, &e.FormsPipeSeparated, &e.CreatedAt, &e.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan entry: %w", err)
 		}
 		bundle.Entries = append(bundle.Entries, e)
@@ -535,10 +649,12 @@ func (db *DB) GetUserDataBundle(userID int64) (*models.UserDataBundle, error) {
 		return nil, fmt.Errorf("error iterating url rows: %w", err)
 	}
 
-	// Get All Paragraphs associated with the user
+	// Get All Paragraphs associated with the user, leaving out book text no word was marked in
 	rows, err = db.Query(`
                SELECT paragraph_hash, text, created_at
-               FROM paragraphs WHERE user_id = ?
+               FROM paragraphs WHERE user_id = ? AND (`+notInBooks+` OR EXISTS (
+                   SELECT 1 FROM relations r WHERE r.user_id = paragraphs.user_id AND r.paragraph_hash = paragraphs.paragraph_hash
+               ))
            `, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query paragraphs: %w", err)
@@ -557,9 +673,11 @@ func (db *DB) GetUserDataBundle(userID int64) (*models.UserDataBundle, error) {
 
 	// Get Relations
 	rows, err = db.Query(`
-        SELECT entry_uuid, url_hash, paragraph_hash, transcript_segment_ref, created_at, updated_at
-        FROM relations WHERE user_id = ?
-    `, userID)
+        SELECT r.entry_uuid, r.url_hash, r.paragraph_hash, r.transcript_segment_ref, r.created_at, r.updated_at
+        FROM relations r
+        JOIN entries e ON r.user_id = e.user_id AND r.entry_uuid = e.uuid
+        WHERE r.user_id = ? AND (? = 0 OR e.dictionary_id = ?)
+    `, userID, dictionaryID, dictionaryID)
 	if err != nil { /* ... error handling ... */
 	}
 	defer rows.Close()
@@ -643,168 +761,239 @@ func (db *DB) GetTrainingData(userID int64, limit int) ([]models.TrainingItem, e
 }
 
 // --- Bulk Import Method ---
-// ImportData imports data from the old UserScript JSON format for a specific user
-// NOTE: This is a basic implementation. Error handling and duplicate management might need refinement.
-func (db *DB) ImportData(userID int64, data map[string]map[string][]string) (int, int, int, int, error) {
-	importedEntries := 0
-	importedUrls := 0
-	importedParagraphs := 0
-	importedRelations := 0
+// ImportData imports data from the old UserScript JSON format for a specific user,
+// each dictionary of the file into the user's dictionary of the same name.
+// Malformed or failing rows are skipped and reported. With dryRun everything is
+// checked, but the transaction is rolled back.
+func (db *DB) ImportData(userID int64, data map[string]map[string][]string, dryRun bool) (*models.ImportDataReport, error) {
+	report := &models.ImportDataReport{DryRun: dryRun, Errors: []models.ImportIssue{}}
 
 	tx, err := db.Begin()
 	if err != nil {
-		return 0, 0, 0, 0, fmt.Errorf("import: failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("import: failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Assuming only one dictionary key exists or we process the first one found
-	var dictData map[string][]string
-	for _, v := range data {
-		dictData = v
-		break
+	// Each key names a dictionary, created if the user does not have it yet.
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, ErrNoImportData
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dictionaryID, err := dictionaryByName(tx, userID, name)
+		if err != nil {
+			return nil, fmt.Errorf("import: %w", err)
+		}
+		importDictionary(tx, userID, dictionaryID, data[name], report)
+	}
+
+	if dryRun {
+		return report, nil // Rolled back by the deferred Rollback
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("import: failed to commit transaction: %w", err)
+	}
+
+	log.Printf("Import successful for user %d: Entries=%d, URLs=%d, Paragraphs=%d, Relations=%d, Errors=%d",
+		userID, report.Entries.Inserted, report.URLs.Inserted, report.Paragraphs.Inserted, report.Relations.Inserted, report.ErrorCount)
+	return report, nil
+}
+
+// importRow runs the statements of one imported row in a savepoint, rolled
+// back if fn fails. PostgreSQL aborts the whole transaction at the first
+// failing statement otherwise, and the rows after it would all fail.
+func importRow(tx *Tx, fn func() error) error {
+	if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+		return err
 	}
-	if dictData == nil {
-		return 0, 0, 0, 0, errors.New("import: no dictionary data found in JSON")
+	if err := fn(); err != nil {
+		if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT import_row"); rbErr != nil {
+			return fmt.Errorf("%w (rolling back the row failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	_, err := tx.Exec("RELEASE SAVEPOINT import_row")
+	return err
+}
+
+// importDictionary imports the entries, URLs, paragraphs and relations of one
+// dictionary of the old UserScript format into report.
+func importDictionary(tx *Tx, userID, dictionaryID int64, dictData map[string][]string, report *models.ImportDataReport) {
+	// insert runs the INSERT ... ON CONFLICT DO NOTHING of a row.
+	insert := func(query string, args ...any) (res sql.Result, err error) {
+		err = importRow(tx, func() error {
+			res, err = tx.Exec(query, args...)
+			return err
+		})
+		return res, err
+	}
+	// count sorts a row by the result of its insert.
+	count := func(c *models.ImportCounts, section string, row int, res sql.Result, err error) bool {
+		if err != nil {
+			c.Invalid++
+			report.AddError(section, row, err.Error())
+			return false
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			c.Duplicate++
+		} else {
+			c.Inserted++
+		}
+		return true
 	}
 
 	// Import Entries first
 	entriesMap := make(map[string]string) // uuid -> word forms
-	for _, entryStr := range dictData["entries"] {
+	for i, entryStr := range dictData["entries"] {
 		parts := strings.SplitN(entryStr, "|", 2)
-		if len(parts) == 2 {
-			uuid := parts[0]
-			forms := parts[1]
-			word := strings.Split(forms, "|")[0] // Assume first form is base word
-
-			_, err := tx.Exec(`
-                        INSERT INTO entries (uuid, user_id, word, forms_pipe_separated, created_at, updated_at)
-                        VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-                        ON CONFLICT(user_id, uuid) DO NOTHING;
-                    `, uuid, userID, word, forms)
-			if err != nil {
-				log.Printf("Import warning: Failed to insert entry %s: %v", uuid, err)
-				continue // Skip this entry
-			}
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			report.Entries.Invalid++
+			report.AddError("entries", i+1, "malformed entry, expected uuid|forms")
+			continue
+		}
+		uuid := parts[0]
+		forms := parts[1]
+		word := strings.Split(forms, "|")[0] // Assume first form is base word
+
+		res, err := insert(`
+                    INSERT INTO entries (uuid, user_id, dictionary_id, word, forms_pipe_separated, created_at, updated_at)
+                    VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+                    ON CONFLICT(user_id, uuid) DO NOTHING;
+                `, uuid, userID, dictionaryID, word, forms)
+		if count(&report.Entries, "entries", i+1, res, err) {
 			entriesMap[uuid] = forms // Keep track for relation import
-			importedEntries++
-		} else {
-			log.Printf("Import warning: Malformed entry string: %s", entryStr)
 		}
 	}
 
 	// Import URLs
 	urlsMap := make(map[string]string) // hash -> url
-	for _, urlStr := range dictData["urls"] {
+	for i, urlStr := range dictData["urls"] {
 		parts := strings.SplitN(urlStr, "|", 3)
-		if len(parts) >= 2 {
-			hash := parts[0]
-			url := parts[1]
-			var title *string
-			if len(parts) == 3 && len(parts[2]) > 0 {
-				title = &parts[2]
-			}
-			_, err := tx.Exec(`
-                        INSERT INTO urls (user_id, url_hash, url, title, created_at)
-                        VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
-                        ON CONFLICT(user_id, url_hash) DO NOTHING;
-                     `, userID, hash, url, title)
-			if err != nil {
-				log.Printf("Import warning: Failed to insert URL %s: %v", hash, err)
-				continue
-			}
+		if len(parts) < 2 || parts[0] == "" {
+			report.URLs.Invalid++
+			report.AddError("urls", i+1, "malformed URL, expected hash|url|title")
+			continue
+		}
+		hash := parts[0]
+		url := parts[1]
+		var title *string
+		if len(parts) == 3 && len(parts[2]) > 0 {
+			title = &parts[2]
+		}
+		res, err := insert(`
+                    INSERT INTO urls (user_id, url_hash, url, title, created_at)
+                    VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+                    ON CONFLICT(user_id, url_hash) DO NOTHING;
+                 `, userID, hash, url, title)
+		if count(&report.URLs, "urls", i+1, res, err) {
 			urlsMap[hash] = url
-			importedUrls++
-		} else {
-			log.Printf("Import warning: Malformed URL string: %s", urlStr)
 		}
 	}
 
 	// Import Paragraphs
 	paragraphsMap := make(map[string]string) // hash -> text
-	for _, paraStr := range dictData["paragraphs"] {
+	for i, paraStr := range dictData["paragraphs"] {
 		parts := strings.SplitN(paraStr, "|", 2)
-		if len(parts) == 2 {
-			hash := parts[0]
-			text := parts[1]
-			_, err := tx.Exec(`
-                        INSERT INTO paragraphs (user_id, paragraph_hash, text, created_at)
-                        VALUES (?, ?, ?, CURRENT_TIMESTAMP)
-                        ON CONFLICT(user_id, paragraph_hash) DO NOTHING;
-                     `, userID, hash, text)
-			if err != nil {
-				log.Printf("Import warning: Failed to insert paragraph %s: %v", hash, err)
-				continue
-			}
+		if len(parts) != 2 || parts[0] == "" {
+			report.Paragraphs.Invalid++
+			report.AddError("paragraphs", i+1, "malformed paragraph, expected hash|text")
+			continue
+		}
+		hash := parts[0]
+		text := parts[1]
+		res, err := insert(`
+                    INSERT INTO paragraphs (user_id, paragraph_hash, text, created_at)
+                    VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+                    ON CONFLICT(user_id, paragraph_hash) DO NOTHING;
+                 `, userID, hash, text)
+		if count(&report.Paragraphs, "paragraphs", i+1, res, err) {
 			paragraphsMap[hash] = text
-			importedParagraphs++
-		} else {
-			log.Printf("Import warning: Malformed paragraph string: %s", paraStr)
 		}
 	}
 
 	// Import Relations
-	for _, relStr := range dictData["relations"] {
+	for i, relStr := range dictData["relations"] {
+		row := i + 1
 		parts := strings.SplitN(relStr, "|", 4)
-		if len(parts) == 4 {
-			tsStr := parts[0]
-			entryUUID := parts[1]
-			urlHash := parts[2]
-			paraHash := parts[3]
-
-			// Convert timestamp (milliseconds string)
-			tsMillis, err := strconv.ParseInt(tsStr, 10, 64)
-			if err != nil {
-				log.Printf("Import warning: Invalid timestamp in relation %s: %v", relStr, err)
-				continue
-			}
-			relTime := time.UnixMilli(tsMillis)
+		if len(parts) != 4 {
+			report.Relations.Invalid++
+			report.AddError("relations", row, "malformed relation, expected timestamp|entry|url hash|paragraph hash")
+			continue
+		}
+		tsStr := parts[0]
+		entryUUID := parts[1]
+		urlHash := parts[2]
+		paraHash := parts[3]
 
-			// Check if referenced items were successfully imported (optional but good practice)
-			if _, ok := entriesMap[entryUUID]; !ok {
-				log.Printf("Import warning: Skipping relation, missing entry %s", entryUUID)
-				continue
-			}
-			if _, ok := urlsMap[urlHash]; !ok {
-				log.Printf("Import warning: Skipping relation, missing url %s", urlHash)
-				continue
-			}
-			if _, ok := paragraphsMap[paraHash]; !ok {
-				log.Printf("Import warning: Skipping relation, missing paragraph %s", paraHash)
-				continue
-			}
+		// Convert timestamp (milliseconds string)
+		tsMillis, err := strconv.ParseInt(tsStr, 10, 64)
+		if err != nil {
+			report.Relations.Invalid++
+			report.AddError("relations", row, fmt.Sprintf("invalid timestamp %q", tsStr))
+			continue
+		}
+		relTime := time.UnixMilli(tsMillis)
 
-			_, err = tx.Exec(`
-                        INSERT INTO relations (user_id, entry_uuid, url_hash, paragraph_hash, created_at, updated_at)
-                        VALUES (?, ?, ?, ?, ?, ?)
-                        ON CONFLICT(user_id, entry_uuid, url_hash, paragraph_hash) DO UPDATE SET
-                            updated_at = excluded.updated_at; -- Update timestamp if newer
-                    `, userID, entryUUID, urlHash, paraHash, relTime, relTime) // Use imported time for both initially
+		// Check if referenced items were successfully imported
+		if _, ok := entriesMap[entryUUID]; !ok {
+			report.MissingEntry++
+			report.AddError("relations", row, "missing entry "+entryUUID)
+			continue
+		}
+		if _, ok := urlsMap[urlHash]; !ok {
+			report.MissingURL++
+			report.AddError("relations", row, "missing url "+urlHash)
+			continue
+		}
+		if _, ok := paragraphsMap[paraHash]; !ok {
+			report.MissingParagraph++
+			report.AddError("relations", row, "missing paragraph "+paraHash)
+			continue
+		}
+
+		var exists bool
+		err = importRow(tx, func() error {
+			err := tx.QueryRow(`
+                    SELECT EXISTS (SELECT 1 FROM relations WHERE user_id = ? AND entry_uuid = ? AND url_hash = ? AND paragraph_hash = ?)
+                `, userID, entryUUID, urlHash, paraHash).Scan(&exists)
 			if err != nil {
-				log.Printf("Import warning: Failed to insert relation %s: %v", relStr, err)
-				continue
+				return err
 			}
-			importedRelations++
-		} else {
-			log.Printf("Import warning: Malformed relation string: %s", relStr)
+			_, err = tx.Exec(`
+                    INSERT INTO relations (user_id, entry_uuid, url_hash, paragraph_hash, created_at, updated_at)
+                    VALUES (?, ?, ?, ?, ?, ?)
+                    ON CONFLICT(user_id, entry_uuid, url_hash, paragraph_hash) DO UPDATE SET
+                        updated_at = excluded.updated_at; -- Update timestamp if newer
+                `, userID, entryUUID, urlHash, paraHash, relTime, relTime) // Use imported time for both initially
+			return err
+		})
+		switch {
+		case err != nil:
+			report.Relations.Invalid++
+			report.AddError("relations", row, err.Error())
+		case exists:
+			report.Relations.Duplicate++
+		default:
+			report.Relations.Inserted++
 		}
 	}
-
-	err = tx.Commit()
-	if err != nil {
-		return 0, 0, 0, 0, fmt.Errorf("import: failed to commit transaction: %w", err)
-	}
-
-	log.Printf("Import successful for user %d: Entries=%d, URLs=%d, Paragraphs=%d, Relations=%d",
-		userID, importedEntries, importedUrls, importedParagraphs, importedRelations)
-	return importedEntries, importedUrls, importedParagraphs, importedRelations, nil
 }
 
 // CreatePodcastRecord inserts initial podcast metadata into the DB.
 func (db *DB) CreatePodcastRecord(p *models.Podcast) error {
-	_, err := db.Exec(`
-        INSERT INTO podcasts (id, user_id, filename, store_path, producer, series, episode, description, original_transcript, status, upload_time)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		p.ID, p.UserID, p.Filename, p.StorePath, p.Producer, p.Series, p.Episode, p.Description, p.OriginalTranscript, p.Status, p.UploadTime,
+	return insertPodcast(db, p)
+}
+
+func insertPodcast(q Querier, p *models.Podcast) error {
+	_, err := q.Exec(`
+        INSERT INTO podcasts (id, user_id, filename, store_path, producer, series, episode, description, original_transcript, status, upload_time, media_type)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.UserID, p.Filename, p.StorePath, p.Producer, p.Series, p.Episode, p.Description, p.OriginalTranscript, p.Status, p.UploadTime, mediaTypeOrAudio(p.MediaType),
 	)
 	if err != nil {
 		// Check for UNIQUE constraint violation on store_path explicitly if needed
@@ -813,6 +1002,15 @@ func (db *DB) CreatePodcastRecord(p *models.Podcast) error {
 	return nil
 }
 
+// mediaTypeOrAudio defaults an unset media type to audio, as podcasts were
+// before video lessons.
+func mediaTypeOrAudio(t models.MediaType) models.MediaType {
+	if t == "" {
+		return models.MediaAudio
+	}
+	return t
+}
+
 // UpdatePodcastStatus updates only the status and error message of a podcast record.
 func (db *DB) UpdatePodcastStatus(userID int64, podcastID string, status models.PodcastStatus, errMsg *string) error {
 	res, err := db.Exec(`
@@ -871,7 +1069,7 @@ func (db *DB) ListPodcastsByUser(userID int64, limit, offset int) ([]models.Podc
 	}
 
 	query := `
-        SELECT id, producer, series, episode, upload_time, status
+        SELECT id, producer, series, episode, upload_time, status, media_type
         FROM podcasts
         WHERE user_id = ?
         ORDER BY upload_time DESC
@@ -886,7 +1084,7 @@ func (db *DB) ListPodcastsByUser(userID int64, limit, offset int) ([]models.Podc
 	podcasts := make([]models.PodcastListItem, 0)
 	for rows.Next() {
 		var p models.PodcastListItem
-		if err := rows.Scan(&p.ID, &p.Producer, &p.Series, &p.Episode, &p.UploadTime, &p.Status); err != nil {
+		if err := rows.Scan(&p.ID, &p.Producer, &p.Series, &p.Episode, &p.UploadTime, &p.Status, &p.MediaType); err != nil {
 			// Log error but continue processing other rows? Or return immediately?
 			log.Printf("Error scanning podcast row for user %d: %v", userID, err)
 			continue // Skip problematic row
@@ -956,7 +1154,7 @@ func (db *DB) DeletePodcastRecord(userID int64, podcastID string) (string, error
 				return storePath, fmt.Errorf("failed to scan relation: %w", err)
 			}
 			// Delete from the paragraphs table
-			_, err = tx.Exec("DELETE FROM paragraphs WHERE user_id = ? AND paragraph_hash = ?", userID, r.ParagraphHash)
+			_, err = tx.Exec("DELETE FROM paragraphs WHERE user_id = ? AND paragraph_hash = ? AND "+notInBooks, userID, r.ParagraphHash)
 			if err != nil {
 				return storePath, fmt.Errorf("failed to delete paragraphs for podcast %s: %w", podcastID, err)
 			}
@@ -988,7 +1186,7 @@ func (db *DB) DeletePodcastRecord(userID int64, podcastID string) (string, error
 func (db *DB) GetPodcastByIDForUser(userID int64, podcastID string) (*models.Podcast, error) {
 	query := `
         SELECT id, user_id, filename, store_path, producer, series, episode, description,
-               original_transcript, final_transcript, upload_time, status, error_message
+               original_transcript, final_transcript, upload_time, status, error_message, media_type
         FROM podcasts
         WHERE id = ? AND user_id = ?
     `
@@ -1000,7 +1198,7 @@ func (db *DB) GetPodcastByIDForUser(userID int64, podcastID string) (*models.Pod
 
 	err := db.QueryRow(query, podcastID, userID).Scan(
 		&p.ID, &p.UserID, &p.Filename, &p.StorePath, &p.Producer, &p.Series, &p.Episode, &desc,
-		&origTranscript, &finalTranscript, &p.UploadTime, &p.Status, &errMsg,
+		&origTranscript, &finalTranscript, &p.UploadTime, &p.Status, &errMsg, &p.MediaType,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -1027,21 +1225,41 @@ func (db *DB) GetPodcastByIDForUser(userID int64, podcastID string) (*models.Pod
 
 type Timestamp time.Time
 
+// timestampFormats are the layouts SQLite may hand back for aggregated DATETIME values:
+// CURRENT_TIMESTAMP defaults and time.Time parameters written by the driver.
+var timestampFormats = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05Z",
+}
+
+// Scan accepts time.Time (PostgreSQL, typed SQLite columns) as well as the
+// strings SQLite returns when an aggregate such as MAX() loses the column type.
 func (p *Timestamp) Scan(value any) error {
-	// t := value.(time.Time)
-	t, err := time.Parse("2006-01-02 15:04:05", value.(string))
-	if err != nil {
-		log.Printf("Error converting string '%s' "+"to time.Time: %v", value, err)
-		t = time.Time{} // Default to zero time on error
+	switch v := value.(type) {
+	case time.Time:
+		*p = Timestamp(v)
+		return nil
+	case []byte:
+		value = string(v)
+	}
+	str, _ := value.(string)
+	for _, layout := range timestampFormats {
+		if t, err := time.Parse(layout, str); err == nil {
+			*p = Timestamp(t)
+			return nil
+		}
 	}
-	*p = Timestamp(t)
+	log.Printf("Error converting '%v' to time.Time", value)
+	*p = Timestamp(time.Time{}) // Default to zero time on error
 	return nil
 }
 
 // GetReviewPageData fetches data structured for the review page.
 // It gets distinct sources (articles or podcasts) based on recent interactions,
 // then fetches all related paragraphs for those sources.
-func (db *DB) GetReviewPageData(userID int64, limit int) ([]models.ReviewSource, error) {
+func (db *DB) GetReviewPageData(userID, dictionaryID int64, limit int) ([]models.ReviewSource, error) {
 	if limit <= 0 {
 		limit = 50
 	}
@@ -1053,12 +1271,13 @@ func (db *DB) GetReviewPageData(userID int64, limit int) ([]models.ReviewSource,
             r.url_hash,
             MAX(r.updated_at) as max_updated_at
         FROM relations r
-        WHERE r.user_id = ?
+        JOIN entries e ON r.user_id = e.user_id AND r.entry_uuid = e.uuid
+        WHERE r.user_id = ? AND (? = 0 OR e.dictionary_id = ?)
         GROUP BY r.url_hash
         ORDER BY max_updated_at DESC
         LIMIT ?;
     `
-	sourceOrderRows, err := db.Query(sourceOrderQuery, userID, limit)
+	sourceOrderRows, err := db.Query(sourceOrderQuery, userID, dictionaryID, dictionaryID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query source order for review page (user %d): %w", userID, err)
 	}
@@ -1117,21 +1336,31 @@ func (db *DB) GetReviewPageData(userID int64, limit int) ([]models.ReviewSource,
             pod.id as podcast_id,
             pod.producer as podcast_producer,
             pod.series as podcast_series,
-            pod.episode as podcast_episode
+            pod.episode as podcast_episode,
+            pod.media_type as podcast_media_type,
+            book.id as book_id,
+            book.title as book_title,
+            bc.chapter_index as book_chapter,
+            bc.title as book_chapter_title
             -- Add r.updated_at here if you want to sort paragraphs by their last interaction
             -- ORDER BY r.url_hash, r.updated_at DESC -- Example for sorting paragraphs within source
         FROM relations r
+        JOIN entries e ON r.user_id = e.user_id AND r.entry_uuid = e.uuid
         JOIN paragraphs p_text ON r.user_id = p_text.user_id AND r.paragraph_hash = p_text.paragraph_hash
         LEFT JOIN urls u ON r.user_id = u.user_id AND r.url_hash = u.url_hash
-        LEFT JOIN podcasts pod ON u.user_id = pod.user_id AND INSTR(u.url, pod.id) > 0 -- Heuristic
-        WHERE r.user_id = ? AND r.url_hash IN (%s)
-        GROUP BY r.url_hash, r.paragraph_hash -- This ensures distinct paragraphs per source
+        LEFT JOIN podcasts pod ON u.user_id = pod.user_id AND u.url LIKE '%%' || pod.id || '%%' -- Heuristic
+        LEFT JOIN book_chapters bc ON r.user_id = bc.user_id AND r.url_hash = bc.url_hash
+        LEFT JOIN books book ON bc.book_id = book.id
+        WHERE r.user_id = ? AND (? = 0 OR e.dictionary_id = ?) AND r.url_hash IN (%s)
+        GROUP BY r.url_hash, r.paragraph_hash, -- This ensures distinct paragraphs per source
+                 p_text.text, u.url, u.title, pod.id, pod.producer, pod.series, pod.episode, pod.media_type, -- Required by PostgreSQL
+                 book.id, book.title, bc.chapter_index, bc.title
         ORDER BY r.url_hash, MAX(r.updated_at) DESC -- MIN(p_text.id) -- Attempt to maintain paragraph original order if possible (by paragraph ID)
                                           -- Or use MAX(r.updated_at) here to sort paragraphs by recent interaction
         ;																					
     `, placeholders)
 
-	allDataRows, err := db.Query(reviewDataQuery, append([]interface{}{userID}, urlHashesForInClause...)...)
+	allDataRows, err := db.Query(reviewDataQuery, append([]interface{}{userID, dictionaryID, dictionaryID}, urlHashesForInClause...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query review data details for user %d: %w", userID, err)
 	}
@@ -1145,12 +1374,15 @@ func (db *DB) GetReviewPageData(userID int64, limit int) ([]models.ReviewSource,
 		var transcriptSegmentRef sql.NullString
 		var isPodcastSegment bool
 		var articleURL, articleTitle sql.NullString
-		var podcastID, podcastProducer, podcastSeries, podcastEpisode sql.NullString
+		var podcastID, podcastProducer, podcastSeries, podcastEpisode, podcastMediaType sql.NullString
+		var bookID, bookTitle, bookChapterTitle sql.NullString
+		var bookChapter sql.NullInt64
 
 		err := allDataRows.Scan(
 			&urlHash, &paragraphText, &paragraphHash, &transcriptSegmentRef, &isPodcastSegment,
 			&articleURL, &articleTitle,
-			&podcastID, &podcastProducer, &podcastSeries, &podcastEpisode,
+			&podcastID, &podcastProducer, &podcastSeries, &podcastEpisode, &podcastMediaType,
+			&bookID, &bookTitle, &bookChapter, &bookChapterTitle,
 		)
 		if err != nil {
 			log.Printf("Error scanning review data row for user %d: %v", userID, err)
@@ -1166,8 +1398,15 @@ func (db *DB) GetReviewPageData(userID int64, limit int) ([]models.ReviewSource,
 			}
 			if podcastID.Valid && podcastID.String != "" {
 				source.SourceType = "podcast"
+				if models.MediaType(podcastMediaType.String) == models.MediaVideo {
+					source.SourceType = "video"
+				}
 				source.SourceTitle = fmt.Sprintf("%s: %s - %s", podcastProducer.String, podcastSeries.String, podcastEpisode.String)
 				source.SourceLink = fmt.Sprintf("/podcasts/play/%s", podcastID.String)
+			} else if bookID.Valid {
+				source.SourceType = "book"
+				source.SourceTitle = fmt.Sprintf("%s: %s", bookTitle.String, bookChapterTitle.String)
+				source.SourceLink = fmt.Sprintf("/books/read/%s/%d", bookID.String, bookChapter.Int64)
 			} else if articleURL.Valid {
 				source.SourceType = "article"
 				source.SourceTitle = articleTitle.String // Will be empty string if NULL, JS handles display
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"fmt"
+	"lingomarker/internal/models"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB opens a migrated SQLite database in a temporary directory.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func createTestUser(t *testing.T, db *DB, username string) int64 {
+	t.Helper()
+	id, err := db.CreateUser(username, username, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// markTestWord marks word in paragraph on the page at url, creating the
+// entry, page and paragraph as needed.
+func markTestWord(t *testing.T, db *DB, userID int64, word, url, paragraph string) {
+	t.Helper()
+	hash := func(s string) string { return fmt.Sprintf("%x", s) }
+	in := &MarkWordInput{
+		URL:       models.URL{UserID: userID, URLHash: hash(url), URL: url},
+		Paragraph: models.Paragraph{UserID: userID, ParagraphHash: hash(paragraph), Text: paragraph},
+		Relation:  models.Relation{UserID: userID, EntryUUID: "uuid-" + word, URLHash: hash(url), ParagraphHash: hash(paragraph)},
+	}
+	if entry, err := db.GetEntryByUUID(userID, "uuid-"+word); err != nil {
+		t.Fatal(err)
+	} else if entry == nil {
+		in.NewEntry = &models.Entry{UUID: "uuid-" + word, UserID: userID, Word: word, FormsPipeSeparated: word}
+	}
+	if _, err := db.MarkWord(in); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// dialect captures what differs between the supported SQL backends.
+// Queries in this package are written with '?' placeholders and portable SQL;
+// the dialect rewrites placeholders and supplies its own migrations.
+type dialect interface {
+	// Name returns the database/sql driver name.
+	Name() string
+	// rebind converts '?' placeholders into the backend's native form.
+	rebind(query string) string
+	// migrations returns the backend's ordered schema migrations.
+	migrations() []Migration
+	// lockMigrations serialises concurrent migration runs (e.g. several server
+	// instances starting at once). The returned function releases the lock.
+	lockMigrations(db *sql.DB) (func(), error)
+}
+
+// isPostgresDSN reports whether the DSN selects the PostgreSQL backend.
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// rebindNumbered replaces '?' placeholders with $1, $2, ... skipping quoted literals.
+func rebindNumbered(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	inQuote := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+			b.WriteByte(c)
+		case c == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+)
+
+// DefaultDictionaryName names the dictionary created for users who have none.
+const DefaultDictionaryName = "Default"
+
+var (
+	ErrDictionaryNotFound = errors.New("dictionary not found")
+	ErrDictionaryExists   = errors.New("a dictionary with this name already exists")
+	ErrLastDictionary     = errors.New("the last dictionary cannot be deleted")
+)
+
+const dictionaryColumns = `id, user_id, name, source_language, target_language, dict_base_url, highlight_color, created_at, updated_at`
+
+// GetDictionaries returns the user's dictionaries, oldest first. A user who
+// has none gets the default dictionary.
+func (db *DB) GetDictionaries(userID int64) ([]models.Dictionary, error) {
+	var dicts []models.Dictionary
+	err := db.WithTx(func(qs *Queries) error {
+		if _, err := defaultDictionaryID(qs.q, userID); err != nil {
+			return err
+		}
+		var err error
+		dicts, err = listDictionaries(qs.q, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dicts, nil
+}
+
+// CreateDictionary adds a dictionary and sets its ID and timestamps. Names
+// are unique per user, ignoring case.
+func (db *DB) CreateDictionary(d *models.Dictionary) error {
+	return db.WithTx(func(qs *Queries) error {
+		if err := checkDictionaryName(qs.q, d.UserID, 0, d.Name); err != nil {
+			return err
+		}
+		err := qs.q.QueryRow(`
+            INSERT INTO dictionaries (user_id, name, source_language, target_language, dict_base_url, highlight_color, created_at, updated_at)
+            VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+            RETURNING id, created_at, updated_at
+        `, d.UserID, d.Name, d.SourceLanguage, d.TargetLanguage, d.DictBaseURL, d.HighlightColor).Scan(&d.ID, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert dictionary %q: %w", d.Name, err)
+		}
+		return nil
+	})
+}
+
+// UpdateDictionary saves the name, languages, URL and color of a dictionary.
+func (db *DB) UpdateDictionary(d *models.Dictionary) error {
+	return db.WithTx(func(qs *Queries) error {
+		if err := checkDictionaryName(qs.q, d.UserID, d.ID, d.Name); err != nil {
+			return err
+		}
+		res, err := qs.q.Exec(`
+            UPDATE dictionaries SET name = ?, source_language = ?, target_language = ?,
+                dict_base_url = ?, highlight_color = ?, updated_at = CURRENT_TIMESTAMP
+            WHERE user_id = ? AND id = ?
+        `, d.Name, d.SourceLanguage, d.TargetLanguage, d.DictBaseURL, d.HighlightColor, d.UserID, d.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update dictionary %d: %w", d.ID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrDictionaryNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteDictionary deletes a dictionary with its entries, and the URLs and
+// paragraphs only those entries referenced. The user's last dictionary
+// cannot be deleted.
+func (db *DB) DeleteDictionary(userID, dictionaryID int64) error {
+	return db.WithTx(func(qs *Queries) error {
+		var count int
+		var found bool
+		err := qs.q.QueryRow(`
+            SELECT COUNT(*), COALESCE(MAX(CASE WHEN id = ? THEN 1 ELSE 0 END), 0) = 1
+            FROM dictionaries WHERE user_id = ?
+        `, dictionaryID, userID).Scan(&count, &found)
+		if err != nil {
+			return fmt.Errorf("failed to count dictionaries: %w", err)
+		}
+		if !found {
+			return ErrDictionaryNotFound
+		}
+		if count == 1 {
+			return ErrLastDictionary
+		}
+
+		var urlHashes, paragraphHashes []string
+		rows, err := qs.q.Query(`
+            SELECT DISTINCT r.url_hash, r.paragraph_hash
+            FROM relations r
+            JOIN entries e ON r.user_id = e.user_id AND r.entry_uuid = e.uuid
+            WHERE e.user_id = ? AND e.dictionary_id = ?
+        `, userID, dictionaryID)
+		if err != nil {
+			return fmt.Errorf("failed to query relations of dictionary %d: %w", dictionaryID, err)
+		}
+		for rows.Next() {
+			var urlHash, paragraphHash string
+			if err := rows.Scan(&urlHash, &paragraphHash); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan relation of dictionary %d: %w", dictionaryID, err)
+			}
+			urlHashes = append(urlHashes, urlHash)
+			paragraphHashes = append(paragraphHashes, paragraphHash)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// Relations and review state go with their entries.
+		if _, err := qs.q.Exec("DELETE FROM entries WHERE user_id = ? AND dictionary_id = ?", userID, dictionaryID); err != nil {
+			return fmt.Errorf("failed to delete entries of dictionary %d: %w", dictionaryID, err)
+		}
+		for _, hash := range urlHashes {
+			if _, err := qs.q.Exec(`
+                DELETE FROM urls WHERE user_id = ? AND url_hash = ?
+                AND NOT EXISTS (SELECT 1 FROM relations WHERE user_id = ? AND url_hash = ?)
+            `, userID, hash, userID, hash); err != nil {
+				return fmt.Errorf("failed to delete orphaned url %s: %w", hash, err)
+			}
+		}
+		for _, hash := range paragraphHashes {
+			if _, err := qs.q.Exec(`
+                DELETE FROM paragraphs WHERE user_id = ? AND paragraph_hash = ?
+                AND NOT EXISTS (SELECT 1 FROM relations WHERE user_id = ? AND paragraph_hash = ?)
+                AND `+notInBooks+`
+            `, userID, hash, userID, hash); err != nil {
+				return fmt.Errorf("failed to delete orphaned paragraph %s: %w", hash, err)
+			}
+		}
+
+		if _, err := qs.q.Exec("DELETE FROM dictionaries WHERE user_id = ? AND id = ?", userID, dictionaryID); err != nil {
+			return fmt.Errorf("failed to delete dictionary %d: %w", dictionaryID, err)
+		}
+		return nil
+	})
+}
+
+// dictionaryByName returns the ID of the user's dictionary with the given
+// name, ignoring case, creating it if there is none.
+func dictionaryByName(q Querier, userID int64, name string) (int64, error) {
+	var id int64
+	err := q.QueryRow("SELECT id FROM dictionaries WHERE user_id = ? AND LOWER(name) = LOWER(?) ORDER BY id LIMIT 1", userID, name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = q.QueryRow(`
+            INSERT INTO dictionaries (user_id, name, created_at, updated_at)
+            VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+            RETURNING id
+        `, userID, name).Scan(&id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get dictionary %q: %w", name, err)
+	}
+	return id, nil
+}
+
+// defaultDictionaryID returns the ID of the user's oldest dictionary,
+// creating the default dictionary if the user has none.
+func defaultDictionaryID(q Querier, userID int64) (int64, error) {
+	var id int64
+	err := q.QueryRow("SELECT id FROM dictionaries WHERE user_id = ? ORDER BY id LIMIT 1", userID).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return dictionaryByName(q, userID, DefaultDictionaryName)
+	case err != nil:
+		return 0, fmt.Errorf("failed to get default dictionary: %w", err)
+	}
+	return id, nil
+}
+
+func listDictionaries(q Querier, userID int64) ([]models.Dictionary, error) {
+	rows, err := q.Query(`SELECT `+dictionaryColumns+` FROM dictionaries WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dictionaries: %w", err)
+	}
+	defer rows.Close()
+
+	dicts := []models.Dictionary{}
+	for rows.Next() {
+		var d models.Dictionary
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Name, &d.SourceLanguage, &d.TargetLanguage,
+			&d.DictBaseURL, &d.HighlightColor, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan dictionary: %w", err)
+		}
+		dicts = append(dicts, d)
+	}
+	return dicts, rows.Err()
+}
+
+// checkDictionaryName returns ErrDictionaryExists if another of the user's
+// dictionaries than exceptID is called name.
+func checkDictionaryName(q Querier, userID, exceptID int64, name string) error {
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM dictionaries WHERE user_id = ? AND LOWER(name) = LOWER(?) AND id <> ?", userID, name, exceptID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check dictionary name: %w", err)
+	}
+	if count > 0 {
+		return ErrDictionaryExists
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+	"time"
+)
+
+var (
+	ErrFeedNotFound = errors.New("feed not found")
+	ErrFeedExists   = errors.New("you are already subscribed to this feed")
+)
+
+const feedColumns = `id, user_id, url, title, author, description, keep_episodes, last_checked_at, last_error, created_at,
+    (SELECT COUNT(*) FROM feed_episodes e WHERE e.feed_id = feeds.id AND e.podcast_id IS NOT NULL)`
+
+func scanFeed(row interface{ Scan(...any) error }) (*models.Feed, error) {
+	f := &models.Feed{}
+	err := row.Scan(&f.ID, &f.UserID, &f.URL, &f.Title, &f.Author, &f.Description, &f.KeepEpisodes,
+		&f.LastCheckedAt, &f.LastError, &f.CreatedAt, &f.Episodes)
+	return f, err
+}
+
+// CreateFeed subscribes the user to a feed and sets its creation time. The
+// feed is checked as soon as a poller gets to it. Returns ErrFeedExists if
+// the user is subscribed to the URL already.
+func (db *DB) CreateFeed(f *models.Feed) error {
+	return db.WithTx(func(qs *Queries) error {
+		var count int
+		if err := qs.q.QueryRow("SELECT COUNT(*) FROM feeds WHERE user_id = ? AND url = ?", f.UserID, f.URL).Scan(&count); err != nil {
+			return fmt.Errorf("failed to check feed URL: %w", err)
+		}
+		if count > 0 {
+			return ErrFeedExists
+		}
+		err := qs.q.QueryRow(`
+            INSERT INTO feeds (id, user_id, url, title, author, description, keep_episodes, created_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+            RETURNING created_at
+        `, f.ID, f.UserID, f.URL, f.Title, f.Author, f.Description, f.KeepEpisodes).Scan(&f.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert feed %s: %w", f.ID, err)
+		}
+		return nil
+	})
+}
+
+// ListFeeds returns the user's feeds, by title.
+func (db *DB) ListFeeds(userID int64) ([]models.Feed, error) {
+	rows, err := db.Query(`SELECT `+feedColumns+` FROM feeds WHERE user_id = ? ORDER BY LOWER(title), created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feeds for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	feeds := make([]models.Feed, 0)
+	for rows.Next() {
+		f, err := scanFeed(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan feed: %w", err)
+		}
+		feeds = append(feeds, *f)
+	}
+	return feeds, rows.Err()
+}
+
+// GetFeed returns one of the user's feeds.
+func (db *DB) GetFeed(userID int64, feedID string) (*models.Feed, error) {
+	f, err := scanFeed(db.QueryRow(`SELECT `+feedColumns+` FROM feeds WHERE id = ? AND user_id = ?`, feedID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFeedNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feed %s: %w", feedID, err)
+	}
+	return f, nil
+}
+
+// UpdateFeed changes how many episodes of a feed are kept and has the feed
+// checked again soon, which deletes the episodes over the new limit.
+func (db *DB) UpdateFeed(userID int64, feedID string, keepEpisodes int) error {
+	res, err := db.Exec(`
+        UPDATE feeds SET keep_episodes = ?, last_checked_at = NULL
+        WHERE id = ? AND user_id = ?
+    `, keepEpisodes, feedID, userID)
+	return feedAffected(res, err, feedID)
+}
+
+// RequestFeedCheck has a feed checked as soon as a poller gets to it.
+func (db *DB) RequestFeedCheck(userID int64, feedID string) error {
+	res, err := db.Exec("UPDATE feeds SET last_checked_at = NULL WHERE id = ? AND user_id = ?", feedID, userID)
+	return feedAffected(res, err, feedID)
+}
+
+// DeleteFeed unsubscribes the user from a feed. Episodes downloaded from it
+// are kept as ordinary podcasts.
+func (db *DB) DeleteFeed(userID int64, feedID string) error {
+	res, err := db.Exec("DELETE FROM feeds WHERE id = ? AND user_id = ?", feedID, userID)
+	return feedAffected(res, err, feedID)
+}
+
+// feedAffected turns the result of an update of one feed into an error,
+// ErrFeedNotFound if it matched no row.
+func feedAffected(res sql.Result, err error, feedID string) error {
+	if err != nil {
+		return fmt.Errorf("failed to update feed %s: %w", feedID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrFeedNotFound
+	}
+	return nil
+}
+
+// dueFeed matches feeds never checked, or last checked before the argument.
+const dueFeed = `(last_checked_at IS NULL OR last_checked_at <= ?)`
+
+// ClaimDueFeed picks the feed that has waited longest for a check, of those
+// not checked within interval, and records now as its check time so that no
+// other poller picks it too. Returns nil if no feed is due.
+func (db *DB) ClaimDueFeed(now time.Time, interval time.Duration) (*models.Feed, error) {
+	// As in ClaimTranscriptionJob, the condition is repeated outside the
+	// subquery for pollers racing on PostgreSQL.
+	dueBefore := now.Add(-interval)
+	f, err := scanFeed(db.QueryRow(`
+        UPDATE feeds SET last_checked_at = ?
+        WHERE id = (
+            SELECT id FROM feeds
+            WHERE `+dueFeed+`
+            ORDER BY COALESCE(last_checked_at, created_at), id
+            LIMIT 1
+        ) AND `+dueFeed+`
+        RETURNING `+feedColumns,
+		now, dueBefore, dueBefore))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim feed: %w", err)
+	}
+	return f, nil
+}
+
+// SaveFeedCheck stores the title, author, description and last error of a
+// feed after a check.
+func (db *DB) SaveFeedCheck(f *models.Feed) error {
+	_, err := db.Exec(`
+        UPDATE feeds SET title = ?, author = ?, description = ?, last_error = ?
+        WHERE id = ?
+    `, f.Title, f.Author, f.Description, f.LastError, f.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save check of feed %s: %w", f.ID, err)
+	}
+	return nil
+}
+
+// GetFeedEpisodeGUIDs returns the GUIDs of the items of a feed seen before.
+func (db *DB) GetFeedEpisodeGUIDs(feedID string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT guid FROM feed_episodes WHERE feed_id = ?", feedID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query episodes of feed %s: %w", feedID, err)
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var guid string
+		if err := rows.Scan(&guid); err != nil {
+			return nil, fmt.Errorf("failed to scan episode of feed %s: %w", feedID, err)
+		}
+		seen[guid] = true
+	}
+	return seen, rows.Err()
+}
+
+// AddFeedEpisode records an item of a feed as seen. If p is not nil, the
+// item was downloaded and p is stored as its podcast in the same transaction.
+func (db *DB) AddFeedEpisode(feedID string, e models.FeedEpisode, p *models.Podcast) error {
+	return db.WithTx(func(qs *Queries) error {
+		if p != nil {
+			if err := insertPodcast(qs.q, p); err != nil {
+				return err
+			}
+			e.PodcastID = &p.ID
+		}
+		_, err := qs.q.Exec(`
+            INSERT INTO feed_episodes (feed_id, guid, podcast_id, title, published_at, created_at)
+            VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+            ON CONFLICT(feed_id, guid) DO NOTHING
+        `, feedID, e.GUID, e.PodcastID, e.Title, e.PublishedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert episode %q of feed %s: %w", e.GUID, feedID, err)
+		}
+		return nil
+	})
+}
+
+// GetExpiredFeedPodcasts returns the IDs of the podcasts downloaded from a
+// feed beyond its newest keep ones.
+func (db *DB) GetExpiredFeedPodcasts(feedID string, keep int) ([]string, error) {
+	rows, err := db.Query(`
+        SELECT podcast_id FROM feed_episodes
+        WHERE feed_id = ? AND podcast_id IS NOT NULL
+        ORDER BY COALESCE(published_at, created_at) DESC, created_at DESC
+    `, feedID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query episodes of feed %s: %w", feedID, err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for n := 0; rows.Next(); n++ {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan episode of feed %s: %w", feedID, err)
+		}
+		if n >= keep {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+	"time"
+)
+
+// ErrLeaseLost is returned when a worker updates a job it no longer holds,
+// because its lease expired and another worker claimed it, or the podcast was deleted.
+var ErrLeaseLost = errors.New("transcription job lease lost")
+
+// ErrTranscriptionRunning is returned when re-queueing a podcast a worker is transcribing right now.
+var ErrTranscriptionRunning = errors.New("transcription is already running")
+
+// claimableJob matches queued jobs that are due and running jobs whose worker went away.
+const claimableJob = `((state = 'queued' AND run_after <= ?) OR (state = 'running' AND lease_expires_at < ?))`
+
+// EnqueueTranscription queues transcription of a podcast, resetting the job if
+// the podcast had one before, and marks the podcast queued. A running job is
+// left alone and ErrTranscriptionRunning returned.
+func (db *DB) EnqueueTranscription(userID int64, podcastID string, runAfter time.Time) error {
+	return db.WithTx(func(qs *Queries) error {
+		res, err := qs.q.Exec(`
+            INSERT INTO transcription_jobs (podcast_id, user_id, state, attempts, run_after, created_at, updated_at)
+            VALUES (?, ?, 'queued', 0, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+            ON CONFLICT(podcast_id) DO UPDATE SET
+                state = 'queued',
+                attempts = 0,
+                run_after = excluded.run_after,
+                lease_owner = NULL,
+                lease_expires_at = NULL,
+                heartbeat_at = NULL,
+                last_error = NULL,
+                updated_at = CURRENT_TIMESTAMP
+            WHERE transcription_jobs.state <> 'running';
+        `, podcastID, userID, runAfter)
+		if err != nil {
+			return fmt.Errorf("failed to enqueue transcription of podcast %s: %w", podcastID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrTranscriptionRunning
+		}
+		return setPodcastStatus(qs.q, podcastID, models.StatusQueued, nil)
+	})
+}
+
+// ClaimTranscriptionJob leases the next due job to owner until now+lease and
+// marks its podcast as transcribing. Returns nil if no job is due.
+func (db *DB) ClaimTranscriptionJob(owner string, now time.Time, lease time.Duration) (*models.TranscriptionJob, error) {
+	var job *models.TranscriptionJob
+	err := db.WithTx(func(qs *Queries) error {
+		// The condition is repeated outside the subquery so that, on PostgreSQL,
+		// a worker that lost the race for the same row re-checks it and gets nothing.
+		j := &models.TranscriptionJob{State: models.JobRunning, LeaseOwner: &owner}
+		leaseExpiresAt := now.Add(lease)
+		err := qs.q.QueryRow(`
+            UPDATE transcription_jobs
+            SET state = 'running', attempts = attempts + 1, lease_owner = ?, lease_expires_at = ?,
+                heartbeat_at = ?, updated_at = CURRENT_TIMESTAMP
+            WHERE id = (
+                SELECT id FROM transcription_jobs
+                WHERE `+claimableJob+`
+                ORDER BY run_after, id
+                LIMIT 1
+            ) AND `+claimableJob+`
+            RETURNING id, podcast_id, user_id, attempts, run_after, last_error
+        `, owner, leaseExpiresAt, now, now, now, now, now).Scan(&j.ID, &j.PodcastID, &j.UserID, &j.Attempts, &j.RunAfter, &j.LastError)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("failed to claim transcription job: %w", err)
+		}
+		j.LeaseExpiresAt = &leaseExpiresAt
+
+		if err := setPodcastStatus(qs.q, j.PodcastID, models.StatusTranscribing, nil); err != nil {
+			return err
+		}
+		job = j
+		return nil
+	})
+	return job, err
+}
+
+// HeartbeatTranscriptionJob extends the lease of a running job held by owner.
+func (db *DB) HeartbeatTranscriptionJob(jobID int64, owner string, now time.Time, lease time.Duration) error {
+	res, err := db.Exec(`
+        UPDATE transcription_jobs SET lease_expires_at = ?, heartbeat_at = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE id = ? AND state = 'running' AND lease_owner = ?
+    `, now.Add(lease), now, jobID, owner)
+	return leaseHeld(res, err, jobID)
+}
+
+// CompleteTranscriptionJob stores the transcript and finishes the job.
+func (db *DB) CompleteTranscriptionJob(job *models.TranscriptionJob, owner, finalTranscript string) error {
+	return db.WithTx(func(qs *Queries) error {
+		res, err := qs.q.Exec(`
+            UPDATE transcription_jobs
+            SET state = 'done', lease_owner = NULL, lease_expires_at = NULL, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+            WHERE id = ? AND state = 'running' AND lease_owner = ?
+        `, job.ID, owner)
+		if err := leaseHeld(res, err, job.ID); err != nil {
+			return err
+		}
+		_, err = qs.q.Exec(`
+            UPDATE podcasts SET final_transcript = ?, status = ?, error_message = NULL
+            WHERE id = ? AND user_id = ?
+        `, finalTranscript, models.StatusCompleted, job.PodcastID, job.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to store transcript for podcast %s: %w", job.PodcastID, err)
+		}
+		return nil
+	})
+}
+
+// FailTranscriptionJob finishes the job as failed and records errMsg on the podcast.
+func (db *DB) FailTranscriptionJob(job *models.TranscriptionJob, owner, errMsg string) error {
+	return db.WithTx(func(qs *Queries) error {
+		res, err := qs.q.Exec(`
+            UPDATE transcription_jobs
+            SET state = 'failed', lease_owner = NULL, lease_expires_at = NULL, last_error = ?, updated_at = CURRENT_TIMESTAMP
+            WHERE id = ? AND state = 'running' AND lease_owner = ?
+        `, errMsg, job.ID, owner)
+		if err := leaseHeld(res, err, job.ID); err != nil {
+			return err
+		}
+		return setPodcastStatus(qs.q, job.PodcastID, models.StatusFailed, &errMsg)
+	})
+}
+
+// RetryTranscriptionJob puts a failed job back in the queue to run again after
+// runAfter. The podcast shows as queued with the error of the failed attempt.
+func (db *DB) RetryTranscriptionJob(job *models.TranscriptionJob, owner, errMsg string, runAfter time.Time) error {
+	return db.WithTx(func(qs *Queries) error {
+		res, err := qs.q.Exec(`
+            UPDATE transcription_jobs
+            SET state = 'queued', run_after = ?, lease_owner = NULL, lease_expires_at = NULL, last_error = ?, updated_at = CURRENT_TIMESTAMP
+            WHERE id = ? AND state = 'running' AND lease_owner = ?
+        `, runAfter, errMsg, job.ID, owner)
+		if err := leaseHeld(res, err, job.ID); err != nil {
+			return err
+		}
+		return setPodcastStatus(qs.q, job.PodcastID, models.StatusQueued, &errMsg)
+	})
+}
+
+// ReleaseTranscriptionJob hands a running job back to the queue without
+// counting the attempt, e.g. when the worker is shutting down.
+func (db *DB) ReleaseTranscriptionJob(job *models.TranscriptionJob, owner string) error {
+	return db.WithTx(func(qs *Queries) error {
+		res, err := qs.q.Exec(`
+            UPDATE transcription_jobs
+            SET state = 'queued', attempts = attempts - 1, lease_owner = NULL, lease_expires_at = NULL, updated_at = CURRENT_TIMESTAMP
+            WHERE id = ? AND state = 'running' AND lease_owner = ?
+        `, job.ID, owner)
+		if err := leaseHeld(res, err, job.ID); err != nil {
+			return err
+		}
+		return setPodcastStatus(qs.q, job.PodcastID, models.StatusQueued, nil)
+	})
+}
+
+// ImportTranscript stores a transcript that didn't come from the job queue,
+// e.g. uploaded subtitles, and completes the podcast. A queued or failed job
+// for the podcast is closed so it won't overwrite the transcript; a running
+// one makes this fail with ErrTranscriptionRunning.
+func (db *DB) ImportTranscript(userID int64, podcastID, finalTranscript string) error {
+	return db.WithTx(func(qs *Queries) error {
+		var state string
+		err := qs.q.QueryRow("SELECT state FROM transcription_jobs WHERE podcast_id = ?", podcastID).Scan(&state)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return fmt.Errorf("failed to look up transcription job of podcast %s: %w", podcastID, err)
+		case state == string(models.JobRunning):
+			return ErrTranscriptionRunning
+		default:
+			_, err = qs.q.Exec(`
+                UPDATE transcription_jobs SET state = 'done', last_error = NULL, updated_at = CURRENT_TIMESTAMP
+                WHERE podcast_id = ?
+            `, podcastID)
+			if err != nil {
+				return fmt.Errorf("failed to close transcription job of podcast %s: %w", podcastID, err)
+			}
+		}
+
+		res, err := qs.q.Exec(`
+            UPDATE podcasts SET final_transcript = ?, status = ?, error_message = NULL
+            WHERE id = ? AND user_id = ?
+        `, finalTranscript, models.StatusCompleted, podcastID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to store transcript for podcast %s: %w", podcastID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("podcast %s not found for user %d", podcastID, userID)
+		}
+		return nil
+	})
+}
+
+// RecoverTranscriptionJobs runs on boot. It re-queues jobs whose lease expired
+// and creates jobs for podcasts left in a processing state without one (uploaded
+// before the job queue existed). Returns the number of jobs queued.
+func (db *DB) RecoverTranscriptionJobs(now time.Time) (int64, error) {
+	var recovered int64
+	err := db.WithTx(func(qs *Queries) error {
+		res, err := qs.q.Exec(`
+            UPDATE transcription_jobs
+            SET state = 'queued', lease_owner = NULL, lease_expires_at = NULL, updated_at = CURRENT_TIMESTAMP
+            WHERE state = 'running' AND lease_expires_at < ?
+        `, now)
+		if err != nil {
+			return fmt.Errorf("failed to recover expired transcription jobs: %w", err)
+		}
+		expired, _ := res.RowsAffected()
+
+		res, err = qs.q.Exec(`
+            INSERT INTO transcription_jobs (podcast_id, user_id, state, attempts, run_after, created_at, updated_at)
+            SELECT p.id, p.user_id, 'queued', 0, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+            FROM podcasts p
+            WHERE p.status IN ('uploaded', 'queued', 'transcribing')
+              AND p.media_type = 'audio' -- Video lessons are never transcribed
+              AND NOT EXISTS (SELECT 1 FROM transcription_jobs j WHERE j.podcast_id = p.id)
+        `, now)
+		if err != nil {
+			return fmt.Errorf("failed to queue orphaned podcasts: %w", err)
+		}
+		orphaned, _ := res.RowsAffected()
+
+		_, err = qs.q.Exec(`
+            UPDATE podcasts SET status = 'queued'
+            WHERE status IN ('uploaded', 'transcribing')
+              AND id IN (SELECT podcast_id FROM transcription_jobs WHERE state = 'queued')
+        `)
+		if err != nil {
+			return fmt.Errorf("failed to reset podcast statuses: %w", err)
+		}
+		recovered = expired + orphaned
+		return nil
+	})
+	return recovered, err
+}
+
+func setPodcastStatus(q Querier, podcastID string, status models.PodcastStatus, errMsg *string) error {
+	_, err := q.Exec("UPDATE podcasts SET status = ?, error_message = ? WHERE id = ?", status, errMsg, podcastID)
+	if err != nil {
+		return fmt.Errorf("failed to set status of podcast %s to %s: %w", podcastID, status, err)
+	}
+	return nil
+}
+
+// leaseHeld turns an UPDATE guarded by lease_owner that touched no rows into ErrLeaseLost.
+func leaseHeld(res sql.Result, err error, jobID int64) error {
+	if err != nil {
+		return fmt.Errorf("failed to update transcription job %d: %w", jobID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migration is a single numbered schema change.
+// Up is applied when migrating forward and Down when rolling back. Changes that
+// cannot be expressed in plain SQL (e.g. adding a column only if it is missing)
+// use UpFunc/DownFunc instead; when both are set, the SQL runs first.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	UpFunc   func(tx *Tx) error
+	DownFunc func(tx *Tx) error
+	// FuncRevision stands in for the code of UpFunc and DownFunc in the
+	// checksum, which can't hash it. Bump it whenever either changes.
+	FuncRevision int
+}
+
+// Checksum identifies the content of a migration. It is stored alongside the
+// version so that edits to an already-applied migration are detected on startup.
+func (m Migration) Checksum() string {
+	content := m.Name + "\n" + strings.TrimSpace(m.Up) + "\n--\n" + strings.TrimSpace(m.Down)
+	if m.UpFunc != nil || m.DownFunc != nil {
+		content += fmt.Sprintf("\n--\nup func: %t, down func: %t, revision %d", m.UpFunc != nil, m.DownFunc != nil, m.FuncRevision)
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// legacyChecksum is the checksum recorded before Down and the functions were
+// covered. Migrate replaces it with Checksum.
+func (m Migration) legacyChecksum() string {
+	sum := sha256.Sum256([]byte(m.Name + "\n" + strings.TrimSpace(m.Up)))
+	return hex.EncodeToString(sum[:])
+}
+
+// AppliedMigration is a row of the schema_migrations table.
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+const createMigrationsTable = `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            checksum TEXT NOT NULL,
+            applied_at TIMESTAMP NOT NULL
+        );`
+
+// Migrate applies all pending migrations in version order, each in its own transaction.
+// It refuses to run if an applied migration was modified or if the database has
+// migrations this binary does not know about.
+func Migrate(db *DB, migrations []Migration) error {
+	if err := validateMigrations(migrations); err != nil {
+		return err
+	}
+	unlock, err := db.dialect.lockMigrations(db.DB)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer unlock()
+
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	if err := verifyApplied(applied, migrations); err != nil {
+		return err
+	}
+	if err := upgradeChecksums(db, applied, migrations); err != nil {
+		return err
+	}
+
+	appliedSet := make(map[int]bool, len(applied))
+	for _, a := range applied {
+		appliedSet[a.Version] = true
+	}
+
+	for _, m := range migrations {
+		if appliedSet[m.Version] {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	return nil
+}
+
+// MigrateDown rolls back applied migrations in reverse order until the schema
+// is at targetVersion. A target of 0 rolls back everything.
+func MigrateDown(db *DB, migrations []Migration, targetVersion int) error {
+	if err := validateMigrations(migrations); err != nil {
+		return err
+	}
+	unlock, err := db.dialect.lockMigrations(db.DB)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer unlock()
+
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	if err := verifyApplied(applied, migrations); err != nil {
+		return err
+	}
+
+	byVersion := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	for i := len(applied) - 1; i >= 0; i-- {
+		if applied[i].Version <= targetVersion {
+			break
+		}
+		m := byVersion[applied[i].Version]
+		if err := revertMigration(db, m); err != nil {
+			return err
+		}
+		log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for an empty database.
+func SchemaVersion(db *DB) (int, error) {
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) == 0 {
+		return 0, nil
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// AppliedMigrations lists the rows of schema_migrations ordered by version,
+// creating the table first if the database has never been migrated.
+func AppliedMigrations(db *DB) ([]AppliedMigration, error) {
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	rows, err := db.Query("SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var applied []AppliedMigration
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied = append(applied, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+func validateMigrations(migrations []Migration) error {
+	if !sort.SliceIsSorted(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version }) {
+		return errors.New("migrations must be listed in ascending version order")
+	}
+	seen := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		if m.Version <= 0 {
+			return fmt.Errorf("migration %q has invalid version %d", m.Name, m.Version)
+		}
+		if seen[m.Version] {
+			return fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+		if m.Up == "" && m.UpFunc == nil {
+			return fmt.Errorf("migration %04d_%s has no up step", m.Version, m.Name)
+		}
+		if (m.UpFunc != nil || m.DownFunc != nil) && m.FuncRevision <= 0 {
+			return fmt.Errorf("migration %04d_%s has functions but no FuncRevision", m.Version, m.Name)
+		}
+		seen[m.Version] = true
+	}
+	return nil
+}
+
+func verifyApplied(applied []AppliedMigration, migrations []Migration) error {
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	for _, a := range applied {
+		m, ok := known[a.Version]
+		if !ok {
+			return fmt.Errorf("database has migration %04d_%s which this build does not know about", a.Version, a.Name)
+		}
+		if a.Checksum != m.Checksum() && a.Checksum != m.legacyChecksum() {
+			return fmt.Errorf("checksum mismatch for applied migration %04d_%s: it was modified after being applied", a.Version, a.Name)
+		}
+	}
+	return nil
+}
+
+// upgradeChecksums replaces legacy checksums of applied migrations, so that
+// later edits to their Down steps and functions are detected too.
+func upgradeChecksums(db *DB, applied []AppliedMigration, migrations []Migration) error {
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	for _, a := range applied {
+		m := known[a.Version]
+		if a.Checksum == m.Checksum() {
+			continue
+		}
+		if _, err := db.Exec("UPDATE schema_migrations SET checksum = ? WHERE version = ?", m.Checksum(), m.Version); err != nil {
+			return fmt.Errorf("migration %04d_%s: failed to update checksum: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %04d_%s: failed to begin transaction: %w", m.Version, m.Name, err)
+	}
+	defer tx.Rollback()
+
+	if m.Up != "" {
+		if _, err := tx.Exec(m.Up); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+	if m.UpFunc != nil {
+		if err := m.UpFunc(tx); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+		m.Version, m.Name, m.Checksum(), time.Now().UTC()); err != nil {
+		return fmt.Errorf("migration %04d_%s: failed to record version: %w", m.Version, m.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %04d_%s: failed to commit: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+func revertMigration(db *DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %04d_%s: failed to begin transaction: %w", m.Version, m.Name, err)
+	}
+	defer tx.Rollback()
+
+	if m.Down != "" {
+		if _, err := tx.Exec(m.Down); err != nil {
+			return fmt.Errorf("rollback of migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+	if m.DownFunc != nil {
+		if err := m.DownFunc(tx); err != nil {
+			return fmt.Errorf("rollback of migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+		return fmt.Errorf("migration %04d_%s: failed to remove version record: %w", m.Version, m.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %04d_%s: failed to commit rollback: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrateUpDownUp(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	want := schemaOf(t, db)
+	latest := db.Migrations()[len(db.Migrations())-1].Version
+	if v, err := SchemaVersion(db); err != nil || v != latest {
+		t.Fatalf("SchemaVersion = %d, %v; want %d", v, err, latest)
+	}
+
+	if err := db.MigrateDown(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := schemaOf(t, db); len(got) != 1 || !strings.Contains(got[0], "schema_migrations") {
+		t.Errorf("schema after rolling back everything = %q, want only schema_migrations", got)
+	}
+
+	// Up again, twice: the second run has nothing to do.
+	for i := 0; i < 2; i++ {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatal(err)
+		}
+		if got := schemaOf(t, db); !reflect.DeepEqual(got, want) {
+			t.Errorf("schema after up/down/up differs:\n%q\nwant:\n%q", got, want)
+		}
+	}
+}
+
+func TestMigrateDownOrder(t *testing.T) {
+	db := openTestDB(t)
+	migrations := testMigrations()
+	if err := Migrate(db, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateDown(db, migrations, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := logOf(t, db), []string{"up 2", "up 3", "down 3", "down 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+	if v, err := SchemaVersion(db); err != nil || v != 1 {
+		t.Errorf("SchemaVersion = %d, %v; want 1", v, err)
+	}
+
+	// Only the rolled back migrations are applied again.
+	if err := Migrate(db, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := logOf(t, db), []string{"up 2", "up 3", "down 3", "down 2", "up 2", "up 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	db := openTestDB(t)
+	migrations := testMigrations()
+	migrations[2].Up = `INSERT INTO migration_log (entry) VALUES ('up 3'); INSERT INTO missing_table VALUES (1);`
+	if err := Migrate(db, migrations); err == nil || !strings.Contains(err.Error(), "0003_third failed") {
+		t.Fatalf("Migrate err = %v, want the failure of 0003_third", err)
+	}
+	if got, want := logOf(t, db), []string{"up 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+	if v, err := SchemaVersion(db); err != nil || v != 2 {
+		t.Errorf("SchemaVersion = %d, %v; want 2", v, err)
+	}
+}
+
+func TestMigrateChecksumMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *Migration)
+	}{
+		{"up", func(m *Migration) { m.Up += " -- edited" }},
+		{"down", func(m *Migration) { m.Down = "" }},
+		{"name", func(m *Migration) { m.Name = "renamed" }},
+		{"func revision", func(m *Migration) { m.FuncRevision++ }},
+		{"func removed", func(m *Migration) { m.UpFunc = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			if err := Migrate(db, testMigrations()); err != nil {
+				t.Fatal(err)
+			}
+			migrations := testMigrations()
+			tt.modify(&migrations[1])
+			if err := Migrate(db, migrations); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+				t.Errorf("Migrate err = %v, want a checksum mismatch", err)
+			}
+			if err := MigrateDown(db, migrations, 0); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+				t.Errorf("MigrateDown err = %v, want a checksum mismatch", err)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyChecksum(t *testing.T) {
+	db := openTestDB(t)
+	migrations := testMigrations()
+	if err := Migrate(db, migrations); err != nil {
+		t.Fatal(err)
+	}
+	legacy := migrations[2].legacyChecksum()
+	if _, err := db.Exec("UPDATE schema_migrations SET checksum = ? WHERE version = 3", legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db, migrations); err != nil {
+		t.Fatalf("Migrate with a legacy checksum: %v", err)
+	}
+	var checksum string
+	if err := db.QueryRow("SELECT checksum FROM schema_migrations WHERE version = 3").Scan(&checksum); err != nil {
+		t.Fatal(err)
+	}
+	if checksum != migrations[2].Checksum() {
+		t.Errorf("checksum = %s, want it upgraded to %s", checksum, migrations[2].Checksum())
+	}
+}
+
+func TestMigrateUnknownVersion(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db, testMigrations()); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db, testMigrations()[:2]); err == nil || !strings.Contains(err.Error(), "does not know about") {
+		t.Errorf("Migrate err = %v, want an unknown migration", err)
+	}
+}
+
+func TestMigrateLocks(t *testing.T) {
+	lock := &recordingDialect{dialect: sqliteDialect{}}
+	db := openTestDB(t)
+	db.dialect = lock
+
+	if err := Migrate(db, testMigrations()); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateDown(db, testMigrations(), 0); err != nil {
+		t.Fatal(err)
+	}
+	migrations := testMigrations()
+	migrations[1].Up = "NOT SQL"
+	if err := Migrate(db, migrations); err == nil {
+		t.Fatal("Migrate of broken SQL succeeded")
+	}
+	if lock.locked != 3 || lock.unlocked != 3 {
+		t.Errorf("locked %d and unlocked %d times, want 3 each", lock.locked, lock.unlocked)
+	}
+
+	lock.err = errors.New("busy")
+	if err := Migrate(db, testMigrations()); !errors.Is(err, lock.err) {
+		t.Errorf("Migrate err = %v, want the lock error", err)
+	}
+	if logOf(t, db) != nil {
+		t.Error("migrations ran without the lock")
+	}
+}
+
+func TestValidateMigrations(t *testing.T) {
+	noop := func(*Tx) error { return nil }
+	tests := []struct {
+		name       string
+		migrations []Migration
+		want       string
+	}{
+		{"out of order", []Migration{{Version: 2, Name: "b", Up: "x"}, {Version: 1, Name: "a", Up: "x"}}, "ascending"},
+		{"duplicate", []Migration{{Version: 1, Name: "a", Up: "x"}, {Version: 1, Name: "b", Up: "x"}}, "duplicate"},
+		{"zero version", []Migration{{Version: 0, Name: "a", Up: "x"}}, "invalid version"},
+		{"no up step", []Migration{{Version: 1, Name: "a", Down: "x"}}, "no up step"},
+		{"func without revision", []Migration{{Version: 1, Name: "a", UpFunc: noop}}, "no FuncRevision"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMigrations(tt.migrations); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if err := validateMigrations(sqliteMigrations); err != nil {
+		t.Errorf("SQLite migrations: %v", err)
+	}
+	if err := validateMigrations(postgresMigrations); err != nil {
+		t.Errorf("PostgreSQL migrations: %v", err)
+	}
+}
+
+// testMigrations creates a log table and records every step after that in it.
+func testMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "log",
+			Up:      `CREATE TABLE migration_log (id INTEGER PRIMARY KEY AUTOINCREMENT, entry TEXT NOT NULL);`,
+			Down:    `DROP TABLE migration_log;`,
+		},
+		{
+			Version:      2,
+			Name:         "second",
+			Up:           `INSERT INTO migration_log (entry) VALUES ('up 2');`,
+			Down:         `INSERT INTO migration_log (entry) VALUES ('down 2');`,
+			FuncRevision: 1,
+			UpFunc:       func(tx *Tx) error { return nil },
+		},
+		{
+			Version: 3,
+			Name:    "third",
+			Up:      `INSERT INTO migration_log (entry) VALUES ('up 3');`,
+			Down:    `INSERT INTO migration_log (entry) VALUES ('down 3');`,
+		},
+	}
+}
+
+// openTestDB opens an empty SQLite database in a temporary directory.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// schemaOf lists the SQL of the tables and indexes in db.
+func schemaOf(t *testing.T, db *DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var schema []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		schema = append(schema, s)
+	}
+	return schema
+}
+
+// logOf returns the entries of the log table of testMigrations, or nil if
+// there is none.
+func logOf(t *testing.T, db *DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT entry FROM migration_log ORDER BY id")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var entries []string
+	for rows.Next() {
+		var e string
+		if err := rows.Scan(&e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// recordingDialect counts migration locks, or fails to take them with err.
+type recordingDialect struct {
+	dialect
+	err              error
+	locked, unlocked int
+}
+
+func (d *recordingDialect) lockMigrations(db *sql.DB) (func(), error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	d.locked++
+	return func() { d.unlocked++ }, nil
+}
@@ -0,0 +1,509 @@
+package database
+
+import "fmt"
+
+// sqliteMigrations is the ordered list of schema changes for the SQLite backend.
+// Never edit a migration once it has shipped; add a new one instead.
+var sqliteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		// Uses IF NOT EXISTS so databases created before the migration engine
+		// existed are adopted without error.
+		Up: `
+        CREATE TABLE IF NOT EXISTS users (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            username TEXT UNIQUE NOT NULL,
+            password_hash TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE TABLE IF NOT EXISTS user_sessions (
+            session_id TEXT PRIMARY KEY,
+            user_id INTEGER NOT NULL,
+            expiry DATETIME NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+        CREATE INDEX IF NOT EXISTS idx_user_sessions_expiry ON user_sessions(expiry);
+
+        CREATE TABLE IF NOT EXISTS user_settings (
+            user_id INTEGER PRIMARY KEY,
+            gemini_api_key TEXT,
+            dict_base_url TEXT DEFAULT 'https://slovniky.lingea.sk/anglicko-slovensky/',
+            allow_fragment_url_list TEXT DEFAULT 'https://www.nytimes.com/,https://developer.mozilla.org/', -- comma-separated
+            words_number_limit INTEGER DEFAULT 4,
+            words_length_limit INTEGER DEFAULT 50,
+            highlight_color TEXT DEFAULT 'rgba(210, 210, 10, 0.4)',
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+
+        CREATE TABLE IF NOT EXISTS entries (
+            uuid TEXT NOT NULL,
+            user_id INTEGER NOT NULL,
+            word TEXT NOT NULL,
+            forms_pipe_separated TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (user_id, uuid), -- Composite key: entry UUID is unique per user
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+        CREATE INDEX IF NOT EXISTS idx_entries_user_word ON entries(user_id, word);
+
+        CREATE TABLE IF NOT EXISTS urls (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL,
+            url_hash TEXT NOT NULL,
+            url TEXT NOT NULL,
+            title TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (user_id, url_hash),
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+
+        CREATE TABLE IF NOT EXISTS paragraphs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL,
+            paragraph_hash TEXT NOT NULL,
+            text TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (user_id, paragraph_hash),
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+
+        CREATE TABLE IF NOT EXISTS relations (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL,
+            entry_uuid TEXT NOT NULL,
+            url_hash TEXT NOT NULL,
+            paragraph_hash TEXT NOT NULL,
+            transcript_segment_ref TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (user_id, entry_uuid, url_hash, paragraph_hash), -- Ensure unique relation per user
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+            FOREIGN KEY (user_id, entry_uuid) REFERENCES entries(user_id, uuid) ON DELETE CASCADE
+            -- No FK constraints on url_hash/paragraph_hash to allow flexibility, handled in logic
+        );
+        CREATE INDEX IF NOT EXISTS idx_relations_user_entry ON relations(user_id, entry_uuid);
+        CREATE INDEX IF NOT EXISTS idx_relations_user_updated ON relations(user_id, updated_at);
+
+        CREATE TABLE IF NOT EXISTS podcasts (
+            id TEXT PRIMARY KEY,                        -- UUID v4
+            user_id INTEGER NOT NULL,
+            filename TEXT NOT NULL,                     -- Original filename from upload
+            store_path TEXT UNIQUE NOT NULL,            -- Relative path on server filesystem
+            producer TEXT NOT NULL,
+            series TEXT NOT NULL,
+            episode TEXT NOT NULL,
+            description TEXT,                           -- Optional episode description
+            original_transcript TEXT,                   -- Optional provided transcript
+            final_transcript TEXT,                      -- Generated JSON transcript (nullable initially)
+            upload_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+            status TEXT NOT NULL DEFAULT 'uploaded' CHECK(status IN ('uploaded', 'transcribing', 'completed', 'failed')),
+            error_message TEXT,                         -- Store error message on failure
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+        CREATE INDEX IF NOT EXISTS idx_podcasts_user_status ON podcasts(user_id, status);
+        CREATE INDEX IF NOT EXISTS idx_podcasts_user_upload_time ON podcasts(user_id, upload_time);
+        `,
+		Down: `
+        DROP TABLE IF EXISTS podcasts;
+        DROP TABLE IF EXISTS relations;
+        DROP TABLE IF EXISTS paragraphs;
+        DROP TABLE IF EXISTS urls;
+        DROP TABLE IF EXISTS entries;
+        DROP TABLE IF EXISTS user_settings;
+        DROP TABLE IF EXISTS user_sessions;
+        DROP TABLE IF EXISTS users;
+        `,
+	},
+	{
+		Version: 2,
+		Name:    "backfill_late_columns",
+		// Databases created by the old createSchema never received columns that
+		// were added to the CREATE TABLE statements later on.
+		FuncRevision: 1,
+		UpFunc: func(tx *Tx) error {
+			columns := []struct{ table, column, decl string }{
+				{"user_settings", "dict_base_url", "TEXT DEFAULT 'https://slovniky.lingea.sk/anglicko-slovensky/'"},
+				{"user_settings", "allow_fragment_url_list", "TEXT DEFAULT 'https://www.nytimes.com/,https://developer.mozilla.org/'"},
+				{"user_settings", "words_number_limit", "INTEGER DEFAULT 4"},
+				{"user_settings", "words_length_limit", "INTEGER DEFAULT 50"},
+				{"user_settings", "highlight_color", "TEXT DEFAULT 'rgba(210, 210, 10, 0.4)'"},
+				{"relations", "transcript_segment_ref", "TEXT"},
+				{"podcasts", "error_message", "TEXT"},
+			}
+			for _, c := range columns {
+				if err := sqliteAddColumnIfMissing(tx, c.table, c.column, c.decl); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_relations_transcript_segment_ref ON relations(transcript_segment_ref);")
+			return err
+		},
+		// The columns are part of the initial schema, so rolling back only drops the index.
+		Down: `DROP INDEX IF EXISTS idx_relations_transcript_segment_ref;`,
+	},
+	{
+		Version: 3,
+		Name:    "forms_provider_settings",
+		Up: `
+        ALTER TABLE user_settings ADD COLUMN forms_provider TEXT DEFAULT 'gemini';
+        ALTER TABLE user_settings ADD COLUMN openai_base_url TEXT;
+        ALTER TABLE user_settings ADD COLUMN openai_model TEXT;
+        ALTER TABLE user_settings ADD COLUMN openai_api_key TEXT;
+        `,
+		Down: `
+        ALTER TABLE user_settings DROP COLUMN openai_api_key;
+        ALTER TABLE user_settings DROP COLUMN openai_model;
+        ALTER TABLE user_settings DROP COLUMN openai_base_url;
+        ALTER TABLE user_settings DROP COLUMN forms_provider;
+        `,
+	},
+	{
+		Version: 4,
+		Name:    "word_forms_cache",
+		Up: `
+        CREATE TABLE word_forms_cache (
+            language TEXT NOT NULL,
+            word TEXT NOT NULL, -- Normalized: lower case, single spaces
+            forms_pipe_separated TEXT NOT NULL,
+            provider TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            expires_at DATETIME NOT NULL,
+            PRIMARY KEY (language, word)
+        );
+        CREATE INDEX idx_word_forms_cache_expires_at ON word_forms_cache(expires_at);
+        `,
+		Down: `DROP TABLE IF EXISTS word_forms_cache;`,
+	},
+	{
+		Version: 5,
+		Name:    "transcription_jobs",
+		// SQLite cannot alter a CHECK constraint, so podcasts is rebuilt to allow 'queued'.
+		Up: sqliteRebuildPodcasts(`'uploaded', 'queued', 'transcribing', 'completed', 'failed'`) + `
+        CREATE TABLE transcription_jobs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            podcast_id TEXT UNIQUE NOT NULL,            -- One job per podcast, re-queued in place
+            user_id INTEGER NOT NULL,
+            state TEXT NOT NULL DEFAULT 'queued' CHECK(state IN ('queued', 'running', 'done', 'failed')),
+            attempts INTEGER NOT NULL DEFAULT 0,
+            run_after DATETIME NOT NULL,                -- Not claimed before this time
+            lease_owner TEXT,                           -- Worker holding the job while running
+            lease_expires_at DATETIME,                  -- Job is up for grabs again after this
+            heartbeat_at DATETIME,
+            last_error TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (podcast_id) REFERENCES podcasts(id) ON DELETE CASCADE,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+        CREATE INDEX idx_transcription_jobs_state_run_after ON transcription_jobs(state, run_after);
+        `,
+		Down: `DROP TABLE IF EXISTS transcription_jobs;
+        UPDATE podcasts SET status = 'uploaded' WHERE status = 'queued';
+        ` + sqliteRebuildPodcasts(`'uploaded', 'transcribing', 'completed', 'failed'`),
+	},
+	{
+		Version: 6,
+		Name:    "srs_review_state",
+		Up: `
+        CREATE TABLE srs_review_state (
+            user_id INTEGER NOT NULL,
+            entry_uuid TEXT NOT NULL,
+            ease REAL NOT NULL DEFAULT 2.5,
+            interval_days INTEGER NOT NULL DEFAULT 0,
+            repetitions INTEGER NOT NULL DEFAULT 0,
+            lapses INTEGER NOT NULL DEFAULT 0,
+            due_at DATETIME NOT NULL,
+            last_reviewed_at DATETIME,
+            last_grade INTEGER NOT NULL DEFAULT 0,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (user_id, entry_uuid),
+            FOREIGN KEY (user_id, entry_uuid) REFERENCES entries(user_id, uuid) ON DELETE CASCADE
+        );
+        CREATE INDEX idx_srs_review_state_user_due ON srs_review_state(user_id, due_at);
+        `,
+		Down: `DROP TABLE IF EXISTS srs_review_state;`,
+	},
+	{
+		Version: 7,
+		Name:    "dictionaries",
+		// Existing words go to a "Default" dictionary per user. Empty languages,
+		// URL and color fall back to the server's language and the user's settings.
+		Up: `
+        CREATE TABLE dictionaries (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            source_language TEXT NOT NULL DEFAULT '',   -- Language of the marked words
+            target_language TEXT NOT NULL DEFAULT '',   -- Language they are looked up in
+            dict_base_url TEXT NOT NULL DEFAULT '',
+            highlight_color TEXT NOT NULL DEFAULT '',
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (user_id, name),
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+        INSERT INTO dictionaries (user_id, name) SELECT id, 'Default' FROM users;
+
+        ALTER TABLE entries ADD COLUMN dictionary_id INTEGER; -- Set by the application, never NULL once written
+        UPDATE entries SET dictionary_id = (SELECT d.id FROM dictionaries d WHERE d.user_id = entries.user_id);
+        CREATE INDEX idx_entries_user_dictionary ON entries(user_id, dictionary_id);
+
+        ALTER TABLE user_settings ADD COLUMN active_dictionary_id INTEGER;
+        `,
+		Down: `
+        ALTER TABLE user_settings DROP COLUMN active_dictionary_id;
+        DROP INDEX IF EXISTS idx_entries_user_dictionary;
+        ALTER TABLE entries DROP COLUMN dictionary_id;
+        DROP TABLE IF EXISTS dictionaries;
+        `,
+	},
+	{
+		Version: 8,
+		Name:    "articles",
+		Up: `
+        CREATE TABLE articles (
+            id TEXT PRIMARY KEY,                        -- UUID v4
+            user_id INTEGER NOT NULL,
+            url TEXT NOT NULL,                          -- Page the article was captured from, or /read/{id}
+            url_hash TEXT NOT NULL,                     -- SHA-256 of url, as in urls
+            title TEXT NOT NULL,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+        CREATE INDEX idx_articles_user_created ON articles(user_id, created_at);
+
+        CREATE TABLE article_paragraphs (
+            article_id TEXT NOT NULL,
+            position INTEGER NOT NULL,                  -- 0-based, in document order
+            paragraph_hash TEXT NOT NULL,               -- SHA-256 of text, as in paragraphs
+            text TEXT NOT NULL,
+            PRIMARY KEY (article_id, position),
+            FOREIGN KEY (article_id) REFERENCES articles(id) ON DELETE CASCADE
+        );
+        `,
+		Down: `
+        DROP TABLE IF EXISTS article_paragraphs;
+        DROP TABLE IF EXISTS articles;
+        `,
+	},
+	{
+		Version: 9,
+		Name:    "books",
+		Up: `
+        CREATE TABLE books (
+            id TEXT PRIMARY KEY,                        -- UUID v4
+            user_id INTEGER NOT NULL,
+            filename TEXT NOT NULL,                     -- Original filename from upload
+            title TEXT NOT NULL,
+            author TEXT NOT NULL DEFAULT '',
+            language TEXT NOT NULL DEFAULT '',
+            position_chapter INTEGER NOT NULL DEFAULT 0, -- Reading position
+            position_paragraph INTEGER NOT NULL DEFAULT 0,
+            position_updated_at DATETIME,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+        CREATE INDEX idx_books_user_created ON books(user_id, created_at);
+
+        CREATE TABLE book_chapters (
+            book_id TEXT NOT NULL,
+            chapter_index INTEGER NOT NULL,             -- 0-based, in reading order
+            user_id INTEGER NOT NULL,
+            title TEXT NOT NULL,
+            url TEXT NOT NULL,                          -- /books/read/{book_id}/{chapter_index}
+            url_hash TEXT NOT NULL,                     -- SHA-256 of url, as in urls
+            PRIMARY KEY (book_id, chapter_index),
+            FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+        );
+        CREATE INDEX idx_book_chapters_user_url_hash ON book_chapters(user_id, url_hash);
+
+        -- Text is in paragraphs, kept there while a book references it
+        CREATE TABLE book_paragraphs (
+            book_id TEXT NOT NULL,
+            chapter_index INTEGER NOT NULL,
+            position INTEGER NOT NULL,                  -- 0-based, in document order
+            user_id INTEGER NOT NULL,
+            paragraph_hash TEXT NOT NULL,
+            PRIMARY KEY (book_id, chapter_index, position),
+            FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+        );
+        CREATE INDEX idx_book_paragraphs_user_hash ON book_paragraphs(user_id, paragraph_hash);
+        `,
+		Down: `
+        DROP TABLE IF EXISTS book_paragraphs;
+        DROP TABLE IF EXISTS book_chapters;
+        DROP TABLE IF EXISTS books;
+        `,
+	},
+	{
+		Version: 10,
+		Name:    "podcast_media_type",
+		Up: `
+        ALTER TABLE podcasts ADD COLUMN media_type TEXT NOT NULL DEFAULT 'audio'; -- 'audio' or 'video'
+        `,
+		Down: `
+        ALTER TABLE podcasts DROP COLUMN media_type;
+        `,
+	},
+	{
+		Version: 11,
+		Name:    "feeds",
+		Up: `
+        CREATE TABLE feeds (
+            id TEXT PRIMARY KEY,                        -- UUID v4
+            user_id INTEGER NOT NULL,
+            url TEXT NOT NULL,
+            title TEXT NOT NULL DEFAULT '',             -- From the feed, used as the series
+            author TEXT NOT NULL DEFAULT '',            -- From the feed, used as the producer
+            description TEXT NOT NULL DEFAULT '',
+            keep_episodes INTEGER NOT NULL DEFAULT 5,   -- Older episodes are deleted
+            last_checked_at DATETIME,                   -- NULL: check as soon as possible
+            last_error TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (user_id, url),
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+        CREATE INDEX idx_feeds_last_checked_at ON feeds(last_checked_at);
+
+        -- Every item seen, so that skipped and deleted episodes are not downloaded again
+        CREATE TABLE feed_episodes (
+            feed_id TEXT NOT NULL,
+            guid TEXT NOT NULL,
+            podcast_id TEXT,                            -- NULL if skipped or deleted
+            title TEXT NOT NULL DEFAULT '',
+            published_at DATETIME,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (feed_id, guid),
+            FOREIGN KEY (feed_id) REFERENCES feeds(id) ON DELETE CASCADE,
+            FOREIGN KEY (podcast_id) REFERENCES podcasts(id) ON DELETE SET NULL
+        );
+        CREATE INDEX idx_feed_episodes_podcast ON feed_episodes(podcast_id);
+        `,
+		Down: `
+        DROP TABLE IF EXISTS feed_episodes;
+        DROP TABLE IF EXISTS feeds;
+        `,
+	},
+	{
+		Version: 12,
+		Name:    "podcast_store_keys",
+		// store_path held the path of the file under the upload directory;
+		// it now holds the blob key "{user id}/{podcast id}{ext}", which is
+		// the same for every storage backend.
+		Up: `
+        UPDATE podcasts SET store_path = CAST(user_id AS TEXT) || '/' || substr(store_path, instr(store_path, id))
+        WHERE instr(store_path, id) > 0;
+        `,
+		// Lossy: the upload directory isn't part of the key, so Down
+		// restores paths under the default "uploads/" directory. Move the
+		// files there, or fix store_path, if storage.upload_dir differed.
+		Down: `
+        UPDATE podcasts SET store_path = 'uploads/' || store_path
+        WHERE store_path LIKE CAST(user_id AS TEXT) || '/' || id || '%';
+        `,
+	},
+	{
+		Version: 13,
+		Name:    "upload_sessions",
+		Up: `
+        CREATE TABLE upload_sessions (
+            id TEXT PRIMARY KEY,                        -- UUID v4, in the upload URL
+            user_id INTEGER NOT NULL,
+            filename TEXT NOT NULL,
+            length INTEGER NOT NULL,                    -- Declared size in bytes
+            upload_offset INTEGER NOT NULL DEFAULT 0,   -- Bytes received so far
+            producer TEXT NOT NULL,
+            series TEXT NOT NULL,
+            episode TEXT NOT NULL,
+            description TEXT,
+            original_transcript TEXT,
+            podcast_id TEXT,                            -- Set once the parts are assembled
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            expires_at DATETIME NOT NULL,               -- Extended by every chunk
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+            FOREIGN KEY (podcast_id) REFERENCES podcasts(id) ON DELETE SET NULL
+        );
+        CREATE INDEX idx_upload_sessions_expires_at ON upload_sessions(expires_at);
+
+        -- Chunks received, each stored as a blob until the upload is assembled
+        CREATE TABLE upload_parts (
+            session_id TEXT NOT NULL,
+            part_offset INTEGER NOT NULL,
+            size INTEGER NOT NULL,
+            store_key TEXT NOT NULL,
+            PRIMARY KEY (session_id, part_offset),
+            FOREIGN KEY (session_id) REFERENCES upload_sessions(id) ON DELETE CASCADE
+        );
+        `,
+		Down: `
+        DROP TABLE IF EXISTS upload_parts;
+        DROP TABLE IF EXISTS upload_sessions;
+        `,
+	},
+	{
+		Version: 14,
+		Name:    "unshared_word_forms",
+		// Only Gemini results are shared now; forms from user-chosen
+		// OpenAI-compatible servers are dropped. They are looked up again.
+		Up: `
+        DELETE FROM word_forms_cache WHERE provider <> 'gemini';
+        `,
+	},
+}
+
+// sqliteRebuildPodcasts recreates the podcasts table allowing the given statuses
+// and copies the rows over. Tables referencing podcasts must be dropped first
+// and created afterwards.
+func sqliteRebuildPodcasts(statuses string) string {
+	return fmt.Sprintf(`
+        CREATE TABLE podcasts_new (
+            id TEXT PRIMARY KEY,                        -- UUID v4
+            user_id INTEGER NOT NULL,
+            filename TEXT NOT NULL,                     -- Original filename from upload
+            store_path TEXT UNIQUE NOT NULL,            -- Relative path on server filesystem
+            producer TEXT NOT NULL,
+            series TEXT NOT NULL,
+            episode TEXT NOT NULL,
+            description TEXT,                           -- Optional episode description
+            original_transcript TEXT,                   -- Optional provided transcript
+            final_transcript TEXT,                      -- Generated JSON transcript (nullable initially)
+            upload_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+            status TEXT NOT NULL DEFAULT 'uploaded' CHECK(status IN (%s)),
+            error_message TEXT,                         -- Store error message on failure
+            FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        );
+        INSERT INTO podcasts_new (id, user_id, filename, store_path, producer, series, episode, description,
+                                  original_transcript, final_transcript, upload_time, status, error_message)
+        SELECT id, user_id, filename, store_path, producer, series, episode, description,
+               original_transcript, final_transcript, upload_time, status, error_message
+        FROM podcasts;
+        DROP TABLE podcasts;
+        ALTER TABLE podcasts_new RENAME TO podcasts;
+        CREATE INDEX IF NOT EXISTS idx_podcasts_user_status ON podcasts(user_id, status);
+        CREATE INDEX IF NOT EXISTS idx_podcasts_user_upload_time ON podcasts(user_id, upload_time);
+        `, statuses)
+}
+
+// sqliteAddColumnIfMissing adds a column unless the table already has it.
+// SQLite has no ADD COLUMN IF NOT EXISTS, so the table info is checked first.
+func sqliteAddColumnIfMissing(tx *Tx, table, column, decl string) error {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect columns of %s: %w", table, err)
+	}
+	if count > 0 {
+		return nil
+	}
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
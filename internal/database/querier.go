@@ -0,0 +1,66 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Querier is the subset of *sql.DB and *sql.Tx used by the data helpers, so the
+// same code can run on the connection pool or inside a transaction.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// rebindQuerier rewrites placeholders for a Querier that does not know the dialect
+// (a plain *sql.DB or *sql.Tx).
+type rebindQuerier struct {
+	q       Querier
+	dialect dialect
+}
+
+func (r rebindQuerier) Exec(query string, args ...any) (sql.Result, error) {
+	return r.q.Exec(r.dialect.rebind(query), args...)
+}
+
+func (r rebindQuerier) Query(query string, args ...any) (*sql.Rows, error) {
+	return r.q.Query(r.dialect.rebind(query), args...)
+}
+
+func (r rebindQuerier) QueryRow(query string, args ...any) *sql.Row {
+	return r.q.QueryRow(r.dialect.rebind(query), args...)
+}
+
+// Queries runs the entry/URL/paragraph/relation helpers against a Querier,
+// either the connection pool or an open transaction.
+type Queries struct {
+	q Querier
+}
+
+// With binds the helpers to q. A plain *sql.DB or *sql.Tx is wrapped so its
+// placeholders are rewritten for the active dialect.
+func (db *DB) With(q Querier) *Queries {
+	switch q.(type) {
+	case *DB, *Tx, rebindQuerier:
+		return &Queries{q: q}
+	}
+	return &Queries{q: rebindQuerier{q: q, dialect: db.dialect}}
+}
+
+// WithTx runs fn inside a transaction, committing if it returns nil and rolling back otherwise.
+func (db *DB) WithTx(fn func(qs *Queries) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after a successful commit
+
+	if err := fn(db.With(tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
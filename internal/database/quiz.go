@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+	"strings"
+)
+
+const quizItemColumns = `e.uuid, e.word, e.forms_pipe_separated, p.paragraph_hash, p.text`
+
+// GetQuizItems returns up to limit random pairs of a marked word and a
+// paragraph it was marked in, from one dictionary or, with 0, from all.
+func (db *DB) GetQuizItems(userID, dictionaryID int64, limit int) ([]models.QuizItem, error) {
+	rows, err := db.Query(`
+        SELECT `+quizItemColumns+`
+        FROM relations r
+        JOIN entries e ON r.user_id = e.user_id AND r.entry_uuid = e.uuid
+        JOIN paragraphs p ON r.user_id = p.user_id AND r.paragraph_hash = p.paragraph_hash
+        WHERE r.user_id = ? AND (? = 0 OR e.dictionary_id = ?)
+        ORDER BY RANDOM()
+        LIMIT ?
+    `, userID, dictionaryID, dictionaryID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quiz items: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]models.QuizItem, 0, limit)
+	for rows.Next() {
+		item, err := scanQuizItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating quiz items: %w", err)
+	}
+	return items, nil
+}
+
+// GetQuizItem returns the word and paragraph a quiz question was built from,
+// or nil if the word was never marked in that paragraph.
+func (db *DB) GetQuizItem(userID int64, entryUUID, paragraphHash string) (*models.QuizItem, error) {
+	item, err := scanQuizItem(db.QueryRow(`
+        SELECT `+quizItemColumns+`
+        FROM relations r
+        JOIN entries e ON r.user_id = e.user_id AND r.entry_uuid = e.uuid
+        JOIN paragraphs p ON r.user_id = p.user_id AND r.paragraph_hash = p.paragraph_hash
+        WHERE r.user_id = ? AND r.entry_uuid = ? AND r.paragraph_hash = ?
+        LIMIT 1
+    `, userID, entryUUID, paragraphHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return item, err
+}
+
+// GetEntryWords returns the base form of every word the user marked, in one
+// dictionary or, with 0, in all.
+func (db *DB) GetEntryWords(userID, dictionaryID int64) ([]string, error) {
+	rows, err := db.Query(`SELECT word FROM entries WHERE user_id = ? AND (? = 0 OR dictionary_id = ?)`, userID, dictionaryID, dictionaryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entry words: %w", err)
+	}
+	defer rows.Close()
+
+	var words []string
+	for rows.Next() {
+		var word string
+		if err := rows.Scan(&word); err != nil {
+			return nil, fmt.Errorf("failed to scan entry word: %w", err)
+		}
+		words = append(words, word)
+	}
+	return words, rows.Err()
+}
+
+func scanQuizItem(row interface{ Scan(...any) error }) (*models.QuizItem, error) {
+	item := &models.QuizItem{}
+	var forms string
+	if err := row.Scan(&item.EntryUUID, &item.Word, &forms, &item.ParagraphHash, &item.Paragraph); err != nil {
+		return nil, fmt.Errorf("failed to scan quiz item: %w", err)
+	}
+	item.Forms = strings.Split(forms, "|")
+	return item, nil
+}
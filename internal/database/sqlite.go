@@ -0,0 +1,51 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// sqliteDialect is the default single-file backend.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string               { return "sqlite3" }
+func (sqliteDialect) rebind(query string) string { return query }
+func (sqliteDialect) migrations() []Migration    { return sqliteMigrations }
+func (sqliteDialect) lockMigrations(*sql.DB) (func(), error) {
+	// SQLite serialises writers itself and each migration runs in its own transaction.
+	return func() {}, nil
+}
+
+// openSQLite opens a SQLite database file. The DSN is a file path, optionally
+// prefixed with sqlite:// or sqlite3://.
+func openSQLite(dataSourceName string) (*DB, error) {
+	dataSourceName = strings.TrimPrefix(dataSourceName, "sqlite3://")
+	dataSourceName = strings.TrimPrefix(dataSourceName, "sqlite://")
+
+	// Ensure the directory exists
+	dir := filepath.Dir(dataSourceName)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return nil, fmt.Errorf("failed to create database directory %s: %w", dir, err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check database directory %s: %w", dir, err)
+	}
+
+	db, err := sql.Open("sqlite3", dataSourceName+"?_foreign_keys=on") // Enable foreign keys
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return &DB{DB: db, dialect: sqliteDialect{}}, nil
+}
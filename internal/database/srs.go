@@ -0,0 +1,192 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+	"strings"
+	"time"
+)
+
+// GetDueCards returns up to limit entries due for review at now, each with up
+// to contexts of the paragraphs it was most recently marked in. Overdue
+// reviews come first, most overdue first, then words never reviewed in the
+// order they were marked. A dictionaryID of 0 includes all dictionaries.
+func (db *DB) GetDueCards(userID, dictionaryID int64, now time.Time, limit, contexts int) ([]models.StudyCard, error) {
+	rows, err := db.Query(`
+        SELECT e.uuid, e.word, e.forms_pipe_separated,
+               s.ease, s.interval_days, s.repetitions, s.lapses, s.due_at, s.last_reviewed_at, s.last_grade
+        FROM entries e
+        LEFT JOIN srs_review_state s ON s.user_id = e.user_id AND s.entry_uuid = e.uuid
+        WHERE e.user_id = ? AND (? = 0 OR e.dictionary_id = ?) AND (s.due_at IS NULL OR s.due_at <= ?)
+        ORDER BY CASE WHEN s.due_at IS NULL THEN 1 ELSE 0 END, s.due_at, e.created_at
+        LIMIT ?
+    `, userID, dictionaryID, dictionaryID, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due cards: %w", err)
+	}
+
+	cards := make([]models.StudyCard, 0, limit)
+	for rows.Next() {
+		var card models.StudyCard
+		var forms string
+		var ease sql.NullFloat64
+		var interval, repetitions, lapses, lastGrade sql.NullInt64
+		var dueAt, lastReviewedAt sql.NullTime
+		if err := rows.Scan(&card.EntryUUID, &card.Word, &forms,
+			&ease, &interval, &repetitions, &lapses, &dueAt, &lastReviewedAt, &lastGrade); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan due card: %w", err)
+		}
+		card.Forms = strings.Split(forms, "|")
+		if !dueAt.Valid {
+			card.IsNew = true
+			card.State = models.ReviewState{EntryUUID: card.EntryUUID, Ease: 2.5, DueAt: now}
+		} else {
+			card.State = models.ReviewState{
+				EntryUUID:    card.EntryUUID,
+				Ease:         ease.Float64,
+				IntervalDays: int(interval.Int64),
+				Repetitions:  int(repetitions.Int64),
+				Lapses:       int(lapses.Int64),
+				DueAt:        dueAt.Time,
+				LastGrade:    int(lastGrade.Int64),
+			}
+			if lastReviewedAt.Valid {
+				card.State.LastReviewedAt = &lastReviewedAt.Time
+			}
+		}
+		cards = append(cards, card)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating due cards: %w", err)
+	}
+
+	if err := db.getStudyContexts(userID, cards, contexts); err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// getStudyContexts fills in the contexts of all cards with one query, taking
+// up to limit of the most recently marked paragraphs per entry.
+func (db *DB) getStudyContexts(userID int64, cards []models.StudyCard, limit int) error {
+	if len(cards) == 0 {
+		return nil
+	}
+	byEntry := make(map[string]*models.StudyCard, len(cards))
+	args := []any{userID}
+	for i := range cards {
+		cards[i].Contexts = []models.StudyContext{}
+		byEntry[cards[i].EntryUUID] = &cards[i]
+		args = append(args, cards[i].EntryUUID)
+	}
+	placeholders := strings.Repeat("?,", len(cards)-1) + "?"
+
+	rows, err := db.Query(fmt.Sprintf(`
+        SELECT entry_uuid, text, url, title, transcript_segment_ref
+        FROM (
+            SELECT r.entry_uuid, p.text, u.url, u.title, r.transcript_segment_ref,
+                   ROW_NUMBER() OVER (PARTITION BY r.entry_uuid ORDER BY r.updated_at DESC) AS n
+            FROM relations r
+            JOIN paragraphs p ON r.user_id = p.user_id AND r.paragraph_hash = p.paragraph_hash
+            LEFT JOIN urls u ON r.user_id = u.user_id AND r.url_hash = u.url_hash
+            WHERE r.user_id = ? AND r.entry_uuid IN (%s)
+        ) ranked
+        WHERE n <= ?
+        ORDER BY entry_uuid, n
+    `, placeholders), append(args, limit)...)
+	if err != nil {
+		return fmt.Errorf("failed to query contexts of due cards: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.StudyContext
+		var entryUUID string
+		var url, title, segmentRef sql.NullString
+		if err := rows.Scan(&entryUUID, &c.Paragraph, &url, &title, &segmentRef); err != nil {
+			return fmt.Errorf("failed to scan context of due card: %w", err)
+		}
+		c.URL = url.String
+		if title.Valid {
+			c.Title = &title.String
+		}
+		if segmentRef.Valid {
+			c.TranscriptSegmentRef = &segmentRef.String
+		}
+		if card := byEntry[entryUUID]; card != nil {
+			card.Contexts = append(card.Contexts, c)
+		}
+	}
+	return rows.Err()
+}
+
+// GetReviewState returns the review state of an entry, or nil if it was never reviewed.
+func (db *DB) GetReviewState(userID int64, entryUUID string) (*models.ReviewState, error) {
+	s := &models.ReviewState{EntryUUID: entryUUID}
+	var lastReviewedAt sql.NullTime
+	err := db.QueryRow(`
+        SELECT ease, interval_days, repetitions, lapses, due_at, last_reviewed_at, last_grade
+        FROM srs_review_state WHERE user_id = ? AND entry_uuid = ?
+    `, userID, entryUUID).Scan(&s.Ease, &s.IntervalDays, &s.Repetitions, &s.Lapses, &s.DueAt, &lastReviewedAt, &s.LastGrade)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query review state of entry %s: %w", entryUUID, err)
+	}
+	if lastReviewedAt.Valid {
+		s.LastReviewedAt = &lastReviewedAt.Time
+	}
+	return s, nil
+}
+
+// GetReviewStates returns the review state of every entry that was reviewed.
+func (db *DB) GetReviewStates(userID int64) ([]models.ReviewState, error) {
+	rows, err := db.Query(`
+        SELECT entry_uuid, ease, interval_days, repetitions, lapses, due_at, last_reviewed_at, last_grade
+        FROM srs_review_state WHERE user_id = ?
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query review states: %w", err)
+	}
+	defer rows.Close()
+
+	states := []models.ReviewState{}
+	for rows.Next() {
+		var s models.ReviewState
+		var lastReviewedAt sql.NullTime
+		if err := rows.Scan(&s.EntryUUID, &s.Ease, &s.IntervalDays, &s.Repetitions, &s.Lapses, &s.DueAt, &lastReviewedAt, &s.LastGrade); err != nil {
+			return nil, fmt.Errorf("failed to scan review state: %w", err)
+		}
+		if lastReviewedAt.Valid {
+			s.LastReviewedAt = &lastReviewedAt.Time
+		}
+		states = append(states, s)
+	}
+	return states, rows.Err()
+}
+
+// SaveReviewState stores the review state of an entry.
+func (db *DB) SaveReviewState(userID int64, s models.ReviewState) error {
+	_, err := db.Exec(`
+        INSERT INTO srs_review_state (user_id, entry_uuid, ease, interval_days, repetitions, lapses, due_at, last_reviewed_at, last_grade, created_at, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+        ON CONFLICT(user_id, entry_uuid) DO UPDATE SET
+            ease = excluded.ease,
+            interval_days = excluded.interval_days,
+            repetitions = excluded.repetitions,
+            lapses = excluded.lapses,
+            due_at = excluded.due_at,
+            last_reviewed_at = excluded.last_reviewed_at,
+            last_grade = excluded.last_grade,
+            updated_at = CURRENT_TIMESTAMP
+    `, userID, s.EntryUUID, s.Ease, s.IntervalDays, s.Repetitions, s.Lapses, s.DueAt, s.LastReviewedAt, s.LastGrade)
+	if err != nil {
+		return fmt.Errorf("failed to save review state of entry %s: %w", s.EntryUUID, err)
+	}
+	return nil
+}
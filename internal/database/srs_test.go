@@ -0,0 +1,77 @@
+package database
+
+import (
+	"lingomarker/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetDueCards(t *testing.T) {
+	db := newTestDB(t)
+	userID := createTestUser(t, db, "anna")
+	other := createTestUser(t, db, "ben")
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	markTestWord(t, db, userID, "tree", "https://example.org/a", "A tree grows.")
+	markTestWord(t, db, userID, "tree", "https://example.org/b", "Trees are tall.")
+	markTestWord(t, db, userID, "tree", "https://example.org/c", "The tree fell.")
+	markTestWord(t, db, userID, "leaf", "https://example.org/a", "A leaf falls.")
+	markTestWord(t, db, userID, "root", "https://example.org/a", "Roots go deep.")
+	markTestWord(t, db, userID, "seed", "https://example.org/a", "A seed sprouts.")
+	markTestWord(t, db, other, "tree", "https://example.org/a", "Another user's tree.")
+	// Order the contexts of "tree" explicitly; CURRENT_TIMESTAMP has whole seconds.
+	for i, p := range []string{"A tree grows.", "Trees are tall.", "The tree fell."} {
+		_, err := db.Exec(`UPDATE relations SET updated_at = ? WHERE user_id = ? AND entry_uuid = 'uuid-tree'
+            AND paragraph_hash = (SELECT paragraph_hash FROM paragraphs WHERE user_id = ? AND text = ?)`,
+			now.Add(time.Duration(i)*time.Minute), userID, userID, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// "leaf" is overdue, "root" is not due yet; "tree" and "seed" are new.
+	for uuid, due := range map[string]time.Time{"uuid-leaf": now.Add(-time.Hour), "uuid-root": now.Add(time.Hour)} {
+		if err := db.SaveReviewState(userID, models.ReviewState{EntryUUID: uuid, Ease: 2.5, IntervalDays: 1, Repetitions: 1, DueAt: due}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cards, err := db.GetDueCards(userID, 0, now, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	var order []string
+	for _, c := range cards {
+		order = append(order, c.Word)
+		got[c.Word] = []string{}
+		for _, ctx := range c.Contexts {
+			got[c.Word] = append(got[c.Word], ctx.Paragraph+" @ "+ctx.URL)
+		}
+	}
+	if len(order) != 3 || order[0] != "leaf" {
+		t.Fatalf("cards = %v, want leaf first, then tree and seed", order)
+	}
+	want := map[string][]string{
+		"leaf": {"A leaf falls. @ https://example.org/a"},
+		"tree": {"The tree fell. @ https://example.org/c", "Trees are tall. @ https://example.org/b"},
+		"seed": {"A seed sprouts. @ https://example.org/a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("contexts = %q\nwant %q", got, want)
+	}
+	if c := cards[0]; c.IsNew || c.State.Repetitions != 1 {
+		t.Errorf("leaf card = %+v, want its review state", c)
+	}
+
+	cards, err = db.GetDueCards(userID, 0, now, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cards {
+		if c.Contexts == nil || len(c.Contexts) != 0 {
+			t.Errorf("card %s has contexts %v, want none", c.Word, c.Contexts)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"lingomarker/internal/models"
+	"time"
+)
+
+// UserStore manages user accounts.
+type UserStore interface {
+	CreateUser(name, username, passwordHash string) (int64, error)
+	GetUserByUsername(username string) (*models.User, error)
+	GetUserByID(userID int64) (*models.User, error)
+}
+
+// SessionStore manages login sessions.
+type SessionStore interface {
+	CreateSession(sessionID string, userID int64, expiry time.Time) error
+	GetUserIDFromSession(sessionID string) (int64, error)
+	DeleteSession(sessionID string) error
+	DeleteExpiredSessions() (int64, error)
+}
+
+// SettingsStore manages per-user settings.
+type SettingsStore interface {
+	GetUserSettings(userID int64) (*models.UserSettings, error)
+	SaveUserSettings(settings *models.UserSettings) error
+}
+
+// EntryStore manages marked words and the URLs, paragraphs and relations that give them context.
+type EntryStore interface {
+	UpsertEntry(entry *models.Entry) error
+	GetEntryByUUID(userID int64, uuid string) (*models.Entry, error)
+	UpsertURL(url *models.URL) error
+	UpsertParagraph(para *models.Paragraph) error
+	UpsertRelation(rel *models.Relation) error
+	MarkWord(in *MarkWordInput) (*models.Entry, error)
+	DeleteEntryAndRelations(userID int64, entryUUID string) error
+	GetUserDataBundle(userID, dictionaryID int64) (*models.UserDataBundle, error)
+	ImportData(userID int64, data map[string]map[string][]string, dryRun bool) (*models.ImportDataReport, error)
+	ImportWords(userID, dictionaryID int64, words []models.ImportedWord) (*models.ImportReport, error)
+}
+
+// PodcastStore manages uploaded podcasts and their transcripts.
+type PodcastStore interface {
+	CreatePodcastRecord(p *models.Podcast) error
+	UpdatePodcastStatus(userID int64, podcastID string, status models.PodcastStatus, errMsg *string) error
+	UpdatePodcastTranscript(userID int64, podcastID string, finalTranscript *string, status models.PodcastStatus, errMsg *string) error
+	GetPodcastStorePath(userID int64, podcastID string) (string, error)
+	ListPodcastsByUser(userID int64, limit, offset int) ([]models.PodcastListItem, error)
+	DeletePodcastRecord(userID int64, podcastID string) (string, error)
+	GetPodcastByIDForUser(userID int64, podcastID string) (*models.Podcast, error)
+}
+
+// ArticleStore manages web pages captured on the server for the reader view.
+type ArticleStore interface {
+	CreateArticle(a *models.Article) error
+	GetArticle(userID int64, articleID string) (*models.Article, error)
+	ListArticles(userID int64, limit, offset int) ([]models.ArticleListItem, error)
+	DeleteArticle(userID int64, articleID string) error
+}
+
+// BookStore manages uploaded books and the reading position in them.
+type BookStore interface {
+	CreateBook(b *models.Book) error
+	ListBooks(userID int64) ([]models.BookListItem, error)
+	GetBook(userID int64, bookID string) (*models.Book, error)
+	GetBookChapter(userID int64, bookID string, chapter int) (*models.BookChapter, error)
+	SaveBookPosition(userID int64, bookID string, chapter, paragraph int) error
+	DeleteBook(userID int64, bookID string) error
+}
+
+// FeedStore manages podcast feed subscriptions and the episodes seen in them.
+type FeedStore interface {
+	CreateFeed(f *models.Feed) error
+	ListFeeds(userID int64) ([]models.Feed, error)
+	GetFeed(userID int64, feedID string) (*models.Feed, error)
+	UpdateFeed(userID int64, feedID string, keepEpisodes int) error
+	RequestFeedCheck(userID int64, feedID string) error
+	DeleteFeed(userID int64, feedID string) error
+	ClaimDueFeed(now time.Time, interval time.Duration) (*models.Feed, error)
+	SaveFeedCheck(f *models.Feed) error
+	GetFeedEpisodeGUIDs(feedID string) (map[string]bool, error)
+	AddFeedEpisode(feedID string, e models.FeedEpisode, p *models.Podcast) error
+	GetExpiredFeedPodcasts(feedID string, keep int) ([]string, error)
+}
+
+// UploadStore manages resumable upload sessions and their parts.
+type UploadStore interface {
+	CreateUploadSession(s *models.UploadSession) error
+	GetUploadSession(userID int64, sessionID string, now time.Time) (*models.UploadSession, error)
+	AddUploadPart(userID int64, sessionID string, part models.UploadPart, now, expires time.Time) error
+	GetUploadParts(sessionID string) ([]models.UploadPart, error)
+	CompleteUploadSession(userID int64, sessionID string, last models.UploadPart, p *models.Podcast, now, expires time.Time) error
+	DeleteUploadSession(userID int64, sessionID string) ([]string, error)
+	DeleteExpiredUploadSessions(now time.Time) ([]string, error)
+}
+
+// ReviewStore provides the read models for the training and review pages.
+type ReviewStore interface {
+	GetTrainingData(userID int64, limit int) ([]models.TrainingItem, error)
+	GetReviewPageData(userID, dictionaryID int64, limit int) ([]models.ReviewSource, error)
+}
+
+// WordFormsCacheStore caches word forms across users, keyed by language and normalized word.
+type WordFormsCacheStore interface {
+	GetCachedWordForms(language, word string, now time.Time) (string, bool, error)
+	PutCachedWordForms(language, word, forms, provider string, expiresAt time.Time) error
+	DeleteCachedWordForms(language, word string) (int64, error)
+	DeleteExpiredWordForms(now time.Time) (int64, error)
+}
+
+// JobStore is the durable transcription job queue.
+type JobStore interface {
+	EnqueueTranscription(userID int64, podcastID string, runAfter time.Time) error
+	ClaimTranscriptionJob(owner string, now time.Time, lease time.Duration) (*models.TranscriptionJob, error)
+	HeartbeatTranscriptionJob(jobID int64, owner string, now time.Time, lease time.Duration) error
+	CompleteTranscriptionJob(job *models.TranscriptionJob, owner, finalTranscript string) error
+	FailTranscriptionJob(job *models.TranscriptionJob, owner, errMsg string) error
+	RetryTranscriptionJob(job *models.TranscriptionJob, owner, errMsg string, runAfter time.Time) error
+	ImportTranscript(userID int64, podcastID, finalTranscript string) error
+	ReleaseTranscriptionJob(job *models.TranscriptionJob, owner string) error
+	RecoverTranscriptionJobs(now time.Time) (int64, error)
+}
+
+// SRSStore manages the spaced-repetition schedule of entries.
+type SRSStore interface {
+	GetDueCards(userID, dictionaryID int64, now time.Time, limit, contexts int) ([]models.StudyCard, error)
+	GetReviewState(userID int64, entryUUID string) (*models.ReviewState, error)
+	GetReviewStates(userID int64) ([]models.ReviewState, error)
+	SaveReviewState(userID int64, s models.ReviewState) error
+}
+
+// QuizStore provides the material for quizzes.
+type QuizStore interface {
+	GetQuizItems(userID, dictionaryID int64, limit int) ([]models.QuizItem, error)
+	GetQuizItem(userID int64, entryUUID, paragraphHash string) (*models.QuizItem, error)
+	GetEntryWords(userID, dictionaryID int64) ([]string, error)
+}
+
+// DictionaryStore manages the dictionaries entries are grouped in, one per language.
+type DictionaryStore interface {
+	GetDictionaries(userID int64) ([]models.Dictionary, error)
+	CreateDictionary(d *models.Dictionary) error
+	UpdateDictionary(d *models.Dictionary) error
+	DeleteDictionary(userID, dictionaryID int64) error
+}
+
+// ArchiveStore backs up and restores everything a user owns.
+type ArchiveStore interface {
+	GetUserArchive(userID int64) (*models.UserArchive, error)
+	RestoreUserArchive(userID int64, a *models.UserArchive, replace bool) (*models.RestoreReport, error)
+}
+
+// Store is everything the handlers need from persistence. *DB implements it
+// for both SQLite and PostgreSQL.
+type Store interface {
+	UserStore
+	SessionStore
+	SettingsStore
+	EntryStore
+	PodcastStore
+	ArticleStore
+	BookStore
+	FeedStore
+	UploadStore
+	ReviewStore
+	WordFormsCacheStore
+	JobStore
+	SRSStore
+	QuizStore
+	DictionaryStore
+	ArchiveStore
+
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
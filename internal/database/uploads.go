@@ -0,0 +1,211 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+	"time"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+)
+
+const uploadSessionColumns = `id, user_id, filename, length, upload_offset, producer, series, episode,
+    description, original_transcript, podcast_id, created_at, expires_at`
+
+func scanUploadSession(row interface{ Scan(...any) error }) (*models.UploadSession, error) {
+	s := &models.UploadSession{}
+	err := row.Scan(&s.ID, &s.UserID, &s.Filename, &s.Length, &s.Offset, &s.Producer, &s.Series, &s.Episode,
+		&s.Description, &s.OriginalTranscript, &s.PodcastID, &s.CreatedAt, &s.ExpiresAt)
+	return s, err
+}
+
+// CreateUploadSession starts a resumable upload and sets its creation time.
+func (db *DB) CreateUploadSession(s *models.UploadSession) error {
+	err := db.QueryRow(`
+        INSERT INTO upload_sessions (id, user_id, filename, length, producer, series, episode,
+                                     description, original_transcript, created_at, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+        RETURNING created_at
+    `, s.ID, s.UserID, s.Filename, s.Length, s.Producer, s.Series, s.Episode,
+		s.Description, s.OriginalTranscript, s.ExpiresAt).Scan(&s.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert upload session %s: %w", s.ID, err)
+	}
+	return nil
+}
+
+// GetUploadSession returns one of the user's upload sessions, unless it
+// expired before now.
+func (db *DB) GetUploadSession(userID int64, sessionID string, now time.Time) (*models.UploadSession, error) {
+	s, err := scanUploadSession(db.QueryRow(`
+        SELECT `+uploadSessionColumns+` FROM upload_sessions
+        WHERE id = ? AND user_id = ? AND expires_at > ?
+    `, sessionID, userID, now))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query upload session %s: %w", sessionID, err)
+	}
+	return s, nil
+}
+
+// AddUploadPart records a chunk stored at the session's current offset,
+// advances the offset past it and extends the session until expires. Returns
+// ErrUploadOffsetMismatch if another chunk was added at that offset first,
+// or the part does not fit the declared length.
+func (db *DB) AddUploadPart(userID int64, sessionID string, part models.UploadPart, now, expires time.Time) error {
+	return db.WithTx(func(qs *Queries) error {
+		if err := advanceUploadSession(qs.q, userID, sessionID, part, now, expires); err != nil {
+			return err
+		}
+		_, err := qs.q.Exec(`
+            INSERT INTO upload_parts (session_id, part_offset, size, store_key)
+            VALUES (?, ?, ?, ?)
+        `, sessionID, part.Offset, part.Size, part.StoreKey)
+		if err != nil {
+			return fmt.Errorf("failed to insert part at %d of upload session %s: %w", part.Offset, sessionID, err)
+		}
+		return nil
+	})
+}
+
+// advanceUploadSession moves the offset of a session past part.
+func advanceUploadSession(q Querier, userID int64, sessionID string, part models.UploadPart, now, expires time.Time) error {
+	res, err := q.Exec(`
+        UPDATE upload_sessions SET upload_offset = upload_offset + ?, expires_at = ?
+        WHERE id = ? AND user_id = ? AND upload_offset = ? AND upload_offset + ? <= length
+          AND podcast_id IS NULL AND expires_at > ?
+    `, part.Size, expires, sessionID, userID, part.Offset, part.Size, now)
+	if err != nil {
+		return fmt.Errorf("failed to advance upload session %s: %w", sessionID, err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	var count int
+	err = q.QueryRow(`
+        SELECT COUNT(*) FROM upload_sessions WHERE id = ? AND user_id = ? AND expires_at > ?
+    `, sessionID, userID, now).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to query upload session %s: %w", sessionID, err)
+	}
+	if count == 0 {
+		return ErrUploadNotFound
+	}
+	return ErrUploadOffsetMismatch
+}
+
+// GetUploadParts returns the parts of an upload session, in order.
+func (db *DB) GetUploadParts(sessionID string) ([]models.UploadPart, error) {
+	rows, err := db.Query(`
+        SELECT part_offset, size, store_key FROM upload_parts
+        WHERE session_id = ? ORDER BY part_offset
+    `, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query parts of upload session %s: %w", sessionID, err)
+	}
+	defer rows.Close()
+
+	var parts []models.UploadPart
+	for rows.Next() {
+		var part models.UploadPart
+		if err := rows.Scan(&part.Offset, &part.Size, &part.StoreKey); err != nil {
+			return nil, fmt.Errorf("failed to scan part of upload session %s: %w", sessionID, err)
+		}
+		parts = append(parts, part)
+	}
+	return parts, rows.Err()
+}
+
+// CompleteUploadSession records the last chunk of an upload session like
+// AddUploadPart, and stores p as the podcast assembled from the session's
+// parts. The parts are forgotten; the caller deletes their blobs. The session
+// is kept until expires, so the client can still ask for its podcast.
+func (db *DB) CompleteUploadSession(userID int64, sessionID string, last models.UploadPart, p *models.Podcast, now, expires time.Time) error {
+	return db.WithTx(func(qs *Queries) error {
+		if err := advanceUploadSession(qs.q, userID, sessionID, last, now, expires); err != nil {
+			return err
+		}
+		if err := insertPodcast(qs.q, p); err != nil {
+			return err
+		}
+		_, err := qs.q.Exec("UPDATE upload_sessions SET podcast_id = ? WHERE id = ?", p.ID, sessionID)
+		if err != nil {
+			return fmt.Errorf("failed to complete upload session %s: %w", sessionID, err)
+		}
+		if _, err := qs.q.Exec("DELETE FROM upload_parts WHERE session_id = ?", sessionID); err != nil {
+			return fmt.Errorf("failed to delete parts of upload session %s: %w", sessionID, err)
+		}
+		return nil
+	})
+}
+
+// DeleteUploadSession cancels one of the user's uploads and returns the
+// store keys of its parts, for the caller to delete.
+func (db *DB) DeleteUploadSession(userID int64, sessionID string) ([]string, error) {
+	var keys []string
+	err := db.WithTx(func(qs *Queries) error {
+		var err error
+		keys, err = uploadPartKeys(qs.q, `
+            SELECT p.store_key FROM upload_parts p JOIN upload_sessions s ON s.id = p.session_id
+            WHERE s.id = ? AND s.user_id = ?
+        `, sessionID, userID)
+		if err != nil {
+			return err
+		}
+		res, err := qs.q.Exec("DELETE FROM upload_sessions WHERE id = ? AND user_id = ?", sessionID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete upload session %s: %w", sessionID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrUploadNotFound
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// DeleteExpiredUploadSessions deletes the upload sessions that expired
+// before now and returns the store keys of their parts, for the caller to
+// delete. Podcasts assembled from them are kept.
+func (db *DB) DeleteExpiredUploadSessions(now time.Time) ([]string, error) {
+	var keys []string
+	err := db.WithTx(func(qs *Queries) error {
+		var err error
+		keys, err = uploadPartKeys(qs.q, `
+            SELECT p.store_key FROM upload_parts p JOIN upload_sessions s ON s.id = p.session_id
+            WHERE s.expires_at <= ?
+        `, now)
+		if err != nil {
+			return err
+		}
+		if _, err := qs.q.Exec("DELETE FROM upload_sessions WHERE expires_at <= ?", now); err != nil {
+			return fmt.Errorf("failed to delete expired upload sessions: %w", err)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func uploadPartKeys(q Querier, query string, args ...any) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query upload parts: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan upload part: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"fmt"
+	"lingomarker/internal/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImportWords adds words read from another app to a dictionary, or with 0 to
+// the default one, in one transaction. A word the dictionary already has,
+// compared case-insensitively, gets any new forms and contexts; otherwise a new
+// entry is created. Words with both a context and a URL get a relation dated as
+// the word, or now when the date is unknown.
+func (db *DB) ImportWords(userID, dictionaryID int64, words []models.ImportedWord) (*models.ImportReport, error) {
+	report := &models.ImportReport{}
+	now := time.Now().UTC()
+	err := db.WithTx(func(qs *Queries) error {
+		if dictionaryID == 0 {
+			var err error
+			if dictionaryID, err = defaultDictionaryID(qs.q, userID); err != nil {
+				return err
+			}
+		}
+		entries, err := getEntriesByWord(qs.q, userID, dictionaryID)
+		if err != nil {
+			return err
+		}
+
+		for _, w := range words {
+			date := orNow(w.Date, now)
+			key := strings.ToLower(w.Word)
+			entry, ok := entries[key]
+			if !ok {
+				entry = &models.Entry{UUID: uuid.NewString(), DictionaryID: dictionaryID, Word: w.Word}
+				entry.FormsPipeSeparated = mergeForms("", w.Forms)
+				if _, err := qs.q.Exec(`
+                    INSERT INTO entries (uuid, user_id, dictionary_id, word, forms_pipe_separated, created_at, updated_at)
+                    VALUES (?, ?, ?, ?, ?, ?, ?)
+                `, entry.UUID, userID, dictionaryID, entry.Word, entry.FormsPipeSeparated, date, date); err != nil {
+					return fmt.Errorf("failed to insert entry for %q: %w", w.Word, err)
+				}
+				entries[key] = entry
+				report.Entries++
+			} else if forms := mergeForms(entry.FormsPipeSeparated, w.Forms); forms != entry.FormsPipeSeparated {
+				if _, err := qs.q.Exec(`
+                    UPDATE entries SET forms_pipe_separated = ?, updated_at = CURRENT_TIMESTAMP
+                    WHERE user_id = ? AND uuid = ?
+                `, forms, userID, entry.UUID); err != nil {
+					return fmt.Errorf("failed to update forms of entry %s: %w", entry.UUID, err)
+				}
+				entry.FormsPipeSeparated = forms
+			}
+
+			if w.URLHash == "" || w.ParagraphHash == "" {
+				continue
+			}
+			var title *string
+			if w.Title != "" {
+				title = &w.Title
+			}
+			n, err := insertCounted(qs.q, `
+                INSERT INTO urls (user_id, url_hash, url, title, created_at)
+                VALUES (?, ?, ?, ?, ?)
+                ON CONFLICT(user_id, url_hash) DO NOTHING
+            `, userID, w.URLHash, w.URL, title, date)
+			if err != nil {
+				return fmt.Errorf("failed to insert URL %s: %w", w.URL, err)
+			}
+			report.URLs += n
+			n, err = insertCounted(qs.q, `
+                INSERT INTO paragraphs (user_id, paragraph_hash, text, created_at)
+                VALUES (?, ?, ?, ?)
+                ON CONFLICT(user_id, paragraph_hash) DO NOTHING
+            `, userID, w.ParagraphHash, w.Context, date)
+			if err != nil {
+				return fmt.Errorf("failed to insert paragraph %s: %w", w.ParagraphHash, err)
+			}
+			report.Paragraphs += n
+			n, err = insertCounted(qs.q, `
+                INSERT INTO relations (user_id, entry_uuid, url_hash, paragraph_hash, created_at, updated_at)
+                VALUES (?, ?, ?, ?, ?, ?)
+                ON CONFLICT(user_id, entry_uuid, url_hash, paragraph_hash) DO NOTHING
+            `, userID, entry.UUID, w.URLHash, w.ParagraphHash, date, date)
+			if err != nil {
+				return fmt.Errorf("failed to insert relation of entry %s: %w", entry.UUID, err)
+			}
+			report.Relations += n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// getEntriesByWord returns the entries of a dictionary keyed by lower-cased
+// word. Of entries sharing a word, the oldest wins.
+func getEntriesByWord(q Querier, userID, dictionaryID int64) (map[string]*models.Entry, error) {
+	rows, err := q.Query(`
+        SELECT uuid, word, forms_pipe_separated FROM entries
+        WHERE user_id = ? AND dictionary_id = ?
+        ORDER BY created_at DESC
+    `, userID, dictionaryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[string]*models.Entry)
+	for rows.Next() {
+		e := &models.Entry{UserID: userID, DictionaryID: dictionaryID}
+		if err := rows.Scan(&e.UUID, &e.Word, &e.FormsPipeSeparated); err != nil {
+			return nil, fmt.Errorf("failed to scan entry: %w", err)
+		}
+		entries[strings.ToLower(e.Word)] = e
+	}
+	return entries, rows.Err()
+}
+
+// mergeForms appends the forms not in the pipe-separated existing list yet.
+func mergeForms(existing string, forms []string) string {
+	var merged []string
+	seen := make(map[string]bool)
+	for _, f := range append(strings.Split(existing, "|"), forms...) {
+		f = strings.TrimSpace(f)
+		if key := strings.ToLower(f); f != "" && !seen[key] {
+			seen[key] = true
+			merged = append(merged, f)
+		}
+	}
+	return strings.Join(merged, "|")
+}
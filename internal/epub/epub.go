@@ -0,0 +1,309 @@
+// Package epub reads the text of EPUB books: the container names the OPF
+// package document, whose spine lists the chapters in reading order. Chapter
+// titles come from the table of contents, the EPUB 3 navigation document or
+// the EPUB 2 NCX, falling back to the chapter's first heading.
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"lingomarker/internal/readability"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// MaxFileSize limits the uncompressed size of each file read from a book.
+const MaxFileSize = 16 << 20
+
+var ErrNotEPUB = errors.New("not an EPUB book")
+
+// Book is the text of a book.
+type Book struct {
+	Title    string
+	Author   string
+	Language string
+	Chapters []Chapter // In reading order, without those that have no text
+}
+
+// Chapter is one document of the spine.
+type Chapter struct {
+	Title      string
+	Paragraphs []string // Whitespace collapsed, in document order
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type opfPackage struct {
+	Metadata struct {
+		Titles    []string `xml:"title"`
+		Creators  []string `xml:"creator"`
+		Languages []string `xml:"language"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		Itemrefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+type ncx struct {
+	NavPoints []navPoint `xml:"navMap>navPoint"`
+}
+
+type navPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Children []navPoint `xml:"navPoint"`
+}
+
+// Read reads a book from an EPUB file.
+func Read(r io.ReaderAt, size int64) (*Book, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrNotEPUB
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var c container
+	if err := decodeXML(files, "META-INF/container.xml", &c); err != nil {
+		return nil, err
+	}
+	opfPath := ""
+	for _, rf := range c.Rootfiles {
+		if rf.MediaType == "" || rf.MediaType == "application/oebps-package+xml" {
+			opfPath = rf.FullPath
+			break
+		}
+	}
+	if opfPath == "" {
+		return nil, fmt.Errorf("%w: no package document", ErrNotEPUB)
+	}
+	var pkg opfPackage
+	if err := decodeXML(files, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	book := &Book{
+		Title:    first(pkg.Metadata.Titles),
+		Author:   first(pkg.Metadata.Creators),
+		Language: first(pkg.Metadata.Languages),
+	}
+	hrefs := make(map[string]string, len(pkg.Manifest))
+	var navPath, ncxPath string
+	for _, item := range pkg.Manifest {
+		href := resolve(opfPath, item.Href)
+		hrefs[item.ID] = href
+		if strings.Contains(" "+item.Properties+" ", " nav ") {
+			navPath = href
+		}
+		if item.ID == pkg.Spine.Toc || (ncxPath == "" && item.MediaType == "application/x-dtbncx+xml") {
+			ncxPath = href
+		}
+	}
+	titles := make(map[string]string)
+	if navPath != "" {
+		navTitles(files, navPath, titles)
+	}
+	if len(titles) == 0 && ncxPath != "" {
+		ncxTitles(files, ncxPath, titles)
+	}
+
+	for _, ref := range pkg.Spine.Itemrefs {
+		href, ok := hrefs[ref.IDRef]
+		if !ok {
+			continue
+		}
+		f, ok := files[href]
+		if !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", href, err)
+		}
+		doc, err := readability.ExtractAll(limit(rc))
+		rc.Close()
+		if errors.Is(err, readability.ErrNoContent) {
+			continue // Cover pages and the like
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", href, err)
+		}
+		chapter := Chapter{Title: titles[href], Paragraphs: doc.Paragraphs}
+		if chapter.Title == "" {
+			chapter.Title = doc.Title
+		}
+		if chapter.Title == "" || chapter.Title == book.Title {
+			chapter.Title = fmt.Sprintf("Chapter %d", len(book.Chapters)+1)
+		}
+		book.Chapters = append(book.Chapters, chapter)
+	}
+	if len(book.Chapters) == 0 {
+		return nil, fmt.Errorf("%w: the book has no text", ErrNotEPUB)
+	}
+	if book.Title == "" {
+		book.Title = book.Chapters[0].Title
+	}
+	return book, nil
+}
+
+// navTitles collects the labels of the table of contents in an EPUB 3
+// navigation document, keyed by the file they point to. The first label of a
+// file wins.
+func navTitles(files map[string]*zip.File, navPath string, titles map[string]string) {
+	f, ok := files[navPath]
+	if !ok {
+		return
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+	doc, err := html.Parse(limit(rc))
+	if err != nil {
+		return
+	}
+
+	var toc *html.Node
+	var findTOC func(*html.Node)
+	findTOC = func(n *html.Node) {
+		if toc != nil {
+			return
+		}
+		if n.DataAtom == atom.Nav && attr(n, "epub:type") == "toc" {
+			toc = n
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			findTOC(c)
+		}
+	}
+	findTOC(doc)
+	if toc == nil {
+		return
+	}
+
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.DataAtom == atom.A {
+			href := resolve(navPath, attr(n, "href"))
+			if label := nodeText(n); label != "" && titles[href] == "" {
+				titles[href] = label
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(toc)
+}
+
+// ncxTitles collects the labels of an EPUB 2 NCX table of contents.
+func ncxTitles(files map[string]*zip.File, ncxPath string, titles map[string]string) {
+	var toc ncx
+	if err := decodeXML(files, ncxPath, &toc); err != nil {
+		return
+	}
+	var collect func([]navPoint)
+	collect = func(points []navPoint) {
+		for _, p := range points {
+			href := resolve(ncxPath, p.Content.Src)
+			if label := strings.Join(strings.Fields(p.Label), " "); label != "" && titles[href] == "" {
+				titles[href] = label
+			}
+			collect(p.Children)
+		}
+	}
+	collect(toc.NavPoints)
+}
+
+func decodeXML(files map[string]*zip.File, name string, v any) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%w: %s is missing", ErrNotEPUB, name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+	dec := xml.NewDecoder(limit(rc))
+	dec.Strict = false
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: invalid %s: %v", ErrNotEPUB, name, err)
+	}
+	return nil
+}
+
+// resolve returns the path within the book of href, which is relative to
+// the file base and may carry a fragment.
+func resolve(base, href string) string {
+	href, _, _ = strings.Cut(href, "#")
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return path.Join(path.Dir(base), href)
+}
+
+func limit(r io.Reader) io.Reader {
+	return io.LimitReader(r, MaxFileSize)
+}
+
+func first(values []string) string {
+	for _, v := range values {
+		if v = strings.Join(strings.Fields(v), " "); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		dir  string // In testdata, zipped by the test
+		want *Book
+	}{
+		{
+			// Titles from the navigation document; a cover without text, an
+			// unknown and a missing spine item are skipped.
+			dir: "epub3",
+			want: &Book{
+				Title:    "The Voyage",
+				Author:   "Ann Example",
+				Language: "en",
+				Chapters: []Chapter{
+					{Title: "1. Leaving Port", Paragraphs: []string{
+						"It was a bright, cold day, and the ship left the harbour at dawn.",
+						"Nobody on board knew where the voyage would end.",
+					}},
+					{Title: "2. At Sea", Paragraphs: []string{"The wind rose on the second night."}},
+					{Title: "Chapter 3", Paragraphs: []string{"They saw land at last."}},
+				},
+			},
+		},
+		{
+			// Titles from the NCX, or the first heading; the book is named
+			// after its first chapter.
+			dir: "epub2",
+			want: &Book{
+				Title:    "Erstes Kapitel",
+				Language: "de",
+				Chapters: []Chapter{
+					{Title: "Erstes Kapitel", Paragraphs: []string{"Es war einmal ein kleines Haus am Meer."}},
+					{Title: "Zweites Kapitel", Paragraphs: []string{"Das Haus war leer."}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			data := zipDir(t, filepath.Join("testdata", tt.dir), nil)
+			book, err := Read(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(book, tt.want) {
+				t.Errorf("book = %+v\nwant %+v", book, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace map[string]string // File contents to replace; empty removes the file
+	}{
+		{name: "no container", replace: map[string]string{"META-INF/container.xml": ""}},
+		{name: "no package document", replace: map[string]string{"META-INF/container.xml": `<container>
+			<rootfiles><rootfile full-path="OPS/book.pdf" media-type="application/pdf"/></rootfiles>
+		</container>`}},
+		{name: "package document missing", replace: map[string]string{"OPS/book.opf": ""}},
+		{name: "package document not XML", replace: map[string]string{"OPS/book.opf": "%PDF-1.4"}},
+		{name: "no text", replace: map[string]string{
+			"OPS/a.html": "<html><body><img src='a.png'></body></html>",
+			"OPS/b.html": "",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := zipDir(t, filepath.Join("testdata", "epub2"), tt.replace)
+			if book, err := Read(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrNotEPUB) {
+				t.Errorf("Read = %+v, %v; want ErrNotEPUB", book, err)
+			}
+		})
+	}
+
+	data := []byte("PK not really a zip")
+	if _, err := Read(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrNotEPUB) {
+		t.Errorf("Read of a non-zip file err = %v, want ErrNotEPUB", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct{ base, href, want string }{
+		{"OEBPS/content.opf", "text/one.xhtml", "OEBPS/text/one.xhtml"},
+		{"OEBPS/nav.xhtml", "text/one.xhtml#start", "OEBPS/text/one.xhtml"},
+		{"OEBPS/text/one.xhtml", "../images/a.jpg", "OEBPS/images/a.jpg"},
+		{"content.opf", "chapter%20two.xhtml", "chapter two.xhtml"},
+		{"content.opf", "100%.xhtml", "100%.xhtml"}, // Not an escape
+	}
+	for _, tt := range tests {
+		if got := resolve(tt.base, tt.href); got != tt.want {
+			t.Errorf("resolve(%q, %q) = %q, want %q", tt.base, tt.href, got, tt.want)
+		}
+	}
+}
+
+// zipDir zips the files under dir, with mimetype first as EPUB requires,
+// replacing the contents of files named in replace.
+func zipDir(t *testing.T, dir string, replace map[string]string) []byte {
+	t.Helper()
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)], err = os.ReadFile(p)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range replace {
+		if content == "" {
+			delete(files, name)
+		} else {
+			files[name] = []byte(content)
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, method uint16) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err == nil {
+			_, err = w.Write(files[name])
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("mimetype", zip.Store)
+	for name := range files {
+		if name != "mimetype" {
+			add(name, zip.Deflate)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,299 @@
+// Package feeds reads podcast feeds, RSS 2.0 with the iTunes extensions or
+// Atom, and downloads their episodes.
+package feeds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const itunesNS = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+var ErrNotFeed = errors.New("not an RSS or Atom feed")
+
+// Feed is a podcast and its episodes.
+type Feed struct {
+	Title       string
+	Author      string // iTunes author, else the feed's author; may be empty
+	Description string
+	Episodes    []Episode // Newest first
+}
+
+// Episode is an item of a feed with an audio enclosure.
+type Episode struct {
+	GUID        string // Stable ID of the item, the enclosure URL if the feed has none
+	Title       string
+	Description string // Plain text
+	AudioURL    string
+	AudioType   string    // MIME type, may be empty
+	Published   time.Time // Zero if the feed has no date
+}
+
+// audioExtensions are the file types episodes are stored as, by MIME type.
+var audioExtensions = map[string]string{
+	"audio/mpeg":  ".mp3",
+	"audio/mp3":   ".mp3",
+	"audio/mp4":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/aac":   ".m4a",
+	"audio/ogg":   ".ogg",
+	"audio/wav":   ".wav",
+	"audio/x-wav": ".wav",
+}
+
+// Extension returns the file extension to store the episode's audio with, or
+// "" if it is not in a format podcasts can be uploaded in.
+func (e Episode) Extension() string {
+	mediaType, _, _ := mime.ParseMediaType(e.AudioType)
+	if ext, ok := audioExtensions[strings.ToLower(mediaType)]; ok {
+		return ext
+	}
+	u, err := url.Parse(e.AudioURL)
+	if err != nil {
+		return ""
+	}
+	switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+	case ".mp3", ".m4a", ".ogg", ".wav":
+		return ext
+	}
+	return ""
+}
+
+type rss struct {
+	Channel struct {
+		Title          string    `xml:"title"`
+		Description    string    `xml:"description"`
+		ManagingEditor string    `xml:"managingEditor"`
+		ITunesAuthor   string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+		ITunesSummary  string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+		Items          []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title         string `xml:"title"`
+	ITunesTitle   string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	GUID          string `xml:"guid"`
+	Description   string `xml:"description"`
+	ITunesSummary string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	PubDate       string `xml:"pubDate"`
+	Enclosure     struct {
+		URL  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"enclosure"`
+}
+
+type atom struct {
+	Title    string `xml:"title"`
+	Subtitle string `xml:"subtitle"`
+	Author   struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Entries []struct {
+		ID        string `xml:"id"`
+		Title     string `xml:"title"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Links     []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// Parse reads an RSS or Atom feed. Items without an enclosure are left out;
+// relative enclosure URLs are resolved against base, which may be nil.
+func Parse(r io.Reader, base *url.URL) (*Feed, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var root string
+	dec := newDecoder(bytes.NewReader(data))
+	for root == "" {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, ErrNotFeed
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			root = start.Name.Local
+		}
+	}
+
+	feed := &Feed{}
+	switch root {
+	case "rss":
+		var doc rss
+		if err := newDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotFeed, err)
+		}
+		c := doc.Channel
+		feed.Title = collapse(c.Title)
+		feed.Author = collapse(first(c.ITunesAuthor, c.ManagingEditor))
+		feed.Description = plainText(first(c.ITunesSummary, c.Description))
+		for _, item := range c.Items {
+			if item.Enclosure.URL == "" {
+				continue
+			}
+			ep := Episode{
+				GUID:        collapse(item.GUID),
+				Title:       collapse(first(item.ITunesTitle, item.Title)),
+				Description: plainText(first(item.Description, item.ITunesSummary)),
+				AudioURL:    resolve(base, item.Enclosure.URL),
+				AudioType:   item.Enclosure.Type,
+				Published:   parseDate(item.PubDate),
+			}
+			feed.Episodes = append(feed.Episodes, ep)
+		}
+	case "feed":
+		var doc atom
+		if err := newDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotFeed, err)
+		}
+		feed.Title = collapse(doc.Title)
+		feed.Author = collapse(doc.Author.Name)
+		feed.Description = plainText(doc.Subtitle)
+		for _, entry := range doc.Entries {
+			ep := Episode{
+				GUID:        collapse(entry.ID),
+				Title:       collapse(entry.Title),
+				Description: plainText(first(entry.Summary, entry.Content)),
+				Published:   parseDate(first(entry.Published, entry.Updated)),
+			}
+			for _, link := range entry.Links {
+				if link.Rel == "enclosure" && link.Href != "" {
+					ep.AudioURL, ep.AudioType = resolve(base, link.Href), link.Type
+					break
+				}
+			}
+			if ep.AudioURL != "" {
+				feed.Episodes = append(feed.Episodes, ep)
+			}
+		}
+	default:
+		return nil, ErrNotFeed
+	}
+
+	for i := range feed.Episodes {
+		ep := &feed.Episodes[i]
+		if ep.GUID == "" {
+			ep.GUID = ep.AudioURL
+		}
+		if ep.Title == "" {
+			ep.Title = path.Base(ep.AudioURL)
+		}
+	}
+	// Feeds usually list the newest first; sort only when every item is dated.
+	dated := true
+	for _, ep := range feed.Episodes {
+		dated = dated && !ep.Published.IsZero()
+	}
+	if dated {
+		sort.SliceStable(feed.Episodes, func(i, j int) bool {
+			return feed.Episodes[i].Published.After(feed.Episodes[j].Published)
+		})
+	}
+	return feed, nil
+}
+
+func newDecoder(r io.Reader) *xml.Decoder {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+	return dec
+}
+
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02",
+}
+
+func parseDate(s string) time.Time {
+	s = collapse(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// plainText returns the text of an HTML description with whitespace
+// collapsed, keeping paragraph breaks.
+func plainText(s string) string {
+	if !strings.Contains(s, "<") {
+		return collapse(html.UnescapeString(s))
+	}
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return collapse(s)
+	}
+	var b strings.Builder
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && (n.Data == "p" || n.Data == "br" || n.Data == "li"):
+			b.WriteString("\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = collapse(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
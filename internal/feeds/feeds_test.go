@@ -0,0 +1,141 @@
+package feeds
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://club.example.org/podcast/feed.xml")
+	tests := []struct {
+		file     string
+		title    string
+		author   string
+		desc     string
+		episodes []Episode
+		err      error
+	}{
+		{
+			file:   "itunes.xml",
+			title:  "Planet Money",
+			author: "NPR",
+			desc:   "The economy, explained.\nTwice a week.",
+			episodes: []Episode{
+				{
+					GUID:        "pm-101",
+					Title:       "Newer episode",
+					Description: "First paragraph.\nSecond\nline.",
+					AudioURL:    "https://cdn.example.org/pm/101.m4a",
+					AudioType:   "audio/x-m4a",
+					Published:   time.Date(2025, 3, 7, 9, 30, 0, 0, time.UTC),
+				},
+				{
+					GUID:        "pm-100",
+					Title:       "Older episode",
+					Description: "Short & plain.",
+					AudioURL:    "https://cdn.example.org/pm/100.mp3",
+					AudioType:   "audio/mpeg",
+					Published:   time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			file:   "atom.xml",
+			title:  "Slow German",
+			author: "Annik Rubens",
+			desc:   "Deutsch lernen, langsam gesprochen.",
+			episodes: []Episode{
+				{
+					GUID:        "urn:uuid:2",
+					Title:       "Folge 2: Fahrrad",
+					Description: "Radfahren in Berlin.",
+					AudioURL:    "https://example.de/audio/folge-2.mp3",
+					AudioType:   "audio/mpeg",
+					Published:   time.Date(2025, 2, 14, 7, 0, 0, 0, time.UTC),
+				},
+				{
+					GUID:        "urn:uuid:1",
+					Title:       "Folge 1: Brot",
+					Description: "Über deutsches Brot.",
+					AudioURL:    "https://example.de/audio/folge-1.ogg",
+					AudioType:   "audio/ogg",
+					Published:   time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			// Relative enclosures resolve against the feed URL; undated items
+			// keep the feed's order.
+			file:  "relative.xml",
+			title: "Club Radio",
+			episodes: []Episode{
+				{
+					GUID:      "https://club.example.org/podcast/episodes/two.mp3",
+					Title:     "Second upload",
+					AudioURL:  "https://club.example.org/podcast/episodes/two.mp3",
+					AudioType: "audio/mpeg",
+				},
+				{
+					GUID:     "https://club.example.org/media/one.wav",
+					Title:    "one.wav",
+					AudioURL: "https://club.example.org/media/one.wav",
+				},
+			},
+		},
+		{file: "page.html", err: ErrNotFeed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			feed, err := Parse(f, base)
+			checkFeed(t, feed, err, tt.title, tt.author, tt.desc, tt.episodes, tt.err)
+		})
+	}
+}
+
+func TestEpisodeExtension(t *testing.T) {
+	tests := []struct {
+		ep   Episode
+		want string
+	}{
+		{Episode{AudioType: "audio/mpeg", AudioURL: "https://example.org/play?id=1"}, ".mp3"},
+		{Episode{AudioType: "audio/x-m4a; charset=binary"}, ".m4a"},
+		{Episode{AudioURL: "https://example.org/a/Episode.OGG?token=x"}, ".ogg"},
+		{Episode{AudioType: "video/mp4", AudioURL: "https://example.org/a/episode.mp4"}, ""},
+		{Episode{AudioURL: "https://example.org/a/episode"}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.ep.Extension(); got != tt.want {
+			t.Errorf("Extension(%q, %q) = %q, want %q", tt.ep.AudioType, tt.ep.AudioURL, got, tt.want)
+		}
+	}
+}
+
+func checkFeed(t *testing.T, feed *Feed, err error, title, author, desc string, episodes []Episode, wantErr error) {
+	t.Helper()
+	if wantErr != nil {
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("err = %v, want %v", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if feed.Title != title || feed.Author != author || feed.Description != desc {
+		t.Errorf("feed = %q, %q, %q; want %q, %q, %q", feed.Title, feed.Author, feed.Description, title, author, desc)
+	}
+	if !reflect.DeepEqual(feed.Episodes, episodes) {
+		t.Errorf("episodes = %+v\nwant %+v", feed.Episodes, episodes)
+	}
+}
@@ -0,0 +1,101 @@
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lingomarker/internal/safehttp"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// MaxFeedSize limits the feeds Fetch downloads.
+const MaxFeedSize = 10 << 20
+
+var (
+	ErrInvalidURL       = errors.New("invalid URL")
+	ErrTooLarge         = errors.New("download exceeds the size limit")
+	ErrForbiddenAddress = safehttp.ErrForbiddenAddress
+)
+
+// fetchTimeout bounds fetching a feed. Episodes take as long as they take;
+// callers bound them with a context.
+const fetchTimeout = 30 * time.Second
+
+// Client fetches feeds and their episodes.
+type Client struct {
+	HTTP *http.Client
+}
+
+// NewClient returns a client that only connects to public addresses.
+func NewClient() *Client {
+	return &Client{HTTP: safehttp.NewClient(0)}
+}
+
+// Fetch downloads and parses the feed at feedURL.
+func (c *Client) Fetch(ctx context.Context, feedURL string) (*Feed, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	resp, err := c.get(ctx, feedURL, "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxFeedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", feedURL, err)
+	}
+	if len(body) > MaxFeedSize {
+		return nil, fmt.Errorf("%w of %dMB for feeds", ErrTooLarge, MaxFeedSize>>20)
+	}
+	return Parse(bytes.NewReader(body), resp.Request.URL)
+}
+
+// Download copies the file at fileURL to w, failing once more than max bytes
+// arrive. Returns the number of bytes written.
+func (c *Client) Download(ctx context.Context, fileURL string, w io.Writer, max int64) (int64, error) {
+	resp, err := c.get(ctx, fileURL, "*/*")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > max {
+		return 0, fmt.Errorf("%w of %dMB", ErrTooLarge, max>>20)
+	}
+
+	n, err := io.Copy(w, io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return n, fmt.Errorf("downloading %s: %w", fileURL, err)
+	}
+	if n > max {
+		return n, fmt.Errorf("%w of %dMB", ErrTooLarge, max>>20)
+	}
+	return n, nil
+}
+
+func (c *Client) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w %q, expected an http or https URL", ErrInvalidURL, rawURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; LingoMarker)")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", u, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/podcast/", http.StripPrefix("/podcast/", http.FileServer(http.Dir("testdata"))))
+	mux.HandleFunc("/moved.xml", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/podcast/relative.xml", http.StatusFound)
+	})
+	mux.HandleFunc("/podcast/episodes/two.mp3", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte{0xff}, 1000))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClientFetch(t *testing.T) {
+	srv := newTestServer(t)
+	c := &Client{HTTP: srv.Client()}
+
+	feed, err := c.Fetch(context.Background(), srv.URL+"/podcast/itunes.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Planet Money" || len(feed.Episodes) != 2 {
+		t.Errorf("feed = %q with %d episodes, want Planet Money with 2", feed.Title, len(feed.Episodes))
+	}
+
+	// Relative enclosures resolve against the URL after redirects.
+	feed, err = c.Fetch(context.Background(), srv.URL+"/moved.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := srv.URL + "/podcast/episodes/two.mp3"; len(feed.Episodes) == 0 || feed.Episodes[0].AudioURL != want {
+		t.Errorf("episodes = %+v, want the first at %s", feed.Episodes, want)
+	}
+
+	tests := []struct {
+		url     string
+		wantErr error
+		wantMsg string
+	}{
+		{url: srv.URL + "/podcast/page.html", wantErr: ErrNotFeed},
+		{url: srv.URL + "/podcast/missing.xml", wantMsg: "404"},
+		{url: "ftp://example.org/feed.xml", wantErr: ErrInvalidURL},
+		{url: "not a url", wantErr: ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		_, err := c.Fetch(context.Background(), tt.url)
+		if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) || !strings.Contains(err.Error(), tt.wantMsg) {
+			t.Errorf("Fetch(%q) err = %v, want %v %q", tt.url, err, tt.wantErr, tt.wantMsg)
+		}
+	}
+}
+
+func TestClientDownload(t *testing.T) {
+	srv := newTestServer(t)
+	c := &Client{HTTP: srv.Client()}
+	fileURL := srv.URL + "/podcast/episodes/two.mp3"
+
+	var buf bytes.Buffer
+	n, err := c.Download(context.Background(), fileURL, &buf, 1000)
+	if err != nil || n != 1000 || buf.Len() != 1000 {
+		t.Errorf("Download = %d, %v with %d bytes written, want 1000", n, err, buf.Len())
+	}
+
+	buf.Reset()
+	if _, err := c.Download(context.Background(), fileURL, &buf, 999); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Download over the limit err = %v, want %v", err, ErrTooLarge)
+	}
+}
+
+func TestNewClientRefusesLocalAddresses(t *testing.T) {
+	srv := newTestServer(t)
+	_, err := NewClient().Fetch(context.Background(), srv.URL+"/podcast/itunes.xml")
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("err = %v, want %v", err, ErrForbiddenAddress)
+	}
+}
@@ -1,22 +1,25 @@
 package handlers
 
 import (
-	"bytes"
-	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"lingomarker/internal/config"
 	"lingomarker/internal/database"
+	"lingomarker/internal/jobs"
 	"lingomarker/internal/models"
+	"lingomarker/internal/quiz"
 	"lingomarker/internal/router"
-	"lingomarker/internal/transcription"
+	"lingomarker/internal/srs"
+	"lingomarker/internal/storage"
+	"lingomarker/internal/subtitles"
+	"lingomarker/internal/wordforms"
 	"log"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -25,9 +28,11 @@ import (
 )
 
 type APIHandlers struct {
-	DB               *database.DB
-	Cfg              *config.Config
-	TranscriptionSvc *transcription.Service
+	DB             database.Store
+	Cfg            *config.Config
+	Blobs          storage.BlobStore
+	Transcriptions *jobs.TranscriptionPool
+	Feeds          *jobs.FeedPoller
 }
 
 // Helper to write JSON responses
@@ -47,6 +52,19 @@ func writeJSONError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, map[string]string{"error": message})
 }
 
+// extendDeadlines gives a request that moves large files server.transfer_timeout,
+// rather than the server-wide timeout, to read its body and write its response.
+func (h *APIHandlers) extendDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(h.Cfg.Server.TransferTimeout)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		log.Printf("Failed to extend read deadline: %v", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		log.Printf("Failed to extend write deadline: %v", err)
+	}
+}
+
 // --- API Endpoints ---
 
 // HandleSessionCheck verifies session and returns user info + settings
@@ -75,19 +93,51 @@ func (h *APIHandlers) HandleSessionCheck(w http.ResponseWriter, r *http.Request)
 		settings = &models.UserSettings{ /* Populate with defaults if necessary */ }
 	}
 
+	dicts, err := h.DB.GetDictionaries(userID)
+	if err != nil {
+		log.Printf("API Session Check: Failed to get dictionaries for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve dictionaries")
+		return
+	}
+	dict, err := h.resolveDictionary(userID, settings, r.URL.Query().Get("dictionary"))
+	if err != nil {
+		if errors.Is(err, database.ErrDictionaryNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Dictionary not found: "+r.URL.Query().Get("dictionary"))
+			return
+		}
+		log.Printf("API Session Check: Failed to resolve dictionary for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve dictionaries")
+		return
+	}
+	// Clients read the lookup URL and color from the settings; the
+	// dictionary's own ones take precedence.
+	if dict.DictBaseURL != "" {
+		settings.DictBaseURL = dict.DictBaseURL
+	}
+	if dict.HighlightColor != "" {
+		settings.HighlightColor = dict.HighlightColor
+	}
+
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"authenticated": true,
 		"userID":        userID,
 		"username":      user.Username,
 		"name":          user.Name,
 		"settings":      settings, // Embed the user settings object
+		"dictionary":    dict,
+		"dictionaries":  dicts,
 	})
 }
 
-// HandleGetData retrieves all user data (words a.k.a. entries) for highlighting
+// HandleGetData retrieves the user data (words a.k.a. entries) of one
+// dictionary for highlighting, selected with ?dictionary=
 func (h *APIHandlers) HandleGetData(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(UserIDContextKey).(int64)
-	bundle, err := h.DB.GetUserDataBundle(userID)
+	dict, _ := h.requestDictionary(w, r, "")
+	if dict == nil {
+		return
+	}
+	bundle, err := h.DB.GetUserDataBundle(userID, dict.ID)
 	if err != nil {
 		log.Printf("API GetData: Failed for user %d: %v", userID, err)
 		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve user data")
@@ -105,6 +155,7 @@ type MarkWordRequest struct {
 	ParagraphHash        string  `json:"paragraphHash"`                  // Pre-calculated by UserScript
 	EntryUUID            *string `json:"entryUUID"`                      // Optional: UUID if word already exists client-side
 	TranscriptSegmentRef *string `json:"transcriptSegmentRef,omitempty"` // Optional
+	Dictionary           string  `json:"dictionary,omitempty"`           // Optional: ID or name, for new words
 }
 
 // HandleMarkWord handles adding/updating a word selection
@@ -124,278 +175,153 @@ func (h *APIHandlers) HandleMarkWord(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 2. Begin Transaction
-	tx, err := h.DB.Begin()
-	if err != nil {
-		log.Printf("API MarkWord: Failed to begin transaction for user %d: %v", userID, err)
-		writeJSONError(w, http.StatusInternalServerError, "Database error")
-		return
-	}
-	// Use a custom DB struct that wraps the transaction
-	/// txDB := &database.DB{DB: h.DB.DB} // Need DB for GetUserSettings etc.
-	// We need helper functions in database.go that accept a *sql.Tx or similar interface
-
-	// *** Refactor database.go required ***
-	// The database methods need to accept a Querier interface (implemented by *sql.DB and *sql.Tx)
-	// Or, pass the transaction explicitly. Let's pass explicitly for now.
-
-	// Rollback helper
-	rollback := func(tx *sql.Tx, msg string, err error) {
-		log.Printf("%s for user %d: %v", msg, userID, err)
-		if rbErr := tx.Rollback(); rbErr != nil {
-			log.Printf("API MarkWord: Error rolling back transaction for user %d: %v", userID, rbErr)
-		}
-		writeJSONError(w, http.StatusInternalServerError, "Failed to process request")
-	}
-
-	// 3. Upsert URL and Paragraph (do this outside the main entry logic if possible)
-	dbURL := &models.URL{UserID: userID, URLHash: req.URLHash, URL: req.URL, Title: req.Title}
-	if err := h.DB.UpsertURL(dbURL); err != nil { // UpsertURL uses its own connection pool logic
-		log.Printf("API MarkWord: Failed to upsert URL %s for user %d: %v", req.URLHash, userID, err)
-		// Not necessarily fatal, maybe log and continue? Or error out? Let's error for now.
-		writeJSONError(w, http.StatusInternalServerError, "Failed to save URL data")
-		return
-	}
-
-	dbPara := &models.Paragraph{UserID: userID, ParagraphHash: req.ParagraphHash, Text: req.ParagraphText}
-	if err := h.DB.UpsertParagraph(dbPara); err != nil { // UpsertParagraph uses its own connection pool logic
-		log.Printf("API MarkWord: Failed to upsert Paragraph %s for user %d: %v", req.ParagraphHash, userID, err)
-		writeJSONError(w, http.StatusInternalServerError, "Failed to save paragraph data")
-		return
-	}
-
-	// 4. Find or Create Entry
+	// 2. Resolve the entry. Only an unknown word needs new forms.
+	var newEntry *models.Entry
 	entryUUID := ""
 	if req.EntryUUID != nil {
-		entryUUID = *req.EntryUUID
-		// Verify it exists for the user
-		_, err := h.DB.GetEntryByUUID(userID, entryUUID) // Check existence
+		existing, err := h.DB.GetEntryByUUID(userID, *req.EntryUUID)
 		if err != nil {
-			rollback(tx, fmt.Sprintf("API MarkWord: Error verifying existing entry UUID %s", entryUUID), err)
-			return
-		}
-		// If err is sql.ErrNoRows, treat as a new word case below
-		if err == sql.ErrNoRows {
-			entryUUID = "" // Force creation path
-		} else if err != nil {
-			// Handle other DB errors
-			rollback(tx, fmt.Sprintf("API MarkWord: DB error verifying existing entry UUID %s", entryUUID), err)
+			log.Printf("API MarkWord: DB error verifying existing entry UUID %s for user %d: %v", *req.EntryUUID, userID, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to process request")
 			return
 		}
+		if existing != nil {
+			entryUUID = existing.UUID
+		} // Unknown UUID: treat as a new word below
 	}
 
-	var finalEntry *models.Entry
-
 	if entryUUID == "" { // Word is new or UUID wasn't provided/valid
-		// Generate a new UUID server-side
-		entryUUID = uuid.NewString()
-
-		// --- Call Gemini API ---
-		settings, err := h.DB.GetUserSettings(userID)
-		if err != nil {
-			rollback(tx, "API MarkWord: Failed to get user settings", err)
-			return
-		}
-		if settings == nil || settings.GeminiAPIKey == "" {
-			rollback(tx, "API MarkWord: Gemini API key not set for user", errors.New("API key not set"))
-			// Or, insert entry without forms? For now require key.
-			writeJSONError(w, http.StatusPreconditionFailed, "Gemini API key not configured in settings.")
+		dict, settings := h.requestDictionary(w, r, req.Dictionary)
+		if dict == nil {
 			return
 		}
+		language := h.dictionaryLanguage(dict)
+
+		// --- Expand word forms (outside the transaction, providers can be slow) ---
+		cache := h.formsCache(language)
+		forms, cached := cache.Get(req.Word)
+		if !cached {
+			provider, err := h.formsProvider(settings, language)
+			if err != nil {
+				log.Printf("API MarkWord: No usable word forms provider for user %d: %v", userID, err)
+				if errors.Is(err, wordforms.ErrMissingAPIKey) {
+					writeJSONError(w, http.StatusPreconditionFailed, "Gemini API key not configured in settings. Set a key or choose the built-in word forms provider.")
+					return
+				}
+				if errors.Is(err, wordforms.ErrUnsupportedLanguage) {
+					writeJSONError(w, http.StatusPreconditionFailed, "The built-in word forms provider only knows English. Choose another provider for this dictionary.")
+					return
+				}
+				writeJSONError(w, http.StatusPreconditionFailed, "Word forms provider misconfigured: "+err.Error())
+				return
+			}
 
-		wordForms, err := callGeminiForEntryForms(h.Cfg, settings.GeminiAPIKey, req.Word)
-		if err != nil {
-			rollback(tx, "API MarkWord: Failed to get word forms from Gemini", err)
-			// Return a specific error?
-			writeJSONError(w, http.StatusFailedDependency, "Failed to retrieve word forms: "+err.Error())
-			return
+			forms, err = provider.Forms(r.Context(), req.Word)
+			if err != nil {
+				log.Printf("API MarkWord: Failed to get word forms from %s for user %d: %v", provider.Name(), userID, err)
+				writeJSONError(w, http.StatusFailedDependency, "Failed to retrieve word forms: "+err.Error())
+				return
+			}
+			cache.Put(req.Word, provider.Name(), forms)
 		}
-		// --- End Gemini API Call ---
-
-		var word string
+		// --- End word forms ---
 
-		if len(wordForms) > 0 {
-			word = strings.Split(wordForms, "|")[0]
-		} else {
-			word = req.Word
+		word := req.Word
+		if len(forms) > 0 {
+			word = forms[0]
 		}
 
-		newEntry := &models.Entry{
+		// Generate a new UUID server-side
+		entryUUID = uuid.NewString()
+		newEntry = &models.Entry{
 			UUID:               entryUUID,
 			UserID:             userID,
+			DictionaryID:       dict.ID,
 			Word:               word,
-			FormsPipeSeparated: wordForms,
-			// CreatedAt/UpdatedAt set by DB default/trigger
-		}
-		if err := h.DB.UpsertEntry(newEntry); err != nil { // UpsertEntry uses its own connection logic
-			rollback(tx, "API MarkWord: Failed to insert new entry", err)
-			return
+			FormsPipeSeparated: wordforms.Join(forms),
 		}
-		finalEntry = newEntry
-		finalEntry.CreatedAt = time.Now() // Approximate time for response
-		finalEntry.UpdatedAt = time.Now()
-	} else {
-		// Word exists, we just need to update relation timestamp
-		// Fetch the existing entry to return it
-		existingEntry, err := h.DB.GetEntryByUUID(userID, entryUUID)
-		if err != nil || existingEntry == nil {
-			rollback(tx, fmt.Sprintf("API MarkWord: Failed to fetch existing entry %s after check", entryUUID), err)
-			return
-		}
-		finalEntry = existingEntry
 	}
 
-	// 5. Upsert Relation (always update timestamp)
-	relation := &models.Relation{
-		UserID:               userID,
-		EntryUUID:            entryUUID,
-		URLHash:              req.URLHash,
-		ParagraphHash:        req.ParagraphHash,
-		TranscriptSegmentRef: req.TranscriptSegmentRef,
-		// CreatedAt/UpdatedAt handled by DB trigger/logic
-	}
-	if err := h.DB.UpsertRelation(relation); err != nil { // UpsertRelation uses its own connection logic
-		rollback(tx, "API MarkWord: Failed to upsert relation", err)
+	// 3. Write URL, paragraph, entry and relation in one transaction
+	finalEntry, err := h.DB.MarkWord(&database.MarkWordInput{
+		URL:       models.URL{UserID: userID, URLHash: req.URLHash, URL: req.URL, Title: req.Title},
+		Paragraph: models.Paragraph{UserID: userID, ParagraphHash: req.ParagraphHash, Text: req.ParagraphText},
+		NewEntry:  newEntry,
+		Relation: models.Relation{
+			UserID:               userID,
+			EntryUUID:            entryUUID,
+			URLHash:              req.URLHash,
+			ParagraphHash:        req.ParagraphHash,
+			TranscriptSegmentRef: req.TranscriptSegmentRef,
+		},
+	})
+	if err != nil {
+		log.Printf("API MarkWord: Failed to save word %q for user %d: %v", req.Word, userID, err)
+		if errors.Is(err, database.ErrEntryNotFound) {
+			writeJSONError(w, http.StatusConflict, "Entry was deleted, please retry")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "Failed to process request")
 		return
 	}
 
-	// 6. Commit Transaction (Only if transaction was used for entry creation logic - refactor needed)
-	// Since Upserts currently handle their own connections, explicit tx commit isn't right here.
-	// The Upsert logic needs refactoring to accept a *sql.Tx if we want true atomicity.
-	// For now, we assume individual upserts are atomic enough.
-	/*
-	    if err := tx.Commit(); err != nil {
-	       log.Printf("API MarkWord: Failed to commit transaction for user %d: %v", userID, err)
-	       writeJSONError(w, http.StatusInternalServerError, "Database error during commit")
-	       return
-	   }
-	*/
-
-	// 7. Return the final Entry object (including generated UUID and forms if new)
+	// 4. Return the final Entry object (including generated UUID and forms if new)
 	writeJSON(w, http.StatusOK, finalEntry)
 }
 
-// callGeminiForEntryForms interacts with the Gemini API
-func callGeminiForEntryForms(cfg *config.Config, apiKey, entry string) (string, error) {
-	if apiKey == "" {
-		return "", errors.New("Gemini API key is missing")
-	}
-	if entry == "" {
-		return "", errors.New("word cannot be empty")
-	}
-
-	log.Printf("API callGeminiForEntryForms: %s", entry)
-
-	// Use the prompt generation logic from the UserScript
-	prompt := fmt.Sprintf(`List all possible forms (including verb conjugations, plural forms, etc.) of the provided word/phrase "%s", separated by the pipe symbol '|'. Do not include any additional text or explanations.
- For example, if the input word is any of the words "glitch", "glitches", the output will be "glitch|glitches".
- For example, if the input word is any of the words "run", "runs" , "ran", "running", the output will be "run|runs|ran|running".
- For example, if the input word is any of the words "spare", "sparer" , "sparest", "sparely", "spares", "spared", "sparing", the output will be "spare|sparer|sparest|sparely|spares|spared|sparing".
- For example, if the input phrase is any of the phrases "freak out", "freaks out", "freaked out", "freaking out", the output will be "freak out|freaks out|freaked out|freaking out".
- For example, if the input phrase is any of the phrases "loan shark", "loan sharks", the output will be "loan shark|loan sharks".
- For example, if the input phrase is any of the phrases "off the cuff", "off-the-cuff", the output will be "off the cuff|off-the-cuff".
- `, entry)
-
-	apiURL := fmt.Sprintf("%s?key=%s", cfg.Gemini.APIEndpoint, apiKey)
-
-	requestBody := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{"text": prompt},
-				},
-			},
-		},
-		// Add safety settings or generation config if needed
-		"generationConfig": map[string]interface{}{
-			"temperature":     0.3, // Adjust as needed
-			"maxOutputTokens": 2048,
-		},
-		"safetySettings": []map[string]string{
-			{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_NONE"},
-			{"category": "HARM_CATEGORY_HATE_SPEECH", "threshold": "BLOCK_NONE"},
-			{"category": "HARM_CATEGORY_SEXUALLY_EXPLICIT", "threshold": "BLOCK_NONE"},
-			{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "threshold": "BLOCK_NONE"},
-		},
-	}
+// formsCache returns the word forms cache of a language, shared by all users.
+func (h *APIHandlers) formsCache(language string) *wordforms.Cache {
+	return &wordforms.Cache{Store: h.DB, Language: language, TTL: h.Cfg.WordForms.CacheTTL}
+}
 
-	jsonData, err := json.Marshal(requestBody)
+// HandleInvalidateWordForms drops a word from the shared word forms cache so the
+// next user marking it gets a fresh lookup. The cache is shared by all users,
+// so only those listed in word_forms.cache_admins may do this.
+// DELETE /api/wordforms/cache?word=...
+func (h *APIHandlers) HandleInvalidateWordForms(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	user, err := h.DB.GetUserByID(userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal Gemini request body: %w", err)
+		log.Printf("API InvalidateWordForms: Failed to get user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve user")
+		return
 	}
-
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create Gemini request: %w", err)
+	if user == nil || !slices.Contains(h.Cfg.WordForms.CacheAdmins, user.Username) {
+		writeJSONError(w, http.StatusForbidden, "Only word forms cache admins can invalidate shared word forms")
+		return
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 20 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to call Gemini API: %w", err)
+	word := wordforms.Normalize(r.URL.Query().Get("word"))
+	if word == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing word query parameter")
+		return
 	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read Gemini response body: %w", err)
+	language := r.URL.Query().Get("language")
+	if language == "" {
+		language = h.Cfg.WordForms.Language
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Gemini API Error: Status %d, Body: %s", resp.StatusCode, string(bodyBytes))
-		// Try to parse error message from Gemini response if possible
-		var errorResp map[string]interface{}
-		if json.Unmarshal(bodyBytes, &errorResp) == nil {
-			if errData, ok := errorResp["error"].(map[string]interface{}); ok {
-				if msg, ok := errData["message"].(string); ok {
-					return "", fmt.Errorf("Gemini API error (%d): %s", resp.StatusCode, msg)
-				}
-			}
-		}
-		return "", fmt.Errorf("Gemini API request failed with status code %d", resp.StatusCode)
-	}
-
-	// Parse the response
-	var result struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-			FinishReason string `json:"finishReason"`
-			// SafetyRatings can be checked here if needed
-		} `json:"candidates"`
-		// PromptFeedback might contain block reasons
-		PromptFeedback *struct {
-			BlockReason string `json:"blockReason"`
-		} `json:"promptFeedback"`
-	}
-
-	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		log.Printf("Failed to unmarshal Gemini response: %s", string(bodyBytes))
-		return "", fmt.Errorf("failed to parse Gemini response: %w", err)
-	}
-
-	if result.PromptFeedback != nil && result.PromptFeedback.BlockReason != "" {
-		return "", fmt.Errorf("Gemini request blocked due to safety settings: %s", result.PromptFeedback.BlockReason)
-	}
-
-	if len(result.Candidates) > 0 && len(result.Candidates[0].Content.Parts) > 0 {
-		forms := strings.TrimSpace(result.Candidates[0].Content.Parts[0].Text)
-		// Basic validation: ensure the original word is present
-		if forms == "" || !strings.Contains(forms, entry) {
-			log.Printf("Warning: Gemini output for '%s' seems invalid or empty: '%s'. Falling back to just the word.", entry, forms)
-			// Fallback to just the original word if Gemini fails or gives weird output
-			return entry, nil // Return at least the base word
-		}
-		return forms, nil
+	deleted, err := h.DB.DeleteCachedWordForms(language, word)
+	if err != nil {
+		log.Printf("API InvalidateWordForms: Failed for %q (user %d): %v", word, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to invalidate cached word forms")
+		return
 	}
+	log.Printf("API InvalidateWordForms: User %d invalidated %q (%s), %d row(s)", userID, word, language, deleted)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"word": word, "language": language, "invalidated": deleted > 0})
+}
 
-	log.Printf("Gemini response for '%s' did not contain expected content structure. Body: %s", entry, string(bodyBytes))
-	// Fallback if structure is wrong
-	return entry, nil // Return base entry as fallback
+// formsProvider builds the word forms provider chosen in the user's settings
+// for words of the given language.
+func (h *APIHandlers) formsProvider(settings *models.UserSettings, language string) (wordforms.FormsProvider, error) {
+	return wordforms.New(wordforms.Options{
+		Provider:       settings.FormsProvider,
+		Language:       language,
+		GeminiEndpoint: h.Cfg.Gemini.APIEndpoint,
+		GeminiAPIKey:   settings.GeminiAPIKey,
+		OpenAIBaseURL:  settings.OpenAIBaseURL,
+		OpenAIModel:    settings.OpenAIModel,
+		OpenAIAPIKey:   settings.OpenAIAPIKey,
+	})
 }
 
 // HandleDeleteEntry removes a word entry and its relations
@@ -446,10 +372,20 @@ func (h *APIHandlers) HandleGetTrainingData(w http.ResponseWriter, r *http.Reque
 	writeJSON(w, http.StatusOK, items)
 }
 
-// HandleImportData allows importing data from the old format (Temporary)
+// HandleImportData allows importing data from the old format (Temporary).
+// With dryRun=true the data is only checked and nothing is stored.
 func (h *APIHandlers) HandleImportData(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(UserIDContextKey).(int64)
 
+	var dryRun bool
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid dryRun, expected true or false")
+			return
+		}
+	}
+
 	var data map[string]map[string][]string // Expecting {"dictionary_name": {"urls": [...], "paragraphs": [...], ...}}
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
 		writeJSONError(w, http.StatusBadRequest, "Invalid JSON data format: "+err.Error())
@@ -457,23 +393,48 @@ func (h *APIHandlers) HandleImportData(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	entries, urls, paras, rels, err := h.DB.ImportData(userID, data)
+	report, err := h.DB.ImportData(userID, data, dryRun)
+	if errors.Is(err, database.ErrNoImportData) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		log.Printf("API ImportData: Failed for user %d: %v", userID, err)
 		writeJSONError(w, http.StatusInternalServerError, "Failed during data import: "+err.Error())
 		return
 	}
 
+	message := "Import successful"
+	if dryRun {
+		message = "Dry run, nothing was imported"
+	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"message":            "Import successful",
-		"importedEntries":    entries,
-		"importedUrls":       urls,
-		"importedParagraphs": paras,
-		"importedRelations":  rels,
+		"message":            message,
+		"importedEntries":    report.Entries.Inserted,
+		"importedUrls":       report.URLs.Inserted,
+		"importedParagraphs": report.Paragraphs.Inserted,
+		"importedRelations":  report.Relations.Inserted,
+		"report":             report,
 	})
 }
 
-// HandlePodcastUpload handles multipart form upload for podcasts.
+// uploadExtensions are the accepted podcast file types. Browsers play MKV only
+// with codecs they support, typically H.264 or VP9 video.
+var uploadExtensions = map[string]models.MediaType{
+	".mp3": models.MediaAudio, ".m4a": models.MediaAudio, ".wav": models.MediaAudio, ".ogg": models.MediaAudio,
+	".mp4": models.MediaVideo, ".mkv": models.MediaVideo, ".webm": models.MediaVideo,
+}
+
+const (
+	// maxAudioUploadSize limits podcast audio, whether uploaded with the form
+	// or resumably.
+	maxAudioUploadSize = int64(500 << 20)
+	// maxVideoUploadSize limits video lessons, which are larger than audio.
+	maxVideoUploadSize = int64(4 << 30)
+)
+
+// HandlePodcastUpload handles multipart form upload for podcasts, and for
+// video lessons, which need a subtitles_file for their transcript.
 func (h *APIHandlers) HandlePodcastUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
@@ -481,13 +442,14 @@ func (h *APIHandlers) HandlePodcastUpload(w http.ResponseWriter, r *http.Request
 	}
 
 	userID := r.Context().Value(UserIDContextKey).(int64)
+	// Videos of up to maxVideoUploadSize take longer than the server timeout.
+	h.extendDeadlines(w)
 
 	// --- Parse Multipart Form ---
-	// Set max upload size (e.g., 500MB) - make configurable?
-	maxUploadSize := int64(500 * 1024 * 1024)
-	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+	// Large audio files are better sent with a resumable upload (/api/uploads).
+	if err := r.ParseMultipartForm(maxAudioUploadSize); err != nil {
 		log.Printf("Error parsing multipart form for user %d: %v", userID, err)
-		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse form: %v. Max size: %dMB", err, maxUploadSize/(1024*1024)))
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse form: %v. Max size: %dMB", err, maxAudioUploadSize/(1024*1024)))
 		return
 	}
 
@@ -504,6 +466,17 @@ func (h *APIHandlers) HandlePodcastUpload(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// --- Optional Subtitles (skip transcription) ---
+	var importedTranscript string
+	if subsFile, _, err := r.FormFile("subtitles_file"); err == nil {
+		importedTranscript, err = readSubtitles(subsFile)
+		subsFile.Close()
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid subtitles: "+err.Error())
+			return
+		}
+	}
+
 	// --- Handle File Upload ---
 	file, handler, err := r.FormFile("audio_file") // Field name in the form
 	if err != nil {
@@ -518,61 +491,50 @@ func (h *APIHandlers) HandlePodcastUpload(w http.ResponseWriter, r *http.Request
 	defer file.Close()
 
 	// --- Validate File (Basic) ---
-	// Check file size again (client might bypass initial limit)
-	if handler.Size > maxUploadSize {
-		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("File size exceeds limit of %dMB", maxUploadSize/(1024*1024)))
-		return
-	}
 	// Check MIME type (simple check based on extension, more robust check needed for production)
-	allowedExtensions := map[string]bool{".mp3": true, ".m4a": true, ".wav": true, ".ogg": true} // Add more as needed
 	fileExt := strings.ToLower(filepath.Ext(handler.Filename))
-	if !allowedExtensions[fileExt] {
-		writeJSONError(w, http.StatusBadRequest, "Invalid file type. Allowed types: mp3, m4a, wav, ogg")
+	mediaType, ok := uploadExtensions[fileExt]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "Invalid file type. Allowed types: mp3, m4a, wav, ogg, mp4, mkv, webm")
 		return
 	}
-
-	// --- Prepare Storage ---
-	podcastID := uuid.NewString()
-	storeFilename := podcastID + fileExt                                          // e.g., bb1b7348-....mp3
-	storeDir := filepath.Join(h.Cfg.Storage.UploadDir, fmt.Sprintf("%d", userID)) // Store uploads in user-specific subdirs
-	storePath := filepath.Join(storeDir, storeFilename)
-
-	// Ensure upload directory exists
-	if err := os.MkdirAll(storeDir, 0750); err != nil { // Use more restrictive permissions maybe?
-		log.Printf("Error creating upload directory %s for user %d: %v", storeDir, userID, err)
-		writeJSONError(w, http.StatusInternalServerError, "Failed to prepare storage location")
+	// Check file size again (client might bypass initial limit)
+	sizeLimit := maxAudioUploadSize
+	if mediaType == models.MediaVideo {
+		sizeLimit = maxVideoUploadSize
+	}
+	if handler.Size > sizeLimit {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("File size exceeds limit of %dMB", sizeLimit/(1024*1024)))
 		return
 	}
-
-	// --- Save Uploaded File ---
-	dst, err := os.Create(storePath)
-	if err != nil {
-		log.Printf("Error creating destination file %s for user %d: %v", storePath, userID, err)
-		writeJSONError(w, http.StatusInternalServerError, "Failed to save uploaded file")
+	// The transcript of a video lesson is its subtitles.
+	if mediaType == models.MediaVideo && importedTranscript == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing required field for video: subtitles_file")
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		// Clean up partially written file on error?
-		_ = os.Remove(storePath)
-		log.Printf("Error copying uploaded file to %s for user %d: %v", storePath, userID, err)
+	// --- Save Uploaded File ---
+	podcastID := uuid.NewString()
+	storeKey := storage.PodcastKey(userID, podcastID, fileExt) // e.g., 1/bb1b7348-....mp3, user-specific like the old upload subdirs
+	if _, err := h.Blobs.Put(r.Context(), storeKey, file); err != nil {
+		log.Printf("Error storing uploaded file as %s for user %d: %v", storeKey, userID, err)
 		writeJSONError(w, http.StatusInternalServerError, "Failed to write uploaded file")
 		return
 	}
-	log.Printf("User %d uploaded file: %s saved to %s", userID, handler.Filename, storePath)
+	log.Printf("User %d uploaded file: %s saved as %s", userID, handler.Filename, storeKey)
 
 	// --- Create Database Record ---
 	podcastRecord := &models.Podcast{
 		ID:         podcastID,
 		UserID:     userID,
 		Filename:   handler.Filename, // Store original name
-		StorePath:  storePath,        // Store full path for now
+		StorePath:  storeKey,
 		Producer:   producer,
 		Series:     series,
 		Episode:    episode,
 		UploadTime: time.Now(),
 		Status:     models.StatusUploaded,
+		MediaType:  mediaType,
 	}
 	if description != "" {
 		podcastRecord.Description = &description
@@ -583,76 +545,40 @@ func (h *APIHandlers) HandlePodcastUpload(w http.ResponseWriter, r *http.Request
 
 	if err := h.DB.CreatePodcastRecord(podcastRecord); err != nil {
 		// Clean up saved file if DB record fails
-		_ = os.Remove(storePath)
+		_ = h.Blobs.Delete(r.Context(), storeKey)
 		log.Printf("Error creating podcast record in DB for user %d, file %s: %v", userID, podcastID, err)
 		writeJSONError(w, http.StatusInternalServerError, "Failed to save podcast metadata")
 		return
 	}
 
-	// --- Trigger Asynchronous Transcription ---
-	go h.startTranscription(userID, podcastID, storePath, description, originalTranscript)
-
-	// --- Respond to Client ---
-	log.Printf("Podcast %s uploaded successfully for user %d. Transcription started.", podcastID, userID)
-	writeJSON(w, http.StatusAccepted, map[string]string{
-		"message":   "Upload successful, transcription processing started.",
-		"podcastId": podcastID,
-	})
-}
-
-// startTranscription is run in a goroutine to handle the transcription process.
-func (h *APIHandlers) startTranscription(userID int64, podcastID, audioFilePath, description, originalTranscript string) {
-	log.Printf("Starting transcription goroutine for podcast %s (user %d)", podcastID, userID)
-
-	// 1. Update status to 'transcribing'
-	// Note: Using background context for DB update within goroutine
-	ctx := context.Background() // Use a background context
-	err := h.DB.UpdatePodcastStatus(userID, podcastID, models.StatusTranscribing, nil)
-	if err != nil {
-		log.Printf("Error updating podcast %s status to 'transcribing': %v", podcastID, err)
-		// Might want to retry or log failure permanently? For now, just log.
-		return // Don't proceed if we can't even update status
-	}
-
-	// 2. Get User's API Key
-	settings, err := h.DB.GetUserSettings(userID)
-	if err != nil {
-		log.Printf("Error getting settings for user %d during transcription start: %v", userID, err)
-		errMsg := "Failed to retrieve API key settings"
-		_ = h.DB.UpdatePodcastStatus(userID, podcastID, models.StatusFailed, &errMsg)
-		return
-	}
-	if settings == nil || settings.GeminiAPIKey == "" {
-		log.Printf("User %d missing Gemini API key for transcription.", userID)
-		errMsg := "Gemini API key not configured in settings."
-		_ = h.DB.UpdatePodcastStatus(userID, podcastID, models.StatusFailed, &errMsg)
+	if importedTranscript != "" {
+		if err := h.DB.ImportTranscript(userID, podcastID, importedTranscript); err != nil {
+			log.Printf("Error storing subtitles of podcast %s for user %d: %v", podcastID, userID, err)
+			writeJSONError(w, http.StatusInternalServerError, "Upload saved, but the subtitles could not be stored")
+			return
+		}
+		log.Printf("Podcast %s uploaded successfully for user %d with subtitles.", podcastID, userID)
+		writeJSON(w, http.StatusCreated, map[string]string{
+			"message":   "Upload successful, transcript imported from subtitles.",
+			"podcastId": podcastID,
+		})
 		return
 	}
-	apiKey := settings.GeminiAPIKey
 
-	// 3. Call Transcription Service
-	// Pass original transcript pointer content or empty string
-	origTranscriptStr := ""
-	if originalTranscript != "" {
-		origTranscriptStr = originalTranscript
-	}
-	descStr := ""
-	if description != "" {
-		descStr = description
+	// --- Queue Transcription ---
+	if err := h.DB.EnqueueTranscription(userID, podcastID, time.Now().UTC()); err != nil {
+		log.Printf("Error queueing transcription of podcast %s for user %d: %v", podcastID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Upload saved, but transcription could not be queued")
+		return
 	}
+	h.Transcriptions.Notify()
 
-	finalTranscriptJSON, err := h.TranscriptionSvc.TranscribeAudioFile(ctx, audioFilePath, descStr, origTranscriptStr, apiKey)
-
-	// 4. Update Database with Result
-	if err != nil {
-		log.Printf("Transcription failed for podcast %s (user %d): %v", podcastID, userID, err)
-		errMsg := err.Error() // Store the error message
-		_ = h.DB.UpdatePodcastTranscript(userID, podcastID, nil, models.StatusFailed, &errMsg)
-	} else {
-		log.Printf("Transcription completed successfully for podcast %s (user %d)", podcastID, userID)
-		// Store the JSON string
-		_ = h.DB.UpdatePodcastTranscript(userID, podcastID, &finalTranscriptJSON, models.StatusCompleted, nil)
-	}
+	// --- Respond to Client ---
+	log.Printf("Podcast %s uploaded successfully for user %d. Transcription queued.", podcastID, userID)
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"message":   "Upload successful, transcription queued.",
+		"podcastId": podcastID,
+	})
 }
 
 // HandleListPodcasts retrieves a list of podcasts for the logged-in user.
@@ -710,8 +636,8 @@ func (h *APIHandlers) HandleDeletePodcast(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Call DB method to delete record (returns store path on success)
-	storePath, err := h.DB.DeletePodcastRecord(userID, podcastID)
+	// Call DB method to delete record (returns store key on success)
+	storeKey, err := h.DB.DeletePodcastRecord(userID, podcastID)
 	if err != nil {
 		log.Printf("API DeletePodcast: Failed for user %d, podcast %s: %v", userID, podcastID, err)
 		if strings.Contains(err.Error(), "not found") {
@@ -722,15 +648,15 @@ func (h *APIHandlers) HandleDeletePodcast(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Attempt to delete the associated audio file from the filesystem *after* DB commit
-	if storePath != "" {
-		err := os.Remove(storePath)
+	// Attempt to delete the associated audio file from the blob store *after* DB commit
+	if storeKey != "" {
+		err := h.Blobs.Delete(r.Context(), storeKey)
 		if err != nil {
 			// Log error, but don't necessarily fail the request, as DB record is gone.
 			// This could leave orphaned files, may need a cleanup process later.
-			log.Printf("Warning: Failed to delete audio file %s after deleting DB record for podcast %s (user %d): %v", storePath, podcastID, userID, err)
+			log.Printf("Warning: Failed to delete audio file %s after deleting DB record for podcast %s (user %d): %v", storeKey, podcastID, userID, err)
 		} else {
-			log.Printf("Successfully deleted audio file %s for podcast %s (user %d)", storePath, podcastID, userID)
+			log.Printf("Successfully deleted audio file %s for podcast %s (user %d)", storeKey, podcastID, userID)
 		}
 	} else {
 		log.Printf("Warning: Store path was empty after deleting podcast %s (user %d), could not delete file.", podcastID, userID)
@@ -740,6 +666,173 @@ func (h *APIHandlers) HandleDeletePodcast(w http.ResponseWriter, r *http.Request
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Podcast deleted successfully"})
 }
 
+// HandleRetranscribePodcast queues a podcast for transcription again, reusing
+// the stored audio, description and original transcript. Handles
+// POST /api/podcasts/{id}/retranscribe, with the ID passed in the context.
+func (h *APIHandlers) HandleRetranscribePodcast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	userID := r.Context().Value(UserIDContextKey).(int64)
+
+	podcastID := router.GetPathParam(r.Context())
+	if _, err := uuid.Parse(podcastID); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid podcast ID format")
+		return
+	}
+
+	podcast, err := h.DB.GetPodcastByIDForUser(userID, podcastID)
+	if err != nil {
+		log.Printf("API RetranscribePodcast: Failed for user %d, podcast %s: %v", userID, podcastID, err)
+		if strings.Contains(err.Error(), "not found") {
+			writeJSONError(w, http.StatusNotFound, "Podcast not found or access denied.")
+		} else {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve podcast data.")
+		}
+		return
+	}
+
+	if podcast.MediaType == models.MediaVideo {
+		writeJSONError(w, http.StatusConflict, "Video lessons are not transcribed. Upload new subtitles instead.")
+		return
+	}
+	if podcast.Status == models.StatusQueued || podcast.Status == models.StatusTranscribing {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("Podcast is already being transcribed (status: %s).", podcast.Status))
+		return
+	}
+	if _, err := h.Blobs.Stat(r.Context(), podcast.StorePath); err != nil {
+		log.Printf("API RetranscribePodcast: Audio file %s of podcast %s (user %d) unavailable: %v", podcast.StorePath, podcastID, userID, err)
+		writeJSONError(w, http.StatusGone, "The audio file of this podcast is no longer available.")
+		return
+	}
+
+	if err := h.DB.EnqueueTranscription(userID, podcastID, time.Now().UTC()); err != nil {
+		if errors.Is(err, database.ErrTranscriptionRunning) {
+			writeJSONError(w, http.StatusConflict, "Podcast is already being transcribed.")
+			return
+		}
+		log.Printf("API RetranscribePodcast: Error queueing podcast %s for user %d: %v", podcastID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to queue transcription")
+		return
+	}
+	h.Transcriptions.Notify()
+
+	log.Printf("Podcast %s queued for re-transcription for user %d", podcastID, userID)
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"message":   "Transcription queued.",
+		"podcastId": podcastID,
+	})
+}
+
+// HandleGetPodcastTranscript downloads a completed transcript as subtitles.
+// Handles GET /api/podcasts/{id}/transcript?format=srt|vtt (default vtt).
+func (h *APIHandlers) HandleGetPodcastTranscript(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	podcastID := router.GetPathParam(r.Context())
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = subtitles.FormatVTT
+	}
+	if format != subtitles.FormatSRT && format != subtitles.FormatVTT {
+		writeJSONError(w, http.StatusBadRequest, "Invalid format. Allowed formats: srt, vtt")
+		return
+	}
+
+	podcast, err := h.DB.GetPodcastByIDForUser(userID, podcastID)
+	if err != nil {
+		log.Printf("API GetPodcastTranscript: Failed for user %d, podcast %s: %v", userID, podcastID, err)
+		if strings.Contains(err.Error(), "not found") {
+			writeJSONError(w, http.StatusNotFound, "Podcast not found or access denied.")
+		} else {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve podcast data.")
+		}
+		return
+	}
+	if podcast.Status != models.StatusCompleted || podcast.FinalTranscript == nil {
+		writeJSONError(w, http.StatusPreconditionFailed, fmt.Sprintf("Podcast transcription is not complete (status: %s).", podcast.Status))
+		return
+	}
+
+	transcript, _, err := models.ParseTranscript([]byte(*podcast.FinalTranscript))
+	if err != nil {
+		log.Printf("API GetPodcastTranscript: Failed to parse FinalTranscript JSON for podcast %s: %v", podcastID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to parse transcript data.")
+		return
+	}
+
+	filename := strings.TrimSuffix(podcast.Filename, filepath.Ext(podcast.Filename)) + "." + format
+	w.Header().Set("Content-Type", subtitles.ContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if err := subtitles.Write(w, format, transcript); err != nil {
+		log.Printf("API GetPodcastTranscript: Failed to write %s for podcast %s: %v", format, podcastID, err)
+	}
+}
+
+// HandleImportPodcastTranscript replaces the transcript of a podcast with an
+// uploaded SRT or WebVTT file and marks it completed, without calling Gemini.
+// Handles PUT /api/podcasts/{id}/transcript with the file as the request body
+// or as the subtitles_file field of a multipart form.
+func (h *APIHandlers) HandleImportPodcastTranscript(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	podcastID := router.GetPathParam(r.Context())
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("subtitles_file")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Missing required field: subtitles_file")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	finalTranscript, err := readSubtitles(body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid subtitles: "+err.Error())
+		return
+	}
+
+	if err := h.DB.ImportTranscript(userID, podcastID, finalTranscript); err != nil {
+		log.Printf("API ImportPodcastTranscript: Failed for user %d, podcast %s: %v", userID, podcastID, err)
+		switch {
+		case errors.Is(err, database.ErrTranscriptionRunning):
+			writeJSONError(w, http.StatusConflict, "Podcast is being transcribed right now, try again when it is done.")
+		case strings.Contains(err.Error(), "not found"):
+			writeJSONError(w, http.StatusNotFound, "Podcast not found or access denied.")
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "Failed to save transcript")
+		}
+		return
+	}
+
+	log.Printf("Transcript of podcast %s imported from subtitles for user %d", podcastID, userID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Transcript imported from subtitles."})
+}
+
+// readSubtitles parses an uploaded subtitle file into the stored transcript JSON.
+func readSubtitles(r io.Reader) (string, error) {
+	const maxSubtitlesSize = 10 * 1024 * 1024
+	data, err := io.ReadAll(io.LimitReader(r, maxSubtitlesSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read subtitles: %w", err)
+	}
+	if len(data) > maxSubtitlesSize {
+		return "", fmt.Errorf("file exceeds the limit of %dMB", maxSubtitlesSize/(1024*1024))
+	}
+	transcript, err := subtitles.Parse(data)
+	if err != nil {
+		return "", err
+	}
+	finalJSON, err := json.Marshal(transcript)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode transcript: %w", err)
+	}
+	return string(finalJSON), nil
+}
+
 // HandleGetPodcastPlayData retrieves data for the podcast play page.
 func (h *APIHandlers) HandleGetPodcastPlayData(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -780,45 +873,30 @@ func (h *APIHandlers) HandleGetPodcastPlayData(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// We need to serve the audio file path relative to the domain, or provide a way for the client to fetch it.
-	// For now, let's make store_path relative from a 'media' root.
-	// Example: store_path might be "./uploads/1/uuid.mp3"
-	// We need to serve it via something like /media/1/uuid.mp3
-	// This requires a new file server route.
+	// Signed, so the URL also works in players that do not send the cookie.
+	mediaSrc, _ := h.signedMediaURL(userID, podcast.ID)
 
-	// Attempt to make storePath relative to a known base for web serving
-	// Assuming cfg.Storage.UploadDir is absolute or relative to server root
-	// And we want to serve files from a /media/ prefix
-	relativeStorePath, err := filepath.Rel(h.Cfg.Storage.UploadDir, podcast.StorePath)
+	// Transcripts stored before validation was added may have bad segments; serve them anyway.
+	transcript, issues, err := models.ParseTranscript([]byte(*podcast.FinalTranscript))
 	if err != nil {
-		// If it can't be made relative (e.g., different drive), this approach needs rethinking.
-		// For now, just log it and use the full store path (which won't work directly in <audio src>)
-		log.Printf("Warning: Could not make store path %s relative to upload dir %s: %v", podcast.StorePath, h.Cfg.Storage.UploadDir, err)
-		// A more robust solution would involve generating a signed URL or a dedicated media serving endpoint.
-		// For now, we'll construct a path assuming a /media route will serve files from Cfg.Storage.UploadDir
-		// and the client will prefix this with the domain.
-		// This is a simplification for local dev.
-		relativeStorePath = strings.TrimPrefix(podcast.StorePath, h.Cfg.Storage.UploadDir) // A bit hacky
-		relativeStorePath = strings.TrimPrefix(relativeStorePath, "/")
-		relativeStorePath = strings.TrimPrefix(relativeStorePath, "\\")
-	}
-
-	// Parse the JSON transcript string into a Go slice of maps or structs
-	var transcriptData []map[string]interface{} // Or a more specific struct
-	if err := json.Unmarshal([]byte(*podcast.FinalTranscript), &transcriptData); err != nil {
 		log.Printf("API GetPodcastPlayData: Failed to parse FinalTranscript JSON for podcast %s: %v", podcastID, err)
 		writeJSONError(w, http.StatusInternalServerError, "Failed to parse transcript data.")
 		return
 	}
+	if len(issues) > 0 {
+		log.Printf("API GetPodcastPlayData: Transcript of podcast %s has %d problem(s), first: %s", podcastID, len(issues), issues[0])
+	}
 
 	playData := map[string]interface{}{
-		"id":          podcast.ID,
-		"producer":    podcast.Producer,
-		"series":      podcast.Series,
-		"episode":     podcast.Episode,
-		"description": podcast.Description,
-		"audioSrc":    "/media/" + relativeStorePath, // Client will prepend domain
-		"transcript":  transcriptData,
+		"id":               podcast.ID,
+		"producer":         podcast.Producer,
+		"series":           podcast.Series,
+		"episode":          podcast.Episode,
+		"description":      podcast.Description,
+		"audioSrc":         mediaSrc,
+		"mediaType":        podcast.MediaType,
+		"transcript":       transcript,
+		"transcriptIssues": issues,
 		// Don't send original_transcript or full store_path unless needed by client directly
 	}
 
@@ -832,10 +910,15 @@ func (h *APIHandlers) HandleGetReviewData(w http.ResponseWriter, r *http.Request
 	}
 	userID := r.Context().Value(UserIDContextKey).(int64)
 
+	dict, _ := h.requestDictionary(w, r, "")
+	if dict == nil {
+		return
+	}
+
 	// Get limit from config (or query param if you want to override)
 	limit := h.Cfg.ReviewPage.ItemsLimit
 
-	reviewData, err := h.DB.GetReviewPageData(userID, limit)
+	reviewData, err := h.DB.GetReviewPageData(userID, dict.ID, limit)
 	if err != nil {
 		log.Printf("API GetReviewData: Failed for user %d: %v", userID, err)
 		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve review data")
@@ -848,3 +931,166 @@ func (h *APIHandlers) HandleGetReviewData(w http.ResponseWriter, r *http.Request
 
 	writeJSON(w, http.StatusOK, reviewData)
 }
+
+// HandleGetDueCards lists the words due for review now, with the paragraphs
+// they were marked in. Handles GET /api/srs/due?limit=N (default 20).
+func (h *APIHandlers) HandleGetDueCards(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	dict, _ := h.requestDictionary(w, r, "")
+	if dict == nil {
+		return
+	}
+	limit := 20
+	if parsedLimit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsedLimit > 0 && parsedLimit < 500 {
+		limit = parsedLimit
+	}
+
+	cards, err := h.DB.GetDueCards(userID, dict.ID, time.Now().UTC(), limit, 3)
+	if err != nil {
+		log.Printf("API GetDueCards: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve due cards")
+		return
+	}
+	writeJSON(w, http.StatusOK, cards)
+}
+
+// HandleGradeEntry records a review of a word and schedules the next one.
+// Handles POST /api/srs/{entryUUID}/grade with {"grade": 0-5}, the UUID
+// passed in the context.
+func (h *APIHandlers) HandleGradeEntry(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	entryUUID := router.GetPathParam(r.Context())
+
+	var req struct {
+		Grade *int `json:"grade"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Grade == nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body, expected {\"grade\": 0-5}")
+		return
+	}
+	defer r.Body.Close()
+
+	entry, err := h.DB.GetEntryByUUID(userID, entryUUID)
+	if err != nil {
+		log.Printf("API GradeEntry: Failed to get entry %s for user %d: %v", entryUUID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve entry")
+		return
+	}
+	if entry == nil {
+		writeJSONError(w, http.StatusNotFound, "Entry not found")
+		return
+	}
+
+	now := time.Now().UTC()
+	state, err := h.DB.GetReviewState(userID, entryUUID)
+	if err != nil {
+		log.Printf("API GradeEntry: Failed to get review state of entry %s for user %d: %v", entryUUID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve review state")
+		return
+	}
+	if state == nil {
+		newState := srs.NewState(entryUUID, now)
+		state = &newState
+	}
+
+	next, err := srs.Schedule(*state, srs.Grade(*req.Grade), now)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.DB.SaveReviewState(userID, next); err != nil {
+		log.Printf("API GradeEntry: Failed for user %d, entry %s: %v", userID, entryUUID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save review")
+		return
+	}
+	writeJSON(w, http.StatusOK, next)
+}
+
+// HandleGetQuiz builds a quiz from the paragraphs the user marked words in.
+// Handles GET /api/quiz?kind=cloze|choice|mixed&limit=N (default mixed, 10).
+func (h *APIHandlers) HandleGetQuiz(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	kind, err := quiz.ParseKind(r.URL.Query().Get("kind"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dict, _ := h.requestDictionary(w, r, "")
+	if dict == nil {
+		return
+	}
+	limit := 10
+	if parsedLimit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+		limit = parsedLimit
+	}
+
+	// Fetch extra items: a word marked in several paragraphs is asked only once.
+	items, err := h.DB.GetQuizItems(userID, dict.ID, limit*3)
+	if err != nil {
+		log.Printf("API GetQuiz: Failed to get items for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to build quiz")
+		return
+	}
+	var words []string
+	if kind != quiz.KindCloze {
+		if words, err = h.DB.GetEntryWords(userID, dict.ID); err != nil {
+			log.Printf("API GetQuiz: Failed to get words for user %d: %v", userID, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to build quiz")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"questions": quiz.Generate(items, words, kind, limit),
+	})
+}
+
+// HandleCheckQuiz checks the answers to a quiz and scores them. Handles
+// POST /api/quiz with {"answers": [{"entryUUID", "paragraphHash", "answer"}]}.
+func (h *APIHandlers) HandleCheckQuiz(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+
+	var req struct {
+		Answers []struct {
+			EntryUUID     string `json:"entryUUID"`
+			ParagraphHash string `json:"paragraphHash"`
+			Answer        string `json:"answer"`
+		} `json:"answers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON data format: "+err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if len(req.Answers) == 0 || len(req.Answers) > 100 {
+		writeJSONError(w, http.StatusBadRequest, "Expected between 1 and 100 answers")
+		return
+	}
+
+	results := make([]quiz.Result, 0, len(req.Answers))
+	correct := 0
+	for _, a := range req.Answers {
+		item, err := h.DB.GetQuizItem(userID, a.EntryUUID, a.ParagraphHash)
+		if err != nil {
+			log.Printf("API CheckQuiz: Failed for user %d, entry %s: %v", userID, a.EntryUUID, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to check answers")
+			return
+		}
+		if item == nil {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Unknown question: entry %s, paragraph %s", a.EntryUUID, a.ParagraphHash))
+			return
+		}
+		result := quiz.Check(*item, a.Answer)
+		if result.Correct {
+			correct++
+		}
+		results = append(results, result)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+		"correct": correct,
+		"total":   len(results),
+		"score":   correct * 100 / len(results),
+	})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"lingomarker/internal/database"
+	"lingomarker/internal/models"
+	"lingomarker/internal/readability"
+	"lingomarker/internal/router"
+	"lingomarker/internal/vocab"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// CreateArticleRequest captures a page either by URL, which the server
+// fetches, or as HTML the client already has. URL and Title are optional
+// with HTML; Title overrides the extracted title.
+type CreateArticleRequest struct {
+	URL   string `json:"url"`
+	HTML  string `json:"html"`
+	Title string `json:"title"`
+}
+
+// HandleCreateArticle extracts the readable text of a page and stores it for
+// the reader view. Handles POST /api/articles.
+func (h *APIHandlers) HandleCreateArticle(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+
+	// Room for a page of MaxPageSize escaped into JSON.
+	r.Body = http.MaxBytesReader(w, r.Body, 2*readability.MaxPageSize)
+	var req CreateArticleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL == "" && strings.TrimSpace(req.HTML) == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing url or html")
+		return
+	}
+
+	var extracted *readability.Article
+	var err error
+	if req.HTML != "" {
+		extracted, err = readability.Extract(strings.NewReader(req.HTML))
+		if err == nil {
+			extracted.URL = req.URL
+		}
+	} else {
+		extracted, err = readability.Fetch(r.Context(), req.URL)
+	}
+	if err != nil {
+		log.Printf("API CreateArticle: Failed to capture %q for user %d: %v", req.URL, userID, err)
+		switch {
+		case errors.Is(err, readability.ErrInvalidURL), errors.Is(err, readability.ErrForbiddenAddress):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, readability.ErrNoContent), errors.Is(err, readability.ErrNotHTML):
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		case req.HTML != "":
+			writeJSONError(w, http.StatusBadRequest, "Failed to parse HTML: "+err.Error())
+		default:
+			writeJSONError(w, http.StatusBadGateway, "Failed to fetch page: "+err.Error())
+		}
+		return
+	}
+
+	settings, err := h.DB.GetUserSettings(userID)
+	if err != nil {
+		log.Printf("API CreateArticle: Failed to get settings for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve user settings")
+		return
+	}
+
+	article := &models.Article{ID: uuid.NewString(), UserID: userID, Title: extracted.Title}
+	if t := strings.TrimSpace(req.Title); t != "" {
+		article.Title = t
+	}
+	// Hash the URL the way the userscript would on the original page, so
+	// marks made there and in the reader view share it. Pasted HTML without a
+	// URL is known by its reader view.
+	if extracted.URL != "" {
+		article.URL = vocab.CleanURL(extracted.URL, strings.Split(settings.AllowFragmentURLList, ","))
+	} else {
+		article.URL = "/read/" + article.ID
+	}
+	article.URLHash = vocab.Hash(article.URL)
+	if article.Title == "" {
+		article.Title = article.URL
+	}
+	for _, text := range extracted.Paragraphs {
+		article.Paragraphs = append(article.Paragraphs, models.ArticleParagraph{ParagraphHash: vocab.Hash(text), Text: text})
+	}
+
+	if err := h.DB.CreateArticle(article); err != nil {
+		log.Printf("API CreateArticle: Failed to save article for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save article")
+		return
+	}
+	writeJSON(w, http.StatusCreated, article)
+}
+
+// HandleListArticles lists the user's articles without their text. Handles
+// GET /api/articles?limit=&offset=.
+func (h *APIHandlers) HandleListArticles(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	articles, err := h.DB.ListArticles(userID, limit, offset)
+	if err != nil {
+		log.Printf("API ListArticles: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve article list")
+		return
+	}
+	writeJSON(w, http.StatusOK, articles)
+}
+
+// HandleGetArticle returns an article with its paragraphs. Handles
+// GET /api/articles/{id}.
+func (h *APIHandlers) HandleGetArticle(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	articleID, ok := articleIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	article, err := h.DB.GetArticle(userID, articleID)
+	if err != nil {
+		if errors.Is(err, database.ErrArticleNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Printf("API GetArticle: Failed for user %d, article %s: %v", userID, articleID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve article")
+		return
+	}
+	writeJSON(w, http.StatusOK, article)
+}
+
+// HandleDeleteArticle deletes an article. Words marked in it are kept.
+// Handles DELETE /api/articles/{id}.
+func (h *APIHandlers) HandleDeleteArticle(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	articleID, ok := articleIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.DeleteArticle(userID, articleID); err != nil {
+		if errors.Is(err, database.ErrArticleNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Printf("API DeleteArticle: Failed for user %d, article %s: %v", userID, articleID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to delete article")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Article deleted successfully"})
+}
+
+// articleIDParam returns the article ID in the path. On failure it writes
+// the error response and returns false.
+func articleIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	articleID := router.GetPathParam(r.Context())
+	if _, err := uuid.Parse(articleID); err != nil || strings.Contains(articleID, "/") {
+		writeJSONError(w, http.StatusBadRequest, "Invalid article ID in path, expected /api/articles/{id}")
+		return "", false
+	}
+	return articleID, true
+}
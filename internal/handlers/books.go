@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"lingomarker/internal/database"
+	"lingomarker/internal/epub"
+	"lingomarker/internal/models"
+	"lingomarker/internal/router"
+	"lingomarker/internal/vocab"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// bookChapterURL is the URL of the reader page of a chapter, which words
+// marked in the chapter are filed under.
+func bookChapterURL(bookID string, chapter int) string {
+	return fmt.Sprintf("/books/read/%s/%d", bookID, chapter)
+}
+
+// HandleUploadBook unpacks an EPUB, sent as the request body or in the
+// "epub_file" form field, and stores its chapters. Handles POST /api/books.
+func (h *APIHandlers) HandleUploadBook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+
+	src, filename, cleanup, err := readImportUpload(w, r, "epub_file")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to read file: "+err.Error())
+		return
+	}
+	defer cleanup()
+
+	// zip needs random access.
+	f, err := os.CreateTemp("", "lingomarker-book-*.epub")
+	if err != nil {
+		log.Printf("API UploadBook: Failed to create temp file: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to store file")
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := io.Copy(f, src)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "Failed to read file: "+err.Error())
+		return
+	}
+
+	parsed, err := epub.Read(f, size)
+	if err != nil {
+		log.Printf("API UploadBook: Failed to read %q for user %d: %v", filename, userID, err)
+		writeJSONError(w, http.StatusBadRequest, "Invalid EPUB file: "+err.Error())
+		return
+	}
+
+	book := &models.Book{
+		ID:       uuid.NewString(),
+		UserID:   userID,
+		Filename: filename,
+		Title:    parsed.Title,
+		Author:   parsed.Author,
+		Language: parsed.Language,
+	}
+	for i, c := range parsed.Chapters {
+		chapter := models.BookChapter{Index: i, Title: c.Title, URL: bookChapterURL(book.ID, i), ParagraphCount: len(c.Paragraphs)}
+		chapter.URLHash = vocab.Hash(chapter.URL)
+		for _, text := range c.Paragraphs {
+			chapter.Paragraphs = append(chapter.Paragraphs, models.ArticleParagraph{ParagraphHash: vocab.Hash(text), Text: text})
+		}
+		book.Chapters = append(book.Chapters, chapter)
+	}
+
+	if err := h.DB.CreateBook(book); err != nil {
+		log.Printf("API UploadBook: Failed to save book for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save book")
+		return
+	}
+
+	log.Printf("API UploadBook: User %d uploaded %q with %d chapters", userID, book.Title, len(book.Chapters))
+	for i := range book.Chapters {
+		book.Chapters[i].Paragraphs = nil
+	}
+	writeJSON(w, http.StatusCreated, book)
+}
+
+// HandleListBooks lists the user's books. Handles GET /api/books.
+func (h *APIHandlers) HandleListBooks(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	books, err := h.DB.ListBooks(userID)
+	if err != nil {
+		log.Printf("API ListBooks: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve book list")
+		return
+	}
+	writeJSON(w, http.StatusOK, books)
+}
+
+// HandleGetBook returns a book with its table of contents and reading
+// position. Handles GET /api/books/{id}, with the ID passed in the context.
+func (h *APIHandlers) HandleGetBook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	bookID := router.GetPathParam(r.Context())
+
+	book, err := h.DB.GetBook(userID, bookID)
+	if err != nil {
+		writeBookError(w, "GetBook", userID, bookID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, book)
+}
+
+// HandleGetBookChapter returns a chapter with its paragraphs. Handles
+// GET /api/books/{id}/chapters/{chapter}, with "{id}/{chapter}" passed in
+// the context.
+func (h *APIHandlers) HandleGetBookChapter(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	bookID, chapterStr, _ := strings.Cut(router.GetPathParam(r.Context()), "/")
+	chapter, err := strconv.Atoi(chapterStr)
+	if err != nil || chapter < 0 {
+		writeJSONError(w, http.StatusBadRequest, "Invalid chapter number")
+		return
+	}
+
+	c, err := h.DB.GetBookChapter(userID, bookID, chapter)
+	if err != nil {
+		writeBookError(w, "GetBookChapter", userID, bookID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// BookPositionRequest is a reading position: a chapter and a paragraph
+// within it, both 0-based.
+type BookPositionRequest struct {
+	Chapter   int `json:"chapter"`
+	Paragraph int `json:"paragraph"`
+}
+
+// HandleSaveBookPosition records how far the user has read. Handles
+// PUT /api/books/{id}/position, with the ID passed in the context.
+func (h *APIHandlers) HandleSaveBookPosition(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	bookID := router.GetPathParam(r.Context())
+
+	var req BookPositionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if err := h.DB.SaveBookPosition(userID, bookID, req.Chapter, req.Paragraph); err != nil {
+		writeBookError(w, "SaveBookPosition", userID, bookID, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDeleteBook deletes a book. Words marked in it keep their context.
+// Handles DELETE /api/books/{id}.
+func (h *APIHandlers) HandleDeleteBook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	bookID := router.GetPathParam(r.Context())
+	if _, err := uuid.Parse(bookID); err != nil || strings.Contains(bookID, "/") {
+		writeJSONError(w, http.StatusBadRequest, "Invalid book ID in path, expected /api/books/{id}")
+		return
+	}
+
+	if err := h.DB.DeleteBook(userID, bookID); err != nil {
+		writeBookError(w, "DeleteBook", userID, bookID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Book deleted successfully"})
+}
+
+// writeBookError writes the response for an error from a book query.
+func writeBookError(w http.ResponseWriter, action string, userID int64, bookID string, err error) {
+	if errors.Is(err, database.ErrBookNotFound) || errors.Is(err, database.ErrChapterNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Printf("API %s: Failed for user %d, book %s: %v", action, userID, bookID, err)
+	writeJSONError(w, http.StatusInternalServerError, "Failed to process book request")
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"lingomarker/internal/database"
+	"lingomarker/internal/models"
+	"lingomarker/internal/router"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// resolveDictionary finds the dictionary named by selector, an ID or a name
+// (ignoring case). An empty selector picks the active dictionary from the
+// settings, or the user's first one. An unknown selector returns
+// database.ErrDictionaryNotFound.
+func (h *APIHandlers) resolveDictionary(userID int64, settings *models.UserSettings, selector string) (*models.Dictionary, error) {
+	dicts, err := h.DB.GetDictionaries(userID)
+	if err != nil {
+		return nil, err
+	}
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		for i := range dicts {
+			if dicts[i].ID == settings.ActiveDictionaryID {
+				return &dicts[i], nil
+			}
+		}
+		return &dicts[0], nil // GetDictionaries never returns none
+	}
+	id, _ := strconv.ParseInt(selector, 10, 64)
+	for i := range dicts {
+		if dicts[i].ID == id || strings.EqualFold(dicts[i].Name, selector) {
+			return &dicts[i], nil
+		}
+	}
+	return nil, database.ErrDictionaryNotFound
+}
+
+// requestDictionary resolves the dictionary selected by the "dictionary"
+// query parameter, or by selector if the request has none. On failure it
+// writes the error response and returns nil.
+func (h *APIHandlers) requestDictionary(w http.ResponseWriter, r *http.Request, selector string) (*models.Dictionary, *models.UserSettings) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	if v := r.URL.Query().Get("dictionary"); v != "" {
+		selector = v
+	}
+
+	settings, err := h.DB.GetUserSettings(userID)
+	if err != nil {
+		log.Printf("API Dictionary: Failed to get settings for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve user settings")
+		return nil, nil
+	}
+	dict, err := h.resolveDictionary(userID, settings, selector)
+	if err != nil {
+		if errors.Is(err, database.ErrDictionaryNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Dictionary not found: "+selector)
+			return nil, nil
+		}
+		log.Printf("API Dictionary: Failed to resolve %q for user %d: %v", selector, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve dictionaries")
+		return nil, nil
+	}
+	return dict, settings
+}
+
+// exportDictionaryID returns the ID of the dictionary selected by the
+// "dictionary" query parameter, or 0 for all of them when there is none. On
+// failure it writes the error response and returns false.
+func (h *APIHandlers) exportDictionaryID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if r.URL.Query().Get("dictionary") == "" {
+		return 0, true
+	}
+	dict, _ := h.requestDictionary(w, r, "")
+	if dict == nil {
+		return 0, false
+	}
+	return dict.ID, true
+}
+
+// dictionaryLanguage is the language of the words in a dictionary.
+func (h *APIHandlers) dictionaryLanguage(dict *models.Dictionary) string {
+	if dict.SourceLanguage != "" {
+		return dict.SourceLanguage
+	}
+	return h.Cfg.WordForms.Language
+}
+
+// HandleListDictionaries lists the user's dictionaries. Handles GET /api/dictionaries.
+func (h *APIHandlers) HandleListDictionaries(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	dicts, err := h.DB.GetDictionaries(userID)
+	if err != nil {
+		log.Printf("API ListDictionaries: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve dictionaries")
+		return
+	}
+	writeJSON(w, http.StatusOK, dicts)
+}
+
+// HandleCreateDictionary adds a dictionary. Handles POST /api/dictionaries
+// with {"name", "sourceLanguage", "targetLanguage", "dictBaseUrl", "highlightColor"}.
+func (h *APIHandlers) HandleCreateDictionary(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	dict, ok := decodeDictionary(w, r)
+	if !ok {
+		return
+	}
+	dict.UserID = userID
+
+	if err := h.DB.CreateDictionary(dict); err != nil {
+		if errors.Is(err, database.ErrDictionaryExists) {
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		log.Printf("API CreateDictionary: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to create dictionary")
+		return
+	}
+	log.Printf("API CreateDictionary: User %d created dictionary %d (%s)", userID, dict.ID, dict.Name)
+	writeJSON(w, http.StatusCreated, dict)
+}
+
+// HandleUpdateDictionary replaces the fields of a dictionary. Handles
+// PUT /api/dictionaries/{id} with the body of HandleCreateDictionary.
+func (h *APIHandlers) HandleUpdateDictionary(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	id, err := strconv.ParseInt(router.GetPathParam(r.Context()), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid path, expected /api/dictionaries/{id}")
+		return
+	}
+	dict, ok := decodeDictionary(w, r)
+	if !ok {
+		return
+	}
+	dict.ID, dict.UserID = id, userID
+
+	if err := h.DB.UpdateDictionary(dict); err != nil {
+		switch {
+		case errors.Is(err, database.ErrDictionaryNotFound):
+			writeJSONError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, database.ErrDictionaryExists):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("API UpdateDictionary: Failed for user %d, dictionary %d: %v", userID, id, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update dictionary")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, dict)
+}
+
+// HandleDeleteDictionary deletes a dictionary with all its words. Handles
+// DELETE /api/dictionaries/{id}.
+func (h *APIHandlers) HandleDeleteDictionary(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	id, err := strconv.ParseInt(router.GetPathParam(r.Context()), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid path, expected /api/dictionaries/{id}")
+		return
+	}
+
+	if err := h.DB.DeleteDictionary(userID, id); err != nil {
+		switch {
+		case errors.Is(err, database.ErrDictionaryNotFound):
+			writeJSONError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, database.ErrLastDictionary):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		default:
+			log.Printf("API DeleteDictionary: Failed for user %d, dictionary %d: %v", userID, id, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to delete dictionary")
+		}
+		return
+	}
+	log.Printf("API DeleteDictionary: User %d deleted dictionary %d", userID, id)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Dictionary deleted successfully"})
+}
+
+// decodeDictionary reads and validates a dictionary from the request body.
+// On failure it writes the error response and returns false.
+func decodeDictionary(w http.ResponseWriter, r *http.Request) (*models.Dictionary, bool) {
+	var dict models.Dictionary
+	if err := json.NewDecoder(r.Body).Decode(&dict); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	dict.Name = strings.TrimSpace(dict.Name)
+	dict.SourceLanguage = strings.TrimSpace(dict.SourceLanguage)
+	dict.TargetLanguage = strings.TrimSpace(dict.TargetLanguage)
+	dict.DictBaseURL = strings.TrimSpace(dict.DictBaseURL)
+	dict.HighlightColor = strings.TrimSpace(dict.HighlightColor)
+	if dict.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing required field: name")
+		return nil, false
+	}
+	if _, err := url.ParseRequestURI(dict.DictBaseURL); err != nil && dict.DictBaseURL != "" {
+		writeJSONError(w, http.StatusBadRequest, "Invalid dictBaseUrl")
+		return nil, false
+	}
+	return &dict, true
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"lingomarker/internal/anki"
+	"lingomarker/internal/archive"
+	"lingomarker/internal/models"
+	"lingomarker/internal/storage"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ffmpegPath is the ffmpeg used to cut podcast clips, the same default the
+// transcription service uses.
+const ffmpegPath = "ffmpeg"
+
+var podcastURLPattern = regexp.MustCompile(`/podcasts/play/([0-9a-fA-F-]{36})`)
+
+// HandleExportAnki downloads the user's marked words as an Anki deck (.apkg).
+// Handles GET /api/export/anki; with audio=0 podcast clips are left out, and
+// with dictionary=ID or name only that dictionary's words are exported.
+func (h *APIHandlers) HandleExportAnki(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	h.extendDeadlines(w) // Cutting audio clips takes a while
+	dictionaryID, ok := h.exportDictionaryID(w, r)
+	if !ok {
+		return
+	}
+
+	bundle, err := h.DB.GetUserDataBundle(userID, dictionaryID)
+	if err != nil {
+		log.Printf("API ExportAnki: Failed to get data for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve user data")
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "lingomarker-anki-")
+	if err != nil {
+		log.Printf("API ExportAnki: Failed to create temp dir: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to build deck")
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	deck := h.buildAnkiDeck(r.Context(), userID, bundle, tmpDir, r.URL.Query().Get("audio") != "0")
+
+	f, err := os.Create(filepath.Join(tmpDir, "lingomarker.apkg"))
+	if err != nil {
+		log.Printf("API ExportAnki: Failed to create package: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to build deck")
+		return
+	}
+	defer f.Close()
+	now := time.Now()
+	if err := deck.WriteAPKG(f, tmpDir, now); err != nil {
+		log.Printf("API ExportAnki: Failed to write deck for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to build deck")
+		return
+	}
+
+	log.Printf("API ExportAnki: Exported %d notes for user %d", deck.Len(), userID)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="lingomarker.apkg"`)
+	http.ServeContent(w, r, "lingomarker.apkg", now, f)
+}
+
+// buildAnkiDeck makes one note per entry, with the paragraph it was most
+// recently marked in as context. For words marked in a podcast transcript the
+// segment's audio is cut into tmpDir, unless withAudio is false or it fails.
+func (h *APIHandlers) buildAnkiDeck(ctx context.Context, userID int64, bundle *models.UserDataBundle, tmpDir string, withAudio bool) *anki.Deck {
+	urls := make(map[string]models.URL, len(bundle.URLs))
+	for _, u := range bundle.URLs {
+		urls[u.URLHash] = u
+	}
+	paragraphs := make(map[string]string, len(bundle.Paragraphs))
+	for _, p := range bundle.Paragraphs {
+		paragraphs[p.ParagraphHash] = p.Text
+	}
+	latest := make(map[string]models.Relation, len(bundle.Entries))
+	for _, rel := range bundle.Relations {
+		if prev, ok := latest[rel.EntryUUID]; !ok || rel.UpdatedAt.After(prev.UpdatedAt) {
+			latest[rel.EntryUUID] = rel
+		}
+	}
+	podcasts := make(map[string]*models.Podcast) // nil if missing or not the user's
+	audioPaths := make(map[string]string)        // Local files of podcast audio, by podcast ID
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+	audioPath := func(podcast *models.Podcast) (string, error) {
+		if p, ok := audioPaths[podcast.ID]; ok {
+			return p, nil
+		}
+		p, release, err := storage.LocalFile(ctx, h.Blobs, podcast.StorePath)
+		if err != nil {
+			return "", err
+		}
+		releases = append(releases, release)
+		audioPaths[podcast.ID] = p
+		return p, nil
+	}
+
+	deck := anki.NewDeck("LingoMarker")
+	for _, entry := range bundle.Entries {
+		forms := strings.Split(entry.FormsPipeSeparated, "|")
+		note := anki.Note{Key: entry.UUID, Word: entry.Word, Forms: forms}
+
+		rel, ok := latest[entry.UUID]
+		if !ok {
+			deck.AddNote(note)
+			continue
+		}
+		note.Context = anki.Highlight(paragraphs[rel.ParagraphHash], append([]string{entry.Word}, forms...))
+		u := urls[rel.URLHash]
+		note.URL = u.URL
+		if u.Title != nil && *u.Title != "" {
+			note.Source = *u.Title
+		} else {
+			note.Source = u.URL
+		}
+
+		if m := podcastURLPattern.FindStringSubmatch(u.URL); m != nil {
+			podcastID := strings.ToLower(m[1])
+			podcast, seen := podcasts[podcastID]
+			if !seen {
+				podcast, _ = h.DB.GetPodcastByIDForUser(userID, podcastID)
+				podcasts[podcastID] = podcast
+			}
+			if podcast != nil {
+				note.Source = fmt.Sprintf("%s: %s - %s", podcast.Producer, podcast.Series, podcast.Episode)
+				if withAudio && rel.TranscriptSegmentRef != nil {
+					var err error
+					if note.Audio, err = addClip(ctx, deck, podcast, audioPath, *rel.TranscriptSegmentRef, tmpDir); err != nil {
+						log.Printf("API ExportAnki: Skipping audio of podcast %s at %s: %v", podcast.ID, *rel.TranscriptSegmentRef, err)
+						if errors.Is(err, exec.ErrNotFound) {
+							withAudio = false // No ffmpeg, no point trying the other clips
+						}
+					}
+				}
+			}
+		}
+		deck.AddNote(note)
+	}
+	return deck
+}
+
+// addClip cuts the audio of a transcript segment into tmpDir and adds it to
+// the deck, returning its media name. audio returns the podcast's audio file.
+func addClip(ctx context.Context, deck *anki.Deck, podcast *models.Podcast, audio func(*models.Podcast) (string, error), segmentRef, tmpDir string) (string, error) {
+	start, end, err := models.ParseTimestamp(segmentRef)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(podcast.ID + "|" + segmentRef))
+	name := "lingomarker-" + hex.EncodeToString(sum[:8]) + ".mp3"
+	path := filepath.Join(tmpDir, name)
+	if _, err := os.Stat(path); err == nil {
+		return name, nil // Same segment as an earlier note
+	}
+	audioPath, err := audio(podcast)
+	if err != nil {
+		return "", err
+	}
+	if err := anki.CutClip(ctx, ffmpegPath, audioPath, path, start, end); err != nil {
+		return "", err
+	}
+	deck.AddMedia(name, path)
+	return name, nil
+}
+
+// maxArchiveSize limits uploaded backup archives, which may contain audio.
+const maxArchiveSize = 4 << 30
+
+// HandleExportArchive downloads everything the user owns as a backup archive.
+// Handles GET /api/export; with audio=1 the podcast audio files are included.
+func (h *APIHandlers) HandleExportArchive(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	h.extendDeadlines(w) // Building and sending gigabytes of audio takes a while
+
+	data, err := h.DB.GetUserArchive(userID)
+	if err != nil {
+		log.Printf("API ExportArchive: Failed to get data for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve user data")
+		return
+	}
+
+	f, err := os.CreateTemp("", "lingomarker-export-*.zip")
+	if err != nil {
+		log.Printf("API ExportArchive: Failed to create temp file: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to build archive")
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var openAudio func(p *models.ArchivedPodcast) (io.ReadCloser, error)
+	if r.URL.Query().Get("audio") == "1" {
+		openAudio = func(p *models.ArchivedPodcast) (io.ReadCloser, error) {
+			return h.Blobs.Open(r.Context(), p.StorePath)
+		}
+	}
+	now := time.Now().UTC()
+	if err := archive.Write(f, data, openAudio, now); err != nil {
+		log.Printf("API ExportArchive: Failed to write archive for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to build archive")
+		return
+	}
+
+	log.Printf("API ExportArchive: Exported %d entries and %d podcasts for user %d", len(data.Entries), len(data.Podcasts), userID)
+	filename := "lingomarker-" + now.Format("2006-01-02") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	http.ServeContent(w, r, filename, now, f)
+}
+
+// HandleImportArchive restores a backup archive made by HandleExportArchive.
+// Handles POST /api/import/archive?mode=merge|replace (default merge), with
+// the archive as the request body or in the "archive_file" form field.
+func (h *APIHandlers) HandleImportArchive(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	h.extendDeadlines(w) // Archives of up to maxArchiveSize take a while to upload
+
+	var replace bool
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "merge":
+	case "replace":
+		replace = true
+	default:
+		writeJSONError(w, http.StatusBadRequest, "Invalid mode, expected merge or replace")
+		return
+	}
+
+	src, size, cleanup, err := readArchiveUpload(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to read archive: "+err.Error())
+		return
+	}
+	defer cleanup()
+
+	reader, err := archive.Open(src, size)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid archive: "+err.Error())
+		return
+	}
+	data := reader.Archive
+
+	for i := range data.Podcasts {
+		p := &data.Podcasts[i]
+		ext := archive.AudioExt(p)
+		mediaType, ok := uploadExtensions[ext]
+		if _, err := uuid.Parse(p.ID); err != nil || !ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid archive: podcast %q has an invalid ID or media type", p.ID))
+			return
+		}
+		p.MediaType = mediaType
+		p.StorePath = storage.PodcastKey(userID, p.ID, ext)
+	}
+
+	report, err := h.DB.RestoreUserArchive(userID, data, replace)
+	if err != nil {
+		log.Printf("API ImportArchive: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to import archive: "+err.Error())
+		return
+	}
+
+	restored := make(map[string]bool, len(report.Restored))
+	for _, id := range report.Restored {
+		restored[id] = true
+	}
+	kept := make(map[string]bool)
+	for i := range data.Podcasts {
+		p := &data.Podcasts[i]
+		if !restored[p.ID] {
+			continue
+		}
+		kept[p.StorePath] = true
+		if !reader.HasAudio(p) {
+			continue
+		}
+		if err := h.restoreAudio(r.Context(), reader, p); err != nil {
+			log.Printf("API ImportArchive: Failed to restore audio of podcast %s for user %d: %v", p.ID, userID, err)
+			continue
+		}
+		report.AudioFiles++
+	}
+	for _, key := range report.RemovedAudio {
+		if kept[key] {
+			continue
+		}
+		if err := h.Blobs.Delete(r.Context(), key); err != nil {
+			log.Printf("API ImportArchive: Failed to delete replaced audio file %s: %v", key, err)
+		}
+	}
+
+	log.Printf("API ImportArchive: User %d imported %+v (replace: %t)", userID, *report, replace)
+	writeJSON(w, http.StatusOK, report)
+}
+
+// restoreAudio copies the audio of p from the archive to the blob store.
+func (h *APIHandlers) restoreAudio(ctx context.Context, reader *archive.Reader, p *models.ArchivedPodcast) error {
+	rc, err := reader.OpenAudio(p)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = h.Blobs.Put(ctx, p.StorePath, rc)
+	return err
+}
+
+// readArchiveUpload returns the uploaded archive, spooling a raw request body
+// to a temporary file since zip needs random access.
+func readArchiveUpload(w http.ResponseWriter, r *http.Request) (io.ReaderAt, int64, func(), error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return nil, 0, nil, err
+		}
+		file, header, err := r.FormFile("archive_file")
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return file, header.Size, func() { file.Close(); r.MultipartForm.RemoveAll() }, nil
+	}
+
+	f, err := os.CreateTemp("", "lingomarker-import-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() { f.Close(); os.Remove(f.Name()) }
+	size, err := io.Copy(f, r.Body)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return f, size, cleanup, nil
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"lingomarker/internal/database"
+	"lingomarker/internal/feeds"
+	"lingomarker/internal/models"
+	"lingomarker/internal/router"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxKeepEpisodes bounds how many episodes a feed may keep.
+const maxKeepEpisodes = 100
+
+// FeedRequest subscribes to a feed, or changes a subscription. KeepEpisodes
+// is optional when subscribing and defaults to feeds.keep_episodes.
+type FeedRequest struct {
+	URL          string `json:"url"`
+	KeepEpisodes *int   `json:"keepEpisodes"`
+}
+
+// keepEpisodes validates the requested limit, returning def if none was sent.
+func (req *FeedRequest) keepEpisodes(def int) (int, bool) {
+	if req.KeepEpisodes == nil {
+		return def, true
+	}
+	n := *req.KeepEpisodes
+	return n, n >= 1 && n <= maxKeepEpisodes
+}
+
+// HandleCreateFeed subscribes the user to an RSS or Atom feed. The feed is
+// fetched once to check it; its episodes are downloaded in the background.
+// Handles POST /api/feeds.
+func (h *APIHandlers) HandleCreateFeed(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+
+	var req FeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing url")
+		return
+	}
+	keep, ok := req.keepEpisodes(h.Cfg.Feeds.KeepEpisodes)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "keepEpisodes must be between 1 and 100")
+		return
+	}
+
+	parsed, err := h.Feeds.Fetch(r.Context(), req.URL)
+	if err != nil {
+		log.Printf("API CreateFeed: Failed to fetch %q for user %d: %v", req.URL, userID, err)
+		switch {
+		case errors.Is(err, feeds.ErrInvalidURL), errors.Is(err, feeds.ErrForbiddenAddress):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, feeds.ErrNotFeed), errors.Is(err, feeds.ErrTooLarge):
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			writeJSONError(w, http.StatusBadGateway, "Failed to fetch feed: "+err.Error())
+		}
+		return
+	}
+
+	feed := &models.Feed{
+		ID:           uuid.NewString(),
+		UserID:       userID,
+		URL:          req.URL,
+		Title:        parsed.Title,
+		Author:       parsed.Author,
+		Description:  parsed.Description,
+		KeepEpisodes: keep,
+	}
+	if err := h.DB.CreateFeed(feed); err != nil {
+		if errors.Is(err, database.ErrFeedExists) {
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		log.Printf("API CreateFeed: Failed to save feed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save feed")
+		return
+	}
+	h.Feeds.Notify()
+
+	log.Printf("API CreateFeed: User %d subscribed to %q with %d episodes", userID, feed.URL, len(parsed.Episodes))
+	writeJSON(w, http.StatusCreated, feed)
+}
+
+// HandleListFeeds lists the user's feeds. Handles GET /api/feeds.
+func (h *APIHandlers) HandleListFeeds(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	list, err := h.DB.ListFeeds(userID)
+	if err != nil {
+		log.Printf("API ListFeeds: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve feed list")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// HandleUpdateFeed changes how many episodes of a feed are kept. Handles
+// PUT /api/feeds/{id} with {"keepEpisodes": n}.
+func (h *APIHandlers) HandleUpdateFeed(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	feedID, ok := feedIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req FeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	keep, ok := req.keepEpisodes(0)
+	if !ok || keep == 0 {
+		writeJSONError(w, http.StatusBadRequest, "keepEpisodes must be between 1 and 100")
+		return
+	}
+
+	if err := h.DB.UpdateFeed(userID, feedID, keep); err != nil {
+		writeFeedError(w, "UpdateFeed", userID, feedID, err)
+		return
+	}
+	h.Feeds.Notify()
+
+	feed, err := h.DB.GetFeed(userID, feedID)
+	if err != nil {
+		writeFeedError(w, "UpdateFeed", userID, feedID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, feed)
+}
+
+// HandleRefreshFeed has a feed checked for new episodes now. Handles
+// POST /api/feeds/{id}/refresh, with the ID passed in the context.
+func (h *APIHandlers) HandleRefreshFeed(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	feedID := router.GetPathParam(r.Context())
+
+	if err := h.DB.RequestFeedCheck(userID, feedID); err != nil {
+		writeFeedError(w, "RefreshFeed", userID, feedID, err)
+		return
+	}
+	h.Feeds.Notify()
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "Feed check queued"})
+}
+
+// HandleDeleteFeed unsubscribes from a feed. Episodes already downloaded are
+// kept. Handles DELETE /api/feeds/{id}.
+func (h *APIHandlers) HandleDeleteFeed(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	feedID, ok := feedIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.DeleteFeed(userID, feedID); err != nil {
+		writeFeedError(w, "DeleteFeed", userID, feedID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Feed deleted successfully"})
+}
+
+// feedIDFromPath returns the feed ID of /api/feeds/{id}, writing an error
+// response if it is not one.
+func feedIDFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	feedID := router.GetPathParam(r.Context())
+	if _, err := uuid.Parse(feedID); err != nil || strings.Contains(feedID, "/") {
+		writeJSONError(w, http.StatusBadRequest, "Invalid feed ID in path, expected /api/feeds/{id}")
+		return "", false
+	}
+	return feedID, true
+}
+
+// writeFeedError writes the response for an error from a feed query.
+func writeFeedError(w http.ResponseWriter, action string, userID int64, feedID string, err error) {
+	if errors.Is(err, database.ErrFeedNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Printf("API %s: Failed for user %d, feed %s: %v", action, userID, feedID, err)
+	writeJSONError(w, http.StatusInternalServerError, "Failed to process feed request")
+}
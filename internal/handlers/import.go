@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"lingomarker/internal/vocab"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportFileSize limits uploaded vocabulary files.
+const maxImportFileSize = 32 << 20
+
+// HandleImportCSV imports words from a CSV or TSV file, sent as the request
+// body or in the "csv_file" form field. Handles POST /api/import/csv.
+//
+// Query parameters: delimiter (comma, tab, semicolon or a single character;
+// detected by default), header (1 or 0; detected by default), dictionary (ID
+// or name; the active one by default), and word, forms, context, url, title
+// and date, each mapping that field to a column by header name or 1-based
+// index.
+func (h *APIHandlers) HandleImportCSV(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	query := r.URL.Query()
+
+	opts := vocab.CSVOptions{Mapping: make(map[string]string)}
+	switch d := query.Get("delimiter"); d {
+	case "":
+	case "comma":
+		opts.Comma = ','
+	case "tab", `\t`:
+		opts.Comma = '\t'
+	case "semicolon":
+		opts.Comma = ';'
+	default:
+		if len([]rune(d)) != 1 {
+			writeJSONError(w, http.StatusBadRequest, "Invalid delimiter, expected comma, tab, semicolon or a single character")
+			return
+		}
+		opts.Comma = []rune(d)[0]
+	}
+	if v := query.Get("header"); v != "" {
+		header, err := strconv.ParseBool(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid header, expected 1 or 0")
+			return
+		}
+		opts.Header = &header
+	}
+	for _, field := range vocab.Fields {
+		if v := strings.TrimSpace(query.Get(field)); v != "" {
+			opts.Mapping[field] = v
+		}
+	}
+	dict, settings := h.requestDictionary(w, r, "")
+	if dict == nil {
+		return
+	}
+
+	src, filename, cleanup, err := readImportUpload(w, r, "csv_file")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to read file: "+err.Error())
+		return
+	}
+	defer cleanup()
+	opts.Source = "import:" + filename
+	opts.KeepFragment = strings.Split(settings.AllowFragmentURLList, ",")
+
+	words, issues, err := vocab.ReadCSV(src, opts)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "Invalid file: "+err.Error())
+		return
+	}
+
+	report, err := h.DB.ImportWords(userID, dict.ID, words)
+	if err != nil {
+		log.Printf("API ImportCSV: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed during import: "+err.Error())
+		return
+	}
+	report.Skipped = issues
+
+	log.Printf("API ImportCSV: User %d imported %d rows from %s: %d entries, %d relations, %d skipped",
+		userID, len(words), filename, report.Entries, report.Relations, len(issues))
+	writeJSON(w, http.StatusOK, report)
+}
+
+// HandleExportCSV downloads the user's words with their contexts as CSV, or
+// as TSV with format=tsv. With dictionary=ID or name only that dictionary's
+// words are exported. Handles GET /api/export/csv.
+func (h *APIHandlers) HandleExportCSV(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	dictionaryID, ok := h.exportDictionaryID(w, r)
+	if !ok {
+		return
+	}
+
+	comma, ext, contentType := ',', ".csv", "text/csv; charset=utf-8"
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "csv":
+	case "tsv":
+		comma, ext, contentType = '\t', ".tsv", "text/tab-separated-values; charset=utf-8"
+	default:
+		writeJSONError(w, http.StatusBadRequest, "Invalid format, expected csv or tsv")
+		return
+	}
+
+	bundle, err := h.DB.GetUserDataBundle(userID, dictionaryID)
+	if err != nil {
+		log.Printf("API ExportCSV: Failed to get data for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve user data")
+		return
+	}
+
+	filename := "lingomarker-words-" + time.Now().UTC().Format("2006-01-02") + ext
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+	if err := vocab.WriteCSV(w, comma, bundle); err != nil {
+		log.Printf("API ExportCSV: Failed to write CSV for user %d: %v", userID, err)
+	}
+}
+
+// readImportUpload returns an uploaded file, from the multipart form field
+// named field or else the request body, and its file name. A raw body is
+// named by the filename query parameter.
+func readImportUpload(w http.ResponseWriter, r *http.Request, field string) (io.Reader, string, func(), error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(8 << 20); err != nil {
+			return nil, "", nil, err
+		}
+		file, header, err := r.FormFile(field)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return file, filepath.Base(header.Filename), func() { file.Close(); r.MultipartForm.RemoveAll() }, nil
+	}
+	name := r.URL.Query().Get("filename")
+	if name == "" {
+		name = "upload"
+	}
+	return r.Body, filepath.Base(name), func() { r.Body.Close() }, nil
+}
+
+// HandleImportKindle imports the lookups of a Kindle Vocabulary Builder
+// database (vocab.db), sent as the request body or in the "vocab_file" form
+// field, into the dictionary selected with ?dictionary= (the active one by
+// default). Handles POST /api/import/kindle.
+func (h *APIHandlers) HandleImportKindle(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	dict, _ := h.requestDictionary(w, r, "")
+	if dict == nil {
+		return
+	}
+
+	src, _, cleanup, err := readImportUpload(w, r, "vocab_file")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to read file: "+err.Error())
+		return
+	}
+	defer cleanup()
+
+	// SQLite needs a file.
+	f, err := os.CreateTemp("", "lingomarker-kindle-*.db")
+	if err != nil {
+		log.Printf("API ImportKindle: Failed to create temp file: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to store file")
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "Failed to read file: "+err.Error())
+		return
+	}
+
+	words, err := vocab.ReadKindle(f.Name())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid file: "+err.Error())
+		return
+	}
+
+	report, err := h.DB.ImportWords(userID, dict.ID, words)
+	if err != nil {
+		log.Printf("API ImportKindle: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed during import: "+err.Error())
+		return
+	}
+
+	log.Printf("API ImportKindle: User %d imported %d lookups: %d entries, %d relations",
+		userID, len(words), report.Entries, report.Relations)
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"lingomarker/internal/auth"
+	"lingomarker/internal/router"
+	"lingomarker/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// mediaPath is the path a podcast's audio or video is served from.
+func mediaPath(podcastID string) string {
+	return "/media/" + podcastID
+}
+
+// signedMediaURL returns the path of a podcast's media with a signature that
+// lets players without the session cookie stream it, and when it expires.
+func (h *APIHandlers) signedMediaURL(userID int64, podcastID string) (string, time.Time) {
+	expires := time.Now().Add(h.Cfg.Storage.SignedURLTTL).Truncate(time.Second)
+	query := auth.SignMediaQuery(h.Cfg.Session.SecretKey, userID, podcastID, expires)
+	return mediaPath(podcastID) + "?" + query.Encode(), expires
+}
+
+// HandleMedia streams the audio or video of a podcast to its owner, who is
+// identified by the session cookie or a signed URL. Range, If-Range and
+// conditional requests are answered as by http.ServeContent. Handles GET and
+// HEAD /media/{id}, outside the auth middleware.
+func (h *APIHandlers) HandleMedia(w http.ResponseWriter, r *http.Request) {
+	podcastID := router.GetPathParam(r.Context())
+	if _, err := uuid.Parse(podcastID); err != nil || strings.Contains(podcastID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID, err := h.mediaUser(r, podcastID)
+	if err != nil {
+		log.Printf("Media: Access to podcast %s denied for %s: %v", podcastID, r.RemoteAddr, err)
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Another user's podcast is reported as missing, like a podcast that
+	// does not exist.
+	storeKey, err := h.DB.GetPodcastStorePath(userID, podcastID)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			log.Printf("Media: Failed to look up podcast %s for user %d: %v", podcastID, userID, err)
+			http.Error(w, "Failed to look up media", http.StatusInternalServerError)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	obj, err := h.Blobs.Open(r.Context(), storeKey)
+	if err != nil {
+		log.Printf("Media: Failed to open %s of podcast %s: %v", storeKey, podcastID, err)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "Failed to read media", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer obj.Close()
+
+	// ServeContent compares the blob's ETag with If-None-Match and If-Range.
+	info := obj.Info()
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, path.Base(storeKey), info.ModTime, obj)
+}
+
+// mediaUser returns the user a media request is made for: the one a valid
+// signature was made for, else the one logged in.
+func (h *APIHandlers) mediaUser(r *http.Request, podcastID string) (int64, error) {
+	query := r.URL.Query()
+	if !query.Has("signature") {
+		return auth.GetUserIDFromRequest(r, h.DB, h.Cfg)
+	}
+	userID, err := auth.VerifyMediaQuery(h.Cfg.Session.SecretKey, query, podcastID, time.Now())
+	if err != nil {
+		// An expired URL still works in the app's own player, which sends the cookie.
+		if sessionUserID, sessionErr := auth.GetUserIDFromRequest(r, h.DB, h.Cfg); sessionErr == nil {
+			return sessionUserID, nil
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// HandleGetPodcastMediaURL returns a signed URL of a podcast's audio or
+// video, for players that cannot send the session cookie. The URL is
+// relative to the server, whose public address the client knows better than
+// the Host header. Handles GET /api/podcasts/{id}/media_url, with the ID
+// passed in the context.
+func (h *APIHandlers) HandleGetPodcastMediaURL(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	podcastID := router.GetPathParam(r.Context())
+
+	if _, err := h.DB.GetPodcastStorePath(userID, podcastID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeJSONError(w, http.StatusNotFound, "Podcast not found or access denied.")
+			return
+		}
+		log.Printf("API GetPodcastMediaURL: Failed for user %d, podcast %s: %v", userID, podcastID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve podcast")
+		return
+	}
+
+	signedPath, expires := h.signedMediaURL(userID, podcastID)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"url":       signedPath,
+		"expiresAt": expires.UTC(),
+	})
+}
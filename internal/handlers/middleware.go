@@ -17,7 +17,7 @@ type contextKey string
 const UserIDContextKey = contextKey("userID")
 
 // AuthMiddleware checks for a valid session and adds user ID to context
-func AuthMiddleware(db *database.DB, cfg *config.Config) func(http.Handler) http.Handler {
+func AuthMiddleware(db database.SessionStore, cfg *config.Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			userID, err := auth.GetUserIDFromRequest(r, db, cfg)
@@ -65,6 +65,12 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the connection, e.g. to extend
+// deadlines.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Optional: Implement Write to capture size if needed
 // func (rw *responseWriter) Write(b []byte) (int, error) {
 //     // Capture size logic
@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"lingomarker/internal/database"
+	"lingomarker/internal/models"
+	"lingomarker/internal/router"
+	"lingomarker/internal/storage"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Resumable uploads follow the tus protocol (https://tus.io), version 1.0.0,
+// with its creation, checksum, termination and expiration extensions, so
+// off-the-shelf tus clients work. Every chunk is stored as a blob right away;
+// the last one assembles them into the podcast.
+const tusVersion = "1.0.0"
+
+// statusChecksumMismatch is the tus status for a chunk whose Upload-Checksum
+// does not match its content. The chunk is discarded.
+const statusChecksumMismatch = 460
+
+// uploadChecksums are the Upload-Checksum algorithms accepted.
+var uploadChecksums = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// uploadPath is the URL of an upload session.
+func uploadPath(sessionID string) string {
+	return "/api/uploads/" + sessionID
+}
+
+// uploadPartKey is the blob key of a chunk. The random suffix keeps chunks
+// sent twice at the same offset, of which only one is recorded, apart.
+func uploadPartKey(sessionID string, offset int64) string {
+	return fmt.Sprintf("upload-parts/%s-%012d-%s", sessionID, offset, uuid.NewString()[:8])
+}
+
+// HandleUploadOptions describes the resumable upload protocol to clients.
+// Handles OPTIONS /api/uploads and /api/uploads/{id}, without auth.
+func (h *APIHandlers) HandleUploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,checksum,termination,expiration")
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxAudioUploadSize, 10))
+	w.Header().Set("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleCreateUpload starts a resumable upload of a podcast's audio. The
+// size goes in Upload-Length and the podcast's fields in Upload-Metadata:
+// filename, producer, series, episode and optionally description and
+// original_transcript. Handles POST /api/uploads.
+func (h *APIHandlers) HandleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		writeJSONError(w, http.StatusBadRequest, "Upload-Defer-Length is not supported, send Upload-Length")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "Missing or invalid Upload-Length")
+		return
+	}
+	if length > maxAudioUploadSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("File size exceeds limit of %dMB", maxAudioUploadSize/(1024*1024)))
+		return
+	}
+
+	meta, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid Upload-Metadata: "+err.Error())
+		return
+	}
+	// Video lessons need their subtitles, which only the form takes.
+	if uploadExtensions[strings.ToLower(filepath.Ext(meta["filename"]))] != models.MediaAudio {
+		writeJSONError(w, http.StatusBadRequest, "Invalid file type. Resumable uploads take audio: mp3, m4a, wav, ogg")
+		return
+	}
+	if meta["producer"] == "" || meta["series"] == "" || meta["episode"] == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing required metadata: producer, series, episode")
+		return
+	}
+
+	session := &models.UploadSession{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Filename:  meta["filename"],
+		Length:    length,
+		Producer:  meta["producer"],
+		Series:    meta["series"],
+		Episode:   meta["episode"],
+		ExpiresAt: time.Now().UTC().Add(h.Cfg.Storage.UploadExpiry),
+	}
+	if description := meta["description"]; description != "" {
+		session.Description = &description
+	}
+	if originalTranscript := meta["original_transcript"]; originalTranscript != "" {
+		session.OriginalTranscript = &originalTranscript
+	}
+	if err := h.DB.CreateUploadSession(session); err != nil {
+		log.Printf("API CreateUpload: Failed for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to start upload")
+		return
+	}
+
+	log.Printf("API CreateUpload: User %d started upload %s of %s (%d bytes)", userID, session.ID, session.Filename, length)
+	setUploadHeaders(w, session)
+	w.Header().Set("Location", uploadPath(session.ID))
+	writeJSON(w, http.StatusCreated, map[string]string{"uploadId": session.ID})
+}
+
+// HandleUploadStatus reports how many bytes of an upload have arrived, so a
+// client can resume from there, and the podcast once it is complete.
+// Handles HEAD /api/uploads/{id}.
+func (h *APIHandlers) HandleUploadStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	if !checkTusVersion(w, r) {
+		return
+	}
+	session, ok := h.uploadSession(w, r, userID, "UploadStatus")
+	if !ok {
+		return
+	}
+	setUploadHeaders(w, session)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleUploadChunk appends a chunk to an upload at Upload-Offset, checking
+// it against Upload-Checksum if given. Without a checksum, the bytes that
+// arrived before the connection broke are kept. The last chunk assembles the
+// upload into a podcast, which is queued for transcription; its ID is sent
+// in the Podcast-Id header. Handles PATCH /api/uploads/{id}.
+func (h *APIHandlers) HandleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	if !checkTusVersion(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeJSONError(w, http.StatusBadRequest, "Missing or invalid Upload-Offset")
+		return
+	}
+	checksum, wantSum, err := parseUploadChecksum(r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid Upload-Checksum: "+err.Error())
+		return
+	}
+
+	session, ok := h.uploadSession(w, r, userID, "UploadChunk")
+	if !ok {
+		return
+	}
+	if offset != session.Offset {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("Upload-Offset %d does not match the %d bytes received", offset, session.Offset))
+		return
+	}
+	remaining := session.Length - session.Offset
+	if r.ContentLength > remaining {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "Chunk exceeds the declared Upload-Length")
+		return
+	}
+	if remaining == 0 || r.ContentLength == 0 {
+		setUploadHeaders(w, session) // Nothing to add
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Keep what arrived even if the client goes away meanwhile.
+	ctx := context.WithoutCancel(r.Context())
+	var body io.Reader = http.MaxBytesReader(w, r.Body, remaining)
+	partial := &partialReader{r: body}
+	if checksum != nil {
+		body = io.TeeReader(body, checksum)
+	} else {
+		body = partial
+	}
+	part := models.UploadPart{Offset: session.Offset, StoreKey: uploadPartKey(session.ID, session.Offset)}
+	part.Size, err = h.Blobs.Put(ctx, part.StoreKey, body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "Chunk exceeds the declared Upload-Length")
+			return
+		}
+		log.Printf("API UploadChunk: Failed to store chunk at %d of upload %s (user %d): %v", offset, session.ID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to store chunk")
+		return
+	}
+	if partial.err != nil {
+		log.Printf("API UploadChunk: Kept %d bytes of interrupted chunk at %d of upload %s (user %d): %v", part.Size, offset, session.ID, userID, partial.err)
+	}
+	if checksum != nil && !bytes.Equal(checksum.Sum(nil), wantSum) {
+		_ = h.Blobs.Delete(ctx, part.StoreKey)
+		writeJSONError(w, statusChecksumMismatch, "Checksum mismatch, the chunk was discarded")
+		return
+	}
+	if part.Size == 0 {
+		_ = h.Blobs.Delete(ctx, part.StoreKey)
+		setUploadHeaders(w, session)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	now := time.Now().UTC()
+	expires := now.Add(h.Cfg.Storage.UploadExpiry)
+	if part.Offset+part.Size < session.Length {
+		err = h.DB.AddUploadPart(userID, session.ID, part, now, expires)
+	} else {
+		err = h.completeUpload(ctx, session, part, now, expires)
+	}
+	if err != nil {
+		_ = h.Blobs.Delete(ctx, part.StoreKey)
+		switch {
+		case errors.Is(err, database.ErrUploadNotFound):
+			writeJSONError(w, http.StatusNotFound, "Upload not found or expired")
+		case errors.Is(err, database.ErrUploadOffsetMismatch):
+			writeJSONError(w, http.StatusConflict, "Another chunk was received at this offset first")
+		default:
+			log.Printf("API UploadChunk: Failed at %d of upload %s (user %d): %v", offset, session.ID, userID, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to save chunk, send it again")
+		}
+		return
+	}
+
+	session.Offset += part.Size
+	session.ExpiresAt = expires
+	setUploadHeaders(w, session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeUpload assembles the parts of a session and its last part into a
+// podcast and queues it for transcription. If it fails, the session is
+// unchanged and the last chunk can be sent again.
+func (h *APIHandlers) completeUpload(ctx context.Context, session *models.UploadSession, last models.UploadPart, now, expires time.Time) error {
+	parts, err := h.DB.GetUploadParts(session.ID)
+	if err != nil {
+		return err
+	}
+	parts = append(parts, last)
+	var next int64
+	for _, part := range parts {
+		if part.Offset != next {
+			return fmt.Errorf("upload %s has a gap at %d", session.ID, next)
+		}
+		next += part.Size
+	}
+
+	podcastID := uuid.NewString()
+	ext := strings.ToLower(filepath.Ext(session.Filename))
+	storeKey := storage.PodcastKey(session.UserID, podcastID, ext)
+	src := &partsReader{ctx: ctx, blobs: h.Blobs, parts: parts}
+	size, err := h.Blobs.Put(ctx, storeKey, src)
+	src.Close()
+	if err == nil && size != session.Length {
+		err = fmt.Errorf("assembled %d of %d bytes", size, session.Length)
+	}
+	if err != nil {
+		_ = h.Blobs.Delete(ctx, storeKey)
+		return fmt.Errorf("failed to assemble upload %s: %w", session.ID, err)
+	}
+
+	podcast := &models.Podcast{
+		ID:                 podcastID,
+		UserID:             session.UserID,
+		Filename:           session.Filename,
+		StorePath:          storeKey,
+		Producer:           session.Producer,
+		Series:             session.Series,
+		Episode:            session.Episode,
+		Description:        session.Description,
+		OriginalTranscript: session.OriginalTranscript,
+		UploadTime:         time.Now(),
+		Status:             models.StatusUploaded,
+		MediaType:          uploadExtensions[ext],
+	}
+	if err := h.DB.CompleteUploadSession(session.UserID, session.ID, last, podcast, now, expires); err != nil {
+		_ = h.Blobs.Delete(ctx, storeKey)
+		return err
+	}
+	session.PodcastID = &podcastID
+	for _, part := range parts {
+		if err := h.Blobs.Delete(ctx, part.StoreKey); err != nil {
+			log.Printf("API UploadChunk: Failed to delete part %s of upload %s: %v", part.StoreKey, session.ID, err)
+		}
+	}
+	log.Printf("User %d uploaded file: %s saved as %s (resumable upload %s)", session.UserID, session.Filename, storeKey, session.ID)
+
+	if err := h.DB.EnqueueTranscription(session.UserID, podcastID, time.Now().UTC()); err != nil {
+		// The podcast exists, so the upload is done; RecoverTranscriptionJobs
+		// queues it at the next start.
+		log.Printf("Error queueing transcription of podcast %s for user %d: %v", podcastID, session.UserID, err)
+		return nil
+	}
+	h.Transcriptions.Notify()
+	log.Printf("Podcast %s uploaded successfully for user %d. Transcription queued.", podcastID, session.UserID)
+	return nil
+}
+
+// HandleDeleteUpload cancels an upload and deletes the chunks received.
+// A podcast already assembled from it is kept. Handles DELETE /api/uploads/{id}.
+func (h *APIHandlers) HandleDeleteUpload(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	if !checkTusVersion(w, r) {
+		return
+	}
+	sessionID, ok := uploadIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	keys, err := h.DB.DeleteUploadSession(userID, sessionID)
+	if err != nil {
+		if errors.Is(err, database.ErrUploadNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Upload not found or expired")
+			return
+		}
+		log.Printf("API DeleteUpload: Failed for user %d, upload %s: %v", userID, sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to delete upload")
+		return
+	}
+	for _, key := range keys {
+		if err := h.Blobs.Delete(r.Context(), key); err != nil {
+			log.Printf("API DeleteUpload: Failed to delete part %s of upload %s: %v", key, sessionID, err)
+		}
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadSession returns the session named in the path, or writes the error.
+func (h *APIHandlers) uploadSession(w http.ResponseWriter, r *http.Request, userID int64, action string) (*models.UploadSession, bool) {
+	sessionID, ok := uploadIDFromPath(w, r)
+	if !ok {
+		return nil, false
+	}
+	session, err := h.DB.GetUploadSession(userID, sessionID, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, database.ErrUploadNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Upload not found or expired")
+			return nil, false
+		}
+		log.Printf("API %s: Failed for user %d, upload %s: %v", action, userID, sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve upload")
+		return nil, false
+	}
+	return session, true
+}
+
+func uploadIDFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	sessionID := router.GetPathParam(r.Context())
+	if _, err := uuid.Parse(sessionID); err != nil || strings.Contains(sessionID, "/") {
+		writeJSONError(w, http.StatusBadRequest, "Invalid upload ID in path, expected /api/uploads/{id}")
+		return "", false
+	}
+	return sessionID, true
+}
+
+// checkTusVersion rejects requests for a protocol version other than ours.
+// Requests without Tus-Resumable are accepted, for plain HTTP clients.
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if v := r.Header.Get("Tus-Resumable"); v != "" && v != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		writeJSONError(w, http.StatusPreconditionFailed, "Unsupported tus version "+v)
+		return false
+	}
+	return true
+}
+
+func setUploadHeaders(w http.ResponseWriter, s *models.UploadSession) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(s.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(s.Length, 10))
+	w.Header().Set("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-store")
+	if s.PodcastID != nil {
+		w.Header().Set("Podcast-Id", *s.PodcastID)
+	}
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma-separated
+// pairs of a key and a base64 value, which may be left out.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	meta := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty key")
+		}
+		if _, dup := meta[key]; dup {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("value of %q is not base64", key)
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// parseUploadChecksum decodes an Upload-Checksum header, "{algorithm}
+// {base64 digest}", into a hash to compute and the digest it must have.
+func parseUploadChecksum(header string) (hash.Hash, []byte, error) {
+	if header == "" {
+		return nil, nil, nil
+	}
+	algorithm, encoded, _ := strings.Cut(header, " ")
+	newHash, ok := uploadChecksums[algorithm]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported algorithm %q, use md5, sha1 or sha256", algorithm)
+	}
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, errors.New("digest is not base64")
+	}
+	return newHash(), sum, nil
+}
+
+// partialReader ends a chunk at the first read error instead of failing it,
+// so the bytes that arrived before a connection broke are kept. A chunk
+// exceeding the upload still fails.
+type partialReader struct {
+	r   io.Reader
+	err error // The error swallowed
+}
+
+func (p *partialReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if err != nil && !errors.Is(err, io.EOF) {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return n, err
+		}
+		p.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// partsReader reads the parts of an upload one after another, opening each
+// once the previous one is done.
+type partsReader struct {
+	ctx   context.Context
+	blobs storage.BlobStore
+	parts []models.UploadPart
+	cur   io.ReadCloser
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.cur == nil {
+			if len(p.parts) == 0 {
+				return 0, io.EOF
+			}
+			obj, err := p.blobs.Open(p.ctx, p.parts[0].StoreKey)
+			if err != nil {
+				return 0, err
+			}
+			p.cur, p.parts = obj, p.parts[1:]
+		}
+		n, err := p.cur.Read(b)
+		if errors.Is(err, io.EOF) {
+			p.cur.Close()
+			p.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.cur != nil {
+		return p.cur.Close()
+	}
+	return nil
+}
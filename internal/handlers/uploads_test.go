@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"lingomarker/internal/config"
+	"lingomarker/internal/database"
+	"lingomarker/internal/jobs"
+	"lingomarker/internal/models"
+	"lingomarker/internal/router"
+	"lingomarker/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumableUpload(t *testing.T) {
+	h, userID, dir := newTestHandlers(t)
+	id := createTestUpload(t, h, userID, 10)
+
+	// The connection breaks after 5 of 10 bytes; those are kept.
+	w := sendChunk(t, h, userID, id, 0, &brokenReader{data: "hello"}, 10, "")
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("interrupted chunk: %d, offset %s: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body)
+	}
+	if w := uploadRequest(t, h, userID, http.MethodHead, id, nil, nil); w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("HEAD: %d, offset %s", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// The same chunk again, as a client that missed the response would.
+	if w := sendChunk(t, h, userID, id, 0, strings.NewReader("hello"), 5, ""); w.Code != http.StatusConflict {
+		t.Errorf("duplicate chunk: %d, want 409: %s", w.Code, w.Body)
+	}
+
+	// The rest, damaged on the way.
+	if w := sendChunk(t, h, userID, id, 5, strings.NewReader("w0rld"), 5, checksum("world")); w.Code != statusChecksumMismatch {
+		t.Errorf("damaged chunk: %d, want %d: %s", w.Code, statusChecksumMismatch, w.Body)
+	}
+	if n := countFiles(t, filepath.Join(dir, "upload-parts")); n != 1 {
+		t.Errorf("%d chunks stored, want 1: the damaged one is discarded", n)
+	}
+
+	w = sendChunk(t, h, userID, id, 5, strings.NewReader("world"), 5, checksum("world"))
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "10" {
+		t.Fatalf("last chunk: %d, offset %s: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body)
+	}
+	podcastID := w.Header().Get("Podcast-Id")
+	podcast, err := h.DB.GetPodcastByIDForUser(userID, podcastID)
+	if err != nil {
+		t.Fatalf("podcast %q: %v", podcastID, err)
+	}
+	if podcast.Filename != "episode.mp3" || podcast.Producer != "Producer" || podcast.Status != models.StatusQueued || podcast.MediaType != models.MediaAudio {
+		t.Errorf("podcast = %+v", podcast)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(podcast.StorePath))); err != nil || string(data) != "helloworld" {
+		t.Errorf("podcast file = %q, %v; want helloworld", data, err)
+	}
+	if n := countFiles(t, filepath.Join(dir, "upload-parts")); n != 0 {
+		t.Errorf("%d chunks left after completion, want 0", n)
+	}
+
+	// The podcast is reported to clients that resume after completion.
+	w = uploadRequest(t, h, userID, http.MethodHead, id, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Podcast-Id") != podcastID {
+		t.Errorf("HEAD after completion: %d, Podcast-Id %q, want %q", w.Code, w.Header().Get("Podcast-Id"), podcastID)
+	}
+}
+
+func TestUploadChunkRace(t *testing.T) {
+	h, userID, dir := newTestHandlers(t)
+	id := createTestUpload(t, h, userID, 10)
+	if w := sendChunk(t, h, userID, id, 0, strings.NewReader("hello"), 5, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("first chunk: %d: %s", w.Code, w.Body)
+	}
+
+	// A second request for offset 0 read the session before the first one
+	// recorded its chunk.
+	h.DB = staleUploads{Store: h.DB}
+	if w := sendChunk(t, h, userID, id, 0, strings.NewReader("hello"), 5, ""); w.Code != http.StatusConflict {
+		t.Errorf("racing chunk: %d, want 409: %s", w.Code, w.Body)
+	}
+	if n := countFiles(t, filepath.Join(dir, "upload-parts")); n != 1 {
+		t.Errorf("%d chunks stored, want 1: the racing one is discarded", n)
+	}
+}
+
+func TestUploadChunkRejects(t *testing.T) {
+	h, userID, _ := newTestHandlers(t)
+	id := createTestUpload(t, h, userID, 10)
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   int
+	}{
+		{"wrong content type", http.Header{"Content-Type": {"audio/mpeg"}, "Upload-Offset": {"0"}}, "hello", http.StatusUnsupportedMediaType},
+		{"no offset", http.Header{}, "hello", http.StatusBadRequest},
+		{"unknown checksum", http.Header{"Upload-Offset": {"0"}, "Upload-Checksum": {"crc32 AAAA"}}, "hello", http.StatusBadRequest},
+		{"past the end", http.Header{"Upload-Offset": {"0"}}, "hello world", http.StatusRequestEntityTooLarge},
+		{"other tus version", http.Header{"Upload-Offset": {"0"}, "Tus-Resumable": {"0.2.2"}}, "hello", http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.header.Get("Content-Type") == "" {
+				tt.header.Set("Content-Type", "application/offset+octet-stream")
+			}
+			w := uploadRequest(t, h, userID, http.MethodPatch, id, tt.header, strings.NewReader(tt.body))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	if w := sendChunk(t, h, userID+1, id, 0, strings.NewReader("hello"), 5, ""); w.Code != http.StatusNotFound {
+		t.Errorf("chunk for another user's upload: %d, want 404", w.Code)
+	}
+}
+
+// newTestHandlers returns handlers backed by a SQLite database and a
+// filesystem blob store in dir, with a user.
+func newTestHandlers(t *testing.T) (h *APIHandlers, userID int64, dir string) {
+	t.Helper()
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	dir = t.TempDir()
+	blobs, err := storage.NewFilesystem(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err = db.CreateUser("Test", "test", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Storage.UploadExpiry = time.Hour
+	h = &APIHandlers{
+		DB:             db,
+		Cfg:            cfg,
+		Blobs:          blobs,
+		Transcriptions: jobs.NewTranscriptionPool(db, blobs, nil, jobs.Config{}), // Never started
+	}
+	return h, userID, dir
+}
+
+// createTestUpload starts an upload of episode.mp3 of length bytes.
+func createTestUpload(t *testing.T, h *APIHandlers, userID int64, length int) string {
+	t.Helper()
+	enc := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	header := http.Header{
+		"Tus-Resumable": {tusVersion},
+		"Upload-Length": {strconv.Itoa(length)},
+		"Upload-Metadata": {"filename " + enc("episode.mp3") + ",producer " + enc("Producer") +
+			",series " + enc("Series") + ",episode " + enc("Episode")},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/uploads", nil)
+	r.Header = header
+	r = r.WithContext(context.WithValue(r.Context(), UserIDContextKey, userID))
+	w := httptest.NewRecorder()
+	h.HandleCreateUpload(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create upload: %d: %s", w.Code, w.Body)
+	}
+	return strings.TrimPrefix(w.Header().Get("Location"), "/api/uploads/")
+}
+
+// sendChunk sends body, declared to be length bytes, at offset.
+func sendChunk(t *testing.T, h *APIHandlers, userID int64, id string, offset int64, body io.Reader, length int64, checksum string) *httptest.ResponseRecorder {
+	t.Helper()
+	header := http.Header{
+		"Content-Type":  {"application/offset+octet-stream"},
+		"Upload-Offset": {strconv.FormatInt(offset, 10)},
+	}
+	if checksum != "" {
+		header.Set("Upload-Checksum", checksum)
+	}
+	r := newUploadRequest(userID, http.MethodPatch, id, header, body)
+	r.ContentLength = length
+	w := httptest.NewRecorder()
+	h.HandleUploadChunk(w, r)
+	return w
+}
+
+// uploadRequest sends a request for the upload id to the handler of method.
+func uploadRequest(t *testing.T, h *APIHandlers, userID int64, method, id string, header http.Header, body io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+	handlers := map[string]http.HandlerFunc{
+		http.MethodHead:   h.HandleUploadStatus,
+		http.MethodPatch:  h.HandleUploadChunk,
+		http.MethodDelete: h.HandleDeleteUpload,
+	}
+	w := httptest.NewRecorder()
+	handlers[method](w, newUploadRequest(userID, method, id, header, body))
+	return w
+}
+
+func newUploadRequest(userID int64, method, id string, header http.Header, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, uploadPath(id), body)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	ctx := context.WithValue(r.Context(), UserIDContextKey, userID)
+	return r.WithContext(context.WithValue(ctx, router.PathParamContextKey, id))
+}
+
+func checksum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+// brokenReader returns data and then fails, as a request body does when
+// the client's connection breaks.
+type brokenReader struct {
+	data string
+	done bool
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if b.done {
+		return 0, errors.New("connection reset by peer")
+	}
+	b.done = true
+	return copy(p, b.data), nil
+}
+
+// staleUploads returns upload sessions as they were before any chunk arrived.
+type staleUploads struct {
+	database.Store
+}
+
+func (s staleUploads) GetUploadSession(userID int64, sessionID string, now time.Time) (*models.UploadSession, error) {
+	session, err := s.Store.GetUploadSession(userID, sessionID, now)
+	if err == nil {
+		session.Offset = 0
+	}
+	return session, err
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"lingomarker/internal/auth"
@@ -8,6 +9,7 @@ import (
 	"lingomarker/internal/database"
 	"lingomarker/internal/models"
 	"lingomarker/internal/router"
+	"lingomarker/internal/wordforms"
 	"log"
 	"net/http"
 	"net/url"
@@ -19,7 +21,7 @@ import (
 )
 
 type WebHandlers struct {
-	DB        *database.DB
+	DB        database.Store
 	Cfg       *config.Config
 	Templates *template.Template
 }
@@ -242,16 +244,25 @@ func (h *WebHandlers) HandleSettingsPage(w http.ResponseWriter, r *http.Request)
 		currentSettings = &models.UserSettings{UserID: userID} // Should not happen with new GetUserSettings logic
 	}
 
+	dicts, err := h.DB.GetDictionaries(userID)
+	if err != nil {
+		log.Printf("Error fetching dictionaries for user %d: %v", userID, err)
+		http.Error(w, "Failed to load dictionaries", http.StatusInternalServerError)
+		return
+	}
+
 	if r.Method == http.MethodGet {
 		apiKeyIsSet := currentSettings.GeminiAPIKey != ""
 
 		data := map[string]interface{}{
-			"Title":       "Settings",
-			"User":        user,
-			"APIKeyIsSet": apiKeyIsSet,     // Still useful indicator
-			"Settings":    currentSettings, // Pass the whole settings object
-			"Message":     r.URL.Query().Get("message"),
-			"Error":       r.URL.Query().Get("error"),
+			"Dictionaries":   dicts,
+			"Title":          "Settings",
+			"User":           user,
+			"APIKeyIsSet":    apiKeyIsSet,     // Still useful indicator
+			"Settings":       currentSettings, // Pass the whole settings object
+			"OpenAIKeyIsSet": currentSettings.OpenAIAPIKey != "",
+			"Message":        r.URL.Query().Get("message"),
+			"Error":          r.URL.Query().Get("error"),
 		}
 		h.renderTemplate(w, "settings.html", data)
 		return
@@ -308,10 +319,43 @@ func (h *WebHandlers) HandleSettingsPage(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		formsProvider := r.FormValue("formsProvider")
+		if formsProvider != "" && !wordforms.ValidProvider(formsProvider) {
+			http.Redirect(w, r, "/settings?error=Unknown+word+forms+provider", http.StatusFound)
+			return
+		} else if formsProvider != "" {
+			updatedSettings.FormsProvider = formsProvider
+		}
+
+		updatedSettings.OpenAIBaseURL = strings.TrimSpace(r.FormValue("openaiBaseUrl"))
+		if _, err := url.ParseRequestURI(updatedSettings.OpenAIBaseURL); err != nil && updatedSettings.OpenAIBaseURL != "" {
+			http.Redirect(w, r, "/settings?error=Invalid+OpenAI-compatible+endpoint+URL", http.StatusFound)
+			return
+		}
+		updatedSettings.OpenAIModel = strings.TrimSpace(r.FormValue("openaiModel"))
+		updatedSettings.OpenAIAPIKey = r.FormValue("openaiApiKey") // Empty clears, same as the Gemini key
+		if updatedSettings.FormsProvider == wordforms.ProviderOpenAI && (updatedSettings.OpenAIBaseURL == "" || updatedSettings.OpenAIModel == "") {
+			http.Redirect(w, r, "/settings?error=OpenAI-compatible+provider+needs+an+endpoint+URL+and+a+model", http.StatusFound)
+			return
+		}
+
 		updatedSettings.HighlightColor = r.FormValue("highlightColor")
 		// Basic color validation (optional) - check for rgba, hex, etc.
 		// For now, trust user input or rely on browser color picker validation.
 
+		if v := r.FormValue("activeDictionaryId"); v != "" {
+			id, _ := strconv.ParseInt(v, 10, 64)
+			found := false
+			for _, d := range dicts {
+				found = found || d.ID == id
+			}
+			if !found {
+				http.Redirect(w, r, "/settings?error=Unknown+dictionary", http.StatusFound)
+				return
+			}
+			updatedSettings.ActiveDictionaryID = id
+		}
+
 		// --- Save updated settings ---
 		err = h.DB.SaveUserSettings(&updatedSettings)
 		if err != nil {
@@ -409,10 +453,175 @@ func (h *WebHandlers) HandlePodcastPlayPage(w http.ResponseWriter, r *http.Reque
 		"User":      user,
 		"PodcastID": podcastID, // Pass ID to the template for JS to use
 		"Podcast":   podcast,   // Pass basic metadata for initial display
+		"IsVideo":   podcast.MediaType == models.MediaVideo,
 	}
 	h.renderTemplate(w, "podcast_play.html", data)
 }
 
+// HandleArticleListPage lists captured articles, with a form to capture more.
+func (h *WebHandlers) HandleArticleListPage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	user, err := h.DB.GetUserByID(userID)
+	if err != nil || user == nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title": "Articles",
+		"User":  user,
+		// The list is fetched by client-side JS
+	}
+	h.renderTemplate(w, "articles.html", data)
+}
+
+// HandleReaderPage shows a captured article, where words can be marked
+// without the browser extension. Handles GET /read/{id}.
+func (h *WebHandlers) HandleReaderPage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	user, err := h.DB.GetUserByID(userID)
+	if err != nil || user == nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	articleID := router.GetPathParam(r.Context())
+	if articleID == "" {
+		http.Redirect(w, r, "/read", http.StatusFound)
+		return
+	}
+	if _, err := uuid.Parse(articleID); err != nil {
+		http.Error(w, "Invalid article ID format", http.StatusBadRequest)
+		return
+	}
+
+	article, err := h.DB.GetArticle(userID, articleID)
+	if err != nil {
+		if errors.Is(err, database.ErrArticleNotFound) {
+			http.Error(w, "Article not found or access denied.", http.StatusNotFound)
+			return
+		}
+		log.Printf("Web HandleReaderPage: Error fetching article %s for user %d: %v", articleID, userID, err)
+		http.Error(w, "Error retrieving article.", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":   article.Title,
+		"User":    user,
+		"Article": article,
+	}
+	h.renderTemplate(w, "read.html", data)
+}
+
+// HandleBookListPage lists uploaded books, with a form to upload more.
+func (h *WebHandlers) HandleBookListPage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	user, err := h.DB.GetUserByID(userID)
+	if err != nil || user == nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title": "Books",
+		"User":  user,
+		// The list is fetched by client-side JS
+	}
+	h.renderTemplate(w, "books.html", data)
+}
+
+// HandleFeedListPage shows the user's podcast feeds and a form to subscribe
+// to one. Handles GET /podcasts/feeds.
+func (h *WebHandlers) HandleFeedListPage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	user, err := h.DB.GetUserByID(userID)
+	if err != nil || user == nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":        "Feeds",
+		"User":         user,
+		"KeepEpisodes": h.Cfg.Feeds.KeepEpisodes,
+		// The list is fetched by client-side JS
+	}
+	h.renderTemplate(w, "feeds.html", data)
+}
+
+// HandleBookReaderPage shows a chapter of a book, where words can be marked.
+// Handles GET /books/read/{id}/{chapter}; GET /books/read/{id} redirects to
+// the chapter the user last read.
+func (h *WebHandlers) HandleBookReaderPage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDContextKey).(int64)
+	user, err := h.DB.GetUserByID(userID)
+	if err != nil || user == nil {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	bookID, chapterStr, hasChapter := strings.Cut(router.GetPathParam(r.Context()), "/")
+	if bookID == "" {
+		http.Redirect(w, r, "/books", http.StatusFound)
+		return
+	}
+	if _, err := uuid.Parse(bookID); err != nil {
+		http.Error(w, "Invalid book ID format", http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.DB.GetBook(userID, bookID)
+	if err != nil {
+		if errors.Is(err, database.ErrBookNotFound) {
+			http.Error(w, "Book not found or access denied.", http.StatusNotFound)
+			return
+		}
+		log.Printf("Web HandleBookReaderPage: Error fetching book %s for user %d: %v", bookID, userID, err)
+		http.Error(w, "Error retrieving book.", http.StatusInternalServerError)
+		return
+	}
+	if !hasChapter {
+		chapter := book.PositionChapter
+		if chapter < 0 || chapter >= len(book.Chapters) {
+			chapter = 0
+		}
+		http.Redirect(w, r, fmt.Sprintf("/books/read/%s/%d", bookID, chapter), http.StatusFound)
+		return
+	}
+
+	index, err := strconv.Atoi(chapterStr)
+	if err != nil || index < 0 || index >= len(book.Chapters) {
+		http.Error(w, "Chapter not found.", http.StatusNotFound)
+		return
+	}
+	chapter, err := h.DB.GetBookChapter(userID, bookID, index)
+	if err != nil {
+		log.Printf("Web HandleBookReaderPage: Error fetching chapter %d of book %s for user %d: %v", index, bookID, userID, err)
+		http.Error(w, "Error retrieving chapter.", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":       book.Title + ": " + chapter.Title,
+		"User":        user,
+		"Book":        book,
+		"Chapter":     chapter,
+		"SourceTitle": book.Title + ": " + chapter.Title,
+	}
+	if index > 0 {
+		data["PrevURL"] = book.Chapters[index-1].URL
+	}
+	if index+1 < len(book.Chapters) {
+		data["NextURL"] = book.Chapters[index+1].URL
+	}
+	// Only the chapter the position is in scrolls back to it.
+	if book.PositionChapter == index {
+		data["RestoreParagraph"] = book.PositionParagraph
+	}
+	h.renderTemplate(w, "book_read.html", data)
+}
+
 func (h *WebHandlers) HandleReviewPage(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(UserIDContextKey).(int64)
 	user, err := h.DB.GetUserByID(userID)
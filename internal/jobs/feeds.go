@@ -0,0 +1,283 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lingomarker/internal/database"
+	"lingomarker/internal/feeds"
+	"lingomarker/internal/models"
+	"lingomarker/internal/storage"
+	"log"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FeedConfig sets how often feeds are checked and how episodes are downloaded.
+type FeedConfig struct {
+	CheckInterval   time.Duration
+	PollInterval    time.Duration
+	MaxEpisodeSize  int64
+	DownloadTimeout time.Duration
+}
+
+// FeedPoller checks subscribed feeds, downloads new episodes and queues them
+// for transcription. When a feed is checked is kept in the database, so
+// several server instances can share the work.
+type FeedPoller struct {
+	db             database.Store
+	blobs          storage.BlobStore
+	client         *feeds.Client
+	transcriptions *TranscriptionPool
+	cfg            FeedConfig
+	wake           chan struct{}
+	wg             sync.WaitGroup
+}
+
+// NewFeedPoller creates a poller; call Start to run it.
+func NewFeedPoller(db database.Store, blobs storage.BlobStore, client *feeds.Client, transcriptions *TranscriptionPool, cfg FeedConfig) *FeedPoller {
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Hour
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Minute
+	}
+	if cfg.MaxEpisodeSize <= 0 {
+		cfg.MaxEpisodeSize = 500 << 20
+	}
+	if cfg.DownloadTimeout <= 0 {
+		cfg.DownloadTimeout = 30 * time.Minute
+	}
+	return &FeedPoller{
+		db:             db,
+		blobs:          blobs,
+		client:         client,
+		transcriptions: transcriptions,
+		cfg:            cfg,
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// Start runs the poller until ctx is cancelled; use Wait to block until it
+// has stopped.
+func (p *FeedPoller) Start(ctx context.Context) {
+	log.Printf("Feeds: checking feeds every %s", p.cfg.CheckInterval)
+	p.wg.Add(1)
+	go p.loop(ctx)
+}
+
+// Notify wakes the poller, e.g. right after a feed was added.
+func (p *FeedPoller) Notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default: // A wake-up is already pending
+	}
+}
+
+// Wait blocks until the poller has stopped.
+func (p *FeedPoller) Wait() {
+	p.wg.Wait()
+}
+
+// Fetch fetches a feed with the poller's client, e.g. to check a URL before
+// subscribing to it.
+func (p *FeedPoller) Fetch(ctx context.Context, feedURL string) (*feeds.Feed, error) {
+	return p.client.Fetch(ctx, feedURL)
+}
+
+func (p *FeedPoller) loop(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		feed, err := p.db.ClaimDueFeed(time.Now().UTC(), p.cfg.CheckInterval)
+		if err != nil {
+			log.Printf("Feeds: %v", err)
+		}
+		if feed != nil {
+			p.check(ctx, feed)
+			continue // Look for more due feeds straight away
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		case <-time.After(p.cfg.PollInterval):
+		}
+	}
+}
+
+// check fetches a claimed feed, adds its new episodes and deletes the ones
+// over its limit. Failures are recorded on the feed and retried at the next
+// check.
+func (p *FeedPoller) check(ctx context.Context, f *models.Feed) {
+	parsed, err := p.client.Fetch(ctx, f.URL)
+	if err == nil {
+		f.Title, f.Author, f.Description = parsed.Title, parsed.Author, parsed.Description
+		err = p.addEpisodes(ctx, f, parsed)
+	}
+	if ctx.Err() != nil {
+		return // Shutting down; the episodes not added yet are still new at the next check
+	}
+	f.LastError = nil
+	if err != nil {
+		log.Printf("Feeds: checking feed %s (user %d) failed: %v", f.ID, f.UserID, err)
+		msg := err.Error()
+		f.LastError = &msg
+	}
+	if err := p.db.SaveFeedCheck(f); err != nil {
+		log.Printf("Feeds: %v", err)
+	}
+	p.deleteExpired(ctx, f)
+}
+
+// addEpisodes downloads the newest of the episodes not seen before, up to the
+// feed's limit, and queues them for transcription. The other new items are
+// recorded as seen so they are never downloaded. An episode that failed to
+// download is tried again at the next check.
+func (p *FeedPoller) addEpisodes(ctx context.Context, f *models.Feed, parsed *feeds.Feed) error {
+	seen, err := p.db.GetFeedEpisodeGUIDs(f.ID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	wanted, queued := 0, 0
+	for _, e := range parsed.Episodes {
+		if seen[e.GUID] {
+			continue
+		}
+		seen[e.GUID] = true // Feeds may repeat an item
+		episode := models.FeedEpisode{GUID: e.GUID, Title: e.Title}
+		if !e.Published.IsZero() {
+			published := e.Published.UTC()
+			episode.PublishedAt = &published
+		}
+
+		if e.Extension() == "" || wanted >= f.KeepEpisodes {
+			if err := p.db.AddFeedEpisode(f.ID, episode, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		wanted++
+
+		podcast, err := p.download(ctx, f, parsed, e)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, feeds.ErrTooLarge) {
+			log.Printf("Feeds: skipping episode %q of feed %s: %v", e.Title, f.ID, err)
+			if err := p.db.AddFeedEpisode(f.ID, episode, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("episode %q: %w", e.Title, err))
+			continue
+		}
+
+		if err := p.db.AddFeedEpisode(f.ID, episode, podcast); err != nil {
+			p.blobs.Delete(ctx, podcast.StorePath)
+			return err
+		}
+		if err := p.db.EnqueueTranscription(f.UserID, podcast.ID, time.Now().UTC()); err != nil {
+			// RecoverTranscriptionJobs queues it at the next start.
+			errs = append(errs, fmt.Errorf("episode %q: %w", e.Title, err))
+			continue
+		}
+		log.Printf("Feeds: downloaded %q from feed %s as podcast %s (user %d)", e.Title, f.ID, podcast.ID, f.UserID)
+		queued++
+	}
+
+	if queued > 0 {
+		p.transcriptions.Notify()
+	}
+	return errors.Join(errs...)
+}
+
+// download streams the audio of an episode into the blob store and returns
+// the podcast for it, not yet saved.
+func (p *FeedPoller) download(ctx context.Context, f *models.Feed, parsed *feeds.Feed, e feeds.Episode) (*models.Podcast, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.DownloadTimeout)
+	defer cancel()
+
+	podcastID := uuid.NewString()
+	storeKey := storage.PodcastKey(f.UserID, podcastID, e.Extension())
+	pr, pw := io.Pipe()
+	downloaded := make(chan error, 1)
+	go func() {
+		_, err := p.client.Download(ctx, e.AudioURL, pw, p.cfg.MaxEpisodeSize)
+		pw.CloseWithError(err)
+		downloaded <- err
+	}()
+	_, err := p.blobs.Put(ctx, storeKey, pr)
+	pr.Close() // Unblocks the download if storing failed
+	// The download's own error, such as feeds.ErrTooLarge, explains a failure best.
+	if downloadErr := <-downloaded; downloadErr != nil && !errors.Is(downloadErr, io.ErrClosedPipe) {
+		err = downloadErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	filename := podcastID + e.Extension()
+	if u, err := url.Parse(e.AudioURL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		filename = path.Base(u.Path)
+	}
+	title := e.Title
+	if title == "" && !e.Published.IsZero() {
+		title = e.Published.Format("2006-01-02")
+	}
+	podcast := &models.Podcast{
+		ID:         podcastID,
+		UserID:     f.UserID,
+		Filename:   filename,
+		StorePath:  storeKey,
+		Producer:   firstNonEmpty(parsed.Author, parsed.Title, f.URL),
+		Series:     firstNonEmpty(parsed.Title, f.URL),
+		Episode:    firstNonEmpty(title, filename),
+		UploadTime: time.Now(),
+		Status:     models.StatusUploaded,
+		MediaType:  models.MediaAudio,
+	}
+	if e.Description != "" {
+		podcast.Description = &e.Description
+	}
+	return podcast, nil
+}
+
+// deleteExpired deletes the podcasts downloaded from a feed beyond its
+// newest KeepEpisodes, with their audio.
+func (p *FeedPoller) deleteExpired(ctx context.Context, f *models.Feed) {
+	ids, err := p.db.GetExpiredFeedPodcasts(f.ID, f.KeepEpisodes)
+	if err != nil {
+		log.Printf("Feeds: %v", err)
+		return
+	}
+	for _, id := range ids {
+		storeKey, err := p.db.DeletePodcastRecord(f.UserID, id)
+		if err != nil {
+			log.Printf("Feeds: failed to delete podcast %s of feed %s: %v", id, f.ID, err)
+			continue
+		}
+		if err := p.blobs.Delete(ctx, storeKey); err != nil {
+			log.Printf("Feeds: failed to delete audio file %s: %v", storeKey, err)
+		}
+		log.Printf("Feeds: deleted podcast %s of feed %s (user %d), over the limit of %d episodes", id, f.ID, f.UserID, f.KeepEpisodes)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
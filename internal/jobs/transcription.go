@@ -0,0 +1,270 @@
+// Package jobs runs background work that must survive server restarts.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lingomarker/internal/database"
+	"lingomarker/internal/models"
+	"lingomarker/internal/storage"
+	"lingomarker/internal/transcription"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Config sizes the worker pool and its leases.
+type Config struct {
+	Workers           int
+	LeaseDuration     time.Duration
+	HeartbeatInterval time.Duration
+	PollInterval      time.Duration
+	MaxAttempts       int
+	RetryBaseDelay    time.Duration
+	RetryMaxDelay     time.Duration
+}
+
+// Transcriber turns an audio file into a transcript; *transcription.Service is one.
+type Transcriber interface {
+	TranscribeAudioFile(ctx context.Context, audioFilePath, description, originalTranscript, apiKey string) (string, error)
+}
+
+// TranscriptionPool transcribes queued podcasts. Jobs live in the database, so
+// several server instances can share the queue and a crashed worker's job is
+// picked up again once its lease runs out.
+type TranscriptionPool struct {
+	db    database.Store
+	blobs storage.BlobStore
+	svc   Transcriber
+	cfg   Config
+	owner string // Identifies this process in lease_owner
+	wake  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewTranscriptionPool creates a pool; call Start to run it.
+func NewTranscriptionPool(db database.Store, blobs storage.BlobStore, svc Transcriber, cfg Config) *TranscriptionPool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = 2 * time.Minute
+	}
+	if cfg.HeartbeatInterval <= 0 || cfg.HeartbeatInterval >= cfg.LeaseDuration {
+		cfg.HeartbeatInterval = cfg.LeaseDuration / 4
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = time.Minute
+	}
+	if cfg.RetryMaxDelay < cfg.RetryBaseDelay {
+		cfg.RetryMaxDelay = cfg.RetryBaseDelay
+	}
+	host, _ := os.Hostname()
+	return &TranscriptionPool{
+		db:    db,
+		blobs: blobs,
+		svc:   svc,
+		cfg:   cfg,
+		owner: fmt.Sprintf("%s/%d/%s", host, os.Getpid(), uuid.NewString()[:8]),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Start recovers jobs left behind by a previous run and starts the workers.
+// Workers stop when ctx is cancelled; use Wait to block until they have.
+func (p *TranscriptionPool) Start(ctx context.Context) error {
+	recovered, err := p.db.RecoverTranscriptionJobs(time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to recover transcription jobs: %w", err)
+	}
+	if recovered > 0 {
+		log.Printf("Transcription: re-queued %d job(s) left over from a previous run", recovered)
+	}
+
+	log.Printf("Transcription: starting %d worker(s) as %s", p.cfg.Workers, p.owner)
+	for i := 0; i < p.cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.worker(ctx, i)
+	}
+	return nil
+}
+
+// Notify wakes an idle worker, e.g. right after a job was queued.
+func (p *TranscriptionPool) Notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default: // A wake-up is already pending
+	}
+}
+
+// Wait blocks until all workers have stopped.
+func (p *TranscriptionPool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *TranscriptionPool) worker(ctx context.Context, n int) {
+	defer p.wg.Done()
+	for {
+		if ctx.Err() != nil {
+			return // Don't claim a job only to release it again
+		}
+		job, err := p.db.ClaimTranscriptionJob(p.owner, time.Now().UTC(), p.cfg.LeaseDuration)
+		if err != nil {
+			log.Printf("Transcription worker %d: %v", n, err)
+		}
+		if job != nil {
+			p.run(ctx, job)
+			if ctx.Err() != nil {
+				return
+			}
+			continue // Look for more work straight away
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		case <-time.After(p.cfg.PollInterval):
+		}
+	}
+}
+
+// run processes one claimed job while keeping its lease alive.
+func (p *TranscriptionPool) run(ctx context.Context, job *models.TranscriptionJob) {
+	log.Printf("Transcription: job %d for podcast %s (user %d), attempt %d", job.ID, job.PodcastID, job.UserID, job.Attempts)
+	if job.Attempts > p.cfg.MaxAttempts {
+		// Only reachable when workers died mid-job and the lease expired each time.
+		p.fail(job, transcription.Permanent(fmt.Errorf("gave up after %d attempts", job.Attempts-1)))
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var leaseLost bool
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(p.cfg.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+				err := p.db.HeartbeatTranscriptionJob(job.ID, p.owner, time.Now().UTC(), p.cfg.LeaseDuration)
+				if errors.Is(err, database.ErrLeaseLost) {
+					log.Printf("Transcription: lost lease on job %d, abandoning it", job.ID)
+					leaseLost = true
+					cancel()
+					return
+				} else if err != nil {
+					log.Printf("Transcription: heartbeat for job %d failed: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+
+	transcript, err := p.transcribe(jobCtx, job)
+	cancel()
+	<-heartbeatDone
+
+	switch {
+	case leaseLost:
+		return // Another worker owns the job now, or the podcast was deleted
+	case ctx.Err() != nil:
+		// Shutting down: hand the job back instead of failing it.
+		if err := p.db.ReleaseTranscriptionJob(job, p.owner); err != nil {
+			log.Printf("Transcription: failed to release job %d: %v", job.ID, err)
+		}
+		return
+	case err != nil:
+		p.fail(job, err)
+		return
+	}
+
+	if err := p.db.CompleteTranscriptionJob(job, p.owner, transcript); err != nil {
+		log.Printf("Transcription: failed to store result of job %d: %v", job.ID, err)
+		return
+	}
+	log.Printf("Transcription completed successfully for podcast %s (user %d)", job.PodcastID, job.UserID)
+}
+
+// fail re-queues the job with a backoff if err is transient and attempts are
+// left, and otherwise finishes it as failed.
+func (p *TranscriptionPool) fail(job *models.TranscriptionJob, err error) {
+	if transcription.IsRetryable(err) && job.Attempts < p.cfg.MaxAttempts {
+		delay := p.backoff(job.Attempts)
+		log.Printf("Transcription failed for podcast %s (user %d), attempt %d of %d, retrying in %s: %v",
+			job.PodcastID, job.UserID, job.Attempts, p.cfg.MaxAttempts, delay.Round(time.Second), err)
+		msg := fmt.Sprintf("Attempt %d of %d failed, retrying: %v", job.Attempts, p.cfg.MaxAttempts, err)
+		if err := p.db.RetryTranscriptionJob(job, p.owner, msg, time.Now().UTC().Add(delay)); err != nil {
+			log.Printf("Transcription: failed to schedule retry of job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Transcription failed for podcast %s (user %d) after %d attempt(s): %v", job.PodcastID, job.UserID, job.Attempts, err)
+	if err := p.db.FailTranscriptionJob(job, p.owner, err.Error()); err != nil {
+		log.Printf("Transcription: failed to record failure of job %d: %v", job.ID, err)
+	}
+}
+
+// backoff doubles the delay with each attempt, up to RetryMaxDelay, and adds
+// up to 10% jitter so jobs that failed together don't retry together.
+func (p *TranscriptionPool) backoff(attempt int) time.Duration {
+	delay := p.cfg.RetryBaseDelay
+	for i := 1; i < attempt && delay < p.cfg.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.cfg.RetryMaxDelay {
+		delay = p.cfg.RetryMaxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+}
+
+func (p *TranscriptionPool) transcribe(ctx context.Context, job *models.TranscriptionJob) (string, error) {
+	podcast, err := p.db.GetPodcastByIDForUser(job.UserID, job.PodcastID)
+	if err != nil {
+		return "", err
+	}
+
+	settings, err := p.db.GetUserSettings(job.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve API key settings: %w", err)
+	}
+	if settings == nil || settings.GeminiAPIKey == "" {
+		return "", transcription.Permanent(errors.New("Gemini API key not configured in settings."))
+	}
+
+	description := ""
+	if podcast.Description != nil {
+		description = *podcast.Description
+	}
+	originalTranscript := ""
+	if podcast.OriginalTranscript != nil {
+		originalTranscript = *podcast.OriginalTranscript
+	}
+
+	audioPath, release, err := storage.LocalFile(ctx, p.blobs, podcast.StorePath)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", transcription.Permanent(fmt.Errorf("audio file of podcast is missing: %w", err))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch audio file: %w", err)
+	}
+	defer release()
+
+	return p.svc.TranscribeAudioFile(ctx, audioPath, description, originalTranscript, settings.GeminiAPIKey)
+}
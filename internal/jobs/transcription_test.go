@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"context"
+	"lingomarker/internal/database"
+	"lingomarker/internal/models"
+	"lingomarker/internal/storage"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStore counts the jobs handed back to the queue.
+type countingStore struct {
+	database.Store
+	releases atomic.Int32
+}
+
+func (s *countingStore) ReleaseTranscriptionJob(job *models.TranscriptionJob, owner string) error {
+	s.releases.Add(1)
+	return s.Store.ReleaseTranscriptionJob(job, owner)
+}
+
+// blockingTranscriber transcribes until it is cancelled.
+type blockingTranscriber struct {
+	started chan struct{}
+}
+
+func (t *blockingTranscriber) TranscribeAudioFile(ctx context.Context, audioFilePath, description, originalTranscript, apiKey string) (string, error) {
+	t.started <- struct{}{}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestTranscriptionPoolShutdown(t *testing.T) {
+	db, blobs := newTestStores(t)
+	userID := createTestPodcast(t, db, blobs, "p1")
+	if err := db.EnqueueTranscription(userID, "p1", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &countingStore{Store: db}
+	transcriber := &blockingTranscriber{started: make(chan struct{}, 1)}
+	pool := NewTranscriptionPool(store, blobs, transcriber, Config{Workers: 1, PollInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := pool.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-transcriber.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was never started")
+	}
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		pool.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after the context was cancelled")
+	}
+
+	if n := store.releases.Load(); n != 1 {
+		t.Errorf("job released %d times, want once", n)
+	}
+	var state models.JobState
+	var attempts int
+	err := db.QueryRow("SELECT state, attempts FROM transcription_jobs WHERE podcast_id = ?", "p1").Scan(&state, &attempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != models.JobQueued || attempts != 0 {
+		t.Errorf("job is %s after %d attempts, want queued after 0", state, attempts)
+	}
+}
+
+func newTestStores(t *testing.T) (*database.DB, *storage.Filesystem) {
+	t.Helper()
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	blobs, err := storage.NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, blobs
+}
+
+// createTestPodcast creates a user with a Gemini API key and an uploaded
+// podcast of theirs, and returns the user's ID.
+func createTestPodcast(t *testing.T, db *database.DB, blobs storage.BlobStore, podcastID string) int64 {
+	t.Helper()
+	userID, err := db.CreateUser("Test", "test", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveUserSettings(&models.UserSettings{UserID: userID, GeminiAPIKey: "key"}); err != nil {
+		t.Fatal(err)
+	}
+	key := storage.PodcastKey(userID, podcastID, ".mp3")
+	if _, err := blobs.Put(context.Background(), key, strings.NewReader("audio")); err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreatePodcastRecord(&models.Podcast{
+		ID:         podcastID,
+		UserID:     userID,
+		Filename:   "episode.mp3",
+		StorePath:  key,
+		Status:     models.StatusUploaded,
+		UploadTime: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"context"
+	"lingomarker/internal/database"
+	"lingomarker/internal/storage"
+	"log"
+	"sync"
+	"time"
+)
+
+// UploadJanitor deletes resumable uploads that expired unfinished, together
+// with the chunks they stored. Several server instances may run one.
+type UploadJanitor struct {
+	db       database.Store
+	blobs    storage.BlobStore
+	interval time.Duration
+	wg       sync.WaitGroup
+}
+
+// NewUploadJanitor creates a janitor that looks for expired uploads every
+// interval (hourly if zero); call Start to run it.
+func NewUploadJanitor(db database.Store, blobs storage.BlobStore, interval time.Duration) *UploadJanitor {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &UploadJanitor{db: db, blobs: blobs, interval: interval}
+}
+
+// Start runs the janitor until ctx is cancelled; use Wait to block until it
+// has stopped.
+func (j *UploadJanitor) Start(ctx context.Context) {
+	log.Printf("Uploads: deleting expired uploads every %s", j.interval)
+	j.wg.Add(1)
+	go j.loop(ctx)
+}
+
+// Wait blocks until the janitor has stopped.
+func (j *UploadJanitor) Wait() {
+	j.wg.Wait()
+}
+
+func (j *UploadJanitor) loop(ctx context.Context) {
+	defer j.wg.Done()
+	for {
+		j.clean(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(j.interval):
+		}
+	}
+}
+
+// clean deletes the expired uploads and then their chunks. A cleanup in
+// progress is finished at shutdown, since the uploads are already forgotten.
+func (j *UploadJanitor) clean(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+	keys, err := j.db.DeleteExpiredUploadSessions(time.Now().UTC())
+	if err != nil {
+		log.Printf("Uploads: Error deleting expired uploads: %v", err)
+		return
+	}
+	for _, key := range keys {
+		if err := j.blobs.Delete(ctx, key); err != nil {
+			log.Printf("Uploads: Error deleting chunk %s of an expired upload: %v", key, err)
+		}
+	}
+	if len(keys) > 0 {
+		log.Printf("Uploads: Deleted %d chunks of expired uploads", len(keys))
+	}
+}
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"lingomarker/internal/database"
+	"lingomarker/internal/models"
+	"lingomarker/internal/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadJanitor(t *testing.T) {
+	db, blobs := newTestStores(t)
+	userID := createTestPodcast(t, db, blobs, "8d3e1f2a-4b5c-4d6e-8f70-1a2b3c4d5e6f")
+	now := time.Now().UTC()
+
+	// Both uploads have a chunk; the first one's expired since.
+	expired := createTestUpload(t, db, blobs, userID, "5b0e7c2d-1111-4a4a-9b9b-000000000001", now.Add(-time.Minute))
+	live := createTestUpload(t, db, blobs, userID, "5b0e7c2d-2222-4a4a-9b9b-000000000002", now.Add(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	janitor := NewUploadJanitor(db, blobs, time.Hour)
+	janitor.Start(ctx) // Cleans up once right away
+	cancel()
+	janitor.Wait()
+
+	if _, err := db.GetUploadSession(userID, expired.ID, now.Add(-time.Hour)); !errors.Is(err, database.ErrUploadNotFound) {
+		t.Errorf("expired upload: err = %v, want ErrUploadNotFound", err)
+	}
+	if _, err := blobs.Stat(context.Background(), expired.StoreKey); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("chunk of the expired upload: err = %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetUploadSession(userID, live.ID, now); err != nil {
+		t.Errorf("live upload: %v", err)
+	}
+	if _, err := blobs.Stat(context.Background(), live.StoreKey); err != nil {
+		t.Errorf("chunk of the live upload: %v", err)
+	}
+}
+
+type testUpload struct {
+	ID       string
+	StoreKey string // Of its chunk
+}
+
+// createTestUpload starts an upload of 10 bytes that has received a chunk
+// of 5 and expires at expires.
+func createTestUpload(t *testing.T, db *database.DB, blobs storage.BlobStore, userID int64, id string, expires time.Time) testUpload {
+	t.Helper()
+	now := time.Now().UTC()
+	err := db.CreateUploadSession(&models.UploadSession{
+		ID: id, UserID: userID, Filename: "episode.mp3", Length: 10,
+		Producer: "P", Series: "S", Episode: "E", ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part := models.UploadPart{Offset: 0, Size: 5, StoreKey: "upload-parts/" + id + "-0"}
+	if _, err := blobs.Put(context.Background(), part.StoreKey, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUploadPart(userID, id, part, now, expires); err != nil {
+		t.Fatal(err)
+	}
+	return testUpload{ID: id, StoreKey: part.StoreKey}
+}
@@ -17,12 +17,32 @@ type UserSettings struct {
 	WordsNumberLimit     int    `json:"wordsNumberLimit"`
 	WordsLengthLimit     int    `json:"wordsLengthLimit"`
 	HighlightColor       string `json:"highlightColor"`
+	FormsProvider        string `json:"formsProvider"` // gemini, openai or rules
+	OpenAIBaseURL        string `json:"openaiBaseUrl"` // OpenAI-compatible endpoint, e.g. a local Ollama
+	OpenAIModel          string `json:"openaiModel"`
+	OpenAIAPIKey         string `json:"-"`
+	ActiveDictionaryID   int64  `json:"activeDictionaryId"` // Used when a request names no dictionary; 0 for the first
+}
+
+// Dictionary groups the entries of one language. Empty fields fall back to
+// the server's word forms language and the user's settings.
+type Dictionary struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"-"`
+	Name           string    `json:"name"`
+	SourceLanguage string    `json:"sourceLanguage"` // Language of the marked words, e.g. "de"
+	TargetLanguage string    `json:"targetLanguage"` // Language they are looked up in
+	DictBaseURL    string    `json:"dictBaseUrl"`
+	HighlightColor string    `json:"highlightColor"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
 }
 
 // Data structures based on UserScript needs, adapted for SQL
 type Entry struct {
 	UUID               string    `json:"uuid"` // Use the UUID from UserScript as primary key? Or generate new? Let's use UserScript UUID.
 	UserID             int64     `json:"-"`
+	DictionaryID       int64     `json:"dictionaryId"`
 	Word               string    `json:"word"`               // The base word form
 	FormsPipeSeparated string    `json:"formsPipeSeparated"` // Store forms as they are for now
 	CreatedAt          time.Time `json:"createdAt"`
@@ -66,6 +86,123 @@ type UserDataBundle struct {
 	Relations  []Relation  `json:"relations"`
 }
 
+// UserArchive is everything a user owns, as written to a backup archive.
+type UserArchive struct {
+	Format       string            `json:"format"`
+	Version      int               `json:"version"`
+	ExportedAt   time.Time         `json:"exportedAt"`
+	Dictionaries []Dictionary      `json:"dictionaries,omitempty"` // Absent from archives of older servers
+	Entries      []Entry           `json:"entries"`
+	URLs         []URL             `json:"urls"`
+	Paragraphs   []Paragraph       `json:"paragraphs"`
+	Relations    []Relation        `json:"relations"`
+	Settings     *UserSettings     `json:"settings,omitempty"` // API keys are never exported
+	ReviewStates []ReviewState     `json:"reviewStates"`
+	Podcasts     []ArchivedPodcast `json:"podcasts"`
+}
+
+// ArchivedPodcast is a podcast with its transcripts. Audio names the audio
+// file within the archive, if it was included.
+type ArchivedPodcast struct {
+	ID                 string        `json:"id"`
+	Filename           string        `json:"filename"`
+	Producer           string        `json:"producer"`
+	Series             string        `json:"series"`
+	Episode            string        `json:"episode"`
+	Description        *string       `json:"description,omitempty"`
+	OriginalTranscript *string       `json:"originalTranscript,omitempty"`
+	FinalTranscript    *string       `json:"finalTranscript,omitempty"`
+	UploadTime         time.Time     `json:"uploadTime"`
+	Status             PodcastStatus `json:"status"`
+	ErrorMessage       *string       `json:"errorMessage,omitempty"`
+	MediaType          MediaType     `json:"mediaType,omitempty"` // Absent in older archives: audio
+	Audio              string        `json:"audio,omitempty"`
+	StorePath          string        `json:"-"`
+}
+
+// RestoreReport counts what an archive import added. Rows that already
+// existed are kept and not counted.
+type RestoreReport struct {
+	Dictionaries     int      `json:"dictionaries"`
+	Entries          int      `json:"entries"`
+	URLs             int      `json:"urls"`
+	Paragraphs       int      `json:"paragraphs"`
+	Relations        int      `json:"relations"`
+	ReviewStates     int      `json:"reviewStates"`
+	Podcasts         int      `json:"podcasts"`
+	AudioFiles       int      `json:"audioFiles"`
+	SkippedRelations int      `json:"skippedRelations"` // Referencing a word missing from the archive
+	SkippedPodcasts  int      `json:"skippedPodcasts"`  // ID taken by another user's podcast
+	Restored         []string `json:"-"`                // IDs of the podcasts added
+	RemovedAudio     []string `json:"-"`                // Store paths of podcasts deleted by a replace
+}
+
+// ImportedWord is a word read from a spreadsheet or another app, with the
+// context it was seen in. Context and URL may be empty; the hashes are
+// computed the way the userscript computes them.
+type ImportedWord struct {
+	Word          string
+	Forms         []string
+	Context       string
+	ParagraphHash string
+	URL           string
+	URLHash       string
+	Title         string
+	Date          time.Time // Zero if unknown
+}
+
+// ImportReport counts what an import of words added. Words that already
+// existed are merged into, not counted.
+type ImportReport struct {
+	Entries    int           `json:"entries"`
+	URLs       int           `json:"urls"`
+	Paragraphs int           `json:"paragraphs"`
+	Relations  int           `json:"relations"`
+	Skipped    []ImportIssue `json:"skipped,omitempty"`
+}
+
+// ImportIssue is a row of an import file that was skipped. Section names the
+// list the row is in for formats that have several.
+type ImportIssue struct {
+	Section string `json:"section,omitempty"`
+	Row     int    `json:"row"`
+	Problem string `json:"problem"`
+}
+
+// ImportCounts sorts the rows of one section of an import.
+type ImportCounts struct {
+	Inserted  int `json:"inserted"`
+	Duplicate int `json:"duplicate"` // Already stored, or repeated in the file
+	Invalid   int `json:"invalid"`
+}
+
+// ImportDataReport describes an import of the userscript's JSON format.
+type ImportDataReport struct {
+	DryRun     bool         `json:"dryRun"`
+	Entries    ImportCounts `json:"entries"`
+	URLs       ImportCounts `json:"urls"`
+	Paragraphs ImportCounts `json:"paragraphs"`
+	Relations  ImportCounts `json:"relations"`
+	// Relations skipped because what they reference is not in the file.
+	MissingEntry     int `json:"missingEntry"`
+	MissingURL       int `json:"missingUrl"`
+	MissingParagraph int `json:"missingParagraph"`
+	// Errors lists the first problems found; ErrorCount counts them all.
+	Errors     []ImportIssue `json:"errors"`
+	ErrorCount int           `json:"errorCount"`
+}
+
+// MaxImportErrors is how many problems an ImportDataReport lists.
+const MaxImportErrors = 50
+
+// AddError records a problem with a row, listing it if there is room.
+func (r *ImportDataReport) AddError(section string, row int, problem string) {
+	r.ErrorCount++
+	if len(r.Errors) < MaxImportErrors {
+		r.Errors = append(r.Errors, ImportIssue{Section: section, Row: row, Problem: problem})
+	}
+}
+
 // Structure for the Training Page data
 type TrainingItem struct {
 	URL       string    `json:"url"`
@@ -75,21 +212,72 @@ type TrainingItem struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// ReviewState is the spaced-repetition schedule of one entry. Entries that
+// were never reviewed have no stored state and are due immediately.
+type ReviewState struct {
+	EntryUUID      string     `json:"entryUUID"`
+	Ease           float64    `json:"ease"`         // SM-2 ease factor, 1.3 or more
+	IntervalDays   int        `json:"intervalDays"` // Days until the next review; 0 while relearning
+	Repetitions    int        `json:"repetitions"`  // Successful reviews in a row
+	Lapses         int        `json:"lapses"`       // Times the word was forgotten after being learned
+	DueAt          time.Time  `json:"dueAt"`
+	LastReviewedAt *time.Time `json:"lastReviewedAt,omitempty"`
+	LastGrade      int        `json:"lastGrade"`
+}
+
+// StudyCard is a due entry with the paragraphs it was marked in.
+type StudyCard struct {
+	EntryUUID string         `json:"entryUUID"`
+	Word      string         `json:"word"`
+	Forms     []string       `json:"forms"`
+	IsNew     bool           `json:"isNew"` // Never reviewed
+	State     ReviewState    `json:"state"`
+	Contexts  []StudyContext `json:"contexts"`
+}
+
+// StudyContext is a paragraph a card's word was marked in.
+type StudyContext struct {
+	Paragraph            string  `json:"paragraph"`
+	URL                  string  `json:"url"`
+	Title                *string `json:"title,omitempty"`
+	TranscriptSegmentRef *string `json:"transcriptSegmentRef,omitempty"`
+}
+
+// QuizItem is a marked word together with one paragraph it was marked in.
+type QuizItem struct {
+	EntryUUID     string
+	Word          string
+	Forms         []string
+	ParagraphHash string
+	Paragraph     string
+}
+
 // PodcastStatus defines the possible states of a podcast transcription job.
 type PodcastStatus string
 
 const (
 	StatusUploaded     PodcastStatus = "uploaded"
+	StatusQueued       PodcastStatus = "queued" // Waiting for a transcription worker
 	StatusTranscribing PodcastStatus = "transcribing"
 	StatusCompleted    PodcastStatus = "completed"
 	StatusFailed       PodcastStatus = "failed"
 )
 
+// MediaType tells audio podcasts from video lessons. A video lesson's
+// transcript comes from the subtitle file uploaded with it, never from
+// transcription.
+type MediaType string
+
+const (
+	MediaAudio MediaType = "audio"
+	MediaVideo MediaType = "video"
+)
+
 type Podcast struct {
 	ID                 string        `json:"id"` // UUID
 	UserID             int64         `json:"-"`  // Belongs to user
 	Filename           string        `json:"filename"`
-	StorePath          string        `json:"-"` // Internal storage path
+	StorePath          string        `json:"-"` // Key of the media in the blob store
 	Producer           string        `json:"producer"`
 	Series             string        `json:"series"`
 	Episode            string        `json:"episode"`
@@ -99,6 +287,32 @@ type Podcast struct {
 	UploadTime         time.Time     `json:"uploadTime"`
 	Status             PodcastStatus `json:"status"`
 	ErrorMessage       *string       `json:"errorMessage,omitempty"` // Nullable error message
+	MediaType          MediaType     `json:"mediaType"`
+}
+
+// JobState is the state of a row in transcription_jobs.
+type JobState string
+
+const (
+	JobQueued  JobState = "queued"
+	JobRunning JobState = "running"
+	JobDone    JobState = "done"
+	JobFailed  JobState = "failed"
+)
+
+// TranscriptionJob is a durable request to transcribe one podcast. A worker
+// holds a lease on a running job and extends it with heartbeats; a job whose
+// lease expired is picked up again.
+type TranscriptionJob struct {
+	ID             int64      `json:"id"`
+	PodcastID      string     `json:"podcastId"`
+	UserID         int64      `json:"-"`
+	State          JobState   `json:"state"`
+	Attempts       int        `json:"attempts"`
+	RunAfter       time.Time  `json:"runAfter"`
+	LeaseOwner     *string    `json:"-"`
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+	LastError      *string    `json:"lastError,omitempty"`
 }
 
 // Add struct for list view if needed later (omitting large fields)
@@ -109,6 +323,122 @@ type PodcastListItem struct {
 	Episode    string        `json:"episode"`
 	UploadTime time.Time     `json:"uploadTime"`
 	Status     PodcastStatus `json:"status"`
+	MediaType  MediaType     `json:"mediaType"`
+}
+
+// Article is a web page captured on the server, reduced to its readable
+// paragraphs. URL and paragraph hashes are computed like the userscript's, so
+// words marked in the reader view join the same urls and paragraphs.
+type Article struct {
+	ID         string             `json:"id"` // UUID
+	UserID     int64              `json:"-"`
+	URL        string             `json:"url"` // Original page, or /read/{id} for pasted HTML
+	URLHash    string             `json:"urlHash"`
+	Title      string             `json:"title"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	Paragraphs []ArticleParagraph `json:"paragraphs,omitempty"`
+}
+
+// ArticleParagraph is one paragraph of an article, in document order.
+type ArticleParagraph struct {
+	ParagraphHash string `json:"paragraphHash"`
+	Text          string `json:"text"`
+}
+
+// ArticleListItem is an article without its text.
+type ArticleListItem struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Title      string    `json:"title"`
+	Paragraphs int       `json:"paragraphs"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Book is an uploaded EPUB, split into chapters whose paragraphs are stored
+// in paragraphs. Each chapter has its own URL, /books/read/{id}/{chapter},
+// that words marked in it are filed under.
+type Book struct {
+	ID                string        `json:"id"` // UUID
+	UserID            int64         `json:"-"`
+	Filename          string        `json:"filename"`
+	Title             string        `json:"title"`
+	Author            string        `json:"author"`
+	Language          string        `json:"language"`
+	PositionChapter   int           `json:"positionChapter"`   // Reading position: 0-based chapter
+	PositionParagraph int           `json:"positionParagraph"` // and paragraph within it
+	CreatedAt         time.Time     `json:"createdAt"`
+	Chapters          []BookChapter `json:"chapters,omitempty"`
+}
+
+// BookChapter is one chapter of a book. Paragraphs is only filled when the
+// chapter is read; ParagraphCount always is.
+type BookChapter struct {
+	Index          int                `json:"index"` // 0-based, in reading order
+	Title          string             `json:"title"`
+	URL            string             `json:"url"`
+	URLHash        string             `json:"-"`
+	ParagraphCount int                `json:"paragraphCount"`
+	Paragraphs     []ArticleParagraph `json:"paragraphs,omitempty"`
+}
+
+// BookListItem is a book without its chapters.
+type BookListItem struct {
+	ID              string    `json:"id"`
+	Title           string    `json:"title"`
+	Author          string    `json:"author"`
+	Chapters        int       `json:"chapters"`
+	PositionChapter int       `json:"positionChapter"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// Feed is a subscription to a podcast's RSS or Atom feed. New episodes are
+// downloaded and transcribed as they appear.
+type Feed struct {
+	ID            string     `json:"id"` // UUID
+	UserID        int64      `json:"-"`
+	URL           string     `json:"url"`
+	Title         string     `json:"title"`  // Series of the episodes
+	Author        string     `json:"author"` // Producer of the episodes
+	Description   string     `json:"description"`
+	KeepEpisodes  int        `json:"keepEpisodes"` // Older episodes are deleted
+	LastCheckedAt *time.Time `json:"lastCheckedAt,omitempty"`
+	LastError     *string    `json:"lastError,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	Episodes      int        `json:"episodes"` // Downloaded episodes still kept
+}
+
+// FeedEpisode is an item of a feed that was seen, downloaded or not.
+type FeedEpisode struct {
+	GUID        string
+	Title       string
+	PublishedAt *time.Time
+	PodcastID   *string // Nil if skipped or deleted
+}
+
+// UploadSession is a resumable upload of a podcast's audio. Its chunks are
+// stored as parts until all Length bytes have arrived, then assembled into
+// the podcast.
+type UploadSession struct {
+	ID                 string // UUID
+	UserID             int64
+	Filename           string
+	Length             int64 // Declared size in bytes
+	Offset             int64 // Bytes received so far
+	Producer           string
+	Series             string
+	Episode            string
+	Description        *string
+	OriginalTranscript *string
+	PodcastID          *string // Set once assembled
+	CreatedAt          time.Time
+	ExpiresAt          time.Time
+}
+
+// UploadPart is a chunk of an upload session, stored as a blob.
+type UploadPart struct {
+	Offset   int64
+	Size     int64
+	StoreKey string
 }
 
 // ReviewParagraph represents a paragraph shown on the review page.
@@ -120,12 +450,12 @@ type ReviewParagraph struct {
 	// We could add the original word that caused this paragraph to be included if needed
 }
 
-// ReviewSource represents a single content source (article or podcast) on the review page.
+// ReviewSource represents a single content source (article, podcast, video lesson or book chapter) on the review page.
 type ReviewSource struct {
 	SourceID              string            `json:"sourceId"`              // URLHash for articles, PodcastID for podcasts
-	SourceType            string            `json:"sourceType"`            // "article" or "podcast"
-	SourceTitle           string            `json:"sourceTitle"`           // Article title or "Producer: Series - Episode"
-	SourceLink            string            `json:"sourceLink"`            // Original article URL or /podcasts/play/{id}
+	SourceType            string            `json:"sourceType"`            // "article", "podcast", "video" or "book"
+	SourceTitle           string            `json:"sourceTitle"`           // Article title, "Producer: Series - Episode" or "Book: Chapter"
+	SourceLink            string            `json:"sourceLink"`            // Original article URL, /podcasts/play/{id} (podcasts and videos) or /books/read/{id}/{chapter}
 	MostRecentInteraction time.Time         `json:"mostRecentInteraction"` // Max updated_at from relations for this source
 	Paragraphs            []ReviewParagraph `json:"paragraphs"`
 }
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transcript is a podcast transcript as stored in podcasts.final_transcript:
+// a JSON array of segments.
+type Transcript struct {
+	Segments []TranscriptSegment
+}
+
+// TranscriptSegment is one utterance. Start and End are parsed from Timestamp
+// and are zero if it is malformed.
+type TranscriptSegment struct {
+	Speaker   string        `json:"speaker"`
+	Timestamp string        `json:"timestamp"` // "mm:ss-mm:ss", or "hh:mm:ss-hh:mm:ss" from the first hour on
+	Text      string        `json:"text"`
+	Start     time.Duration `json:"-"`
+	End       time.Duration `json:"-"`
+}
+
+// SegmentIssue is a problem with one segment of a transcript.
+type SegmentIssue struct {
+	Index   int    `json:"index"`
+	Problem string `json:"problem"`
+}
+
+func (i SegmentIssue) String() string {
+	return fmt.Sprintf("segment %d: %s", i.Index, i.Problem)
+}
+
+// ParseTranscript decodes a stored or generated transcript. Only data that is
+// not a JSON array of objects is an error; problems with single segments are
+// returned as issues and the segments are kept.
+func ParseTranscript(data []byte) (*Transcript, []SegmentIssue, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("transcript is not a JSON array: %w", err)
+	}
+
+	t := &Transcript{Segments: make([]TranscriptSegment, 0, len(raw))}
+	var issues []SegmentIssue
+	for i, msg := range raw {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(msg, &fields); err != nil || fields == nil {
+			return nil, nil, fmt.Errorf("transcript segment %d is not an object", i)
+		}
+		field := func(name string) string {
+			v, ok := fields[name]
+			if !ok {
+				return ""
+			}
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				issues = append(issues, SegmentIssue{Index: i, Problem: fmt.Sprintf("%s is not a string: %s", name, v)})
+			}
+			return s
+		}
+		t.Segments = append(t.Segments, TranscriptSegment{
+			Speaker:   field("speaker"),
+			Timestamp: field("timestamp"),
+			Text:      field("text"),
+		})
+	}
+	issues = append(issues, t.Validate()...)
+	return t, issues, nil
+}
+
+// Validate parses the timestamps of all segments into Start and End and
+// reports segments without speaker or text, with malformed timestamps, or
+// starting before the segment in front of them.
+func (t *Transcript) Validate() []SegmentIssue {
+	var issues []SegmentIssue
+	report := func(i int, format string, args ...any) {
+		issues = append(issues, SegmentIssue{Index: i, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	var prevStart time.Duration
+	for i := range t.Segments {
+		seg := &t.Segments[i]
+		if strings.TrimSpace(seg.Speaker) == "" {
+			report(i, "missing speaker")
+		}
+		if strings.TrimSpace(seg.Text) == "" {
+			report(i, "missing text")
+		}
+		start, end, err := ParseTimestamp(seg.Timestamp)
+		seg.Start, seg.End = start, end
+		if err != nil {
+			report(i, "%v", err)
+			continue
+		}
+		if start < prevStart {
+			report(i, "starts at %s, before the previous segment at %s", FormatTimestamp(start), FormatTimestamp(prevStart))
+		}
+		prevStart = start
+	}
+	return issues
+}
+
+// Normalize rewrites every well-formed timestamp in the canonical format, so
+// that e.g. "75:10-75:20" and "1:15:10-1:15:20" both become "01:15:10-01:15:20".
+func (t *Transcript) Normalize() {
+	for i := range t.Segments {
+		if ts, err := NormalizeTimestamp(t.Segments[i].Timestamp); err == nil {
+			t.Segments[i].Timestamp = ts
+		}
+	}
+}
+
+func (t Transcript) MarshalJSON() ([]byte, error) {
+	if t.Segments == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(t.Segments)
+}
+
+func (t *Transcript) UnmarshalJSON(data []byte) error {
+	parsed, _, err := ParseTranscript(data)
+	if err != nil {
+		return err
+	}
+	*t = *parsed
+	return nil
+}
+
+// ParseTimestamp reads a "start-end" timestamp where each side is mm:ss or
+// hh:mm:ss, optionally with fractional seconds. Minutes may run past 59 when
+// no hours are given.
+func ParseTimestamp(ts string) (start, end time.Duration, err error) {
+	startStr, endStr, ok := strings.Cut(ts, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("malformed timestamp %q: want start-end", ts)
+	}
+	if start, err = parseClock(strings.TrimSpace(startStr)); err != nil {
+		return 0, 0, fmt.Errorf("malformed timestamp %q: %w", ts, err)
+	}
+	if end, err = parseClock(strings.TrimSpace(endStr)); err != nil {
+		return 0, 0, fmt.Errorf("malformed timestamp %q: %w", ts, err)
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("timestamp %q ends before it starts", ts)
+	}
+	return start, end, nil
+}
+
+// NormalizeTimestamp rewrites a timestamp accepted by ParseTimestamp in the
+// canonical format.
+func NormalizeTimestamp(ts string) (string, error) {
+	start, end, err := ParseTimestamp(ts)
+	if err != nil {
+		return "", err
+	}
+	return FormatTimestamp(start) + "-" + FormatTimestamp(end), nil
+}
+
+// FormatTimestamp writes mm:ss, or hh:mm:ss from the first hour on.
+func FormatTimestamp(d time.Duration) string {
+	total := int64(d.Round(time.Second) / time.Second)
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
+
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("%q is not mm:ss or hh:mm:ss", s)
+	}
+	var seconds float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || part == "" || strings.Trim(part, "0123456789.") != "" {
+			return 0, fmt.Errorf("%q is not mm:ss or hh:mm:ss", s)
+		}
+		if i == len(parts)-1 && v >= 60 || len(parts) == 3 && i == 1 && v >= 60 {
+			return 0, fmt.Errorf("%q is out of range", s)
+		}
+		seconds = seconds*60 + v
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimestampRoundTrip(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "00:00"},
+		{7 * time.Second, "00:07"},
+		{59*time.Minute + 59*time.Second, "59:59"},
+		{time.Hour, "01:00:00"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "01:02:03"},
+		{99*time.Hour + 59*time.Minute + 59*time.Second, "99:59:59"},
+		{123 * time.Hour, "123:00:00"},
+	}
+	for _, tt := range tests {
+		got := FormatTimestamp(tt.d)
+		if got != tt.want {
+			t.Errorf("FormatTimestamp(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+		start, end, err := ParseTimestamp(got + "-" + got)
+		if err != nil || start != tt.d || end != tt.d {
+			t.Errorf("ParseTimestamp(%q) = %s, %s, %v; want %s", got+"-"+got, start, end, err, tt.d)
+		}
+	}
+}
+
+func TestFormatTimestampRounds(t *testing.T) {
+	if got := FormatTimestamp(59*time.Minute + 59*time.Second + 600*time.Millisecond); got != "01:00:00" {
+		t.Errorf("FormatTimestamp(59:59.6) = %q, want 01:00:00", got)
+	}
+	if got := FormatTimestamp(1400 * time.Millisecond); got != "00:01" {
+		t.Errorf("FormatTimestamp(1.4s) = %q, want 00:01", got)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		ts         string
+		start, end time.Duration
+	}{
+		{"00:07-00:15", 7 * time.Second, 15 * time.Second},
+		{" 00:07 - 00:15 ", 7 * time.Second, 15 * time.Second},
+		{"75:10-75:20", 75*time.Minute + 10*time.Second, 75*time.Minute + 20*time.Second},
+		{"59:59-1:00:00", 59*time.Minute + 59*time.Second, time.Hour},
+		{"00:01.5-00:02.25", 1500 * time.Millisecond, 2250 * time.Millisecond},
+		{"00:05-00:05", 5 * time.Second, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		start, end, err := ParseTimestamp(tt.ts)
+		if err != nil || start != tt.start || end != tt.end {
+			t.Errorf("ParseTimestamp(%q) = %s, %s, %v; want %s, %s", tt.ts, start, end, err, tt.start, tt.end)
+		}
+	}
+}
+
+func TestParseTimestampRejects(t *testing.T) {
+	for _, ts := range []string{
+		"",
+		"00:07",             // No end
+		"7-15",              // No minutes
+		"00:07-",            // Empty end
+		"-00:07",            // Empty start
+		"00:60-01:00",       // Seconds out of range
+		"01:60:00-02:00:00", // Minutes out of range when hours are given
+		"1:2:3:4-1:2:3:5",   // Too many parts
+		"00:15-00:07",       // Ends before it starts
+		"aa:bb-00:07",
+		"00:+7-00:15",
+		"00:1e1-00:15",
+		":07-00:15",
+		"00:07–00:15", // En dash
+	} {
+		if start, end, err := ParseTimestamp(ts); err == nil {
+			t.Errorf("ParseTimestamp(%q) = %s, %s; want an error", ts, start, end)
+		}
+	}
+}
+
+func TestNormalizeTimestamp(t *testing.T) {
+	tests := []struct{ ts, want string }{
+		{"0:7-0:15", "00:07-00:15"},
+		{"75:10-75:20", "01:15:10-01:15:20"},
+		{"1:15:10-1:15:20", "01:15:10-01:15:20"},
+		{"59:59-60:00", "59:59-01:00:00"},
+	}
+	for _, tt := range tests {
+		if got, err := NormalizeTimestamp(tt.ts); err != nil || got != tt.want {
+			t.Errorf("NormalizeTimestamp(%q) = %q, %v; want %q", tt.ts, got, err, tt.want)
+		}
+	}
+	if _, err := NormalizeTimestamp("soon"); err == nil {
+		t.Error("NormalizeTimestamp(\"soon\") succeeded, want an error")
+	}
+}
+
+func TestTranscriptValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []TranscriptSegment
+		want     []SegmentIssue
+	}{
+		{
+			name: "valid",
+			segments: []TranscriptSegment{
+				{Speaker: "A", Timestamp: "00:00-00:10", Text: "One."},
+				{Speaker: "B", Timestamp: "00:10-00:20", Text: "Two."},
+			},
+		},
+		{
+			// Speakers may talk over each other.
+			name: "overlapping",
+			segments: []TranscriptSegment{
+				{Speaker: "A", Timestamp: "00:00-00:20", Text: "One."},
+				{Speaker: "B", Timestamp: "00:15-00:25", Text: "Two."},
+			},
+		},
+		{
+			name: "not monotonic",
+			segments: []TranscriptSegment{
+				{Speaker: "A", Timestamp: "00:10-00:20", Text: "One."},
+				{Speaker: "B", Timestamp: "00:05-00:08", Text: "Two."},
+				{Speaker: "A", Timestamp: "00:09-00:12", Text: "Three."},
+			},
+			want: []SegmentIssue{
+				{Index: 1, Problem: "starts at 00:05, before the previous segment at 00:10"},
+			},
+		},
+		{
+			// A malformed segment doesn't reset the order check.
+			name: "malformed in between",
+			segments: []TranscriptSegment{
+				{Speaker: "A", Timestamp: "01:00:00-01:00:10", Text: "One."},
+				{Speaker: "B", Timestamp: "later", Text: "Two."},
+				{Speaker: "A", Timestamp: "59:00-59:10", Text: "Three."},
+			},
+			want: []SegmentIssue{
+				{Index: 1, Problem: `malformed timestamp "later": want start-end`},
+				{Index: 2, Problem: "starts at 59:00, before the previous segment at 01:00:00"},
+			},
+		},
+		{
+			name: "missing fields",
+			segments: []TranscriptSegment{
+				{Speaker: " ", Timestamp: "00:00-00:10", Text: ""},
+			},
+			want: []SegmentIssue{
+				{Index: 0, Problem: "missing speaker"},
+				{Index: 0, Problem: "missing text"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &Transcript{Segments: tt.segments}
+			if got := tr.Validate(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscriptValidateSetsTimes(t *testing.T) {
+	tr := &Transcript{Segments: []TranscriptSegment{
+		{Speaker: "A", Timestamp: "01:02:03-01:02:04", Text: "One."},
+		{Speaker: "A", Timestamp: "broken", Text: "Two."},
+	}}
+	tr.Validate()
+	if s := tr.Segments[0]; s.Start != time.Hour+2*time.Minute+3*time.Second || s.End != s.Start+time.Second {
+		t.Errorf("segment 0 at %s-%s", s.Start, s.End)
+	}
+	if s := tr.Segments[1]; s.Start != 0 || s.End != 0 {
+		t.Errorf("malformed segment at %s-%s, want zero", s.Start, s.End)
+	}
+}
+
+func TestTranscriptNormalize(t *testing.T) {
+	tr := &Transcript{Segments: []TranscriptSegment{
+		{Timestamp: "75:10-75:20"},
+		{Timestamp: "0:05-0:01"}, // Ends before it starts: left alone
+		{Timestamp: "soon"},
+		{Timestamp: "00:00:05-00:00:07"},
+	}}
+	tr.Normalize()
+	var got []string
+	for _, s := range tr.Segments {
+		got = append(got, s.Timestamp)
+	}
+	want := []string{"01:15:10-01:15:20", "0:05-0:01", "soon", "00:05-00:07"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Normalize = %q, want %q", got, want)
+	}
+}
+
+func TestParseTranscript(t *testing.T) {
+	data := `[
+		{"speaker": "A", "timestamp": "00:00-00:05", "text": "Hello."},
+		{"speaker": 7, "timestamp": "00:05-00:09", "text": "Numbers are not names."},
+		{"speaker": "B", "timestamp": "00:09-00:12", "text": "Bye.", "extra": true}
+	]`
+	tr, issues, err := ParseTranscript([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.Segments) != 3 || tr.Segments[2].Text != "Bye." || tr.Segments[2].End != 12*time.Second {
+		t.Errorf("segments = %+v", tr.Segments)
+	}
+	want := []SegmentIssue{
+		{Index: 1, Problem: "speaker is not a string: 7"},
+		{Index: 1, Problem: "missing speaker"},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("issues = %v, want %v", issues, want)
+	}
+
+	for _, bad := range []string{``, `{}`, `"text"`, `[1]`, `[null]`, `[{"speaker": "A"}, []]`} {
+		if _, _, err := ParseTranscript([]byte(bad)); err == nil {
+			t.Errorf("ParseTranscript(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestTranscriptJSON(t *testing.T) {
+	const data = `[{"speaker":"A","timestamp":"00:00-00:05","text":"Hello."}]`
+	var tr Transcript
+	if err := json.Unmarshal([]byte(data), &tr); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(tr)
+	if err != nil || string(out) != data {
+		t.Errorf("Marshal = %s, %v; want %s", out, err, data)
+	}
+	if out, _ := json.Marshal(Transcript{}); string(out) != "[]" {
+		t.Errorf("empty transcript = %s, want []", out)
+	}
+	if err := json.Unmarshal([]byte(`{"segments": []}`), &tr); err == nil || !strings.Contains(err.Error(), "not a JSON array") {
+		t.Errorf("Unmarshal of an object err = %v, want not a JSON array", err)
+	}
+}
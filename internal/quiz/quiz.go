@@ -0,0 +1,237 @@
+// Package quiz builds cloze and multiple-choice questions from the paragraphs
+// words were marked in, and checks the answers.
+package quiz
+
+import (
+	"errors"
+	"lingomarker/internal/models"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind is the type of a question.
+type Kind string
+
+const (
+	KindCloze  Kind = "cloze"  // Type the missing word
+	KindChoice Kind = "choice" // Pick the missing word from Choices
+	KindMixed  Kind = "mixed"  // Either, at random; only valid when generating
+)
+
+// Blank replaces the word in the text of a question.
+const Blank = "_____"
+
+// Distractors is how many wrong choices a multiple-choice question offers.
+const Distractors = 3
+
+var ErrUnknownKind = errors.New("unknown quiz kind, expected cloze, choice or mixed")
+
+// ParseKind reads a kind, defaulting to mixed.
+func ParseKind(s string) (Kind, error) {
+	switch k := Kind(strings.ToLower(s)); k {
+	case "":
+		return KindMixed, nil
+	case KindCloze, KindChoice, KindMixed:
+		return k, nil
+	}
+	return "", ErrUnknownKind
+}
+
+// Question is a paragraph with every form of a word blanked out. The answer
+// isn't included; the question is identified by its entry and paragraph.
+type Question struct {
+	EntryUUID     string   `json:"entryUUID"`
+	ParagraphHash string   `json:"paragraphHash"`
+	Kind          Kind     `json:"kind"`
+	Text          string   `json:"text"`
+	Blanks        int      `json:"blanks"`
+	Choices       []string `json:"choices,omitempty"`
+}
+
+// Result is the outcome of one answer.
+type Result struct {
+	EntryUUID     string `json:"entryUUID"`
+	ParagraphHash string `json:"paragraphHash"`
+	Correct       bool   `json:"correct"`
+	Answer        string `json:"answer"`
+	Expected      string `json:"expected"`
+}
+
+// Generate builds up to n questions of kind from items, at most one per word,
+// in the order of items. words are the user's marked words, used as
+// distractors; a multiple-choice question without any falls back to cloze.
+// Items whose paragraph doesn't contain any form of the word are skipped.
+func Generate(items []models.QuizItem, words []string, kind Kind, n int) []Question {
+	rng := rand.New(rand.NewSource(rand.Int63()))
+	questions := make([]Question, 0, n)
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if len(questions) == n {
+			break
+		}
+		if seen[item.EntryUUID] {
+			continue
+		}
+		text, answer, blanks := Cloze(item.Paragraph, formsOf(item))
+		if blanks == 0 {
+			continue
+		}
+		seen[item.EntryUUID] = true
+
+		q := Question{
+			EntryUUID:     item.EntryUUID,
+			ParagraphHash: item.ParagraphHash,
+			Kind:          KindCloze,
+			Text:          text,
+			Blanks:        blanks,
+		}
+		if kind == KindChoice || (kind == KindMixed && rng.Intn(2) == 0) {
+			if wrong := pickDistractors(rng, answer, formsOf(item), words, Distractors); len(wrong) > 0 {
+				q.Kind = KindChoice
+				q.Choices = append(wrong, answer)
+				rng.Shuffle(len(q.Choices), func(i, j int) {
+					q.Choices[i], q.Choices[j] = q.Choices[j], q.Choices[i]
+				})
+			}
+		}
+		questions = append(questions, q)
+	}
+	return questions
+}
+
+// Check grades an answer to the question built from item. The expected
+// answer is the form of the word at the first blank; case, surrounding
+// whitespace and punctuation don't matter.
+func Check(item models.QuizItem, answer string) Result {
+	_, expected, _ := Cloze(item.Paragraph, formsOf(item))
+	return Result{
+		EntryUUID:     item.EntryUUID,
+		ParagraphHash: item.ParagraphHash,
+		Correct:       expected != "" && normalize(answer) == normalize(expected),
+		Answer:        answer,
+		Expected:      expected,
+	}
+}
+
+// Cloze replaces every whole-word occurrence of any of forms in paragraph
+// with Blank. It returns the new text, the text of the first occurrence and
+// the number of blanks.
+func Cloze(paragraph string, forms []string) (text, answer string, blanks int) {
+	var b strings.Builder
+	last := 0
+	for _, loc := range FindForms(paragraph, forms) {
+		if blanks == 0 {
+			answer = paragraph[loc[0]:loc[1]]
+		}
+		blanks++
+		b.WriteString(paragraph[last:loc[0]])
+		b.WriteString(Blank)
+		last = loc[1]
+	}
+	b.WriteString(paragraph[last:])
+	return b.String(), answer, blanks
+}
+
+// FindForms returns the start and end of every whole-word, case-insensitive
+// occurrence of any of forms in paragraph.
+func FindForms(paragraph string, forms []string) [][2]int {
+	re := formsPattern(forms)
+	if re == nil {
+		return nil
+	}
+	var locs [][2]int
+	for _, loc := range re.FindAllStringIndex(paragraph, -1) {
+		if isBoundary(paragraph, loc[0], loc[1]) {
+			locs = append(locs, [2]int{loc[0], loc[1]})
+		}
+	}
+	return locs
+}
+
+// formsPattern matches any of forms, case-insensitively, preferring longer
+// forms so that "running" isn't matched as "run".
+func formsPattern(forms []string) *regexp.Regexp {
+	quoted := make([]string, 0, len(forms))
+	for _, f := range forms {
+		if f = strings.TrimSpace(f); f != "" {
+			quoted = append(quoted, regexp.QuoteMeta(f))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)
+}
+
+// isBoundary reports whether s[start:end] is not part of a longer word.
+func isBoundary(s string, start, end int) bool {
+	if r, _ := utf8.DecodeLastRuneInString(s[:start]); start > 0 && isWordRune(r) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(s[end:]); end < len(s) && isWordRune(r) {
+		return false
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '\''
+}
+
+// pickDistractors chooses up to n words of similar length to answer that
+// aren't forms of the word being asked, matching the answer's capitalization.
+// Words of the same length are picked at random.
+func pickDistractors(rng *rand.Rand, answer string, forms, words []string, n int) []string {
+	exclude := make(map[string]bool)
+	for _, f := range forms {
+		exclude[normalize(f)] = true
+	}
+	var candidates []string
+	for _, w := range words {
+		if key := normalize(w); key != "" && !exclude[key] {
+			exclude[key] = true
+			candidates = append(candidates, w)
+		}
+	}
+	rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	length := utf8.RuneCountInString(answer)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return abs(utf8.RuneCountInString(candidates[i])-length) < abs(utf8.RuneCountInString(candidates[j])-length)
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+
+	first, _ := utf8.DecodeRuneInString(answer)
+	for i, c := range candidates {
+		if unicode.IsUpper(first) {
+			r, size := utf8.DecodeRuneInString(c)
+			candidates[i] = string(unicode.ToUpper(r)) + c[size:]
+		} else {
+			candidates[i] = strings.ToLower(c)
+		}
+	}
+	return candidates
+}
+
+func formsOf(item models.QuizItem) []string {
+	return append([]string{item.Word}, item.Forms...)
+}
+
+func normalize(s string) string {
+	s = strings.ReplaceAll(s, "’", "'")
+	s = strings.TrimFunc(s, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsPunct(r) })
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,230 @@
+package quiz
+
+import (
+	"errors"
+	"lingomarker/internal/models"
+	"math/rand"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestCloze(t *testing.T) {
+	tests := []struct {
+		paragraph string
+		forms     []string
+		text      string
+		answer    string
+		blanks    int
+	}{
+		{
+			paragraph: "She runs every day and running is fun.",
+			forms:     []string{"run", "runs", "running"},
+			text:      "She _____ every day and _____ is fun.",
+			answer:    "runs",
+			blanks:    2,
+		},
+		{
+			paragraph: "Running late, I run.",
+			forms:     []string{"run", "running"},
+			text:      "_____ late, I _____.",
+			answer:    "Running",
+			blanks:    2,
+		},
+		{
+			paragraph: "A rerun for the runner.",
+			forms:     []string{"run"},
+			text:      "A rerun for the runner.",
+		},
+		{
+			paragraph: "Don't stop.",
+			forms:     []string{"don"},
+			text:      "Don't stop.",
+		},
+		{
+			paragraph: "She gave up, then gave in. He gives up.",
+			forms:     []string{"give up", "gave up", "gives up"},
+			text:      "She _____, then gave in. He _____.",
+			answer:    "gave up",
+			blanks:    2,
+		},
+		{
+			paragraph: "Über Brot und Brote.",
+			forms:     []string{"brot"},
+			text:      "Über _____ und Brote.",
+			answer:    "Brot",
+			blanks:    1,
+		},
+		{
+			paragraph: "Is C++ hard? (C++)",
+			forms:     []string{"c++"},
+			text:      "Is _____ hard? (_____)",
+			answer:    "C++",
+			blanks:    2,
+		},
+		{
+			paragraph: "Nothing to hide.",
+			forms:     []string{"", "  "},
+			text:      "Nothing to hide.",
+		},
+	}
+	for _, tt := range tests {
+		text, answer, blanks := Cloze(tt.paragraph, tt.forms)
+		if text != tt.text || answer != tt.answer || blanks != tt.blanks {
+			t.Errorf("Cloze(%q, %q) = %q, %q, %d; want %q, %q, %d",
+				tt.paragraph, tt.forms, text, answer, blanks, tt.text, tt.answer, tt.blanks)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	item := models.QuizItem{EntryUUID: "e", ParagraphHash: "p", Word: "run", Forms: []string{"runs", "ran", "running"}, Paragraph: "She ran home, running."}
+	tests := []struct {
+		answer  string
+		correct bool
+	}{
+		{"ran", true},
+		{"  RAN ", true},
+		{"ran.", true},
+		{`"Ran!"`, true},
+		{"running", false}, // Only the first blank counts
+		{"run", false},
+		{"r an", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		r := Check(item, tt.answer)
+		if r.Correct != tt.correct || r.Expected != "ran" || r.Answer != tt.answer || r.EntryUUID != "e" || r.ParagraphHash != "p" {
+			t.Errorf("Check(%q) = %+v, want correct %v", tt.answer, r, tt.correct)
+		}
+	}
+
+	// A paragraph without the word can't be answered.
+	item.Paragraph = "Nothing here."
+	if r := Check(item, ""); r.Correct || r.Expected != "" {
+		t.Errorf("Check without a blank = %+v, want incorrect", r)
+	}
+}
+
+func TestPickDistractors(t *testing.T) {
+	forms := []string{"cat", "cats"}
+	tests := []struct {
+		name   string
+		answer string
+		words  []string
+		n      int
+		want   []string // In any order
+	}{
+		{
+			name:   "closest length",
+			answer: "cat",
+			words:  []string{"elephant", "dog", "cat", "hippopotamus", "bee", "ox"},
+			n:      2,
+			want:   []string{"bee", "dog"},
+		},
+		{
+			name:   "fewer words than wanted",
+			answer: "cat",
+			words:  []string{"Cats", "tree", "cat"},
+			n:      3,
+			want:   []string{"tree"},
+		},
+		{
+			name:   "only forms of the word",
+			answer: "cat",
+			words:  []string{"cat", "CATS"},
+			n:      3,
+		},
+		{
+			name:   "duplicates and case",
+			answer: "cat",
+			words:  []string{"Tree", "tree", " TREE "},
+			n:      3,
+			want:   []string{"tree"},
+		},
+		{
+			name:   "capitalized answer",
+			answer: "Cats",
+			words:  []string{"dog", "über"},
+			n:      3,
+			want:   []string{"Dog", "Über"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pickDistractors(rand.New(rand.NewSource(1)), tt.answer, forms, tt.words, tt.n)
+			sort.Strings(got)
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("pickDistractors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickDistractorsRandom(t *testing.T) {
+	// Words of the same length are picked at random, reproducibly for a seed.
+	words := []string{"ant", "bee", "cow", "dog", "eel", "fox", "gnu", "hen"}
+	pick := func(seed int64) []string {
+		return pickDistractors(rand.New(rand.NewSource(seed)), "cat", []string{"cat"}, words, 3)
+	}
+	if a, b := pick(1), pick(1); !reflect.DeepEqual(a, b) {
+		t.Errorf("seed 1 picked %q, then %q", a, b)
+	}
+	seen := map[string]bool{}
+	for seed := int64(0); seed < 20; seed++ {
+		for _, w := range pick(seed) {
+			seen[w] = true
+		}
+	}
+	if len(seen) < 6 {
+		t.Errorf("20 seeds picked only %d different words", len(seen))
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	items := []models.QuizItem{
+		{EntryUUID: "run", Word: "run", Forms: []string{"ran"}, Paragraph: "She ran home."},
+		{EntryUUID: "run", Word: "run", Paragraph: "Run!"},                // Same word again
+		{EntryUUID: "tree", Word: "tree", Paragraph: "Only leaves here."}, // Word not in the paragraph
+		{EntryUUID: "leaf", Word: "leaf", Forms: []string{"leaves"}, Paragraph: "Leaves fall."},
+		{EntryUUID: "root", Word: "root", Paragraph: "A root."},
+	}
+
+	got := Generate(items, nil, KindChoice, 2)
+	if len(got) != 2 || got[0].EntryUUID != "run" || got[1].EntryUUID != "leaf" {
+		t.Fatalf("questions = %+v, want run and leaf", got)
+	}
+	for _, q := range got {
+		if q.Kind != KindCloze || q.Choices != nil {
+			t.Errorf("question %s is %s with %q, want cloze without distractors", q.EntryUUID, q.Kind, q.Choices)
+		}
+	}
+	if got[1].Text != "_____ fall." || got[1].Blanks != 1 {
+		t.Errorf("question = %q with %d blanks", got[1].Text, got[1].Blanks)
+	}
+
+	got = Generate(items, []string{"run", "tree", "leaf", "root", "branch"}, KindChoice, 10)
+	if len(got) != 3 {
+		t.Fatalf("%d questions, want 3", len(got))
+	}
+	if q := got[0]; q.Kind != KindChoice || len(q.Choices) != 1+Distractors || !slices.Contains(q.Choices, "ran") {
+		t.Errorf("question = %s with %q, want choice including ran", got[0].Kind, got[0].Choices)
+	}
+	for _, c := range got[0].Choices {
+		if c == "run" {
+			t.Errorf("choices %q include a form of the word", got[0].Choices)
+		}
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	for in, want := range map[string]Kind{"": KindMixed, "Cloze": KindCloze, "choice": KindChoice, "mixed": KindMixed} {
+		if got, err := ParseKind(in); err != nil || got != want {
+			t.Errorf("ParseKind(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseKind("essay"); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("ParseKind(essay) err = %v, want %v", err, ErrUnknownKind)
+	}
+}
@@ -0,0 +1,88 @@
+package readability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"lingomarker/internal/safehttp"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// MaxPageSize limits the pages Fetch downloads.
+const MaxPageSize = 5 << 20
+
+var (
+	ErrInvalidURL       = errors.New("invalid URL")
+	ErrNotHTML          = errors.New("not an HTML page")
+	ErrForbiddenAddress = safehttp.ErrForbiddenAddress
+)
+
+var client = safehttp.NewClient(30 * time.Second)
+
+// Fetch downloads an http or https page and extracts its article. The
+// article's URL is the one the page was finally served from.
+func Fetch(ctx context.Context, pageURL string) (*Article, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w %q, expected an http or https URL", ErrInvalidURL, pageURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; LingoMarker)")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", u, resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("%w: %s", ErrNotHTML, mediaType)
+	}
+
+	body, err := charset.NewReader(&limitedReader{r: resp.Body, n: MaxPageSize}, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported page encoding: %w", err)
+	}
+	article, err := Extract(body)
+	if err != nil {
+		return nil, err
+	}
+	article.URL = resp.Request.URL.String()
+	return article, nil
+}
+
+// limitedReader fails instead of silently truncating a page that is too large.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// Only more data than the limit is an error.
+		if n, _ := l.r.Read(make([]byte, 1)); n == 0 {
+			return 0, io.EOF
+		}
+		return 0, fmt.Errorf("page exceeds the limit of %dMB", MaxPageSize>>20)
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,511 @@
+// Package readability extracts the main text of a web page, leaving out
+// navigation, sidebars, comments and ads, in the spirit of Mozilla's
+// Readability: paragraphs score their ancestors by length and commas, and the
+// best scoring element, with its related siblings, is the article.
+package readability
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoContent is returned when a page has no readable text.
+var ErrNoContent = errors.New("no readable content found")
+
+// Article is the readable part of a page.
+type Article struct {
+	URL        string // Set by Fetch to the URL after redirects
+	Title      string
+	Paragraphs []string // Whitespace collapsed, in document order
+}
+
+var (
+	unlikelyPattern = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|gdpr|header|legends|menu|modal|nav|newsletter|pager|pagination|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|tags|tool|widget|^ad-|-ad-|advert`)
+	maybePattern    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positivePattern = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|story|text|blog`)
+	negativePattern = regexp.MustCompile(`(?i)hidden|^hid$|-hid$|^hid-|banner|byline|caption|combx|comment|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget|ad-`)
+)
+
+// removedTags never hold article text.
+var removedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Iframe: true, atom.Object: true, atom.Embed: true, atom.Svg: true, atom.Math: true,
+	atom.Form: true, atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true,
+	atom.Nav: true, atom.Aside: true, atom.Footer: true, atom.Header: true,
+	atom.Figure: true, atom.Picture: true, atom.Canvas: true, atom.Audio: true, atom.Video: true,
+}
+
+// scriptTags hold no text even in documents that are all content.
+var scriptTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Math: true,
+}
+
+// blockTags end a paragraph of running text.
+var blockTags = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Dd: true, atom.Details: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Fieldset: true, atom.Figcaption: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Hr: true, atom.Li: true, atom.Main: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Section: true, atom.Table: true, atom.Tbody: true, atom.Td: true, atom.Th: true,
+	atom.Thead: true, atom.Tr: true, atom.Ul: true, atom.Br: true,
+}
+
+// minParagraphLength is the length below which text does not count as a
+// paragraph when scoring.
+const minParagraphLength = 25
+
+// maxDepth is the deepest nesting of elements kept. The HTML parser scans
+// the open elements for most tags, so deeper documents take quadratic time to
+// parse; tags nested deeper are dropped before parsing and their text kept.
+const maxDepth = 128
+
+// uncountedTags do not add to the nesting depth: void elements, elements
+// holding raw text, and elements whose end tag is usually left out, which
+// the parser closes itself.
+var uncountedTags = map[atom.Atom]bool{
+	atom.Area: true, atom.Base: true, atom.Br: true, atom.Col: true, atom.Embed: true, atom.Hr: true,
+	atom.Img: true, atom.Input: true, atom.Link: true, atom.Meta: true, atom.Source: true,
+	atom.Track: true, atom.Wbr: true,
+	atom.Script: true, atom.Style: true, atom.Textarea: true, atom.Title: true, atom.Xmp: true,
+	atom.Iframe: true, atom.Noembed: true, atom.Noframes: true, atom.Noscript: true, atom.Plaintext: true,
+	atom.Html: true, atom.Head: true, atom.Body: true, atom.P: true, atom.Li: true, atom.Dt: true,
+	atom.Dd: true, atom.Option: true, atom.Optgroup: true, atom.Tr: true, atom.Td: true, atom.Th: true,
+	atom.Thead: true, atom.Tbody: true, atom.Tfoot: true, atom.Colgroup: true, atom.Caption: true,
+	atom.Rb: true, atom.Rt: true, atom.Rp: true, atom.Rtc: true,
+}
+
+// Extract reads an HTML document and returns its title and main text.
+func Extract(r io.Reader) (*Article, error) {
+	doc, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	article := &Article{Title: title(doc)}
+	body := find(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+	clean(body)
+	lengths := measure(body)
+
+	top := topCandidate(body, lengths)
+	if top == nil {
+		top = body
+	}
+	article.Paragraphs = paragraphs(top, lengths)
+	if len(article.Paragraphs) == 0 && top != body {
+		article.Paragraphs = paragraphs(body, lengths)
+	}
+	if len(article.Paragraphs) == 0 {
+		return nil, ErrNoContent
+	}
+	// Pages often repeat the title as the first heading.
+	if len(article.Paragraphs) > 1 && strings.EqualFold(article.Paragraphs[0], article.Title) {
+		article.Paragraphs = article.Paragraphs[1:]
+	}
+	return article, nil
+}
+
+// ExtractAll reads an HTML document that is all content, such as a chapter
+// of a book, and returns all of its text. The title is the first heading, or
+// the <title> if there is none.
+func ExtractAll(r io.Reader) (*Article, error) {
+	doc, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	article := &Article{}
+	for _, a := range []atom.Atom{atom.H1, atom.H2, atom.H3, atom.Title} {
+		if n := find(doc, a); n != nil && text(n) != "" {
+			article.Title = text(n)
+			break
+		}
+	}
+	body := find(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+	walk(body, func(n *html.Node) bool {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.CommentNode || (c.Type == html.ElementNode && scriptTags[c.DataAtom]) {
+				n.RemoveChild(c)
+			}
+			c = next
+		}
+		return true
+	})
+
+	article.Paragraphs = paragraphs(body, measure(body))
+	if len(article.Paragraphs) == 0 {
+		return nil, ErrNoContent
+	}
+	if len(article.Paragraphs) > 1 && article.Paragraphs[0] == article.Title {
+		article.Paragraphs = article.Paragraphs[1:]
+	}
+	return article, nil
+}
+
+// parse parses an HTML document, first dropping the tags nested deeper than
+// maxDepth. Depth is counted from the tags, as the parser's would be without
+// its error recovery.
+func parse(r io.Reader) (*html.Node, error) {
+	z := html.NewTokenizer(r)
+	var b bytes.Buffer
+	depth, excess := 0, 0 // Open counted elements, and those dropped
+	foreign := 0          // Open <svg> and <math>, where "<x/>" closes x
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			return html.Parse(&b)
+		}
+		start := b.Len()
+		b.Write(z.Raw())
+		if tt != html.StartTagToken && tt != html.EndTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, _ := z.TagName()
+		a := atom.Lookup(name)
+		if uncountedTags[a] || (tt == html.SelfClosingTagToken && foreign > 0) {
+			continue
+		}
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken: // "<div/>" opens a div
+			if depth >= maxDepth {
+				excess++
+				b.Truncate(start)
+				continue
+			}
+			depth++
+			if tt == html.StartTagToken && (a == atom.Svg || a == atom.Math) {
+				foreign++
+			}
+		case html.EndTagToken:
+			if excess > 0 {
+				excess--
+				b.Truncate(start)
+				continue
+			}
+			if depth > 0 {
+				depth--
+			}
+			if (a == atom.Svg || a == atom.Math) && foreign > 0 {
+				foreign--
+			}
+		}
+	}
+}
+
+// title prefers the Open Graph title, which lacks the site name that
+// <title> usually carries, then <title>, then the first <h1>.
+func title(doc *html.Node) string {
+	var og, head, h1 string
+	walk(doc, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.Meta:
+			if og == "" && (attr(n, "property") == "og:title" || attr(n, "name") == "twitter:title") {
+				og = collapse(attr(n, "content"))
+			}
+		case atom.Title:
+			if head == "" {
+				head = text(n)
+			}
+		case atom.H1:
+			if h1 == "" {
+				h1 = text(n)
+			}
+		}
+		return true
+	})
+	for _, t := range []string{og, head, h1} {
+		if t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// clean removes the elements that are never part of an article, and those
+// whose class or ID marks them as page furniture.
+func clean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && (removedTags[c.DataAtom] || unlikely(c) || hidden(c)):
+			n.RemoveChild(c)
+		default:
+			clean(c)
+		}
+		c = next
+	}
+}
+
+func unlikely(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main || n.DataAtom == atom.A {
+		return false
+	}
+	match := attr(n, "class") + " " + attr(n, "id")
+	if role := attr(n, "role"); role == "navigation" || role == "complementary" || role == "banner" || role == "dialog" {
+		return true
+	}
+	return unlikelyPattern.MatchString(match) && !maybePattern.MatchString(match)
+}
+
+func hidden(n *html.Node) bool {
+	style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", "")
+	return hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" ||
+		strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// topCandidate scores the ancestors of every paragraph and returns the best
+// one, or nil if no paragraph is long enough.
+func topCandidate(body *html.Node, lengths textLengths) *html.Node {
+	scores := make(map[*html.Node]float64)
+	var order []*html.Node
+	addScore := func(n *html.Node, s float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			order = append(order, n)
+		}
+		scores[n] += s
+	}
+
+	walk(body, func(n *html.Node) bool {
+		if n.Type != html.ElementNode || !(n.DataAtom == atom.P || n.DataAtom == atom.Pre || n.DataAtom == atom.Td || (n.DataAtom == atom.Div && !hasBlockChild(n))) {
+			return true
+		}
+		t := text(n)
+		if len(t) < minParagraphLength {
+			return false
+		}
+		s := 1 + float64(strings.Count(t, ",")) + math.Min(float64(len(t))/100, 3)
+		// Ancestors further up get a shrinking share.
+		for level, a := 0, n.Parent; a != nil && level < 3; level, a = level+1, a.Parent {
+			switch level {
+			case 0:
+				addScore(a, s)
+			case 1:
+				addScore(a, s/2)
+			default:
+				addScore(a, s/float64(level*3))
+			}
+		}
+		return false
+	})
+
+	var top *html.Node
+	best := 0.0
+	for _, n := range order {
+		scores[n] *= 1 - lengths.linkDensity(n)
+		if scores[n] > best {
+			top, best = n, scores[n]
+		}
+	}
+	if top == nil {
+		return nil
+	}
+
+	// Text split across siblings, e.g. by ads that were removed, is gathered
+	// under the common parent.
+	if parent := top.Parent; parent != nil && parent != body.Parent {
+		threshold := math.Max(10, best*0.2)
+		related := 0
+		for s := parent.FirstChild; s != nil; s = s.NextSibling {
+			if s != top && scores[s] >= threshold {
+				related++
+			}
+		}
+		if related > 0 {
+			return parent
+		}
+	}
+	return top
+}
+
+func initialScore(n *html.Node) float64 {
+	var s float64
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		s = 10
+	case atom.Div:
+		s = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		s = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li:
+		s = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		s = -5
+	}
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if negativePattern.MatchString(name) {
+			s -= 25
+		}
+		if positivePattern.MatchString(name) {
+			s += 25
+		}
+	}
+	return s
+}
+
+// paragraphs returns the text of n split at block elements, dropping blocks
+// that are mostly links, such as lists of related articles.
+func paragraphs(n *html.Node, lengths textLengths) []string {
+	var out []string
+	var b strings.Builder
+	flush := func() {
+		if t := collapse(b.String()); t != "" {
+			out = append(out, t)
+		}
+		b.Reset()
+	}
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if blockTags[n.DataAtom] {
+				flush()
+				if n.DataAtom != atom.Br && n.DataAtom != atom.Hr && lengths.linkDensity(n) > 0.5 && !hasBlockChild(n) {
+					return
+				}
+				defer flush()
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	flush()
+	return out
+}
+
+func hasBlockChild(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockTags[c.DataAtom] && c.DataAtom != atom.Br {
+			return true
+		}
+	}
+	return false
+}
+
+// textLengths holds, for every element, the length of its text and of the
+// part of it inside links. Whitespace between text nodes is not counted.
+type textLengths map[*html.Node][2]int
+
+// measure computes the text lengths of n and the elements under it in one
+// pass, so that nested elements are not walked again for each ancestor.
+func measure(n *html.Node) textLengths {
+	lengths := make(textLengths)
+	var visit func(*html.Node) [2]int
+	visit = func(n *html.Node) [2]int {
+		if n.Type == html.TextNode {
+			return [2]int{len(collapse(n.Data)), 0}
+		}
+		var l [2]int
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			cl := visit(c)
+			l[0] += cl[0]
+			l[1] += cl[1]
+		}
+		if n.DataAtom == atom.A {
+			l[1] = l[0]
+		}
+		if n.Type == html.ElementNode {
+			lengths[n] = l
+		}
+		return l
+	}
+	visit(n)
+	return lengths
+}
+
+// linkDensity is the share of the text of n inside links.
+func (lengths textLengths) linkDensity(n *html.Node) float64 {
+	l := lengths[n]
+	if l[0] == 0 {
+		return 0
+	}
+	return float64(l[1]) / float64(l[0])
+}
+
+// text returns the collapsed text of n.
+func text(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+		return true
+	})
+	return collapse(b.String())
+}
+
+// collapse trims s and replaces runs of whitespace with a single space, as
+// browsers render text.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// walk calls fn for n and its descendants in document order, skipping the
+// children of nodes for which fn returns false.
+func walk(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+func find(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) bool {
+		if found == nil && c.DataAtom == a {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package readability
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		file       string
+		title      string
+		paragraphs []string
+		err        error
+	}{
+		{
+			file:  "news.html",
+			title: "Why cities are planting tiny forests",
+			paragraphs: []string{
+				"Across Europe, city councils are turning parking lots and verges into dense patches of native trees, each no bigger than a tennis court.",
+				"The method, developed by a Japanese botanist, packs three to five saplings into every square metre, so that they compete for light and grow quickly.",
+				"Supporters say the forests cool the streets in summer, soak up rain, and give schoolchildren a place to learn about insects, birds and soil.",
+				"Critics, however, point out that the forests need watering for the first years, and that a single large park can do more for wildlife.",
+			},
+		},
+		{
+			file:  "related.html",
+			title: "Learning to bake sourdough bread",
+			paragraphs: []string{
+				"Sourdough needs nothing more than flour, water and salt, yet it rewards patience like few other breads, because the starter does the work.",
+				"Feed the starter the evening before, and use it when it has doubled in size, smells pleasantly sour, and is full of bubbles.",
+				"After shaping, a long cold rise in the fridge develops flavour and makes the dough easier to score before it goes into a hot oven.",
+			},
+		},
+		{
+			file:  "hidden.html",
+			title: "Notes on tea",
+			paragraphs: []string{
+				"Green tea is steamed or pan-fired soon after picking, which stops oxidation and keeps the leaves green, fresh and grassy.",
+				"Black tea, by contrast, is left to oxidise fully, which darkens the leaves and gives the brew its malty, robust taste.",
+			},
+		},
+		{file: "navigation.html", err: ErrNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			article, err := Extract(openFixture(t, tt.file))
+			checkArticle(t, article, err, tt.title, tt.paragraphs, tt.err)
+		})
+	}
+}
+
+func TestExtractAll(t *testing.T) {
+	tests := []struct {
+		file       string
+		title      string
+		paragraphs []string
+		err        error
+	}{
+		{
+			file:  "chapter.xhtml",
+			title: "Chapter One",
+			paragraphs: []string{
+				"It was a bright, cold day, and the ship left the harbour at dawn.",
+				"Nobody on board knew where the voyage would end.",
+				"Short.",
+			},
+		},
+		{
+			file:       "untitled.xhtml",
+			title:      "Part Two",
+			paragraphs: []string{"A single paragraph without a heading."},
+		},
+		{
+			file:  "hidden.html",
+			title: "Notes on tea",
+			paragraphs: []string{
+				"Green tea is steamed or pan-fired soon after picking, which stops oxidation and keeps the leaves green, fresh and grassy.",
+				"Subscribe to our newsletter for weekly tea facts, offers and more, delivered straight to you.",
+				"This paragraph is hidden with a style attribute and should never be read.",
+				"This paragraph is hidden from screen readers, and from readers like us.",
+				"Black tea, by contrast, is left to oxidise fully, which darkens the leaves and gives the brew its malty, robust taste.",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			article, err := ExtractAll(openFixture(t, tt.file))
+			checkArticle(t, article, err, tt.title, tt.paragraphs, tt.err)
+		})
+	}
+}
+
+func TestExtractDeeplyNested(t *testing.T) {
+	const depth = 20000
+	text := "Deeply nested text is still extracted, even past the nesting limit."
+	doc := "<html><body>" + strings.Repeat("<div>", depth) + "<p>" + text + "</p>" +
+		strings.Repeat("</div>", depth) + "</body></html>"
+
+	for name, extract := range map[string]func(string) (*Article, error){
+		"Extract":    func(s string) (*Article, error) { return Extract(strings.NewReader(s)) },
+		"ExtractAll": func(s string) (*Article, error) { return ExtractAll(strings.NewReader(s)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			article, err := extract(doc)
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if !reflect.DeepEqual(article.Paragraphs, []string{text}) {
+				t.Errorf("paragraphs = %q, want %q", article.Paragraphs, text)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("took %v", elapsed)
+			}
+		})
+	}
+}
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func checkArticle(t *testing.T, article *Article, err error, title string, paragraphs []string, wantErr error) {
+	t.Helper()
+	if wantErr != nil {
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("err = %v, want %v", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if article.Title != title {
+		t.Errorf("title = %q, want %q", article.Title, title)
+	}
+	if !reflect.DeepEqual(article.Paragraphs, paragraphs) {
+		t.Errorf("paragraphs = %q\nwant %q", article.Paragraphs, paragraphs)
+	}
+}
@@ -0,0 +1,52 @@
+// Package safehttp makes outgoing requests to URLs that users provide. Its
+// clients refuse to connect to loopback, private and link-local addresses, so
+// users cannot make the server fetch from its own network.
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddress = errors.New("address not allowed")
+
+// NewClient returns a client for public http and https URLs. Requests time
+// out after timeout in total; 0 leaves only the connect, TLS handshake and
+// response header timeouts, for downloads of unknown length.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: 10 * time.Second,
+				Control: func(network, address string, _ syscall.RawConn) error {
+					host, _, err := net.SplitHostPort(address)
+					if err != nil {
+						return err
+					}
+					ip := net.ParseIP(host)
+					if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+						ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+						return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+					}
+					return nil
+				},
+			}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,81 @@
+// Package srs schedules reviews of marked words with the SM-2 algorithm.
+package srs
+
+import (
+	"errors"
+	"lingomarker/internal/models"
+	"math"
+	"time"
+)
+
+// Grade is the SM-2 quality of a recall, from 0 (blackout) to 5 (perfect).
+// The study page offers four of them.
+type Grade int
+
+const (
+	GradeAgain Grade = 1 // Forgotten
+	GradeHard  Grade = 3 // Recalled with serious difficulty
+	GradeGood  Grade = 4 // Recalled after some hesitation
+	GradeEasy  Grade = 5 // Recalled instantly
+)
+
+const (
+	InitialEase = 2.5
+	MinEase     = 1.3
+
+	// RelearnDelay is when a forgotten word comes back, within the same session.
+	RelearnDelay = 10 * time.Minute
+)
+
+var ErrInvalidGrade = errors.New("grade must be between 0 and 5")
+
+// Valid reports whether g is on the SM-2 scale.
+func (g Grade) Valid() bool {
+	return g >= 0 && g <= 5
+}
+
+// NewState is the state of a word that has never been reviewed: due now.
+func NewState(entryUUID string, now time.Time) models.ReviewState {
+	return models.ReviewState{EntryUUID: entryUUID, Ease: InitialEase, DueAt: now}
+}
+
+// Schedule returns the state after reviewing a word with grade g at now.
+//
+// A grade below 3 is a lapse: the word starts over and is due again after
+// RelearnDelay. Otherwise the interval grows to 1 day, then 6 days, then by the
+// ease factor, and the ease is adjusted by how hard the recall was.
+func Schedule(s models.ReviewState, g Grade, now time.Time) (models.ReviewState, error) {
+	if !g.Valid() {
+		return s, ErrInvalidGrade
+	}
+	if s.Ease == 0 {
+		s.Ease = InitialEase
+	}
+
+	q := float64(g)
+	s.Ease = math.Max(MinEase, s.Ease+0.1-(5-q)*(0.08+(5-q)*0.02))
+	s.LastGrade = int(g)
+	s.LastReviewedAt = &now
+
+	if g < 3 {
+		if s.Repetitions > 0 {
+			s.Lapses++
+		}
+		s.Repetitions = 0
+		s.IntervalDays = 0
+		s.DueAt = now.Add(RelearnDelay)
+		return s, nil
+	}
+
+	switch s.Repetitions {
+	case 0:
+		s.IntervalDays = 1
+	case 1:
+		s.IntervalDays = 6
+	default:
+		s.IntervalDays = int(math.Round(float64(s.IntervalDays) * s.Ease))
+	}
+	s.Repetitions++
+	s.DueAt = now.AddDate(0, 0, s.IntervalDays)
+	return s, nil
+}
@@ -0,0 +1,100 @@
+package srs
+
+import (
+	"errors"
+	"lingomarker/internal/models"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	reviewed := models.ReviewState{EntryUUID: "e", Ease: 2.5, IntervalDays: 15, Repetitions: 3}
+	tests := []struct {
+		name        string
+		state       models.ReviewState
+		grade       Grade
+		ease        float64
+		interval    int
+		repetitions int
+		lapses      int
+		due         time.Time
+	}{
+		// New words
+		{"new, grade 5", NewState("e", now), 5, 2.6, 1, 1, 0, now.AddDate(0, 0, 1)},
+		{"new, grade 4", NewState("e", now), 4, 2.5, 1, 1, 0, now.AddDate(0, 0, 1)},
+		{"new, grade 3", NewState("e", now), 3, 2.36, 1, 1, 0, now.AddDate(0, 0, 1)},
+		{"new, grade 2", NewState("e", now), 2, 2.18, 0, 0, 0, now.Add(RelearnDelay)},
+		{"new, grade 1", NewState("e", now), 1, 1.96, 0, 0, 0, now.Add(RelearnDelay)},
+		{"new, grade 0", NewState("e", now), 0, 1.7, 0, 0, 0, now.Add(RelearnDelay)},
+		{"unset ease", models.ReviewState{}, 4, 2.5, 1, 1, 0, now.AddDate(0, 0, 1)},
+
+		// Reviewed words: interval times ease, or a lapse
+		{"reviewed, grade 5", reviewed, 5, 2.6, 39, 4, 0, now.AddDate(0, 0, 39)},
+		{"reviewed, grade 4", reviewed, 4, 2.5, 38, 4, 0, now.AddDate(0, 0, 38)},
+		{"reviewed, grade 3", reviewed, 3, 2.36, 35, 4, 0, now.AddDate(0, 0, 35)},
+		{"reviewed, grade 2", reviewed, 2, 2.18, 0, 0, 1, now.Add(RelearnDelay)},
+		{"reviewed, grade 0", reviewed, 0, 1.7, 0, 0, 1, now.Add(RelearnDelay)},
+
+		// The ease never drops below MinEase.
+		{"ease floor on a lapse", models.ReviewState{Ease: 1.4, Repetitions: 2, IntervalDays: 6, Lapses: 2}, 0, MinEase, 0, 0, 3, now.Add(RelearnDelay)},
+		{"ease floor on a hard recall", models.ReviewState{Ease: MinEase, Repetitions: 2, IntervalDays: 10}, 3, MinEase, 13, 3, 0, now.AddDate(0, 0, 13)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Schedule(tt.state, tt.grade, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got.Ease-tt.ease) > 1e-9 || got.IntervalDays != tt.interval || got.Repetitions != tt.repetitions || got.Lapses != tt.lapses || !got.DueAt.Equal(tt.due) {
+				t.Errorf("Schedule = ease %.2f, %d days, %d repetitions, %d lapses, due %s\nwant ease %.2f, %d days, %d repetitions, %d lapses, due %s",
+					got.Ease, got.IntervalDays, got.Repetitions, got.Lapses, got.DueAt, tt.ease, tt.interval, tt.repetitions, tt.lapses, tt.due)
+			}
+			if got.LastGrade != int(tt.grade) || got.LastReviewedAt == nil || !got.LastReviewedAt.Equal(now) {
+				t.Errorf("last review = grade %d at %v, want grade %d at %s", got.LastGrade, got.LastReviewedAt, tt.grade, now)
+			}
+		})
+	}
+}
+
+func TestScheduleProgression(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewState("e", now)
+	var intervals []int
+	for i := 0; i < 5; i++ {
+		var err error
+		if s, err = Schedule(s, GradeGood, s.DueAt); err != nil {
+			t.Fatal(err)
+		}
+		intervals = append(intervals, s.IntervalDays)
+	}
+	want := []int{1, 6, 15, 38, 95}
+	for i := range want {
+		if intervals[i] != want[i] {
+			t.Fatalf("intervals = %v, want %v", intervals, want)
+		}
+	}
+
+	// A lapse starts over, and the next recall is again due after a day.
+	if s, _ = Schedule(s, GradeAgain, now); s.Repetitions != 0 || s.Lapses != 1 {
+		t.Fatalf("after a lapse: %d repetitions, %d lapses", s.Repetitions, s.Lapses)
+	}
+	if s, _ = Schedule(s, GradeGood, now); s.IntervalDays != 1 {
+		t.Errorf("after relearning: %d days, want 1", s.IntervalDays)
+	}
+}
+
+func TestScheduleInvalidGrade(t *testing.T) {
+	now := time.Now()
+	state := NewState("e", now)
+	for _, g := range []Grade{-1, 6} {
+		got, err := Schedule(state, g, now)
+		if !errors.Is(err, ErrInvalidGrade) {
+			t.Errorf("Schedule(grade %d) err = %v, want %v", g, err, ErrInvalidGrade)
+		}
+		if got != state {
+			t.Errorf("Schedule(grade %d) changed the state", g)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3PartSize is the size of the parts of multipart uploads, and the largest
+// blob stored with a single request. S3 allows up to 10,000 parts.
+const s3PartSize = 16 << 20
+
+// S3Config locates a bucket of an S3-compatible object store, such as AWS S3
+// or MinIO.
+type S3Config struct {
+	Endpoint        string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Region          string
+	Bucket          string
+	Prefix          string // Prepended to every key, e.g. "lingomarker/"
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool // Address the bucket in the path instead of the host name, as MinIO needs
+}
+
+// S3 stores blobs as objects in a bucket. Requests are signed with AWS
+// Signature Version 4; payloads are sent unsigned so they can be streamed.
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3 returns a store for the bucket in cfg. The bucket must exist.
+func NewS3(cfg S3Config) (*S3, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("missing S3 bucket")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &S3{cfg: cfg, endpoint: endpoint, client: &http.Client{}}, nil
+}
+
+// Put uploads blobs up to s3PartSize with one request and larger ones as a
+// multipart upload, holding one part in memory at a time.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		resp, err := s.do(ctx, http.MethodPut, key, nil, nil, buf[:n])
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return int64(n), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	uploadID, err := s.createMultipartUpload(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	size, err := s.uploadParts(ctx, key, uploadID, r, buf)
+	if err != nil {
+		// Uploaded parts are kept, and billed, until the upload is aborted.
+		if resp, abortErr := s.do(context.WithoutCancel(ctx), http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// uploadParts uploads the first part, already read into buf, and the rest of
+// r, then completes the upload.
+func (s *S3) uploadParts(ctx context.Context, key, uploadID string, r io.Reader, buf []byte) (int64, error) {
+	var parts []completedPart
+	var size int64
+	n := len(buf)
+	for n > 0 {
+		number := len(parts) + 1
+		resp, err := s.do(ctx, http.MethodPut, key, url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {uploadID},
+		}, nil, buf[:n])
+		if err != nil {
+			return 0, fmt.Errorf("failed to upload part %d of %s: %w", number, key, err)
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		size += int64(n)
+
+		var err2 error
+		n, err2 = io.ReadFull(r, buf)
+		if err2 != nil && !errors.Is(err2, io.EOF) && !errors.Is(err2, io.ErrUnexpectedEOF) {
+			return 0, err2
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to complete upload of %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	// Completing can fail after a 200 response has begun; the error is then in the body.
+	if err := bodyError(resp); err != nil {
+		return 0, fmt.Errorf("failed to complete upload of %s: %w", key, err)
+	}
+	return size, nil
+}
+
+func (s *S3) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to start upload of %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("failed to start upload of %s: no upload ID in response (%v)", key, err)
+	}
+	return result.UploadID, nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (Object, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{ctx: ctx, store: s, key: key, info: info}, nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Info, error) {
+	if err := checkKey(key); err != nil {
+		return Info{}, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return Info{Size: resp.ContentLength, ModTime: modTime, ETag: resp.Header.Get("ETag")}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3Object reads an object with ranged GET requests, starting a new one
+// after every Seek that moves the offset.
+type s3Object struct {
+	ctx    context.Context
+	store  *S3
+	key    string
+	info   Info
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *s3Object) Info() Info { return o.info }
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.info.Size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		header := http.Header{"Range": {fmt.Sprintf("bytes=%d-", o.offset)}}
+		if o.info.ETag != "" {
+			header.Set("If-Match", o.info.ETag) // Fail rather than mix two versions of the object
+		}
+		resp, err := o.store.do(o.ctx, http.MethodGet, o.key, nil, header, nil)
+		if err != nil {
+			return 0, err
+		}
+		o.body = resp.Body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	if errors.Is(err, io.EOF) && o.offset < o.info.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.info.Size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body != nil {
+		return o.body.Close()
+	}
+	return nil
+}
+
+// do sends a signed request for the object under key and returns the
+// response if its status is 2xx, and otherwise the error it describes.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	objectPath := "/" + s.cfg.Prefix + key
+	if s.cfg.PathStyle {
+		objectPath = "/" + s.cfg.Bucket + objectPath
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	u.Path = s.endpoint.Path + objectPath
+	u.RawPath = uriEncode(s.endpoint.Path, false) + uriEncode(objectPath, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.GetBody, req.ContentLength = nil, nil, 0
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// unsignedPayload stands in for the hash of request bodies, which aren't
+// signed so they can be streamed.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// sign adds the Signature Version 4 headers to req.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	signer := sigV4{AccessKeyID: s.cfg.AccessKeyID, SecretAccessKey: s.cfg.SecretAccessKey, Region: s.cfg.Region, Service: "s3"}
+	signer.sign(req, []string{"host", "x-amz-content-sha256", "x-amz-date"}, unsignedPayload, now)
+}
+
+// sigV4 signs requests to an AWS service with Signature Version 4.
+type sigV4 struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+	Service         string
+}
+
+// sign sets the X-Amz-Date and Authorization headers of req. signedHeaders
+// are the lower-case names of the headers to sign, sorted; payloadHash is the
+// hex SHA-256 of the body, or unsignedPayload.
+func (v sigV4) sign(req *http.Request, signedHeaders []string, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	stringToSign := v.stringToSign(amzDate, canonicalRequest(req, signedHeaders, payloadHash))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		v.AccessKeyID, v.scope(amzDate[:8]), strings.Join(signedHeaders, ";"), v.signature(amzDate[:8], stringToSign)))
+}
+
+// scope is the credential scope of requests signed on date (YYYYMMDD).
+func (v sigV4) scope(date string) string {
+	return date + "/" + v.Region + "/" + v.Service + "/aws4_request"
+}
+
+func (v sigV4) stringToSign(amzDate, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	return "AWS4-HMAC-SHA256\n" + amzDate + "\n" + v.scope(amzDate[:8]) + "\n" + hex.EncodeToString(hash[:])
+}
+
+func (v sigV4) signature(date, stringToSign string) string {
+	key := hmacSHA256([]byte("AWS4"+v.SecretAccessKey), date)
+	for _, part := range []string{v.Region, v.Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalRequest describes req as Signature Version 4 signs it. The path
+// is taken as escaped, since S3 doesn't normalize it.
+func canonicalRequest(req *http.Request, signedHeaders []string, payloadHash string) string {
+	lines := []string{req.Method, req.URL.EscapedPath(), canonicalQuery(req.URL.Query())}
+	for _, name := range signedHeaders {
+		value := strings.Join(req.Header.Values(name), ",")
+		if name == "host" {
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		}
+		// Values are trimmed and runs of spaces collapsed.
+		lines = append(lines, name+":"+strings.Join(strings.Fields(value), " "))
+	}
+	lines = append(lines, "", strings.Join(signedHeaders, ";"), payloadHash)
+	return strings.Join(lines, "\n")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode percent-encodes s as Signature Version 4 requires: everything
+// but unreserved characters, and slashes unless encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery encodes query sorted by name, as signed.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Error is the error document of a failed request.
+type s3Error struct {
+	Status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 request failed: %s", http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("S3 request failed: %s: %s", e.Code, e.Message)
+}
+
+// responseError returns the error of a response with a non-2xx status.
+func responseError(resp *http.Response) error {
+	e := &s3Error{Status: resp.StatusCode}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(e)
+	if resp.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %v", ErrNotFound, e)
+	}
+	return e
+}
+
+// bodyError returns the error in the body of a 200 response, if there is one.
+func bodyError(resp *http.Response) error {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	var root struct {
+		XMLName xml.Name
+		s3Error
+	}
+	if xml.Unmarshal(data, &root) == nil && root.XMLName.Local == "Error" {
+		root.s3Error.Status = resp.StatusCode
+		return &root.s3Error
+	}
+	return nil
+}
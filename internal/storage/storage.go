@@ -0,0 +1,225 @@
+// Package storage keeps uploaded audio and video as blobs, on the local
+// filesystem or in an S3-compatible object store. With an object store,
+// several server instances can share the files.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Info describes a stored blob.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+	ETag    string // Quoted, as in an HTTP ETag header
+}
+
+// Object is an opened blob. Reads after a Seek continue from there, so it
+// can be served with http.ServeContent.
+type Object interface {
+	io.ReadSeekCloser
+	Info() Info
+}
+
+// BlobStore stores blobs under keys such as "1/{podcast id}.mp3". Keys use
+// forward slashes and never start with one.
+type BlobStore interface {
+	// Put stores the content of r under key, replacing any blob there, and
+	// returns its size. A blob is only visible once it was stored completely.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Open opens the blob under key, or returns ErrNotFound.
+	Open(ctx context.Context, key string) (Object, error)
+	// Stat describes the blob under key, or returns ErrNotFound.
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete deletes the blob under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// PodcastKey is the key of the audio or video of a podcast.
+func PodcastKey(userID int64, podcastID, ext string) string {
+	return fmt.Sprintf("%d/%s%s", userID, podcastID, strings.ToLower(ext))
+}
+
+// checkKey rejects keys that could escape the store's root.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("%w %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// LocalFile returns the path of a file with the content of the blob under
+// key, for tools such as ffmpeg that need one. Blobs that are not files
+// already are downloaded to a temporary file, which release deletes.
+func LocalFile(ctx context.Context, store BlobStore, key string) (filePath string, release func(), err error) {
+	if fs, ok := store.(*Filesystem); ok {
+		p, err := fs.path(key)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			return "", nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		} else if err != nil {
+			return "", nil, err
+		}
+		return p, func() {}, nil
+	}
+
+	obj, err := store.Open(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer obj.Close()
+	// Keep the extension: ffmpeg and MIME detection go by it.
+	f, err := os.CreateTemp("", "lingomarker-blob-*"+path.Ext(key))
+	if err != nil {
+		return "", nil, err
+	}
+	release = func() { os.Remove(f.Name()) }
+	_, err = io.Copy(f, obj)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		release()
+		return "", nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return f.Name(), release, nil
+}
+
+// Filesystem stores blobs as files under a directory.
+type Filesystem struct {
+	root string
+}
+
+// NewFilesystem returns a store keeping blobs under dir, which is created if
+// needed.
+func NewFilesystem(dir string) (*Filesystem, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %w", dir, err)
+	}
+	return &Filesystem{root: dir}, nil
+}
+
+func (s *Filesystem) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file next to the blob and renames it into place.
+func (s *Filesystem) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, contextReader{ctx, r})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return n, err
+	}
+	return n, nil
+}
+
+func (s *Filesystem) Open(ctx context.Context, key string) (Object, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &file{File: f, info: fileInfo(info)}, nil
+}
+
+func (s *Filesystem) Stat(ctx context.Context, key string) (Info, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return Info{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return fileInfo(info), nil
+}
+
+func (s *Filesystem) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// fileInfo describes a file. Files are never rewritten in place, so size and
+// modification time identify the content.
+func fileInfo(info os.FileInfo) Info {
+	return Info{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		ETag:    fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+	}
+}
+
+type file struct {
+	*os.File
+	info Info
+}
+
+func (f *file) Info() Info { return f.info }
+
+// contextReader stops a copy once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,238 @@
+// Package subtitles converts podcast transcripts to and from SubRip (.srt)
+// and WebVTT (.vtt) subtitle files.
+package subtitles
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"lingomarker/internal/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatSRT = "srt"
+	FormatVTT = "vtt"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown subtitle format, expected srt or vtt")
+	ErrNoCues        = errors.New("subtitle file contains no cues")
+)
+
+// ContentType returns the MIME type of a subtitle format.
+func ContentType(format string) string {
+	if format == FormatVTT {
+		return "text/vtt; charset=utf-8"
+	}
+	return "application/x-subrip; charset=utf-8"
+}
+
+// Write renders t as a subtitle file. Segments whose timestamp can't be parsed
+// are skipped, since a cue needs a time, and so are segments without text.
+func Write(w io.Writer, format string, t *models.Transcript) error {
+	if format != FormatSRT && format != FormatVTT {
+		return ErrUnknownFormat
+	}
+	bw := bufio.NewWriter(w)
+	if format == FormatVTT {
+		bw.WriteString("WEBVTT\n\n")
+	}
+
+	n := 0
+	for i, seg := range t.Segments {
+		text := strings.TrimSpace(seg.Text)
+		start, end, err := models.ParseTimestamp(seg.Timestamp)
+		if err != nil || text == "" {
+			continue
+		}
+		if end <= start { // Timestamps have whole seconds, so short utterances may have none
+			end = start + time.Second
+			if i+1 < len(t.Segments) {
+				if next, _, err := models.ParseTimestamp(t.Segments[i+1].Timestamp); err == nil && next > start && next < end {
+					end = next
+				}
+			}
+		}
+		n++
+
+		speaker := strings.TrimSpace(seg.Speaker)
+		if format == FormatVTT {
+			fmt.Fprintf(bw, "%d\n%s --> %s\n", n, formatCueTime(start, '.'), formatCueTime(end, '.'))
+			if speaker != "" {
+				fmt.Fprintf(bw, "<v %s>", escapeVTT(speaker))
+			}
+			fmt.Fprintf(bw, "%s\n\n", escapeVTT(text))
+		} else {
+			fmt.Fprintf(bw, "%d\n%s --> %s\n", n, formatCueTime(start, ','), formatCueTime(end, ','))
+			if speaker != "" {
+				fmt.Fprintf(bw, "%s: ", speaker)
+			}
+			fmt.Fprintf(bw, "%s\n\n", text)
+		}
+	}
+	return bw.Flush()
+}
+
+// Parse reads an SRT or WebVTT file, telling them apart by the WEBVTT header.
+// Each cue becomes one segment, its start rounded down and its end rounded up
+// to whole seconds. Speakers are taken from WebVTT voice tags
+// (<v Name>) or from a "Name:" prefix on the first line of an SRT cue.
+func Parse(data []byte) (*models.Transcript, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	isVTT := strings.HasPrefix(text, "WEBVTT")
+
+	t := &models.Transcript{}
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		timing := -1
+		for i, line := range lines {
+			if strings.Contains(line, "-->") {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue // Header, NOTE, STYLE or REGION block, or a stray line
+		}
+
+		start, end, err := parseCueTiming(lines[timing])
+		if err != nil {
+			return nil, fmt.Errorf("cue %q: %w", lines[timing], err)
+		}
+		// Transcripts have whole seconds; widen the cue rather than let it start late.
+		start = start.Truncate(time.Second)
+		end = (end + time.Second - 1).Truncate(time.Second)
+		timestamp := models.FormatTimestamp(start) + "-" + models.FormatTimestamp(end)
+
+		var segs []models.TranscriptSegment
+		if isVTT {
+			segs = parseVTTCue(lines[timing+1:])
+		} else {
+			segs = parseSRTCue(lines[timing+1:])
+		}
+		for _, seg := range segs {
+			seg.Timestamp = timestamp
+			t.Segments = append(t.Segments, seg)
+		}
+	}
+	if len(t.Segments) == 0 {
+		return nil, ErrNoCues
+	}
+	t.Validate() // Fills in Start and End
+	return t, nil
+}
+
+var (
+	voiceTag    = regexp.MustCompile(`^<v(?:\.[^ >]*)?\s+([^>]*)>`)
+	markupTag   = regexp.MustCompile(`<[^>]*>`)
+	speakerName = regexp.MustCompile(`^([\p{Lu}][\p{L}\p{N}.'\- ]{0,30}):\s+(.+)$`)
+)
+
+// parseVTTCue splits the text of a cue into segments, one per voice.
+func parseVTTCue(lines []string) []models.TranscriptSegment {
+	var segs []models.TranscriptSegment
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		speaker := ""
+		if m := voiceTag.FindStringSubmatch(line); m != nil {
+			speaker = strings.TrimSpace(m[1])
+		}
+		text := cleanText(line)
+		if text == "" {
+			continue
+		}
+		if n := len(segs); n > 0 && (speaker == "" || speaker == segs[n-1].Speaker) {
+			segs[n-1].Text += " " + text
+			continue
+		}
+		segs = append(segs, models.TranscriptSegment{Speaker: speaker, Text: text})
+	}
+	return segs
+}
+
+func parseSRTCue(lines []string) []models.TranscriptSegment {
+	var parts []string
+	for _, line := range lines {
+		if text := cleanText(line); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	text := strings.Join(parts, " ")
+	seg := models.TranscriptSegment{Text: text}
+	if m := speakerName.FindStringSubmatch(text); m != nil && len(strings.Fields(m[1])) <= 3 {
+		seg.Speaker, seg.Text = m[1], m[2]
+	}
+	return []models.TranscriptSegment{seg}
+}
+
+// cleanText drops formatting tags and decodes entities.
+func cleanText(line string) string {
+	return strings.TrimSpace(html.UnescapeString(markupTag.ReplaceAllString(line, "")))
+}
+
+// parseCueTiming reads "start --> end", ignoring WebVTT cue settings after end.
+func parseCueTiming(line string) (start, end time.Duration, err error) {
+	startStr, rest, _ := strings.Cut(line, "-->")
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return 0, 0, errors.New("missing end time")
+	}
+	if start, err = parseCueTime(strings.TrimSpace(startStr)); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseCueTime(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, errors.New("cue ends before it starts")
+	}
+	return start, end, nil
+}
+
+// parseCueTime reads hh:mm:ss,mmm (SRT) or [hh:]mm:ss.mmm (WebVTT).
+func parseCueTime(s string) (time.Duration, error) {
+	clock, frac, _ := strings.Cut(strings.Replace(s, ",", ".", 1), ".")
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("malformed time %q", s)
+	}
+	var d time.Duration
+	for _, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("malformed time %q", s)
+		}
+		d = d*60 + time.Duration(v)*time.Second
+	}
+	if frac != "" {
+		ms, err := strconv.Atoi((frac + "00")[:3])
+		if err != nil {
+			return 0, fmt.Errorf("malformed time %q", s)
+		}
+		d += time.Duration(ms) * time.Millisecond
+	}
+	return d, nil
+}
+
+func formatCueTime(d time.Duration, sep byte) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+func escapeVTT(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,185 @@
+package subtitles
+
+import (
+	"bytes"
+	"errors"
+	"lingomarker/internal/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	srt := []string{
+		"Anna|00:01-00:05|Welcome back to the show.",
+		"|00:04-00:07|Today we talk about sourdough & patience.",
+		"|01:02:03-01:02:06|- Is it hard? - Not really.",
+	}
+	tests := []struct {
+		file string
+		want []string
+		err  error
+	}{
+		{file: "comma.srt", want: srt},
+		{file: "dot.srt", want: srt},
+		{file: "crlf.srt", want: srt},
+		{file: "bom.srt", want: srt},
+		{
+			file: "blocks.vtt",
+			want: []string{
+				"Anna|00:01-00:05|Welcome back to the show.",
+				"Ben|00:04-00:07|Today we talk about sourdough & patience.",
+				"Anna|01:02:03-01:02:06|Is it hard?",
+				"Ben|01:02:03-01:02:06|Not really.",
+			},
+		},
+		{file: "empty.vtt", err: ErrNoCues},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			tr, err := Parse(readFixture(t, tt.file))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describe(tr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("segments = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimes(t *testing.T) {
+	tr, err := Parse(readFixture(t, "comma.srt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 00:00:01,600 --> 00:00:04,200 must not start late.
+	if s := tr.Segments[0]; s.Start != time.Second || s.End != 5*time.Second {
+		t.Errorf("first cue at %s-%s, want 1s-5s", s.Start, s.End)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, file := range []string{"backwards.srt", "malformed.srt"} {
+		if _, err := Parse(readFixture(t, file)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", file)
+		}
+	}
+}
+
+func TestParseCueTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"00:00:01,600", 1600 * time.Millisecond},
+		{"00:00:01.600", 1600 * time.Millisecond},
+		{"01:02.5", time.Minute + 2500*time.Millisecond},
+		{"10:00:00", 10 * time.Hour},
+		{"00:00:01,6", 1600 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got, err := parseCueTime(tt.in); err != nil || got != tt.want {
+			t.Errorf("parseCueTime(%q) = %s, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "5", "1:2:3:4", "00:-1:00", "00:01,abc"} {
+		if got, err := parseCueTime(bad); err == nil {
+			t.Errorf("parseCueTime(%q) = %s, want an error", bad, got)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tr := transcript(
+		"Anna|00:01-00:05|Welcome <back> & hello.",
+		"Ben|00:05-00:05|Hm.", // No length: runs until the next segment
+		"Anna|00:05-00:06| ",  // Nothing to show
+		"Anna|later|Skipped, it has no time.",
+		"Ben|01:02:03-01:02:03|Bye.", // No length and none after it: one second
+	)
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: FormatSRT,
+			want: "1\n00:00:01,000 --> 00:00:05,000\nAnna: Welcome <back> & hello.\n\n" +
+				"2\n00:00:05,000 --> 00:00:06,000\nBen: Hm.\n\n" +
+				"3\n01:02:03,000 --> 01:02:04,000\nBen: Bye.\n\n",
+		},
+		{
+			format: FormatVTT,
+			want: "WEBVTT\n\n" +
+				"1\n00:00:01.000 --> 00:00:05.000\n<v Anna>Welcome &lt;back&gt; &amp; hello.\n\n" +
+				"2\n00:00:05.000 --> 00:00:06.000\n<v Ben>Hm.\n\n" +
+				"3\n01:02:03.000 --> 01:02:04.000\n<v Ben>Bye.\n\n",
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Write(&buf, tt.format, tr); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("Write(%s) =\n%s\nwant\n%s", tt.format, buf.String(), tt.want)
+		}
+	}
+	if err := Write(&bytes.Buffer{}, "ass", tr); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Write(ass) err = %v, want %v", err, ErrUnknownFormat)
+	}
+}
+
+func TestSRTToVTTRoundTrip(t *testing.T) {
+	srt, err := Parse(readFixture(t, "comma.srt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vtt bytes.Buffer
+	if err := Write(&vtt, FormatVTT, srt); err != nil {
+		t.Fatal(err)
+	}
+	back, err := Parse(vtt.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describe(back), describe(srt); !reflect.DeepEqual(got, want) {
+		t.Errorf("after SRT -> VTT -> transcript:\n%q\nwant %q", got, want)
+	}
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// transcript builds a transcript from "speaker|timestamp|text" segments.
+func transcript(segments ...string) *models.Transcript {
+	t := &models.Transcript{}
+	for _, s := range segments {
+		f := strings.SplitN(s, "|", 3)
+		t.Segments = append(t.Segments, models.TranscriptSegment{Speaker: f[0], Timestamp: f[1], Text: f[2]})
+	}
+	return t
+}
+
+func describe(t *models.Transcript) []string {
+	var out []string
+	for _, seg := range t.Segments {
+		out = append(out, seg.Speaker+"|"+seg.Timestamp+"|"+seg.Text)
+	}
+	return out
+}
@@ -0,0 +1,94 @@
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chunk is a piece of the episode cut out for transcription on its own.
+type chunk struct {
+	Path   string
+	Offset time.Duration // Start of the chunk within the episode
+	Length time.Duration // Including the overlap with the next chunk
+}
+
+// probeDuration asks ffprobe for the length of an audio file.
+func (s *Service) probeDuration(ctx context.Context, audioFilePath string) (time.Duration, error) {
+	out, err := runTool(ctx, s.cfg.FFprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		audioFilePath,
+	)
+	if err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected duration %q from ffprobe: %w", strings.TrimSpace(out), err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// planChunks lays out chunks of ChunkDuration, each running ChunkOverlap into
+// the next so that words cut at a boundary are heard whole at least once.
+// A short remainder is merged into the last chunk rather than sent alone.
+func (s *Service) planChunks(total time.Duration) []chunk {
+	size, overlap := s.cfg.ChunkDuration, s.cfg.ChunkOverlap
+	var chunks []chunk
+	for offset := time.Duration(0); offset < total; offset += size {
+		length := size + overlap
+		if total-offset-size < size/4 { // Remainder too short to be worth its own call
+			length = total - offset
+		}
+		chunks = append(chunks, chunk{Offset: offset, Length: length})
+		if offset+length >= total {
+			break
+		}
+	}
+	return chunks
+}
+
+// splitAudio cuts the planned chunks out of the episode into dir. Chunks are
+// re-encoded to mono FLAC so that cuts are sample-accurate whatever the source codec.
+func (s *Service) splitAudio(ctx context.Context, audioFilePath, dir string, chunks []chunk) error {
+	for i := range chunks {
+		chunks[i].Path = filepath.Join(dir, fmt.Sprintf("chunk_%03d.flac", i))
+		_, err := runTool(ctx, s.cfg.FFmpegPath,
+			"-v", "error", "-y",
+			"-ss", formatSeconds(chunks[i].Offset),
+			"-t", formatSeconds(chunks[i].Length),
+			"-i", audioFilePath,
+			"-vn", "-ac", "1", "-ar", "16000", "-c:a", "flac",
+			chunks[i].Path,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to cut chunk %d at %s: %w", i, chunks[i].Offset, err)
+		}
+	}
+	return nil
+}
+
+func runTool(ctx context.Context, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", filepath.Base(name), err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", filepath.Base(name), err)
+	}
+	return stdout.String(), nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
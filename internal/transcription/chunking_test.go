@@ -0,0 +1,67 @@
+package transcription
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanChunks(t *testing.T) {
+	s := NewService(&Config{ModelName: "test", ChunkDuration: 10 * time.Minute, ChunkOverlap: 15 * time.Second})
+	const m, sec = time.Minute, time.Second
+	tests := []struct {
+		name  string
+		total time.Duration
+		want  []chunk
+	}{
+		{name: "empty", total: 0},
+		{name: "shorter than a chunk", total: 5 * m, want: []chunk{{Offset: 0, Length: 5 * m}}},
+		{name: "exactly one chunk", total: 10 * m, want: []chunk{{Offset: 0, Length: 10 * m}}},
+		{
+			name:  "exact multiple",
+			total: 30 * m,
+			want: []chunk{
+				{Offset: 0, Length: 10*m + 15*sec},
+				{Offset: 10 * m, Length: 10*m + 15*sec},
+				{Offset: 20 * m, Length: 10 * m},
+			},
+		},
+		{
+			// A remainder shorter than the overlap is covered by the last chunk.
+			name:  "remainder shorter than the overlap",
+			total: 20*m + 10*sec,
+			want: []chunk{
+				{Offset: 0, Length: 10*m + 15*sec},
+				{Offset: 10 * m, Length: 10*m + 10*sec},
+			},
+		},
+		{
+			name:  "short remainder merged",
+			total: 22 * m,
+			want: []chunk{
+				{Offset: 0, Length: 10*m + 15*sec},
+				{Offset: 10 * m, Length: 12 * m},
+			},
+		},
+		{
+			name:  "remainder of its own",
+			total: 23 * m,
+			want: []chunk{
+				{Offset: 0, Length: 10*m + 15*sec},
+				{Offset: 10 * m, Length: 10*m + 15*sec},
+				{Offset: 20 * m, Length: 3 * m},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.planChunks(tt.total)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planChunks(%s) = %+v\nwant %+v", tt.total, got, tt.want)
+			}
+			if n := len(got); n > 0 && got[n-1].Offset+got[n-1].Length != tt.total {
+				t.Errorf("chunks end at %s, want %s", got[n-1].Offset+got[n-1].Length, tt.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package transcription
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+
+	"google.golang.org/genai"
+)
+
+// Error tells the job queue whether a failed transcription is worth retrying.
+type Error struct {
+	Err       error
+	Retryable bool
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// Retryable marks err as transient, e.g. a rate limit or unusable model output.
+func Retryable(err error) error { return &Error{Err: err, Retryable: true} }
+
+// Permanent marks err as one that another attempt will not fix, e.g. a missing API key.
+func Permanent(err error) error { return &Error{Err: err, Retryable: false} }
+
+// IsRetryable reports whether a failed transcription should be attempted again.
+// Explicitly classified errors win; Gemini API errors are classified by status
+// code; anything else unknown is retried, bounded by the attempt limit.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Retryable
+	}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.Code)
+	}
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return true // Network errors, timeouts and anything unclassified
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusRequestTimeout,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
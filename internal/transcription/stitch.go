@@ -0,0 +1,118 @@
+package transcription
+
+import (
+	"lingomarker/internal/models"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// stitch joins the transcripts of consecutive chunks into one, shifting
+// timestamps by each chunk's offset. Where two chunks overlap, the earlier one
+// keeps the segments that start before the middle of the overlap and the later
+// one those that end after it. A segment cut short at the end of a chunk thus
+// appears in both, and the words repeated across the cut are dropped from the
+// later copy.
+func stitch(chunks []chunk, results []*models.Transcript) *models.Transcript {
+	var out []models.TranscriptSegment
+	for i, t := range results {
+		if t == nil {
+			continue // Not transcribed; callers only stitch complete results
+		}
+		lower, upper := time.Duration(math.MinInt64), time.Duration(math.MaxInt64)
+		if i > 0 {
+			lower = cutPoint(chunks[i-1], chunks[i])
+		}
+		if i < len(chunks)-1 {
+			upper = cutPoint(chunks[i], chunks[i+1])
+		}
+
+		kept := 0 // Segments of this chunk kept so far
+		for _, seg := range t.Segments {
+			start, end, err := models.ParseTimestamp(seg.Timestamp)
+			if err != nil {
+				// Without a time it can't be placed; keep the words with the previous segment.
+				if kept > 0 {
+					out[len(out)-1].Text = strings.TrimSpace(out[len(out)-1].Text + " " + seg.Text)
+				}
+				continue
+			}
+			start += chunks[i].Offset
+			end += chunks[i].Offset
+			if end <= lower || start >= upper {
+				continue
+			}
+
+			if len(out) > 0 {
+				prev := &out[len(out)-1]
+				prevStart, prevEnd := prev.Start, prev.End
+				if kept == 0 || start < prevEnd {
+					seg.Text = trimRepeated(prev.Text, seg.Text)
+					// Same speaker right across the cut: finish the sentence the
+					// earlier chunk cut off. After a pause the segment stays apart.
+					continues := kept == 0 && seg.Speaker == prev.Speaker && start <= prevEnd+time.Second
+					if seg.Text == "" || continues {
+						prev.Text = strings.TrimSpace(prev.Text + " " + seg.Text)
+						if end > prevEnd {
+							prev.End = end
+							prev.Timestamp = models.FormatTimestamp(prevStart) + "-" + models.FormatTimestamp(end)
+						}
+						continue
+					}
+				}
+				if start < prevEnd {
+					start = prevEnd
+				}
+				if end < start {
+					end = start
+				}
+			}
+			seg.Start, seg.End = start, end
+			seg.Timestamp = models.FormatTimestamp(start) + "-" + models.FormatTimestamp(end)
+			out = append(out, seg)
+			kept++
+		}
+	}
+	return &models.Transcript{Segments: out}
+}
+
+// cutPoint is the middle of the overlap between a chunk and the next one.
+func cutPoint(a, b chunk) time.Duration {
+	overlapEnd := a.Offset + a.Length
+	if overlapEnd <= b.Offset {
+		return b.Offset
+	}
+	return b.Offset + (overlapEnd-b.Offset)/2
+}
+
+// trimRepeated removes from the start of next the longest run of words that
+// also ends prev. Single-word runs are ignored since they are usually chance.
+func trimRepeated(prev, next string) string {
+	prevWords, nextWords := strings.Fields(prev), strings.Fields(next)
+	best := 0
+	for n := 2; n <= len(prevWords) && n <= len(nextWords); n++ {
+		if wordsEqual(prevWords[len(prevWords)-n:], nextWords[:n]) {
+			best = n
+		}
+	}
+	if best == 0 && len(nextWords) == 1 && len(prevWords) > 0 && wordsEqual(prevWords[len(prevWords)-1:], nextWords) {
+		best = 1 // The whole of next is a repeat
+	}
+	return strings.Join(nextWords[best:], " ")
+}
+
+func wordsEqual(a, b []string) bool {
+	for i := range a {
+		if normalizeWord(a[i]) != normalizeWord(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeWord(w string) string {
+	return strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}))
+}
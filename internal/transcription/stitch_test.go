@@ -0,0 +1,138 @@
+package transcription
+
+import (
+	"lingomarker/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStitch(t *testing.T) {
+	// Each chunk overlaps the next by 10s, so the cut is 5s into the overlap.
+	chunks := []chunk{
+		{Offset: 0, Length: 70 * time.Second},
+		{Offset: 60 * time.Second, Length: 70 * time.Second},
+		{Offset: 120 * time.Second, Length: 30 * time.Second},
+	}
+	tests := []struct {
+		name    string
+		results []*models.Transcript
+		want    []string
+	}{
+		{
+			name: "sentence repeated in the overlap",
+			results: []*models.Transcript{
+				transcript(
+					"A|00:00-00:30|Hello and welcome to the show.",
+					"B|00:30-01:10|Today we talk about trees and why they matter",
+				),
+				transcript(
+					"B|00:00-00:08|why they matter so much.",
+					"A|00:08-00:20|Indeed.",
+				),
+				nil,
+			},
+			want: []string{
+				"A 00:00-00:30 Hello and welcome to the show.",
+				"B 00:30-01:10 Today we talk about trees and why they matter so much.",
+				"A 01:10-01:20 Indeed.",
+			},
+		},
+		{
+			name: "segment heard whole in both chunks",
+			results: []*models.Transcript{
+				transcript("A|00:50-01:02|Short and sweet."),
+				transcript("A|00:00-00:02|Short and sweet.", "B|00:06-00:09|Yes."),
+				nil,
+			},
+			want: []string{
+				"A 00:50-01:02 Short and sweet.",
+				"B 01:06-01:09 Yes.",
+			},
+		},
+		{
+			name: "gap after the cut",
+			results: []*models.Transcript{
+				transcript("A|00:00-00:20|First part."),
+				transcript("A|00:20-00:30|After a pause."),
+				transcript("B|00:10-00:15|The end."),
+			},
+			want: []string{
+				"A 00:00-00:20 First part.",
+				"A 01:20-01:30 After a pause.",
+				"B 02:10-02:15 The end.",
+			},
+		},
+		{
+			name: "segments out of order within a chunk",
+			results: []*models.Transcript{
+				transcript("A|00:00-00:10|One."),
+				transcript("B|00:20-00:25|Three.", "C|00:10-00:15|Two."),
+				nil,
+			},
+			want: []string{
+				"A 00:00-00:10 One.",
+				"B 01:20-01:25 Three.",
+				"C 01:25-01:25 Two.",
+			},
+		},
+		{
+			name: "segment without a time",
+			results: []*models.Transcript{
+				transcript("A|00:00-00:10|Said first", "A|soon|and then this."),
+				nil,
+				nil,
+			},
+			want: []string{"A 00:00-00:10 Said first and then this."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := describe(stitch(chunks, tt.results))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stitch = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimRepeated(t *testing.T) {
+	tests := []struct {
+		prev, next, want string
+	}{
+		{"and why they matter", "Why they matter, so much.", "so much."},
+		{"it was over", "over and out", "over and out"}, // A single word is chance
+		{"it was over", "over.", ""},
+		{"", "Hello there", "Hello there"},
+	}
+	for _, tt := range tests {
+		if got := trimRepeated(tt.prev, tt.next); got != tt.want {
+			t.Errorf("trimRepeated(%q, %q) = %q, want %q", tt.prev, tt.next, got, tt.want)
+		}
+	}
+}
+
+// transcript builds a transcript from "speaker|timestamp|text" segments.
+func transcript(segments ...string) *models.Transcript {
+	t := &models.Transcript{}
+	for _, s := range segments {
+		f := strings.SplitN(s, "|", 3)
+		t.Segments = append(t.Segments, models.TranscriptSegment{Speaker: f[0], Timestamp: f[1], Text: f[2]})
+	}
+	return t
+}
+
+// describe lists segments as "speaker timestamp text", checking that Start
+// and End match the timestamp.
+func describe(t *models.Transcript) []string {
+	var out []string
+	for _, seg := range t.Segments {
+		line := seg.Speaker + " " + seg.Timestamp + " " + seg.Text
+		if start, end, err := models.ParseTimestamp(seg.Timestamp); err != nil || start != seg.Start || end != seg.End {
+			line += " (times don't match the timestamp)"
+		}
+		out = append(out, line)
+	}
+	return out
+}
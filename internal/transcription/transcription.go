@@ -3,8 +3,13 @@ package transcription
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"lingomarker/internal/models"
 	"log"
+	"os"
+	"sync"
+	"time"
 
 	"google.golang.org/genai"
 )
@@ -12,6 +17,16 @@ import (
 // Config holds transcription related configuration (could be extended)
 type Config struct {
 	ModelName string
+
+	// Episodes longer than ChunkDuration are cut into chunks of that length,
+	// each overlapping the next by ChunkOverlap, and up to ChunkConcurrency
+	// chunks are transcribed at once. Requires ffmpeg and ffprobe; without
+	// them the whole file is sent in one request.
+	ChunkDuration    time.Duration
+	ChunkOverlap     time.Duration
+	ChunkConcurrency int
+	FFmpegPath       string
+	FFprobePath      string
 }
 
 // Service handles transcription tasks
@@ -25,6 +40,21 @@ func NewService(cfg *Config) *Service {
 		cfg.ModelName = "gemini-2.5-flash" // Use a sensible default, maybe flash? Check latest recommended model
 		log.Printf("Transcription model name not configured, defaulting to %s", cfg.ModelName)
 	}
+	if cfg.ChunkDuration <= 0 {
+		cfg.ChunkDuration = 10 * time.Minute
+	}
+	if cfg.ChunkOverlap <= 0 || cfg.ChunkOverlap >= cfg.ChunkDuration/2 {
+		cfg.ChunkOverlap = 15 * time.Second
+	}
+	if cfg.ChunkConcurrency <= 0 {
+		cfg.ChunkConcurrency = 3
+	}
+	if cfg.FFmpegPath == "" {
+		cfg.FFmpegPath = "ffmpeg"
+	}
+	if cfg.FFprobePath == "" {
+		cfg.FFprobePath = "ffprobe"
+	}
 	return &Service{cfg: cfg}
 }
 
@@ -33,7 +63,7 @@ func NewService(cfg *Config) *Service {
 // Returns the generated transcript as a JSON string.
 func (s *Service) TranscribeAudioFile(ctx context.Context, audioFilePath, description, originalTranscript, apiKey string) (string, error) {
 	if apiKey == "" {
-		return "", fmt.Errorf("transcription requires a valid Gemini API key")
+		return "", Permanent(fmt.Errorf("transcription requires a valid Gemini API key"))
 	}
 
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
@@ -44,23 +74,156 @@ func (s *Service) TranscribeAudioFile(ctx context.Context, audioFilePath, descri
 		return "", fmt.Errorf("failed to create genai client: %w", err)
 	}
 
-	localAudioPath := audioFilePath
+	generate := func(ctx context.Context, audioFilePath, mimeType, prompt string) (*models.Transcript, error) {
+		return s.generateTranscript(ctx, client, audioFilePath, mimeType, prompt)
+	}
+	var transcript *models.Transcript
+	chunks := s.chunksFor(ctx, audioFilePath)
+	if len(chunks) <= 1 {
+		prompt := transcriptionPrompt(description, originalTranscript)
+		transcript, err = generate(ctx, audioFilePath, "", prompt)
+	} else {
+		transcript, err = s.transcribeChunks(ctx, generate, audioFilePath, chunks, description, originalTranscript)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkTranscript(audioFilePath, transcript); err != nil {
+		return "", err
+	}
+	finalJSON, err := json.Marshal(transcript)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode transcript: %w", err)
+	}
+	log.Printf("Transcription successful for: %s (%d segments)", audioFilePath, len(transcript.Segments))
+	return string(finalJSON), nil
+}
+
+// checkTranscript normalizes the timestamps of a generated transcript and
+// validates it. Problems with single segments are logged and the segments
+// kept, since losing text is worse than a segment the player can't place;
+// the transcript is only rejected if no segment at all is usable.
+func checkTranscript(audioFilePath string, t *models.Transcript) error {
+	t.Normalize()
+	issues := t.Validate()
+	if len(issues) == 0 {
+		return nil
+	}
+
+	bad := make(map[int]bool)
+	for _, issue := range issues {
+		bad[issue.Index] = true
+	}
+	if len(bad) == len(t.Segments) {
+		return Retryable(fmt.Errorf("none of the %d transcript segments is valid, e.g. %s", len(t.Segments), issues[0]))
+	}
+
+	log.Printf("Warning: Transcript of %s has %d problem(s) in %d of %d segments:", audioFilePath, len(issues), len(bad), len(t.Segments))
+	for i, issue := range issues {
+		if i == 20 {
+			log.Printf("  ... and %d more", len(issues)-i)
+			break
+		}
+		log.Printf("  %s", issue)
+	}
+	return nil
+}
+
+// chunksFor plans the chunks of a file, or returns nil if it should be sent
+// whole: because it is short, or because its length can't be determined.
+func (s *Service) chunksFor(ctx context.Context, audioFilePath string) []chunk {
+	duration, err := s.probeDuration(ctx, audioFilePath)
+	if err != nil {
+		log.Printf("Warning: Could not determine length of %s, transcribing it in one request: %v", audioFilePath, err)
+		return nil
+	}
+	return s.planChunks(duration)
+}
+
+// generateFunc transcribes one audio file as asked in prompt.
+type generateFunc func(ctx context.Context, audioFilePath, mimeType, prompt string) (*models.Transcript, error)
+
+// transcribeChunks cuts the file into chunks and transcribes them.
+func (s *Service) transcribeChunks(ctx context.Context, generate generateFunc, audioFilePath string, chunks []chunk, description, originalTranscript string) (*models.Transcript, error) {
+	dir, err := os.MkdirTemp("", "lingomarker-chunks-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory for audio chunks: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := s.splitAudio(ctx, audioFilePath, dir, chunks); err != nil {
+		return nil, err
+	}
+	log.Printf("Transcribing %s in %d chunks", audioFilePath, len(chunks))
+	return s.transcribeCut(ctx, generate, chunks, description, originalTranscript)
+}
+
+// transcribeCut transcribes chunks that were cut already, concurrently, and
+// stitches the results. The first failure cancels the remaining chunks.
+func (s *Service) transcribeCut(ctx context.Context, generate generateFunc, chunks []chunk, description, originalTranscript string) (*models.Transcript, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*models.Transcript, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, s.cfg.ChunkConcurrency)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			if err := ctx.Err(); err != nil {
+				errs[i] = err // Another chunk failed while this one waited for a slot
+				return
+			}
+
+			prompt := chunkPrompt(description, originalTranscript, chunks[i], i, len(chunks))
+			res, err := generate(ctx, chunks[i].Path, "audio/flac", prompt)
+			if err != nil {
+				errs[i] = fmt.Errorf("chunk %d of %d at %s: %w", i+1, len(chunks), models.FormatTimestamp(chunks[i].Offset), err)
+				cancel()
+				return
+			}
+			results[i] = res
+		}(i)
+	}
+	wg.Wait()
+
+	// Report the failure that caused the cancellation rather than the chunks it cancelled.
+	var firstErr error
+	for _, err := range errs {
+		if err != nil && (firstErr == nil || errors.Is(firstErr, context.Canceled)) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return stitch(chunks, results), nil
+}
+
+// generateTranscript uploads one audio file, asks the model to transcribe it
+// and parses the JSON array extracted from the reply.
+func (s *Service) generateTranscript(ctx context.Context, client *genai.Client, audioFilePath, mimeType, prompt string) (*models.Transcript, error) {
 	uploadedFile, err := client.Files.UploadFromPath(
 		ctx,
-		localAudioPath,
-		nil,
+		audioFilePath,
+		&genai.UploadFileConfig{MIMEType: mimeType},
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload audio file to Gemini API: %w", err)
+		return nil, fmt.Errorf("failed to upload audio file to Gemini API: %w", err)
 	}
 
 	parts := []*genai.Part{
-		genai.NewPartFromText(fmt.Sprintf(`Transcribe the provided audio from a podcast episode.
-		Generate the transcript in JSON format with speaker diarization and timestamps.
-		The timestamp field should clearly indicate the start and end of each speaker's utterance in the format mm:ss-mm:ss, for example, 00:07-00:15.
-		If available, use the following podcast description for context: `+"```"+`%s`+"```"+`.
-		If available, use the following original transcript as a reference: `+"```"+`%s`+"```"+`, and since the audio may contain advertisements that are typically not included in the original transcript, integrate the advertisement sections into the original transcript, ensuring that the timestamps are accurate.
-    Format the final output as a JSON array of objects, where each object contains speaker, timestamp, and text.`, description, originalTranscript)),
+		genai.NewPartFromText(prompt),
 		genai.NewPartFromURI(uploadedFile.URI, uploadedFile.MIMEType),
 	}
 	contents := []*genai.Content{
@@ -74,14 +237,14 @@ func (s *Service) TranscribeAudioFile(ctx context.Context, audioFilePath, descri
 		nil,
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate content with Gemini API: %w", err)
+		return nil, fmt.Errorf("failed to generate content with Gemini API: %w", err)
 	}
 
 	var geminiText string
 	if result != nil && len(result.Text()) > 0 {
 		geminiText = result.Text()
 	} else {
-		return "", fmt.Errorf("gemini API returned empty response")
+		return nil, Retryable(fmt.Errorf("gemini API returned empty response"))
 	}
 
 	// Simple attempt to extract potential JSON block (might need more robust parsing)
@@ -91,22 +254,41 @@ func (s *Service) TranscribeAudioFile(ctx context.Context, audioFilePath, descri
 
 	if jsonStart == -1 || jsonEnd == -1 || jsonEnd < jsonStart {
 		log.Printf("Warning: Could not find valid JSON block in Gemini response: %s", geminiText)
-		// As a fallback, return the raw text response wrapped in a simple JSON structure
-		fallbackJSON, _ := json.Marshal(map[string]string{"raw_text": geminiText})
-		return string(fallbackJSON), fmt.Errorf("could not extract JSON from gemini response, returning raw text fallback")
+		// The model does not always follow the format; another attempt usually does.
+		return nil, Retryable(fmt.Errorf("could not extract JSON from gemini response"))
 	}
 
 	extractedJSON := geminiText[jsonStart : jsonEnd+1]
 
-	// Validate the JSON structure more formally
-	var tempJson []map[string]interface{}
-	if err := json.Unmarshal([]byte(extractedJSON), &tempJson); err != nil {
+	// Segment-level problems are left to checkTranscript, after stitching.
+	transcript, _, err := models.ParseTranscript([]byte(extractedJSON))
+	if err != nil {
 		log.Printf("Error: Gemini response failed JSON validation: %v\nResponse Text: %s", err, extractedJSON)
-		return "", fmt.Errorf("gemini response failed JSON validation: %w", err)
+		return nil, Retryable(fmt.Errorf("gemini response failed JSON validation: %w", err))
 	}
+	return transcript, nil
+}
 
-	log.Printf("Transcription successful for: %s", audioFilePath)
-	return extractedJSON, nil // Return the validated JSON string
+func transcriptionPrompt(description, originalTranscript string) string {
+	return fmt.Sprintf(`Transcribe the provided audio from a podcast episode.
+		Generate the transcript in JSON format with speaker diarization and timestamps.
+		The timestamp field should clearly indicate the start and end of each speaker's utterance in the format mm:ss-mm:ss, for example, 00:07-00:15.
+		If available, use the following podcast description for context: `+"```"+`%s`+"```"+`.
+		If available, use the following original transcript as a reference: `+"```"+`%s`+"```"+`, and since the audio may contain advertisements that are typically not included in the original transcript, integrate the advertisement sections into the original transcript, ensuring that the timestamps are accurate.
+    Format the final output as a JSON array of objects, where each object contains speaker, timestamp, and text.`, description, originalTranscript)
+}
+
+// chunkPrompt is transcriptionPrompt for a piece of an episode. Timestamps are
+// requested relative to the chunk; stitch shifts them.
+func chunkPrompt(description, originalTranscript string, c chunk, index, count int) string {
+	return fmt.Sprintf(`Transcribe the provided audio, which is part %d of %d of a podcast episode, starting %s into the episode.
+		Generate the transcript in JSON format with speaker diarization and timestamps.
+		The timestamp field should clearly indicate the start and end of each speaker's utterance in the format mm:ss-mm:ss, measured from the start of this audio clip (not the episode), for example, 00:07-00:15.
+		The clip may begin and end in the middle of a sentence; transcribe exactly the words that are audible in the clip.
+		Use the speakers' names if they can be inferred, so that speakers are labelled consistently across parts.
+		If available, use the following podcast description for context: `+"```"+`%s`+"```"+`.
+		If available, use the following original transcript of the whole episode as a reference for the part heard in this clip: `+"```"+`%s`+"```"+`. The audio may contain advertisements that are not included in the original transcript; transcribe them too.
+    Format the final output as a JSON array of objects, where each object contains speaker, timestamp, and text.`, index+1, count, models.FormatTimestamp(c.Offset), description, originalTranscript)
 }
 
 // findJSONStart attempts to find the index of the start of a JSON array.
@@ -0,0 +1,104 @@
+package transcription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testChunks(n int) []chunk {
+	chunks := make([]chunk, n)
+	for i := range chunks {
+		chunks[i] = chunk{
+			Path:   fmt.Sprintf("chunk_%d.flac", i),
+			Offset: time.Duration(i) * time.Minute,
+			Length: time.Minute + 10*time.Second,
+		}
+	}
+	return chunks
+}
+
+func TestTranscribeCut(t *testing.T) {
+	s := NewService(&Config{ModelName: "test", ChunkConcurrency: 3})
+	chunks := testChunks(4)
+
+	// Later chunks finish first; the result is still in order.
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	generate := func(ctx context.Context, audioFilePath, mimeType, prompt string) (*models.Transcript, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+
+		var i int
+		fmt.Sscanf(audioFilePath, "chunk_%d.flac", &i)
+		time.Sleep(time.Duration(len(chunks)-i) * 5 * time.Millisecond)
+		return transcript(fmt.Sprintf("A|00:05-00:10|Part %d.", i)), nil
+	}
+
+	got, err := s.transcribeCut(context.Background(), generate, chunks, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"A 00:05-00:10 Part 0.", "A 01:05-01:10 Part 1.", "A 02:05-02:10 Part 2.", "A 03:05-03:10 Part 3."}
+	if d := describe(got); !reflect.DeepEqual(d, want) {
+		t.Errorf("transcript = %q\nwant %q", d, want)
+	}
+	if maxRunning > 3 {
+		t.Errorf("%d chunks transcribed at once, want at most 3", maxRunning)
+	}
+}
+
+func TestTranscribeCutFailure(t *testing.T) {
+	errBoom := errors.New("boom")
+	for _, concurrency := range []int{1, 3} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			s := NewService(&Config{ModelName: "test", ChunkConcurrency: concurrency})
+			chunks := testChunks(6)
+
+			var failed atomic.Bool
+			var late atomic.Int32 // Chunks started after the failure
+			generate := func(ctx context.Context, audioFilePath, mimeType, prompt string) (*models.Transcript, error) {
+				if failed.Load() {
+					late.Add(1)
+				}
+				if audioFilePath == "chunk_1.flac" {
+					failed.Store(true)
+					return nil, Retryable(errBoom)
+				}
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(20 * time.Millisecond):
+					return transcript("A|00:00-00:05|Fine."), nil
+				}
+			}
+
+			_, err := s.transcribeCut(context.Background(), generate, chunks, "", "")
+			if !errors.Is(err, errBoom) || !strings.Contains(err.Error(), "chunk 2 of 6") {
+				t.Errorf("err = %v, want the failure of chunk 2 of 6", err)
+			}
+			if !IsRetryable(err) {
+				t.Errorf("err = %v is not retryable", err)
+			}
+			// Only checked without concurrency, where a slot is freed only
+			// after the failing chunk cancelled the others.
+			if n := late.Load(); concurrency == 1 && n > 0 {
+				t.Errorf("%d chunks started after the failure, want none", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+// Package vocab converts marked words to and from files kept in other tools,
+// such as spreadsheets.
+package vocab
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"lingomarker/internal/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields that can be mapped to CSV columns, in the order they are exported
+// and expected in a file without a header row.
+var Fields = []string{"word", "forms", "context", "url", "title", "date"}
+
+// fieldAliases are header names recognized for each field, lower case.
+var fieldAliases = map[string][]string{
+	"word":    {"word", "term", "expression", "headword", "lemma"},
+	"forms":   {"forms", "inflections", "word forms"},
+	"context": {"context", "sentence", "example", "paragraph", "usage"},
+	"url":     {"url", "source url", "link", "source"},
+	"title":   {"title", "source title", "book"},
+	"date":    {"date", "added", "created", "timestamp", "date added"},
+}
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02", "2006/01/02"}
+
+var ErrNoWordColumn = errors.New("no word column: name it in the header or map it explicitly")
+
+// CSVOptions control how a CSV or TSV file is read.
+type CSVOptions struct {
+	// Comma is the delimiter; 0 picks tab or comma, whichever the first line has more of.
+	Comma rune
+	// Header says whether the first row names the columns; nil detects it.
+	Header *bool
+	// Mapping maps fields to a column, given as a header name or a 1-based
+	// index. Unmapped fields are found by header name. A file with neither
+	// header nor mapping is read in the order of Fields.
+	Mapping map[string]string
+	// Source is used as the URL of rows that have a context but no URL.
+	Source string
+	// KeepFragment lists URL prefixes whose fragment is kept, as in the user's settings.
+	KeepFragment []string
+}
+
+// ReadCSV reads words from a CSV or TSV file. Rows without a word are
+// skipped and reported; the other fields are optional.
+func ReadCSV(r io.Reader, opts CSVOptions) ([]models.ImportedWord, []models.ImportIssue, error) {
+	br := bufio.NewReader(r)
+	if opts.Comma == 0 {
+		first, _ := br.Peek(4096)
+		line, _, _ := strings.Cut(string(first), "\n")
+		opts.Comma = ','
+		if strings.Count(line, "\t") > strings.Count(line, ",") {
+			opts.Comma = '\t'
+		}
+	}
+	cr := csv.NewReader(br)
+	cr.Comma = opts.Comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+	rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff") // UTF-8 BOM
+
+	hasHeader := isHeader(rows[0], opts.Mapping)
+	if opts.Header != nil {
+		hasHeader = *opts.Header
+	}
+	var header []string
+	if hasHeader {
+		header = rows[0]
+	}
+	columns, err := resolveColumns(header, opts.Mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var words []models.ImportedWord
+	var issues []models.ImportIssue
+	for i, row := range rows {
+		rowNum := i + 1
+		if hasHeader && i == 0 {
+			continue
+		}
+		cell := func(field string) string {
+			if c, ok := columns[field]; ok && c < len(row) {
+				return strings.TrimSpace(row[c])
+			}
+			return ""
+		}
+
+		w := models.ImportedWord{
+			Word:    cell("word"),
+			Context: cell("context"),
+			URL:     cell("url"),
+			Title:   cell("title"),
+		}
+		if w.Word == "" {
+			if strings.TrimSpace(strings.Join(row, "")) != "" {
+				issues = append(issues, models.ImportIssue{Row: rowNum, Problem: "missing word"})
+			}
+			continue
+		}
+		w.Forms = splitForms(w.Word, cell("forms"))
+		if d := cell("date"); d != "" {
+			w.Date = parseDate(d)
+		}
+		if w.Context != "" && w.URL == "" {
+			w.URL = opts.Source
+			if w.Title == "" {
+				w.Title = opts.Source
+			}
+		}
+		SetHashes(&w, opts.KeepFragment)
+		words = append(words, w)
+	}
+	return words, issues, nil
+}
+
+// WriteCSV writes one row per context a word was marked in, or a single row
+// without context for words that have none, with the columns of Fields.
+func WriteCSV(w io.Writer, comma rune, bundle *models.UserDataBundle) error {
+	urls := make(map[string]models.URL, len(bundle.URLs))
+	for _, u := range bundle.URLs {
+		urls[u.URLHash] = u
+	}
+	paragraphs := make(map[string]string, len(bundle.Paragraphs))
+	for _, p := range bundle.Paragraphs {
+		paragraphs[p.ParagraphHash] = p.Text
+	}
+	relations := make(map[string][]models.Relation)
+	for _, r := range bundle.Relations {
+		relations[r.EntryUUID] = append(relations[r.EntryUUID], r)
+	}
+	entries := append([]models.Entry(nil), bundle.Entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Word) < strings.ToLower(entries[j].Word)
+	})
+
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(Fields); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		forms := strings.ReplaceAll(e.FormsPipeSeparated, "|", "; ")
+		rels := relations[e.UUID]
+		if len(rels) == 0 {
+			if err := cw.Write([]string{e.Word, forms, "", "", "", formatDate(e.CreatedAt)}); err != nil {
+				return err
+			}
+			continue
+		}
+		sort.SliceStable(rels, func(i, j int) bool { return rels[i].CreatedAt.Before(rels[j].CreatedAt) })
+		for _, r := range rels {
+			u := urls[r.URLHash]
+			title := ""
+			if u.Title != nil {
+				title = *u.Title
+			}
+			if err := cw.Write([]string{e.Word, forms, paragraphs[r.ParagraphHash], u.URL, title, formatDate(r.CreatedAt)}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Hash keys URLs and paragraphs like the userscript: the hex SHA-256 of the text.
+func Hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// CleanURL drops the fragment of url unless it starts with one of
+// keepFragment, as the userscript does before hashing.
+func CleanURL(url string, keepFragment []string) string {
+	for _, prefix := range keepFragment {
+		if prefix = strings.TrimSpace(prefix); prefix != "" && strings.HasPrefix(url, prefix) {
+			return url
+		}
+	}
+	url, _, _ = strings.Cut(url, "#")
+	return url
+}
+
+// SetHashes cleans the URL of w and fills in its URL and paragraph hashes.
+func SetHashes(w *models.ImportedWord, keepFragment []string) {
+	w.Context = strings.TrimSpace(w.Context)
+	w.ParagraphHash, w.URLHash = "", ""
+	if w.Context != "" {
+		w.ParagraphHash = Hash(w.Context)
+	}
+	if w.URL != "" {
+		w.URL = CleanURL(w.URL, keepFragment)
+		w.URLHash = Hash(w.URL)
+	}
+}
+
+// isHeader guesses whether row names the columns: a cell matches a field
+// name, one of its aliases or a name used in mapping.
+func isHeader(row []string, mapping map[string]string) bool {
+	for _, cell := range row {
+		cell = strings.ToLower(strings.TrimSpace(cell))
+		for field, aliases := range fieldAliases {
+			if m, ok := mapping[field]; ok && strings.EqualFold(m, cell) {
+				return true
+			}
+			for _, alias := range aliases {
+				if cell == alias {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// resolveColumns finds the column of every field. header is nil if the file has none.
+func resolveColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	byName := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, dup := byName[name]; !dup {
+			byName[name] = i
+		}
+	}
+
+	columns := make(map[string]int)
+	for i, field := range Fields {
+		if m, ok := mapping[field]; ok && m != "" {
+			if n, err := strconv.Atoi(m); err == nil {
+				if n < 1 {
+					return nil, fmt.Errorf("column of %s must be 1 or more", field)
+				}
+				columns[field] = n - 1
+			} else if c, ok := byName[strings.ToLower(m)]; ok {
+				columns[field] = c
+			} else {
+				return nil, fmt.Errorf("no column named %q for %s", m, field)
+			}
+			continue
+		}
+		if header == nil {
+			if len(mapping) == 0 {
+				columns[field] = i
+			}
+			continue
+		}
+		for _, alias := range fieldAliases[field] {
+			if c, ok := byName[alias]; ok {
+				columns[field] = c
+				break
+			}
+		}
+	}
+	if _, ok := columns["word"]; !ok {
+		return nil, ErrNoWordColumn
+	}
+	return columns, nil
+}
+
+// splitForms reads a list of forms separated by "|", ";" or ",", and puts
+// word first.
+func splitForms(word, cell string) []string {
+	forms := []string{word}
+	seen := map[string]bool{strings.ToLower(word): true}
+	for _, f := range strings.FieldsFunc(cell, func(r rune) bool { return r == '|' || r == ';' || r == ',' }) {
+		f = strings.TrimSpace(f)
+		if key := strings.ToLower(f); f != "" && !seen[key] {
+			seen[key] = true
+			forms = append(forms, f)
+		}
+	}
+	return forms
+}
+
+func parseDate(s string) time.Time {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,211 @@
+package vocab
+
+import (
+	"bytes"
+	"errors"
+	"lingomarker/internal/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadCSV(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name   string
+		file   string // In testdata
+		data   string // Used when there is no file
+		opts   CSVOptions
+		words  []models.ImportedWord
+		issues []models.ImportIssue
+		err    error
+	}{
+		{
+			name: "header with aliases",
+			file: "header.csv",
+			words: []models.ImportedWord{
+				word("run", []string{"run", "runs", "ran", "running"}, "She ran home.", "https://example.com/a", "Story", day(2024, 5, 1)),
+				word("go", []string{"go"}, "", "", "", day(2024, 5, 2)),
+				word("look", []string{"look", "looks"}, "He said: \"Look,\nthere.\"", "https://example.com/b", "", time.Time{}),
+			},
+			issues: []models.ImportIssue{{Row: 3, Problem: "missing word"}},
+		},
+		{
+			name: "fragment kept",
+			data: "word,url\nrun,https://example.com/a#frag\n",
+			opts: CSVOptions{KeepFragment: []string{" https://example.com/"}},
+			words: []models.ImportedWord{
+				word("run", []string{"run"}, "", "https://example.com/a#frag", "", time.Time{}),
+			},
+		},
+		{
+			name: "TSV without header",
+			file: "plain.tsv",
+			opts: CSVOptions{Source: "Notebook"},
+			words: []models.ImportedWord{
+				word("tree", []string{"tree", "trees"}, "A tree grew.", "Notebook", "Notebook", time.Date(2024, 5, 3, 10, 0, 0, 0, time.UTC)),
+				word("leaf", []string{"leaf"}, "", "", "", time.Time{}),
+			},
+		},
+		{
+			name: "mapped by index",
+			data: "She ran home.;run\n",
+			opts: CSVOptions{Comma: ';', Header: &no, Mapping: map[string]string{"word": "2", "context": "1"}},
+			words: []models.ImportedWord{
+				word("run", []string{"run"}, "She ran home.", "", "", time.Time{}),
+			},
+		},
+		{
+			name: "mapped by name",
+			data: "Vocab,Quote\nrun,She ran home.\n",
+			opts: CSVOptions{Mapping: map[string]string{"word": "vocab", "context": "Quote"}},
+			words: []models.ImportedWord{
+				word("run", []string{"run"}, "She ran home.", "", "", time.Time{}),
+			},
+		},
+		{
+			name: "header forced",
+			data: "a,b\nrun,ran\n",
+			opts: CSVOptions{Header: &yes, Mapping: map[string]string{"word": "a", "forms": "b"}},
+			words: []models.ImportedWord{
+				word("run", []string{"run", "ran"}, "", "", "", time.Time{}),
+			},
+		},
+		{
+			name: "short rows",
+			data: "word,context,url\nrun\n",
+			words: []models.ImportedWord{
+				word("run", []string{"run"}, "", "", "", time.Time{}),
+			},
+		},
+		{name: "empty", data: ""},
+		{name: "header without word column", data: "context,url\nShe ran home.,https://example.com/\n", err: ErrNoWordColumn},
+		{name: "mapping to no column", data: "word\nrun\n", opts: CSVOptions{Mapping: map[string]string{"context": "sentence"}}, err: errAny},
+		{name: "mapping to column 0", data: "run\n", opts: CSVOptions{Mapping: map[string]string{"word": "0"}}, err: errAny},
+		{
+			// Quotes are read leniently, as spreadsheets write them.
+			name: "unterminated quote",
+			data: "word,context\nrun,\"She ran\n",
+			words: []models.ImportedWord{
+				word("run", []string{"run"}, "She ran", "", "", time.Time{}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte(tt.data)
+			if tt.file != "" {
+				var err error
+				if data, err = os.ReadFile(filepath.Join("testdata", tt.file)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			words, issues, err := ReadCSV(bytes.NewReader(data), tt.opts)
+			if tt.err != nil {
+				if err == nil || (tt.err != errAny && !errors.Is(err, tt.err)) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(words, tt.words) {
+				t.Errorf("words = %+v\nwant %+v", words, tt.words)
+			}
+			if !reflect.DeepEqual(issues, tt.issues) {
+				t.Errorf("issues = %v, want %v", issues, tt.issues)
+			}
+		})
+	}
+}
+
+func TestWriteCSVRoundTrip(t *testing.T) {
+	title := "Story"
+	created := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	bundle := &models.UserDataBundle{
+		Entries: []models.Entry{
+			{UUID: "2", Word: "Run", FormsPipeSeparated: "run|ran", CreatedAt: created},
+			{UUID: "1", Word: "apple", FormsPipeSeparated: "apple", CreatedAt: created},
+		},
+		URLs: []models.URL{
+			{URLHash: "u1", URL: "https://example.com/a", Title: &title},
+			{URLHash: "u2", URL: "https://example.com/b"},
+		},
+		Paragraphs: []models.Paragraph{
+			{ParagraphHash: "p1", Text: "She ran home, \"fast\"."},
+			{ParagraphHash: "p2", Text: "Run!"},
+		},
+		Relations: []models.Relation{
+			{EntryUUID: "2", URLHash: "u2", ParagraphHash: "p2", CreatedAt: created.Add(time.Hour)},
+			{EntryUUID: "2", URLHash: "u1", ParagraphHash: "p1", CreatedAt: created},
+		},
+	}
+	for _, comma := range []rune{',', '\t'} {
+		var buf bytes.Buffer
+		if err := WriteCSV(&buf, comma, bundle); err != nil {
+			t.Fatal(err)
+		}
+		if comma == ',' {
+			want := "word,forms,context,url,title,date\n" +
+				"apple,apple,,,,2024-05-01T08:00:00Z\n" +
+				"Run,run; ran,\"She ran home, \"\"fast\"\".\",https://example.com/a,Story,2024-05-01T08:00:00Z\n" +
+				"Run,run; ran,Run!,https://example.com/b,,2024-05-01T09:00:00Z\n"
+			if buf.String() != want {
+				t.Errorf("CSV:\n%s\nwant:\n%s", buf.String(), want)
+			}
+		}
+
+		words, issues, err := ReadCSV(&buf, CSVOptions{})
+		if err != nil || issues != nil {
+			t.Fatalf("ReadCSV = %v, %v", issues, err)
+		}
+		want := []models.ImportedWord{
+			word("apple", []string{"apple"}, "", "", "", created),
+			word("Run", []string{"Run", "ran"}, "She ran home, \"fast\".", "https://example.com/a", "Story", created),
+			word("Run", []string{"Run", "ran"}, "Run!", "https://example.com/b", "", created.Add(time.Hour)),
+		}
+		if !reflect.DeepEqual(words, want) {
+			t.Errorf("read back with %q = %+v\nwant %+v", comma, words, want)
+		}
+	}
+}
+
+func TestCleanURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		keep []string
+		want string
+	}{
+		{"https://example.com/a#b", nil, "https://example.com/a"},
+		{"https://example.com/a", nil, "https://example.com/a"},
+		{"https://example.com/a#b", []string{"", "https://example.com/"}, "https://example.com/a#b"},
+		{"https://example.org/a#b", []string{"https://example.com/"}, "https://example.org/a"},
+	}
+	for _, tt := range tests {
+		if got := CleanURL(tt.url, tt.keep); got != tt.want {
+			t.Errorf("CleanURL(%q, %q) = %q, want %q", tt.url, tt.keep, got, tt.want)
+		}
+	}
+}
+
+// errAny stands for any error in test tables.
+var errAny = errors.New("any error")
+
+// word builds the word ReadCSV returns for the given fields, hashes included.
+func word(w string, forms []string, context, url, title string, date time.Time) models.ImportedWord {
+	iw := models.ImportedWord{Word: w, Forms: forms, Context: context, URL: url, Title: title, Date: date}
+	if context != "" {
+		iw.ParagraphHash = Hash(context)
+	}
+	if url != "" {
+		iw.URLHash = Hash(url)
+	}
+	return iw
+}
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
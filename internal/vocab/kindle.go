@@ -0,0 +1,84 @@
+package vocab
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lingomarker/internal/models"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// KindleScheme is the scheme of the URLs made up for Kindle books.
+const KindleScheme = "kindle://"
+
+var ErrNotKindleDB = errors.New("not a Kindle vocabulary database")
+
+// ReadKindle reads the lookups of a Kindle Vocabulary Builder database
+// (vocab.db) at path, oldest first. Each lookup becomes a word whose context
+// is the usage sentence and whose URL is made up from the book, with the book
+// title as title and the lookup time as date. The looked-up word and its stem
+// are the forms; the stem is the word when known.
+func ReadKindle(path string) ([]models.ImportedWord, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&immutable=1")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+        SELECT w.word, COALESCE(w.stem, ''), COALESCE(l.usage, ''), COALESCE(l.timestamp, 0),
+               COALESCE(b.id, ''), COALESCE(b.asin, ''), COALESCE(b.title, '')
+        FROM LOOKUPS l
+        JOIN WORDS w ON w.id = l.word_key
+        LEFT JOIN BOOK_INFO b ON b.id = l.book_key
+        ORDER BY l.timestamp
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotKindleDB, err)
+	}
+	defer rows.Close()
+
+	var words []models.ImportedWord
+	for rows.Next() {
+		var word, stem, usage, bookID, asin, title string
+		var millis int64
+		if err := rows.Scan(&word, &stem, &usage, &millis, &bookID, &asin, &title); err != nil {
+			return nil, fmt.Errorf("failed to scan Kindle lookup: %w", err)
+		}
+		word, stem = strings.TrimSpace(word), strings.TrimSpace(stem)
+		if word == "" {
+			continue
+		}
+
+		w := models.ImportedWord{Word: word, Context: usage, URL: kindleBookURL(bookID, asin), Title: strings.TrimSpace(title)}
+		if stem != "" {
+			w.Word = stem
+		}
+		w.Forms = splitForms(w.Word, word)
+		if millis > 0 {
+			w.Date = time.UnixMilli(millis).UTC()
+		}
+		SetHashes(&w, nil)
+		words = append(words, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading Kindle lookups: %w", err)
+	}
+	return words, nil
+}
+
+// kindleBookURL identifies a book by its ASIN, or by its Kindle ID for books
+// without one, such as personal documents.
+func kindleBookURL(bookID, asin string) string {
+	switch {
+	case asin != "":
+		return KindleScheme + "book/" + url.PathEscape(asin)
+	case bookID != "":
+		return KindleScheme + "book/" + url.PathEscape(bookID)
+	}
+	return KindleScheme + "book/unknown"
+}
@@ -0,0 +1,59 @@
+package wordforms
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// CacheStore persists cached forms. Implemented by the database.
+type CacheStore interface {
+	GetCachedWordForms(language, word string, now time.Time) (string, bool, error)
+	PutCachedWordForms(language, word, forms, provider string, expiresAt time.Time) error
+}
+
+// Cache is a forms cache shared by all users, consulted before any provider.
+// Lookup failures are logged and treated as misses so a broken cache never
+// blocks marking a word.
+type Cache struct {
+	Store    CacheStore
+	Language string
+	TTL      time.Duration
+}
+
+// Get returns the cached forms of word, if any.
+func (c *Cache) Get(word string) ([]string, bool) {
+	key := Normalize(word)
+	if key == "" {
+		return nil, false
+	}
+	forms, ok, err := c.Store.GetCachedWordForms(c.Language, key, time.Now().UTC())
+	if err != nil {
+		log.Printf("wordforms cache: lookup of %q failed: %v", key, err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	return strings.Split(forms, "|"), true
+}
+
+// Put stores forms returned by provider. Only Gemini results are shared: its
+// endpoint is set by the server, while the OpenAI-compatible server is chosen
+// by each user, who could otherwise plant forms for everyone. Rule-based
+// results are cheap to recompute and worse than an LLM's. Single-form results
+// are usually the fallback for an unusable reply and are skipped too.
+func (c *Cache) Put(word, provider string, forms []string) {
+	key := Normalize(word)
+	if key == "" || provider != ProviderGemini || len(forms) < 2 {
+		return
+	}
+	if err := c.Store.PutCachedWordForms(c.Language, key, Join(forms), provider, time.Now().UTC().Add(c.TTL)); err != nil {
+		log.Printf("wordforms cache: storing %q failed: %v", key, err)
+	}
+}
+
+// Normalize is the cache key for a word: lower case with single spaces.
+func Normalize(word string) string {
+	return strings.ToLower(strings.Join(strings.Fields(word), " "))
+}
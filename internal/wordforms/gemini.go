@@ -0,0 +1,127 @@
+package wordforms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Gemini asks the Gemini generateContent REST endpoint for the forms.
+type Gemini struct {
+	Endpoint string
+	APIKey   string
+	Language string // English when empty
+	Client   *http.Client
+}
+
+// NewGemini creates a Gemini provider.
+func NewGemini(endpoint, apiKey string) *Gemini {
+	return &Gemini{
+		Endpoint: endpoint,
+		APIKey:   apiKey,
+		Client:   &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (g *Gemini) Name() string { return ProviderGemini }
+
+func (g *Gemini) Forms(ctx context.Context, word string) ([]string, error) {
+	if word == "" {
+		return nil, fmt.Errorf("word cannot be empty")
+	}
+
+	log.Printf("wordforms gemini: %s", word)
+
+	apiURL := fmt.Sprintf("%s?key=%s", g.Endpoint, g.APIKey)
+
+	requestBody := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{
+				"parts": []map[string]string{
+					{"text": prompt(g.Language, word)},
+				},
+			},
+		},
+		"generationConfig": map[string]interface{}{
+			"temperature":     0.3,
+			"maxOutputTokens": 2048,
+		},
+		"safetySettings": []map[string]string{
+			{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_NONE"},
+			{"category": "HARM_CATEGORY_HATE_SPEECH", "threshold": "BLOCK_NONE"},
+			{"category": "HARM_CATEGORY_SEXUALLY_EXPLICIT", "threshold": "BLOCK_NONE"},
+			{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "threshold": "BLOCK_NONE"},
+		},
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Gemini request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Gemini API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Gemini response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Gemini API Error: Status %d, Body: %s", resp.StatusCode, string(bodyBytes))
+		// Try to parse error message from Gemini response if possible
+		var errorResp map[string]interface{}
+		if json.Unmarshal(bodyBytes, &errorResp) == nil {
+			if errData, ok := errorResp["error"].(map[string]interface{}); ok {
+				if msg, ok := errData["message"].(string); ok {
+					return nil, fmt.Errorf("Gemini API error (%d): %s", resp.StatusCode, msg)
+				}
+			}
+		}
+		return nil, fmt.Errorf("Gemini API request failed with status code %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"content"`
+			FinishReason string `json:"finishReason"`
+		} `json:"candidates"`
+		PromptFeedback *struct {
+			BlockReason string `json:"blockReason"`
+		} `json:"promptFeedback"`
+	}
+
+	if err := json.Unmarshal(bodyBytes, &result); err != nil {
+		log.Printf("Failed to unmarshal Gemini response: %s", string(bodyBytes))
+		return nil, fmt.Errorf("failed to parse Gemini response: %w", err)
+	}
+
+	if result.PromptFeedback != nil && result.PromptFeedback.BlockReason != "" {
+		return nil, fmt.Errorf("Gemini request blocked due to safety settings: %s", result.PromptFeedback.BlockReason)
+	}
+
+	if len(result.Candidates) > 0 && len(result.Candidates[0].Content.Parts) > 0 {
+		return parseLLMForms(word, result.Candidates[0].Content.Parts[0].Text), nil
+	}
+
+	log.Printf("Gemini response for '%s' did not contain expected content structure. Body: %s", word, string(bodyBytes))
+	return []string{word}, nil // Fall back to the word itself
+}
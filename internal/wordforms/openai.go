@@ -0,0 +1,106 @@
+package wordforms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAI talks to any server implementing the OpenAI chat completions API,
+// such as Ollama, llama.cpp or vLLM.
+type OpenAI struct {
+	BaseURL  string // Up to and including the version, e.g. http://localhost:11434/v1
+	Model    string
+	APIKey   string
+	Language string // English when empty
+	Client   *http.Client
+}
+
+// NewOpenAI creates an OpenAI-compatible provider.
+func NewOpenAI(baseURL, model, apiKey string) *OpenAI {
+	return &OpenAI{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Model:   model,
+		APIKey:  apiKey,
+		Client:  &http.Client{Timeout: 60 * time.Second}, // Local models can be slow to load
+	}
+}
+
+func (o *OpenAI) Name() string { return ProviderOpenAI }
+
+func (o *OpenAI) Forms(ctx context.Context, word string) ([]string, error) {
+	if word == "" {
+		return nil, fmt.Errorf("word cannot be empty")
+	}
+
+	log.Printf("wordforms openai (%s): %s", o.Model, word)
+
+	requestBody := map[string]interface{}{
+		"model": o.Model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt(o.Language, word)},
+		},
+		"temperature": 0.3,
+		"stream":      false,
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chat request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chat request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call chat endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chat response body: %w", err)
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	jsonErr := json.Unmarshal(bodyBytes, &result)
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Chat endpoint error: Status %d, Body: %s", resp.StatusCode, string(bodyBytes))
+		if jsonErr == nil && result.Error != nil && result.Error.Message != "" {
+			return nil, fmt.Errorf("chat endpoint error (%d): %s", resp.StatusCode, result.Error.Message)
+		}
+		return nil, fmt.Errorf("chat request failed with status code %d", resp.StatusCode)
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("failed to parse chat response: %w", jsonErr)
+	}
+
+	if len(result.Choices) > 0 {
+		return parseLLMForms(word, result.Choices[0].Message.Content), nil
+	}
+	log.Printf("Chat response for '%s' had no choices. Body: %s", word, string(bodyBytes))
+	return []string{word}, nil
+}
@@ -0,0 +1,516 @@
+package wordforms
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed data/irregular_verbs.txt
+var irregularVerbsData string
+
+//go:embed data/irregular_nouns.txt
+var irregularNounsData string
+
+//go:embed data/adjectives.txt
+var adjectivesData string
+
+// Rules is an offline English inflector. It guesses the base form of the input
+// with suffix rules and the bundled tables, then generates plurals, third
+// person, -ed/-ing and (for known adjectives) comparative forms. It has no
+// dictionary, so forms that do not exist are sometimes produced; they are
+// harmless for highlighting.
+type Rules struct {
+	verbs      map[string][][]string // base -> {past forms, participles}
+	verbLemma  map[string]string     // irregular past/participle -> base
+	nouns      map[string][]string   // singular -> plurals
+	nounLemma  map[string]string     // plural -> singular
+	adjectives map[string][][]string // base -> {comparatives, superlatives}, empty when regular
+	adjLemma   map[string]string     // irregular comparative/superlative -> base
+}
+
+var (
+	rulesOnce sync.Once
+	rules     *Rules
+)
+
+// NewRules returns the rule-based provider. The tables are parsed once and shared.
+func NewRules() *Rules {
+	rulesOnce.Do(func() {
+		rules = &Rules{
+			verbs:      make(map[string][][]string),
+			verbLemma:  make(map[string]string),
+			nouns:      make(map[string][]string),
+			nounLemma:  make(map[string]string),
+			adjectives: make(map[string][][]string),
+			adjLemma:   make(map[string]string),
+		}
+		eachTableRow(irregularVerbsData, func(f []string) {
+			if len(f) != 3 {
+				return
+			}
+			rules.verbs[f[0]] = [][]string{alternatives(f[1]), alternatives(f[2])}
+		})
+		for f, base := range irregularPresent {
+			rules.verbLemma[f] = base
+		}
+		// Resolve past forms only after all bases are known, so "saw" and
+		// "lay" stay verbs in their own right.
+		for base, forms := range rules.verbs {
+			for _, group := range forms {
+				for _, f := range group {
+					if _, isBase := rules.verbs[f]; !isBase && f != base {
+						rules.verbLemma[f] = base
+					}
+				}
+			}
+		}
+		eachTableRow(irregularNounsData, func(f []string) {
+			if len(f) != 2 {
+				return
+			}
+			rules.nouns[f[0]] = alternatives(f[1])
+			for _, p := range alternatives(f[1]) {
+				if p != f[0] {
+					rules.nounLemma[p] = f[0]
+				}
+			}
+		})
+		eachTableRow(adjectivesData, func(f []string) {
+			switch len(f) {
+			case 1:
+				rules.adjectives[f[0]] = nil
+			case 3:
+				rules.adjectives[f[0]] = [][]string{alternatives(f[1]), alternatives(f[2])}
+				for _, g := range f[1:] {
+					for _, a := range alternatives(g) {
+						if _, ok := rules.adjLemma[a]; !ok {
+							rules.adjLemma[a] = f[0]
+						}
+					}
+				}
+			}
+		})
+	})
+	return rules
+}
+
+func (r *Rules) Name() string { return ProviderRules }
+
+func (r *Rules) Forms(_ context.Context, word string) ([]string, error) {
+	word = strings.ToLower(strings.TrimSpace(word))
+	if word == "" {
+		return nil, errors.New("word cannot be empty")
+	}
+	if !strings.ContainsFunc(word, unicode.IsLetter) || utf8.RuneCountInString(word) == 1 {
+		return []string{word}, nil // Only punctuation or a single letter, nothing to inflect
+	}
+	if functionWords[word] {
+		return []string{word}, nil
+	}
+	var forms []string
+	if strings.ContainsAny(word, " -") {
+		forms = r.phraseForms(word)
+	} else {
+		forms = r.wordForms(r.lemma(word))
+	}
+	return appendUnique(forms, word), nil
+}
+
+// phraseForms inflects the verb of a phrasal verb ("freak out") or the head
+// noun of anything else ("loan shark"). Hyphenated input also gets its spaced
+// spelling and vice versa for the base form.
+func (r *Rules) phraseForms(phrase string) []string {
+	tokens := strings.Fields(strings.ReplaceAll(phrase, "-", " "))
+	if len(tokens) < 2 {
+		return r.wordForms(r.lemma(strings.Join(tokens, "")))
+	}
+	hyphenated := strings.Contains(phrase, "-")
+
+	var forms []string
+	join := func(t []string) {
+		forms = appendUnique(forms, strings.Join(t, " "))
+		if hyphenated {
+			forms = appendUnique(forms, strings.Join(t, "-"))
+		}
+	}
+
+	first, last := tokens[0], tokens[len(tokens)-1]
+	if lemma := r.lemma(first); particles[tokens[1]] || r.verbs[lemma] != nil {
+		for _, f := range r.verbForms(lemma) {
+			join(append([]string{f}, tokens[1:]...))
+		}
+	} else {
+		head := r.lemma(last)
+		join(append(tokens[:len(tokens)-1:len(tokens)-1], head))
+		for _, f := range r.pluralForms(head) {
+			join(append(tokens[:len(tokens)-1:len(tokens)-1], f))
+		}
+	}
+	return forms
+}
+
+// wordForms lists every form generated for a base word, base first.
+func (r *Rules) wordForms(base string) []string {
+	forms := []string{base}
+	if _, ok := r.nouns[base]; ok {
+		return appendUnique(forms, r.nouns[base]...) // fish, sheep
+	}
+	if _, ok := r.adjectives[base]; ok {
+		return appendUnique(forms, r.comparativeForms(base)...)
+	}
+	return appendUnique(forms, r.verbForms(base)...)
+}
+
+func (r *Rules) verbForms(base string) []string {
+	if base == "be" {
+		return []string{"be", "am", "is", "are", "was", "were", "been", "being"}
+	}
+	forms := []string{base}
+	switch base {
+	case "have":
+		forms = append(forms, "has")
+	case "do", "go", "undo", "undergo", "overdo":
+		forms = append(forms, base+"es")
+	default:
+		forms = appendUnique(forms, r.pluralForms(base)...)
+	}
+	if irregular, ok := r.verbs[base]; ok {
+		for _, group := range irregular {
+			for _, f := range group {
+				forms = appendUnique(forms, f)
+			}
+		}
+	} else {
+		forms = appendUnique(forms, edForm(base))
+	}
+	return appendUnique(forms, ingForm(base))
+}
+
+func (r *Rules) pluralForms(base string) []string {
+	if plurals, ok := r.nouns[base]; ok {
+		return plurals
+	}
+	n := len(base)
+	switch {
+	case n > 1 && base[n-1] == 'y' && !isVowel(base[n-2]):
+		return []string{base[:n-1] + "ies"}
+	case n > 1 && base[n-1] == 'o' && !isVowel(base[n-2]):
+		return []string{base + "s", base + "es"} // photos, heroes
+	case strings.HasSuffix(base, "s"), strings.HasSuffix(base, "x"), strings.HasSuffix(base, "z"),
+		strings.HasSuffix(base, "ch"), strings.HasSuffix(base, "sh"):
+		return []string{base + "es"}
+	}
+	return []string{base + "s"}
+}
+
+func (r *Rules) comparativeForms(base string) []string {
+	if irregular := r.adjectives[base]; irregular != nil {
+		return append(append([]string{}, irregular[0]...), irregular[1]...)
+	}
+	n := len(base)
+	switch {
+	case n == 0:
+		return nil
+	case base[n-1] == 'e':
+		return []string{base + "r", base + "st"}
+	case n > 1 && base[n-1] == 'y' && !isVowel(base[n-2]):
+		return []string{base[:n-1] + "ier", base[:n-1] + "iest"}
+	case doublesFinal(base):
+		last := base[n-1:]
+		return []string{base + last + "er", base + last + "est"}
+	}
+	return []string{base + "er", base + "est"}
+}
+
+// lemma guesses the base form of a single word.
+func (r *Rules) lemma(w string) string {
+	if _, ok := r.verbs[w]; ok {
+		return w
+	}
+	if _, ok := r.nouns[w]; ok {
+		return w
+	}
+	if _, ok := r.adjectives[w]; ok {
+		return w
+	}
+	if keepAsIs[w] {
+		return w
+	}
+	for _, m := range []map[string]string{r.verbLemma, r.nounLemma, r.adjLemma} {
+		if base, ok := m[w]; ok {
+			return base
+		}
+	}
+	if base, ok := r.stripComparative(w); ok {
+		return base
+	}
+	for _, strip := range []func(string) (string, bool){stripIng, stripEd, stripPlural} {
+		if base, ok := strip(w); ok {
+			return base
+		}
+	}
+	return w
+}
+
+// stripComparative only accepts bases found in the adjective table; without
+// it "teacher" would become "teach".
+func (r *Rules) stripComparative(w string) (string, bool) {
+	for _, suffix := range []string{"est", "er"} {
+		if !strings.HasSuffix(w, suffix) || len(w) < len(suffix)+2 {
+			continue
+		}
+		stem := strings.TrimSuffix(w, suffix)
+		candidates := []string{stem, stem + "e"}
+		if strings.HasSuffix(stem, "i") {
+			candidates = append(candidates, stem[:len(stem)-1]+"y")
+		}
+		if n := len(stem); n > 2 && stem[n-1] == stem[n-2] {
+			candidates = append(candidates, stem[:n-1])
+		}
+		for _, c := range candidates {
+			if _, ok := r.adjectives[c]; ok {
+				return c, true
+			}
+		}
+	}
+	return "", false
+}
+
+func stripIng(w string) (string, bool) {
+	if !strings.HasSuffix(w, "ing") || len(w) < 5 {
+		return "", false
+	}
+	stem := w[:len(w)-3]
+	if !hasVowel(stem) {
+		return "", false // string, thing
+	}
+	if len(stem) == 2 && stem[1] == 'y' {
+		return stem[:1] + "ie", true // lying, dying
+	}
+	return restoreStem(stem), true
+}
+
+func stripEd(w string) (string, bool) {
+	n := len(w)
+	switch {
+	case !strings.HasSuffix(w, "ed") || n < 4:
+		return "", false
+	case strings.HasSuffix(w, "ied") && n > 4:
+		return w[:n-3] + "y", true // studied
+	case strings.HasSuffix(w, "eed"):
+		return w[:n-1], true // agreed
+	}
+	stem := w[:n-2]
+	if !hasVowel(stem) {
+		return "", false
+	}
+	return restoreStem(stem), true
+}
+
+func stripPlural(w string) (string, bool) {
+	n := len(w)
+	switch {
+	case n <= 3 || !strings.HasSuffix(w, "s"):
+		return "", false
+	case strings.HasSuffix(w, "ss"), strings.HasSuffix(w, "us"), strings.HasSuffix(w, "is"), strings.HasSuffix(w, "ics"):
+		return "", false
+	case strings.HasSuffix(w, "ies") && n > 4:
+		return w[:n-3] + "y", true
+	case strings.HasSuffix(w, "ches"), strings.HasSuffix(w, "shes"), strings.HasSuffix(w, "sses"),
+		strings.HasSuffix(w, "xes"), strings.HasSuffix(w, "zzes"):
+		return w[:n-2], true
+	case strings.HasSuffix(w, "oes") && n > 5:
+		return w[:n-2], true // heroes
+	}
+	return w[:n-1], true
+}
+
+// restoreStem undoes the spelling changes made when -ed or -ing was added:
+// stopp -> stop, mak -> make, creat -> create.
+func restoreStem(stem string) string {
+	n := len(stem)
+	if n >= 4 && stem[n-1] == stem[n-2] && !isVowel(stem[n-1]) && !strings.ContainsRune("lsfz", rune(stem[n-1])) {
+		return stem[:n-1]
+	}
+	if needsSilentE(stem) {
+		return stem + "e"
+	}
+	return stem
+}
+
+func needsSilentE(stem string) bool {
+	n := len(stem)
+	last := stem[n-1]
+	switch {
+	case n == 2 && isVowel(stem[0]) && !isVowel(last): // us(e)
+		return true
+	case strings.ContainsRune("cvu", rune(last)): // produc(e), giv(e), argu(e)
+		return true
+	case n <= 4 && !isVowel(stem[0]) && isCVC(stem): // mak(e), hop(e), smok(e)
+		return true
+	}
+	if n < 5 {
+		return false
+	}
+	for _, suffix := range []string{"at", "ut", "ang", "dg", "rg", "ns", "rs", "ls", "ur", "ir", "is",
+		"bl", "pl", "tl", "dl", "gl", "kl", "fl", "cl", "zl"} {
+		if strings.HasSuffix(stem, suffix) {
+			return true
+		}
+	}
+	// caus(e), pleas(e); compar(e), prepar(e)
+	if last == 's' && isVowel(stem[n-2]) && isVowel(stem[n-3]) {
+		return true
+	}
+	return strings.HasSuffix(stem, "ar") && !isVowel(stem[n-3])
+}
+
+func edForm(base string) string {
+	n := len(base)
+	switch {
+	case n == 0:
+		return base
+	case base[n-1] == 'e':
+		return base + "d"
+	case n > 1 && base[n-1] == 'y' && !isVowel(base[n-2]):
+		return base[:n-1] + "ied"
+	case doublesFinal(base):
+		return base + base[n-1:] + "ed"
+	}
+	return base + "ed"
+}
+
+func ingForm(base string) string {
+	n := len(base)
+	switch {
+	case n == 0:
+		return base
+	case strings.HasSuffix(base, "ie"):
+		return base[:n-2] + "ying" // lying, dying
+	case n > 2 && base[n-1] == 'e' && !strings.ContainsRune("eoy", rune(base[n-2])):
+		return base[:n-1] + "ing" // making; but seeing, hoeing
+	case doublesFinal(base):
+		return base + base[n-1:] + "ing"
+	}
+	return base + "ing"
+}
+
+// doublesFinal reports whether the final consonant is doubled before a
+// vowel suffix: single-syllable CVC words (stop, big) and a few stressed
+// two-syllable ones (admit, prefer).
+func doublesFinal(base string) bool {
+	if stressedFinal[base] {
+		return true
+	}
+	return isCVC(base) && vowelGroups(base) == 1
+}
+
+func isCVC(w string) bool {
+	n := len(w)
+	if n < 3 {
+		return false
+	}
+	c1, v, c2 := w[n-3], w[n-2], w[n-1]
+	return !isVowel(c1) && isVowel(v) && !isVowel(c2) && !strings.ContainsRune("wxy", rune(c2))
+}
+
+func vowelGroups(w string) int {
+	groups := 0
+	prev := false
+	for i := 0; i < len(w); i++ {
+		v := isVowel(w[i])
+		if v && !prev {
+			groups++
+		}
+		prev = v
+	}
+	return groups
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiou", c) >= 0
+}
+
+func hasVowel(s string) bool {
+	return strings.ContainsAny(s, "aeiouy")
+}
+
+// particles mark a phrasal verb when they follow the first word.
+var particles = map[string]bool{
+	"up": true, "down": true, "out": true, "off": true, "in": true, "on": true, "over": true,
+	"away": true, "back": true, "through": true, "around": true, "about": true, "along": true,
+	"across": true, "after": true, "into": true, "for": true, "with": true,
+}
+
+// irregularPresent maps present and participle forms the tables don't list
+// to their base; the past forms come from irregular_verbs.txt.
+var irregularPresent = map[string]string{
+	"am": "be", "is": "be", "are": "be", "being": "be",
+	"has": "have", "does": "do", "goes": "go",
+}
+
+// functionWords are pronouns, articles and auxiliaries, which don't inflect
+// like other words and would only yield junk such as "i" -> "ied".
+var functionWords = map[string]bool{
+	"i": true, "me": true, "my": true, "you": true, "your": true, "he": true, "him": true,
+	"she": true, "her": true, "it": true, "its": true, "we": true, "us": true, "our": true,
+	"they": true, "them": true, "their": true, "a": true, "an": true, "the": true,
+	"can": true, "could": true, "will": true, "would": true, "shall": true, "should": true,
+	"may": true, "might": true, "must": true,
+}
+
+// keepAsIs lists common words that merely look inflected.
+var keepAsIs = map[string]bool{
+	"bed": true, "red": true, "shed": true, "wed": true, "need": true, "seed": true, "weed": true,
+	"reed": true, "greed": true, "hundred": true, "sacred": true, "naked": true, "wicked": true,
+	"ceiling": true, "evening": true, "morning": true, "during": true, "nothing": true,
+	"something": true, "anything": true, "everything": true, "king": true, "wing": true,
+	"building": true, "meeting": true, "feeling": true, "wedding": true, "pudding": true,
+	"news": true, "always": true, "perhaps": true, "whereas": true, "chaos": true, "lens": true,
+	"yes": true, "this": true, "his": true, "hers": true, "ours": true, "yours": true, "theirs": true,
+}
+
+// stressedFinal lists common two-syllable words that double their final consonant.
+var stressedFinal = map[string]bool{
+	"admit": true, "commit": true, "submit": true, "permit": true, "omit": true, "emit": true,
+	"occur": true, "refer": true, "prefer": true, "confer": true, "transfer": true, "deter": true,
+	"control": true, "patrol": true, "regret": true, "equip": true, "compel": true, "expel": true,
+	"propel": true, "rebel": true, "excel": true, "acquit": true, "abhor": true,
+}
+
+func eachTableRow(data string, fn func(fields []string)) {
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fn(strings.Fields(line))
+	}
+}
+
+func alternatives(field string) []string {
+	return strings.Split(field, "/")
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, l := range list {
+			if l == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
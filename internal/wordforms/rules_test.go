@@ -0,0 +1,71 @@
+package wordforms
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRulesForms(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		// Regular
+		{"walk", []string{"walk", "walks", "walked", "walking"}},
+		{"walked", []string{"walk", "walks", "walked", "walking"}},
+		{"stopping", []string{"stop", "stops", "stopped", "stopping"}},
+		{"studies", []string{"study", "studies", "studied", "studying"}},
+		{"Box", []string{"box", "boxes", "boxed", "boxing"}},
+		{"happier", []string{"happy", "happier", "happiest"}},
+		{"big", []string{"big", "bigger", "biggest"}},
+		{"need", []string{"need", "needs", "needed", "needing"}},
+
+		// Irregular
+		{"went", []string{"go", "goes", "went", "gone", "going"}},
+		{"goes", []string{"go", "goes", "went", "gone", "going"}},
+		{"Running", []string{"run", "runs", "ran", "running"}},
+		{"has", []string{"have", "has", "had", "having"}},
+		{"does", []string{"do", "does", "did", "done", "doing"}},
+		{"is", []string{"be", "am", "is", "are", "was", "were", "been", "being"}},
+		{"were", []string{"be", "am", "is", "are", "was", "were", "been", "being"}},
+		{"children", []string{"child", "children"}},
+		{"axis", []string{"axis", "axes"}},
+		{"better", []string{"good", "better", "best"}},
+		{"fish", []string{"fish"}},
+		{"sheep", []string{"sheep"}},
+
+		// Phrases
+		{"gave up", []string{"give up", "gives up", "gave up", "given up", "giving up"}},
+		{"loan sharks", []string{"loan shark", "loan sharks"}},
+		{"loan-shark", []string{"loan shark", "loan-shark", "loan sharks", "loan-sharks"}},
+
+		// Function words, single letters and punctuation are left alone
+		{"I", []string{"i"}},
+		{"the", []string{"the"}},
+		{"them", []string{"them"}},
+		{"should", []string{"should"}},
+		{"x", []string{"x"}},
+		{"é", []string{"é"}},
+		{"-", []string{"-"}},
+		{"'", []string{"'"}},
+		{" -- ", []string{"--"}},
+	}
+	r := NewRules()
+	for _, tt := range tests {
+		got, err := r.Forms(context.Background(), tt.word)
+		if err != nil {
+			t.Errorf("Forms(%q) err = %v", tt.word, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Forms(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestRulesFormsEmpty(t *testing.T) {
+	if _, err := NewRules().Forms(context.Background(), "  "); err == nil {
+		t.Error("Forms of blank input succeeded, want an error")
+	}
+}
@@ -0,0 +1,133 @@
+// Package wordforms expands a marked word or phrase into the forms it can take
+// in running text (plurals, conjugations, spelling variants), so all of them can
+// be highlighted.
+package wordforms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Provider names as stored in user settings.
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+	ProviderRules  = "rules"
+)
+
+// DefaultProvider is used when a user has not chosen one.
+const DefaultProvider = ProviderGemini
+
+// ErrMissingAPIKey is returned by New when the chosen provider needs a key the user has not set.
+var ErrMissingAPIKey = errors.New("API key not configured")
+
+// ErrUnsupportedLanguage is returned by New when the chosen provider cannot
+// inflect words of the requested language.
+var ErrUnsupportedLanguage = errors.New("language not supported")
+
+// FormsProvider returns the forms of a word or phrase. The first form is the
+// dictionary (base) form; the input itself is always among the results.
+type FormsProvider interface {
+	Name() string
+	Forms(ctx context.Context, word string) ([]string, error)
+}
+
+// Options selects and configures a provider.
+type Options struct {
+	Provider string
+	Language string // Code of the words' language, e.g. "de"; English when empty
+
+	GeminiEndpoint string
+	GeminiAPIKey   string
+
+	OpenAIBaseURL string // e.g. http://localhost:11434/v1 for Ollama
+	OpenAIModel   string
+	OpenAIAPIKey  string // Optional for local servers
+}
+
+// New builds the provider named in opts.
+func New(opts Options) (FormsProvider, error) {
+	switch opts.Provider {
+	case "", ProviderGemini:
+		if opts.GeminiAPIKey == "" {
+			return nil, fmt.Errorf("gemini: %w", ErrMissingAPIKey)
+		}
+		g := NewGemini(opts.GeminiEndpoint, opts.GeminiAPIKey)
+		g.Language = opts.Language
+		return g, nil
+	case ProviderOpenAI:
+		if opts.OpenAIBaseURL == "" || opts.OpenAIModel == "" {
+			return nil, errors.New("openai: base URL and model must be configured")
+		}
+		o := NewOpenAI(opts.OpenAIBaseURL, opts.OpenAIModel, opts.OpenAIAPIKey)
+		o.Language = opts.Language
+		return o, nil
+	case ProviderRules:
+		if !IsEnglish(opts.Language) {
+			return nil, fmt.Errorf("rules: %w: %s", ErrUnsupportedLanguage, opts.Language)
+		}
+		return NewRules(), nil
+	}
+	return nil, fmt.Errorf("unknown forms provider %q", opts.Provider)
+}
+
+// ValidProvider reports whether name is a known provider.
+func ValidProvider(name string) bool {
+	switch name {
+	case ProviderGemini, ProviderOpenAI, ProviderRules:
+		return true
+	}
+	return false
+}
+
+// IsEnglish reports whether a language code, such as "en" or "en-GB", is
+// English. The empty code counts as English.
+func IsEnglish(language string) bool {
+	language = strings.ToLower(language)
+	return language == "" || language == "en" || strings.HasPrefix(language, "en-") || strings.HasPrefix(language, "en_")
+}
+
+// Join formats forms the way entries store them.
+func Join(forms []string) string {
+	return strings.Join(forms, "|")
+}
+
+// prompt is shared by the LLM-backed providers. The examples are English;
+// for other languages the model is told which language the word is in.
+func prompt(language, word string) string {
+	p := fmt.Sprintf(`List all possible forms (including verb conjugations, plural forms, etc.) of the provided word/phrase "%s", separated by the pipe symbol '|'. Do not include any additional text or explanations.
+ For example, if the input word is any of the words "glitch", "glitches", the output will be "glitch|glitches".
+ For example, if the input word is any of the words "run", "runs" , "ran", "running", the output will be "run|runs|ran|running".
+ For example, if the input word is any of the words "spare", "sparer" , "sparest", "sparely", "spares", "spared", "sparing", the output will be "spare|sparer|sparest|sparely|spares|spared|sparing".
+ For example, if the input phrase is any of the phrases "freak out", "freaks out", "freaked out", "freaking out", the output will be "freak out|freaks out|freaked out|freaking out".
+ For example, if the input phrase is any of the phrases "loan shark", "loan sharks", the output will be "loan shark|loan sharks".
+ For example, if the input phrase is any of the phrases "off the cuff", "off-the-cuff", the output will be "off the cuff|off-the-cuff".
+ `, word)
+	if !IsEnglish(language) {
+		p += fmt.Sprintf(` The word/phrase "%s" is in the language with the code "%s". List its forms in that language, not in English.
+ `, word, language)
+	}
+	return p
+}
+
+// parseLLMForms splits a pipe-separated model reply. Replies that do not
+// mention the word are treated as garbage and replaced by the word alone.
+func parseLLMForms(word, reply string) []string {
+	reply = strings.TrimSpace(reply)
+	if reply == "" || !strings.Contains(reply, word) {
+		return []string{word}
+	}
+	var forms []string
+	seen := make(map[string]bool)
+	for _, f := range strings.Split(reply, "|") {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		forms = append(forms, f)
+	}
+	return forms
+}
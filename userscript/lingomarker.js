@@ -1190,7 +1190,7 @@
 
                 alert("Importing data... This may take a moment.");
                 const result = await apiRequest('POST', '/api/import', parsedData);
-                alert(`Import Complete!\nEntries: ${result.importedEntries}\nURLs: ${result.importedUrls}\nParagraphs: ${result.importedParagraphs}\nRelations: ${result.importedRelations}`);
+                alert(`Import Complete!\nEntries: ${result.importedEntries}\nURLs: ${result.importedUrls}\nParagraphs: ${result.importedParagraphs}\nRelations: ${result.importedRelations}\nSkipped: ${result.report ? result.report.errorCount : 0}`);
                 await fetchUserDataAndHighlight(); // Refresh highlights
             } catch (error) {
                 console.error("Import failed:", error);
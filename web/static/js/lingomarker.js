@@ -565,7 +565,17 @@
         return url;
     }
 
+    // The in-app reader names the page an article was captured from on its container.
+    function getSourceElement(node) {
+        const element = node.nodeType === Node.ELEMENT_NODE ? node : node.parentElement;
+        return element ? element.closest('[data-source-url]') : null;
+    }
+
     function getUrlFromNode(node) {
+        const source = getSourceElement(node);
+        if (source) {
+            return normalizeBackendUrl(source.dataset.sourceUrl);
+        }
         let current = node;
         while (current && current !== document.body) {
             // Special handling for review page source links
@@ -627,7 +637,8 @@
 
             const urlHash = await sha256(url);
             const urlFragment = nodeUrl.includes('#') ? nodeUrl.split('#')[1] : null;
-            const titleText = (document.title || "").trim();
+            const source = getSourceElement(node);
+            const titleText = ((source && source.dataset.sourceTitle) || document.title || "").trim();
             const finalTitle = urlFragment ? `${titleText} #${urlFragment}` : titleText;
 
             return {
@@ -883,7 +894,7 @@
             }
             alert("Importing data... This may take a moment.");
             const result = await apiRequest('POST', '/api/import', parsedData);
-            alert(`Import Complete!\nEntries: ${result.importedEntries}\nURLs: ${result.importedUrls}\nParagraphs: ${result.importedParagraphs}\nRelations: ${result.importedRelations}`);
+            alert(`Import Complete!\nEntries: ${result.importedEntries}\nURLs: ${result.importedUrls}\nParagraphs: ${result.importedParagraphs}\nRelations: ${result.importedRelations}\nSkipped: ${result.report ? result.report.errorCount : 0}`);
             await fetchUserDataAndHighlight();
         } catch (error) {
             console.error("Import failed:", error);
@@ -271,8 +271,12 @@ class PodcastTableComponent extends HTMLElement {
       let statusHtml = '';
       switch (podcast.status) {
         case 'uploaded':
+        case 'queued':
         case 'transcribing':
           statusHtml = `<span>${this._escapeHtml(podcast.status)} <span class="spinner">⏳</span></span>`;
+          if (podcast.status === 'queued' && podcast.errorMessage) { // Waiting to retry a failed attempt
+            statusHtml += ` <small style="display:block; color: #777;">${this._escapeHtml(podcast.errorMessage)}</small>`;
+          }
           break;
         case 'completed':
           statusHtml = '<span style="color: green;">✓ Completed</span>';
@@ -289,12 +293,20 @@ class PodcastTableComponent extends HTMLElement {
 
       let actionsHtml = '';
       actionsHtml += `<button class="action-open" data-id="${podcast.id}" ${podcast.status !== 'completed' ? 'disabled' : ''}>Open</button> `;
+      if (podcast.status === 'completed') {
+        actionsHtml += `<button class="action-download" data-id="${podcast.id}" data-format="srt">SRT</button> `;
+        actionsHtml += `<button class="action-download" data-id="${podcast.id}" data-format="vtt">VTT</button> `;
+      }
+      // Video lessons take their transcript from subtitles only
+      if ((podcast.status === 'failed' || podcast.status === 'completed') && podcast.mediaType !== 'video') {
+        actionsHtml += `<button class="action-retranscribe" data-id="${podcast.id}">Retranscribe</button> `;
+      }
       actionsHtml += `<button class="action-delete" data-id="${podcast.id}">Delete</button>`;
 
       row.innerHTML = `
         <td data-label="Producer">${this._escapeHtml(podcast.producer)}</td>
         <td data-label="Series">${this._escapeHtml(podcast.series)}</td>
-        <td data-label="Episode">${this._escapeHtml(podcast.episode)}</td>
+        <td data-label="Episode">${podcast.mediaType === 'video' ? '🎬 ' : ''}${this._escapeHtml(podcast.episode)}</td>
         <td data-label="Uploaded">${uploadDate}</td>
         <td data-label="Status" class="status-cell">${statusHtml}</td>
         <td data-label="Actions" class="actions-cell">${actionsHtml}</td>
@@ -367,6 +379,43 @@ class PodcastTableComponent extends HTMLElement {
       }
     } else if (target.classList.contains('action-open') && !target.disabled) {
       this._openPodcast(podcastId);
+    } else if (target.classList.contains('action-download')) {
+      window.location.href = `${this._apiEndpoint}/${podcastId}/transcript?format=${target.dataset.format}`;
+    } else if (target.classList.contains('action-retranscribe') && !target.disabled) {
+      const podcast = this._allPodcasts.find(p => p.id === podcastId);
+      if (podcast?.status !== 'completed' || confirm('Replace the current transcript with a new transcription?')) {
+        this._retranscribePodcast(podcastId, target);
+      }
+    }
+  }
+
+  async _retranscribePodcast(podcastId, button) {
+    button.disabled = true;
+    button.textContent = 'Queueing...';
+    this._showMessage('');
+
+    try {
+      const response = await fetch(`${this._apiEndpoint}/${podcastId}/retranscribe`, {
+        method: 'POST'
+      });
+      const result = await response.json();
+
+      if (response.ok) {
+        this._showMessage(`✅ ${result.message || 'Transcription queued.'}`, 'success');
+        this._allPodcasts = this._allPodcasts.map(p =>
+          p.id === podcastId ? { ...p, status: 'queued', errorMessage: null } : p
+        );
+        this._render(); // Shows the spinner and starts polling
+      } else {
+        this._showMessage(`❌ Error: ${result.error || `Retranscribe failed (${response.status})`}`, 'error');
+        button.disabled = false;
+        button.textContent = 'Retranscribe';
+      }
+    } catch (error) {
+      console.error("Retranscribe podcast error:", error);
+      this._showMessage(`❌ Network Error: ${error.message}`, 'error');
+      button.disabled = false;
+      button.textContent = 'Retranscribe';
     }
   }
 
@@ -413,7 +462,7 @@ class PodcastTableComponent extends HTMLElement {
 
   // --- Status Polling Methods ---
   _startPollingIfNeeded() {
-    const requiresPolling = this._allPodcasts.some(p => p.status === 'uploaded' || p.status === 'transcribing');
+    const requiresPolling = this._allPodcasts.some(p => p.status === 'uploaded' || p.status === 'queued' || p.status === 'transcribing');
 
     if (requiresPolling && !this._pollIntervalId) {
       console.log("PodcastTableComponent: Starting status polling...");
@@ -433,7 +482,7 @@ class PodcastTableComponent extends HTMLElement {
 
   async _pollPodcastStatuses() {
     console.log("PodcastTableComponent: Polling for status updates...");
-    const podcastsCurrentlyProcessing = this._allPodcasts.filter(p => p.status === 'uploaded' || p.status === 'transcribing');
+    const podcastsCurrentlyProcessing = this._allPodcasts.filter(p => p.status === 'uploaded' || p.status === 'queued' || p.status === 'transcribing');
 
     if (podcastsCurrentlyProcessing.length === 0) {
       this._stopPolling();
@@ -466,7 +515,7 @@ class PodcastTableComponent extends HTMLElement {
       }
 
       // Check if polling still needed after updates
-      const stillProcessing = this._allPodcasts.some(p => p.status === 'uploaded' || p.status === 'transcribing');
+      const stillProcessing = this._allPodcasts.some(p => p.status === 'uploaded' || p.status === 'queued' || p.status === 'transcribing');
       if (!stillProcessing) {
         this._stopPolling();
       }